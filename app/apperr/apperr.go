@@ -0,0 +1,154 @@
+package apperr
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// Code identifies a kind of error to callers. codes are part of the api, once released one never changes meaning
+type Code string
+
+// codes, see Code.Status for the http status of each
+const (
+	CodeBadRequest           Code = "bad_request"
+	CodeValidation           Code = "validation_failed"
+	CodeUnauthorized         Code = "unauthorized"
+	CodeForbidden            Code = "forbidden"
+	CodeNotFound             Code = "not_found"
+	CodeMethodNotAllowed     Code = "method_not_allowed"
+	CodeConflict             Code = "conflict"
+	CodePayloadTooLarge      Code = "payload_too_large"
+	CodeUnsupportedMediaType Code = "unsupported_media_type"
+	CodeRateLimited          Code = "rate_limited"
+	CodeInternal             Code = "internal"
+	CodeUnavailable          Code = "unavailable"
+	CodeTimeout              Code = "timeout"
+)
+
+var statuses = map[Code]int{
+	CodeBadRequest:           http.StatusBadRequest,
+	CodeValidation:           http.StatusBadRequest,
+	CodeUnauthorized:         http.StatusUnauthorized,
+	CodeForbidden:            http.StatusForbidden,
+	CodeNotFound:             http.StatusNotFound,
+	CodeMethodNotAllowed:     http.StatusMethodNotAllowed,
+	CodeConflict:             http.StatusConflict,
+	CodePayloadTooLarge:      http.StatusRequestEntityTooLarge,
+	CodeUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	CodeRateLimited:          http.StatusTooManyRequests,
+	CodeInternal:             http.StatusInternalServerError,
+	CodeUnavailable:          http.StatusServiceUnavailable,
+	CodeTimeout:              http.StatusGatewayTimeout,
+}
+
+// Status is the http status errors with the code are sent with
+func (c Code) Status() int {
+	if status, ok := statuses[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// CodeForStatus is the code for an http status, e.g. of an error returned by echo or its middleware
+func CodeForStatus(status int) Code {
+	for code, s := range statuses {
+		// validation failures are a kind of bad request, only Validation sends them
+		if s == status && code != CodeValidation {
+			return code
+		}
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// FieldError is why one field of a request failed validation
+type FieldError struct {
+	Field   string // json path, e.g. events[1]
+	Rule    string // validation rule that failed, e.g. required
+	Message string
+}
+
+// Error is an error with a message that is safe to show callers. any other error is internal, its text is only shown
+// in dev since it can hold sql, hostnames and the like
+type Error struct {
+	Code    Code
+	Message string
+	Fields  []FieldError // validation failures
+	Err     error        // cause, logged rather than sent
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the cause
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Status is the http status the error is sent with
+func (e *Error) Status() int {
+	return e.Code.Status()
+}
+
+// New creates an error with code and a message for the caller
+func New(code Code, msg string) *Error {
+	return &Error{Code: code, Message: msg}
+}
+
+// Errorf creates an error with code and a formatted message for the caller
+func Errorf(code Code, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// BadRequest is for a request that cannot be understood, e.g. a malformed body or path param
+func BadRequest(msg string) *Error {
+	return New(CodeBadRequest, msg)
+}
+
+// Unauthorized is for a caller that did not authenticate
+func Unauthorized(msg string) *Error {
+	return New(CodeUnauthorized, msg)
+}
+
+// Forbidden is for an authenticated caller that is not allowed to do something
+func Forbidden(msg string) *Error {
+	return New(CodeForbidden, msg)
+}
+
+// NotFound is for something that does not exist, or that the caller may not know exists
+func NotFound(msg string) *Error {
+	return New(CodeNotFound, msg)
+}
+
+// Conflict is for a request the current state of something does not allow
+func Conflict(msg string) *Error {
+	return New(CodeConflict, msg)
+}
+
+// Internal wraps an unexpected error, callers are only told something went wrong
+func Internal(err error) *Error {
+	return &Error{Code: CodeInternal, Message: http.StatusText(http.StatusInternalServerError), Err: err}
+}
+
+// From returns err as an *Error, wrapping errors of any other type as internal
+func From(err error) *Error {
+	var ae *Error
+	if errors.As(err, &ae) {
+		return ae
+	}
+	return Internal(err)
+}
+
+// CodeOf is the code of err, internal for errors that are not an *Error
+func CodeOf(err error) Code {
+	return From(err).Code
+}
@@ -0,0 +1,75 @@
+package apperr
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodeForStatus(t *testing.T) {
+	for status, want := range map[int]Code{
+		http.StatusBadRequest:            CodeBadRequest,
+		http.StatusNotFound:              CodeNotFound,
+		http.StatusTooManyRequests:       CodeRateLimited,
+		http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+		http.StatusTeapot:                CodeBadRequest,
+		http.StatusBadGateway:            CodeInternal,
+	} {
+		assert.Equal(t, want, CodeForStatus(status), status)
+	}
+	for code := range statuses {
+		if code != CodeValidation {
+			assert.Equal(t, code, CodeForStatus(code.Status()), "codes round trip through their status")
+		}
+	}
+}
+
+func TestFrom(t *testing.T) {
+	notFound := NotFound("no widget for given id")
+	assert.Same(t, notFound, From(errors.Wrap(notFound, "loading widget")))
+	assert.Equal(t, CodeNotFound, CodeOf(notFound))
+
+	cause := errors.New(`pq: relation "widgets" does not exist`)
+	internal := From(cause)
+	assert.Equal(t, CodeInternal, internal.Code)
+	assert.Equal(t, http.StatusInternalServerError, internal.Status())
+	assert.Equal(t, "Internal Server Error", internal.Message, "cause is not in the message")
+	assert.ErrorIs(t, internal, cause)
+}
+
+func TestValidation(t *testing.T) {
+	type item struct {
+		Name string `json:"name" validate:"required,max=3"`
+	}
+	type request struct {
+		Email  string   `json:"email" validate:"required,email"`
+		Role   string   `json:"role" validate:"oneof=owner admin"`
+		Limit  int      `query:"limit" validate:"omitempty,min=1"`
+		Items  []item   `json:"items" validate:"dive"`
+		Events []string `json:"events,omitempty" validate:"max=1"`
+	}
+	v := validator.New()
+	v.RegisterTagNameFunc(FieldName)
+
+	err := Validation(v.Struct(request{
+		Email:  "nope",
+		Role:   "member",
+		Limit:  -1,
+		Items:  []item{{Name: "ok"}, {Name: "too long"}},
+		Events: []string{"a", "b"},
+	}))
+	assert.Equal(t, CodeValidation, err.Code)
+	assert.Equal(t, http.StatusBadRequest, err.Status())
+	assert.Equal(t, []FieldError{
+		{Field: "email", Rule: "email", Message: "must be an email address"},
+		{Field: "role", Rule: "oneof", Message: "must be one of: owner, admin"},
+		{Field: "limit", Rule: "min", Message: "must be at least 1"},
+		{Field: "items[1].name", Rule: "max", Message: "must be at most 3 characters long"},
+		{Field: "events", Rule: "max", Message: "must have at most 1 items"},
+	}, err.Fields)
+
+	assert.Equal(t, CodeInternal, Validation(errors.New("not a validation error")).Code)
+}
@@ -0,0 +1,25 @@
+package apperr
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+// ResponseStatus is the status sent for the request, or the one the error handler will send for the handler's err.
+// middleware that runs before the error handler, e.g. for metrics, sees the error rather than the response
+func ResponseStatus(c echo.Context, err error) int {
+	if err == nil || c.Response().Committed {
+		return c.Response().Status
+	}
+	var ae *Error
+	if errors.As(err, &ae) {
+		return ae.Status()
+	}
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return CodeForStatus(he.Code).Status()
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,28 @@
+package apperr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseStatus(t *testing.T) {
+	e := echo.New()
+	newCtx := func() echo.Context {
+		return e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	}
+
+	assert.Equal(t, http.StatusConflict, ResponseStatus(newCtx(), errors.Wrap(Conflict("taken"), "saving")))
+	assert.Equal(t, http.StatusNotFound, ResponseStatus(newCtx(), echo.ErrNotFound))
+	assert.Equal(t, http.StatusInternalServerError, ResponseStatus(newCtx(), echo.NewHTTPError(http.StatusBadGateway)))
+	assert.Equal(t, http.StatusInternalServerError, ResponseStatus(newCtx(), errors.New("boom")))
+
+	// once a response is sent its status is what the caller got
+	c := newCtx()
+	assert.NoError(t, c.NoContent(http.StatusAccepted))
+	assert.Equal(t, http.StatusAccepted, ResponseStatus(c, errors.New("after the response")))
+}
@@ -30,43 +30,80 @@ func rootCmd() *cli.App {
 	return root
 }
 
-func getMigrator() (*migrate.Migrate, error) {
+// forEachSchema calls fn with a migrator for the default schema, then for each tenant schema. it stops at the first
+// error so a failed migration is not followed by others
+func forEachSchema(ctx context.Context, fn func(schema string, m *migrate.Migrate) error) error {
 	cfg, err := platform.NewDBConfig()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return repo.NewMigrator(repo.GetConnectionURI(cfg))
+
+	conn, err := repo.Initialize(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := runSchema(cfg, repo.NewMigrator, fn); err != nil {
+		return err
+	}
+
+	// listed after the default schema is migrated, a tenant created meanwhile is migrated by its provisioner
+	schemas, err := repo.ListTenantSchemas(ctx, conn)
+	if err != nil {
+		return err
+	}
+	for _, schema := range schemas {
+		tenantCfg := cfg
+		tenantCfg.Schema = schema
+		if err := runSchema(tenantCfg, repo.NewTenantMigrator, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runSchema(
+	cfg platform.DBConfig,
+	newMigrator func(dsn string) (*migrate.Migrate, error),
+	fn func(schema string, m *migrate.Migrate) error,
+) error {
+	m, err := newMigrator(repo.GetConnectionURI(cfg))
+	if err != nil {
+		return errors.Wrapf(err, "problem creating migrator for schema %s", cfg.Schema)
+	}
+	defer func() { _, _ = m.Close() }()
+
+	return errors.Wrapf(fn(cfg.Schema, m), "schema %s", cfg.Schema)
 }
 
 func currentCmd() *cli.Command {
 	cmd := &cli.Command{
 		Name:  "current",
-		Usage: "list current and latest db migration version",
+		Usage: "list current and latest db migration version of the default and every tenant schema",
 		Action: func(cCtx *cli.Context) error {
 			latestVersion, err := db.LatestMigrationVersion()
 			if err != nil {
 				return err
 			}
 
-			m, err := getMigrator()
-			if err != nil {
-				return errors.Wrap(err, "problem creating migrator")
-			}
-
-			currentVersion, dirty, err := m.Version()
-			if err != nil {
-				if !errors.Is(err, migrate.ErrNilVersion) {
-					return errors.Wrap(err, "problem getting migration version")
+			return forEachSchema(cCtx.Context, func(schema string, m *migrate.Migrate) error {
+				currentVersion, dirty, err := m.Version()
+				if err != nil {
+					if !errors.Is(err, migrate.ErrNilVersion) {
+						return errors.Wrap(err, "problem getting migration version")
+					}
+					slog.WarnContext(cCtx.Context, "no database migrations have ever been applied", slog.String("schema", schema))
 				}
-				slog.WarnContext(cCtx.Context, "no database migrations have ever been applied")
-			}
 
-			slog.InfoContext(cCtx.Context, "migration information",
-				slog.Int("latest", latestVersion),
-				slog.Int("current", int(currentVersion)),
-				slog.Bool("dirty", dirty),
-			)
-			return nil
+				slog.InfoContext(cCtx.Context, "migration information",
+					slog.String("schema", schema),
+					slog.Int("latest", latestVersion),
+					slog.Int("current", int(currentVersion)),
+					slog.Bool("dirty", dirty),
+				)
+				return nil
+			})
 		},
 	}
 	return cmd
@@ -75,7 +112,7 @@ func currentCmd() *cli.Command {
 func runCmd() *cli.Command {
 	cmd := &cli.Command{
 		Name:  "run",
-		Usage: "run up/down migration to specified version. no args runs up to latest",
+		Usage: "run up/down migration of the default and every tenant schema to specified version. no args runs up to latest",
 		Flags: []cli.Flag{
 			&cli.IntFlag{
 				Name:    "n",
@@ -85,30 +122,31 @@ func runCmd() *cli.Command {
 			},
 		},
 		Action: func(cCtx *cli.Context) error {
-			m, err := getMigrator()
-			if err != nil {
-				return errors.Wrap(err, "problem creating migrator")
-			}
-
 			version := cCtx.Int("number")
-			if version < 0 {
-				slog.InfoContext(cCtx.Context, "migrating to latest version")
-				err = m.Up()
-			} else {
-				slog.InfoContext(cCtx.Context, "migrating to specific version", slog.Int("version", version))
-				err = m.Migrate(uint(version))
-			}
+			return forEachSchema(cCtx.Context, func(schema string, m *migrate.Migrate) error {
+				var err error
+				if version < 0 {
+					slog.InfoContext(cCtx.Context, "migrating to latest version", slog.String("schema", schema))
+					err = m.Up()
+				} else {
+					slog.InfoContext(cCtx.Context, "migrating to specific version",
+						slog.String("schema", schema),
+						slog.Int("version", version),
+					)
+					err = m.Migrate(uint(version))
+				}
 
-			if err != nil {
-				if errors.Is(err, migrate.ErrNoChange) {
-					slog.WarnContext(cCtx.Context, "no changes in migration")
-					return nil
+				if err != nil {
+					if errors.Is(err, migrate.ErrNoChange) {
+						slog.WarnContext(cCtx.Context, "no changes in migration", slog.String("schema", schema))
+						return nil
+					}
+					return errors.Wrap(err, "problem running migrating")
 				}
-				return errors.Wrap(err, "problem running migrating")
-			}
 
-			slog.InfoContext(cCtx.Context, "migration successful")
-			return nil
+				slog.InfoContext(cCtx.Context, "migration successful", slog.String("schema", schema))
+				return nil
+			})
 		},
 	}
 	return cmd
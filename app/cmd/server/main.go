@@ -2,28 +2,224 @@ package main
 
 import (
 	"context"
+	stderrors "errors"
+	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"github.com/drmaples/starter-app/app/controller"
+	"github.com/drmaples/starter-app/app/health"
+	"github.com/drmaples/starter-app/app/jobs"
+	"github.com/drmaples/starter-app/app/lifecycle"
+	"github.com/drmaples/starter-app/app/logging"
+	"github.com/drmaples/starter-app/app/mail"
+	"github.com/drmaples/starter-app/app/metrics"
 	"github.com/drmaples/starter-app/app/platform"
+	"github.com/drmaples/starter-app/app/ratelimit"
+	"github.com/drmaples/starter-app/app/realtime"
 	"github.com/drmaples/starter-app/app/repo"
+	"github.com/drmaples/starter-app/app/reporting"
+	"github.com/drmaples/starter-app/app/stream"
+	"github.com/drmaples/starter-app/app/tracing"
+	"github.com/drmaples/starter-app/app/webhook"
 )
 
-func main() {
-	ctx := context.Background()
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
-	slog.SetDefault(logger)
-
+func run(ctx context.Context) (err error) {
 	cfg, err := platform.NewConfig()
 	if err != nil {
-		panic(err)
+		return err
 	}
+	logOutput, logLevels, err := logging.NewOutput(os.Stdout, cfg.Log)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(logging.NewHandler(logOutput, tracing.LogAttrs)))
+
+	// components are stopped in reverse order, register each after the ones it uses
+	lc := lifecycle.New()
+	defer func() {
+		// ctx is already done, shutting down gets its own deadline
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cfg.ShutdownTimeout)
+		defer cancel()
+		slog.InfoContext(shutdownCtx, "shutting down", slog.Duration("timeout", cfg.ShutdownTimeout))
+		err = stderrors.Join(err, lc.Shutdown(shutdownCtx))
+	}()
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	// stopped last, flushes spans from everything else stopping
+	lc.Register("tracing", shutdownTracing)
+
 	dbConn, err := repo.Initialize(ctx, cfg.DB)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	lc.Register("db", func(context.Context) error { return repo.Close() })
+
+	dbRouter, err := repo.InitializeRouter(cfg.DB, dbConn)
+	if err != nil {
+		return err
+	}
+	lc.Register("db replicas", func(context.Context) error { return dbRouter.Close() })
+	lc.Go("db router", dbRouter.Run)
+
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		return err
+	}
+	switch cfg.Mail.Queue {
+	case mail.QueueJobs:
+		mailer = jobs.NewMailer(jobs.NewClient(dbConn, repo.DefaultSchema, repo.NewJobRepo()))
+	case mail.QueueMemory:
+		mailQueue := mail.NewQueuedMailer(mailer, cfg.Mail.QueueSize, cfg.Mail.QueueWorkers)
+		mailQueue.Run(ctx)
+		lc.Register("mail queue", func(context.Context) error {
+			mailQueue.Close()
+			return nil
+		})
+		mailer = mailQueue
+	default:
+		return errors.Errorf("unknown mail queue: %q", cfg.Mail.Queue)
+	}
+
+	webhookRepo := repo.NewWebhookRepo()
+	deliverer := webhook.NewDeliverer(dbConn, webhookRepo, jobs.NewClient(dbConn, repo.DefaultSchema, repo.NewJobRepo()), webhook.Options{
+		MaxAttempts:  cfg.Webhook.MaxAttempts,
+		Timeout:      cfg.Webhook.Timeout,
+		AllowPrivate: cfg.Webhook.AllowPrivate,
+	})
+
+	hub := stream.NewHub(dbConn, repo.NewEventLogRepo(), stream.HubOptions{Buffer: cfg.Stream.Buffer})
+	lc.Go("event stream hub", hub.Run)
+
+	realtimeHub := realtime.NewHub(realtime.Options{
+		AllowedOrigins: cfg.Realtime.AllowedOrigins,
+		SendBuffer:     cfg.Realtime.SendBuffer,
+		PingInterval:   cfg.Realtime.PingInterval,
+		MaxMessageSize: cfg.Realtime.MaxMessageSize,
+		MaxTopics:      cfg.Realtime.MaxTopics,
+	})
+
+	healthChecks := health.NewRegistry(health.Options{
+		Timeout:  cfg.Health.CheckTimeout,
+		CacheTTL: cfg.Health.CacheTTL,
+	})
+	healthChecks.Register(health.DBCheck(dbConn))
+	healthChecks.Register(health.MigrationCheck(dbConn, cfg.DB.Schema))
+	if cfg.Tenant.Enabled {
+		healthChecks.Register(health.TenantMigrationCheck(dbConn))
 	}
 
-	con := controller.New(dbConn, cfg, repo.NewUserRepo())
-	con.Run(ctx)
+	reporter, err := reporting.New(cfg.Reporting, cfg.Environment)
+	if err != nil {
+		return err
+	}
+	reportQueue := reporting.NewQueuedReporter(reporter, cfg.Reporting.QueueSize)
+	reportQueue.Run()
+	lc.Register("error report queue", func(context.Context) error {
+		reportQueue.Close()
+		return nil
+	})
+
+	var limiter *ratelimit.Limiter
+	if cfg.RateLimit.Enabled {
+		if limiter, err = newLimiter(cfg.RateLimit, dbConn, lc); err != nil {
+			return err
+		}
+	}
+
+	metricsHandler := metrics.Handler(metrics.NewRegistry(dbConn.SQL, repo.Collectors()...))
+	if cfg.MetricsPort != 0 {
+		lc.Register("metrics server", serveMetrics(ctx, cfg.MetricsPort, metricsHandler))
+	}
+
+	con := controller.New(cfg, controller.Deps{
+		DBRouter:     dbRouter,
+		Mailer:       mailer,
+		UserRepo:     repo.NewUserRepo(),
+		OrgRepo:      repo.NewOrgRepo(),
+		InviteRepo:   repo.NewInviteRepo(),
+		ScheduleRepo: repo.NewScheduleRepo(),
+		OutboxRepo:   repo.NewOutboxRepo(),
+		WebhookRepo:  webhookRepo,
+		AuditRepo:    repo.NewAuditRepo(),
+		Deliverer:    deliverer,
+		Hub:          hub,
+		Realtime:     realtimeHub,
+		Health:       healthChecks,
+		Metrics:      metricsHandler,
+		LogLevels:    logLevels,
+		Limiter:      limiter,
+		Reporter:     reportQueue,
+	})
+	// also closes open event streams and websockets
+	lc.Register("http server", con.Shutdown)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- con.Run(ctx)
+	}()
+	select {
+	case <-ctx.Done():
+		slog.InfoContext(ctx, "received shutdown signal")
+		return nil
+	case err := <-errc:
+		return err
+	}
+}
+
+// newLimiter sets up api rate limiting with the configured store
+func newLimiter(cfg platform.RateLimitConfig, dbConn *repo.DB, lc *lifecycle.Manager) (*ratelimit.Limiter, error) {
+	var store ratelimit.Store
+	switch cfg.Store {
+	case ratelimit.StoreMemory:
+		mem := ratelimit.NewMemoryStore()
+		lc.Go("rate limit sweeper", mem.Run)
+		store = mem
+	case ratelimit.StorePostgres:
+		store = ratelimit.NewPostgresStore(dbConn, repo.DefaultSchema, repo.NewRateLimitRepo())
+	default:
+		return nil, errors.Errorf("unknown rate limit store: %q", cfg.Store)
+	}
+	return ratelimit.NewFromConfig(store, cfg.Default, cfg.Routes)
+}
+
+// serveMetrics serves /metrics on an admin port kept off the public load balancer, returning how to stop it
+func serveMetrics(ctx context.Context, port int, handler http.Handler) lifecycle.StopFunc {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		slog.InfoContext(ctx, "starting metrics server", slog.Int("port", port))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.ErrorContext(ctx, "problem running metrics server", slog.Any("error", err))
+		}
+	}()
+	return srv.Shutdown
+}
+
+func main() {
+	// until config is loaded and says how to log
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx); err != nil {
+		slog.Error("server stopped with error", slog.String("error", fmt.Sprintf("%+v", err)))
+		stop()
+		os.Exit(1)
+	}
 }
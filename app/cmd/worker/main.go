@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/drmaples/starter-app/app/events"
+	"github.com/drmaples/starter-app/app/jobs"
+	"github.com/drmaples/starter-app/app/lifecycle"
+	"github.com/drmaples/starter-app/app/logging"
+	"github.com/drmaples/starter-app/app/mail"
+	"github.com/drmaples/starter-app/app/platform"
+	"github.com/drmaples/starter-app/app/repo"
+	"github.com/drmaples/starter-app/app/stream"
+	"github.com/drmaples/starter-app/app/tracing"
+	"github.com/drmaples/starter-app/app/webhook"
+)
+
+func run(ctx context.Context) (err error) {
+	cfg, err := platform.NewWorkerConfig()
+	if err != nil {
+		return err
+	}
+	logOutput, _, err := logging.NewOutput(os.Stdout, cfg.Log)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(logging.NewHandler(logOutput, tracing.LogAttrs)))
+
+	// components are stopped in reverse order, register each after the ones it uses
+	lc := lifecycle.New()
+	defer func() {
+		// ctx is already done, shutting down gets its own deadline
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cfg.ShutdownTimeout)
+		defer cancel()
+		slog.InfoContext(shutdownCtx, "shutting down", slog.Duration("timeout", cfg.ShutdownTimeout))
+		err = stderrors.Join(err, lc.Shutdown(shutdownCtx))
+	}()
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	// stopped last, flushes spans from everything else stopping
+	lc.Register("tracing", shutdownTracing)
+
+	dbConn, err := repo.Initialize(ctx, cfg.DB)
+	if err != nil {
+		return err
+	}
+	lc.Register("db", func(context.Context) error { return repo.Close() })
+
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		return err
+	}
+
+	jobRepo := repo.NewJobRepo()
+	webhookRepo := repo.NewWebhookRepo()
+	deliverer := webhook.NewDeliverer(dbConn, webhookRepo, jobs.NewClient(dbConn, repo.DefaultSchema, jobRepo), webhook.Options{
+		MaxAttempts:  cfg.Webhook.MaxAttempts,
+		Timeout:      cfg.Webhook.Timeout,
+		AllowPrivate: cfg.Webhook.AllowPrivate,
+	})
+
+	for _, queue := range cfg.Jobs.Queues {
+		w := jobs.NewWorker(dbConn, repo.DefaultSchema, jobRepo, jobs.WorkerOptions{
+			Queue:        queue,
+			Concurrency:  cfg.Jobs.Concurrency,
+			PollInterval: cfg.Jobs.PollInterval,
+			JobTimeout:   cfg.Jobs.JobTimeout,
+			StuckTimeout: cfg.Jobs.StuckTimeout,
+		})
+		jobs.RegisterMail(w, mailer)
+		webhook.Register(w, deliverer)
+		lc.Go(fmt.Sprintf("job worker %s", queue), w.Run)
+	}
+
+	sinks, err := events.NewSinks(cfg.Outbox.Sinks,
+		webhook.NewSink(dbConn, webhookRepo, deliverer),
+		stream.NewSink(dbConn, repo.NewEventLogRepo()),
+	)
+	if err != nil {
+		return err
+	}
+	relay := events.NewRelay(dbConn, repo.NewOutboxRepo(), sinks, events.RelayOptions{
+		BatchSize:    cfg.Outbox.BatchSize,
+		PollInterval: cfg.Outbox.PollInterval,
+		ClaimTimeout: cfg.Outbox.ClaimTimeout,
+	})
+	lc.Go("outbox relay", relay.Run)
+
+	if cfg.Jobs.SchedulerEnabled {
+		scheduler, err := newScheduler(cfg, dbConn, jobRepo)
+		if err != nil {
+			return err
+		}
+		lc.Go("scheduler", scheduler.Run)
+	}
+
+	<-ctx.Done()
+	slog.InfoContext(ctx, "received shutdown signal")
+	return nil
+}
+
+// newScheduler sets up the recurring schedules. specs here are defaults, SCHEDULES in config can override them
+func newScheduler(cfg platform.WorkerConfig, dbConn *repo.DB, jobRepo repo.IJobRepo) (*jobs.Scheduler, error) {
+	scheduler := jobs.NewScheduler(dbConn, repo.DefaultSchema, repo.NewScheduleRepo(), jobs.SchedulerOptions{})
+	err := scheduler.Add(jobs.Schedule{
+		Name: "purge_jobs",
+		Spec: "0 3 * * *",
+		Run: func(ctx context.Context) error {
+			n, err := jobRepo.DeleteSucceededJobs(ctx, dbConn, repo.DefaultSchema, time.Now().Add(-cfg.Jobs.Retention))
+			if err != nil {
+				return err
+			}
+			slog.InfoContext(ctx, "purged succeeded jobs", slog.Int64("count", n))
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	rateLimitRepo := repo.NewRateLimitRepo()
+	err = scheduler.Add(jobs.Schedule{
+		Name: "purge_rate_limits",
+		Spec: "15 * * * *",
+		Run: func(ctx context.Context) error {
+			n, err := rateLimitRepo.DeleteIdleRateLimitBuckets(ctx, dbConn, repo.DefaultSchema, time.Now().Add(-cfg.RateLimit.Retention))
+			if err != nil {
+				return err
+			}
+			slog.InfoContext(ctx, "purged idle rate limit buckets", slog.Int64("count", n))
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	outboxRepo := repo.NewOutboxRepo()
+	err = scheduler.Add(jobs.Schedule{
+		Name: "purge_outbox",
+		Spec: "30 3 * * *",
+		Run: func(ctx context.Context) error {
+			n, err := outboxRepo.DeletePublishedEvents(ctx, dbConn, repo.DefaultSchema, time.Now().Add(-cfg.Outbox.Retention))
+			if err != nil {
+				return err
+			}
+			slog.InfoContext(ctx, "purged published outbox events", slog.Int64("count", n))
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	eventLogRepo := repo.NewEventLogRepo()
+	err = scheduler.Add(jobs.Schedule{
+		Name: "purge_event_log",
+		Spec: "*/15 * * * *",
+		Run: func(ctx context.Context) error {
+			n, err := eventLogRepo.DeleteEventsBefore(ctx, dbConn, repo.DefaultSchema, time.Now().Add(-cfg.Stream.Retention))
+			if err != nil {
+				return err
+			}
+			slog.InfoContext(ctx, "purged event log", slog.Int64("count", n))
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client := jobs.NewClient(dbConn, repo.DefaultSchema, jobRepo)
+	if err := scheduler.Configure(cfg.Jobs.Schedules, client); err != nil {
+		return nil, err
+	}
+	return scheduler, nil
+}
+
+func main() {
+	// until config is loaded and says how to log
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx); err != nil {
+		slog.Error("worker stopped with error", slog.String("error", fmt.Sprintf("%+v", err)))
+		stop()
+		os.Exit(1)
+	}
+}
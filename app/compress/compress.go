@@ -0,0 +1,218 @@
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// content encodings, in order of preference
+const (
+	EncodingBrotli = "br"
+	EncodingGzip   = "gzip"
+)
+
+// brotliLevel trades some ratio for speed, responses are compressed on every request
+const brotliLevel = 4
+
+// Options for the compression middleware
+type Options struct {
+	MinLength int // bytes, smaller responses are sent as is since compressing them saves little
+	Skipper   middleware.Skipper
+}
+
+// encoder is what gzip.Writer and brotli.Writer have in common
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+var (
+	pools = map[string]*sync.Pool{
+		EncodingBrotli: {New: func() any { return brotli.NewWriterLevel(io.Discard, brotliLevel) }},
+		EncodingGzip:   {New: func() any { return gzip.NewWriter(io.Discard) }},
+	}
+	buffers = sync.Pool{New: func() any { return &bytes.Buffer{} }}
+)
+
+// Middleware compresses responses of at least opts.MinLength bytes with brotli or gzip, whichever the client
+// prefers. responses the handler already encoded are left alone
+func Middleware(opts Options) echo.MiddlewareFunc {
+	if opts.Skipper == nil {
+		opts.Skipper = middleware.DefaultSkipper
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if opts.Skipper(c) || c.Request().Method == http.MethodHead {
+				return next(c)
+			}
+			res := c.Response()
+			res.Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+			encoding := Negotiate(c.Request().Header.Get(echo.HeaderAcceptEncoding))
+			if encoding == "" {
+				return next(c)
+			}
+
+			pool := pools[encoding]
+			enc := pool.Get().(encoder)
+			buf := buffers.Get().(*bytes.Buffer)
+			buf.Reset()
+			w := &responseWriter{ResponseWriter: res.Writer, encoding: encoding, enc: enc, buf: buf, minLength: opts.MinLength}
+			res.Writer = w
+			defer func() {
+				res.Writer = w.ResponseWriter
+				w.finish()
+				enc.Reset(io.Discard)
+				pool.Put(enc)
+				buffers.Put(buf)
+			}()
+			return next(c)
+		}
+	}
+}
+
+// Negotiate picks the encoding to use for an Accept-Encoding header, empty when the client accepts neither
+func Negotiate(acceptEncoding string) string {
+	var best string
+	var bestQ float64
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != EncodingBrotli && name != EncodingGzip || q <= 0 {
+			continue
+		}
+		// brotli wins ties, it compresses better
+		if q > bestQ || q == bestQ && name == EncodingBrotli {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// responseWriter buffers the start of a response until it knows whether it reaches the minimum length. the status is
+// held back with it, Content-Encoding has to be decided before the header is sent
+type responseWriter struct {
+	http.ResponseWriter
+	encoding  string
+	enc       encoder
+	buf       *bytes.Buffer
+	minLength int
+
+	code        int
+	wroteHeader bool // held back in code
+	decided     bool // sent the header, compressing or not
+	compressing bool
+}
+
+// WriteHeader implements http.ResponseWriter
+func (w *responseWriter) WriteHeader(code int) {
+	if w.decided {
+		return
+	}
+	w.code = code
+	w.wroteHeader = true
+}
+
+// Write implements http.ResponseWriter
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.decided {
+		if w.compressing {
+			return w.enc.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	if w.Header().Get(echo.HeaderContentType) == "" {
+		w.Header().Set(echo.HeaderContentType, http.DetectContentType(b))
+	}
+	n, _ := w.buf.Write(b)
+	if w.buf.Len() >= w.minLength {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// decide sends the header and whatever is buffered, compressed or as is
+func (w *responseWriter) decide(compress bool) error {
+	w.decided = true
+	// the handler encoded the response itself
+	if w.Header().Get(echo.HeaderContentEncoding) != "" {
+		compress = false
+	}
+	w.compressing = compress
+	if compress {
+		w.Header().Set(echo.HeaderContentEncoding, w.encoding)
+		w.Header().Del(echo.HeaderContentLength)
+		w.enc.Reset(w.ResponseWriter)
+	}
+	if w.wroteHeader {
+		w.ResponseWriter.WriteHeader(w.code)
+	}
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if compress {
+		_, err = w.enc.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+// finish sends a response that stayed under the minimum length as is, or ends the compressed stream
+func (w *responseWriter) finish() {
+	if !w.decided {
+		// nothing written, e.g. a handler error still to be sent, leaves the response as the handler found it
+		if !w.wroteHeader && w.buf.Len() == 0 {
+			return
+		}
+		_ = w.decide(false)
+		return
+	}
+	if w.compressing {
+		_ = w.enc.Close()
+	}
+}
+
+// Flush implements http.Flusher. a response flushed early is compressed, there is no telling how long it gets
+func (w *responseWriter) Flush() {
+	if !w.decided {
+		_ = w.decide(true)
+	}
+	if w.compressing {
+		_ = w.enc.Flush()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack implements http.Hijacker, for websockets
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,105 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiate(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                          "",
+		"identity":                  "",
+		"gzip":                      EncodingGzip,
+		"gzip, deflate, br":         EncodingBrotli,
+		"br;q=0.5, gzip;q=0.8":      EncodingGzip,
+		"br;q=0, gzip":              EncodingGzip,
+		"GZIP;q=0.1":                EncodingGzip,
+		"gzip;q=0, br;q=0, deflate": "",
+		"br;q=x, gzip":              EncodingGzip,
+	} {
+		assert.Equal(t, want, Negotiate(header), header)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	big := strings.Repeat("a long enough response body. ", 100)
+	e := echo.New()
+	e.Use(Middleware(Options{MinLength: 1024}))
+	e.GET("/big", func(c echo.Context) error { return c.String(http.StatusCreated, big) })
+	e.GET("/small", func(c echo.Context) error { return c.String(http.StatusOK, "small") })
+	e.GET("/encoded", func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderContentEncoding, "identity")
+		return c.String(http.StatusOK, big)
+	})
+	e.GET("/error", func(_ echo.Context) error { return echo.NewHTTPError(http.StatusNotFound, "nope") })
+	e.GET("/flushed", func(c echo.Context) error {
+		c.Response().WriteHeader(http.StatusOK)
+		_, _ = c.Response().Write([]byte("first"))
+		c.Response().Flush()
+		_, _ = c.Response().Write([]byte(" second"))
+		return nil
+	})
+
+	serve := func(path string, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(echo.HeaderAcceptEncoding, acceptEncoding)
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, req)
+		return recorder
+	}
+	decode := func(recorder *httptest.ResponseRecorder) string {
+		var r io.Reader
+		switch recorder.Header().Get(echo.HeaderContentEncoding) {
+		case EncodingGzip:
+			gr, err := gzip.NewReader(recorder.Body)
+			assert.NoError(t, err)
+			r = gr
+		case EncodingBrotli:
+			r = brotli.NewReader(recorder.Body)
+		default:
+			r = recorder.Body
+		}
+		b, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		return string(b)
+	}
+
+	for _, encoding := range []string{EncodingGzip, EncodingBrotli} {
+		recorder := serve("/big", encoding)
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		assert.Equal(t, encoding, recorder.Header().Get(echo.HeaderContentEncoding))
+		assert.Equal(t, echo.HeaderAcceptEncoding, recorder.Header().Get(echo.HeaderVary))
+		assert.Less(t, recorder.Body.Len(), len(big))
+		assert.Equal(t, big, decode(recorder), encoding)
+	}
+
+	recorder := serve("/big", "")
+	assert.Empty(t, recorder.Header().Get(echo.HeaderContentEncoding), "client accepts no encoding")
+	assert.Equal(t, big, recorder.Body.String())
+
+	recorder = serve("/small", "gzip")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Header().Get(echo.HeaderContentEncoding), "under the minimum length")
+	assert.Equal(t, "small", recorder.Body.String())
+
+	recorder = serve("/encoded", "gzip")
+	assert.Equal(t, "identity", recorder.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, big, recorder.Body.String())
+
+	recorder = serve("/error", "gzip")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Empty(t, recorder.Header().Get(echo.HeaderContentEncoding))
+	assert.Contains(t, recorder.Body.String(), "nope")
+
+	recorder = serve("/flushed", "br")
+	assert.Equal(t, EncodingBrotli, recorder.Header().Get(echo.HeaderContentEncoding), "flushed before the minimum length")
+	assert.Equal(t, "first second", decode(recorder))
+}
@@ -0,0 +1,24 @@
+package controller
+
+import (
+	"math/rand"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	slogecho "github.com/samber/slog-echo"
+)
+
+// sampleAccessLog logs rate of successful requests, e.g. 0.1 logs 1 in 10. failed requests are always logged
+func sampleAccessLog(rate float64) slogecho.Filter {
+	return func(c echo.Context) bool {
+		if rate >= 1 {
+			return true
+		}
+		res := c.Response()
+		// not committed means the handler returned an error still to be sent
+		if !res.Committed || res.Status >= http.StatusBadRequest {
+			return true
+		}
+		return rand.Float64() < rate //nolint:gosec // sampling, not security sensitive
+	}
+}
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/samber/lo"
+
+	"github.com/drmaples/starter-app/app/apperr"
+	"github.com/drmaples/starter-app/app/dto"
+	"github.com/drmaples/starter-app/app/logging"
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+var errAdminOnly = apperr.Forbidden("only admins may do this")
+
+// adminMiddleware only lets through callers listed in ADMIN_EMAILS. admin routes act on the whole process and every
+// tenant, so no org role is enough
+func (con *Controller) adminMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		email, err := con.extractUser(c)
+		if err != nil {
+			return con.sendError(c, unauthenticated(err))
+		}
+		if !con.isAdmin(email) {
+			return con.sendError(c, errAdminOnly)
+		}
+		return next(c)
+	}
+}
+
+// isAdmin reports whether email is listed in ADMIN_EMAILS
+func (con *Controller) isAdmin(email string) bool {
+	return lo.ContainsBy(con.cfg.AdminEmails, func(admin string) bool { return strings.EqualFold(admin, email) })
+}
+
+// @Summary		db connection pool stats
+// @Description	db connection pool stats for monitoring
+// @Tags		admin
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Success		200	{object}	dto.DBStats
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Router		/v1/admin/db/stats [get]
+func (con *Controller) handleDBStats(c echo.Context) error {
+	var res dto.DBStats
+	return c.JSON(http.StatusOK, res.FromModel(repo.GetPoolStats(con.db)))
+}
+
+const defaultScheduleRunsLimit = 50
+
+// @Summary		schedule run history
+// @Description	most recent runs of recurring schedules, newest first
+// @Tags		admin
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		name query string false "only runs of this schedule"
+// @Param 		limit query int false "max runs returned, default 50, max 500"
+// @Success		200	{object}	[]dto.ScheduleRun
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/admin/schedules/runs [get]
+func (con *Controller) handleListScheduleRuns(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var q dto.ListScheduleRuns
+	if err := c.Bind(&q); err != nil {
+		return con.sendError(c, err)
+	}
+	if err := c.Validate(q); err != nil {
+		return con.sendError(c, apperr.Validation(err))
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultScheduleRunsLimit
+	}
+
+	// schedules run against the default schema only, not per tenant
+	runs, err := con.scheduleRepo.ListScheduleRuns(ctx, con.readDB(ctx), repo.DefaultSchema, q.Name, q.Limit)
+	if err != nil {
+		return con.sendError(c, err)
+	}
+
+	var res dto.ScheduleRun
+	return c.JSON(http.StatusOK, res.FromModels(runs))
+}
+
+// @Summary		log levels
+// @Description	minimum level logged, overall and per package
+// @Tags		admin
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Success		200	{object}	dto.LogLevels
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Router		/v1/admin/log-level [get]
+func (con *Controller) handleGetLogLevel(c echo.Context) error {
+	var res dto.LogLevels
+	return c.JSON(http.StatusOK, res.FromLevels(con.logLevels.Get()))
+}
+
+// @Summary		change log levels
+// @Description	change the minimum level logged while running, e.g. to debug an issue. packages not given go back to the overall level. this instance only, restarting resets to LOG_LEVEL and LOG_LEVELS
+// @Tags		admin
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param		levels	body		dto.LogLevels	true	"new levels"
+// @Success		200	{object}	dto.LogLevels
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Router		/v1/admin/log-level [put]
+func (con *Controller) handleSetLogLevel(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var req dto.LogLevels
+	if err := c.Bind(&req); err != nil {
+		return con.sendError(c, err)
+	}
+	if err := c.Validate(req); err != nil {
+		return con.sendError(c, apperr.Validation(err))
+	}
+	base, packages, err := logging.ParseLevelNames(req.Level, req.Packages)
+	if err != nil {
+		return con.sendError(c, apperr.BadRequest(err.Error()))
+	}
+
+	con.logLevels.Set(base, packages)
+	slog.InfoContext(ctx, "changed log levels", slog.String("level", base.String()), slog.Any("packages", req.Packages))
+
+	var res dto.LogLevels
+	return c.JSON(http.StatusOK, res.FromLevels(con.logLevels.Get()))
+}
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drmaples/starter-app/app/dto"
+	"github.com/drmaples/starter-app/app/logging"
+	"github.com/drmaples/starter-app/app/platform"
+)
+
+func (s *controllerTestSuite) Test_handleSetLogLevel() {
+	e := echo.New()
+	e.Validator = newValidator()
+	levels := logging.NewLevels(slog.LevelInfo, nil)
+	con := &Controller{e: e, logLevels: levels}
+
+	put := func(body string) (int, string) {
+		req := httptest.NewRequest(http.MethodPut, "/v1/admin/log-level", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		recorder := httptest.NewRecorder()
+		c := e.NewContext(req, recorder)
+		c.Set(authContextKey, s.Token) // fake authentication
+		assert.NoError(s.T(), con.handleSetLogLevel(c))
+		return recorder.Code, recorder.Body.String()
+	}
+
+	code, body := put(`{"level":"debug","packages":{"jobs":"warn"}}`)
+	assert.Equal(s.T(), http.StatusOK, code)
+	var actual dto.LogLevels
+	assert.NoError(s.T(), json.Unmarshal([]byte(body), &actual))
+	assert.Equal(s.T(), dto.LogLevels{Level: "DEBUG", Packages: map[string]string{"jobs": "WARN"}}, actual)
+	base, packages := levels.Get()
+	assert.Equal(s.T(), slog.LevelDebug, base)
+	assert.Equal(s.T(), map[string]slog.Level{"jobs": slog.LevelWarn}, packages)
+
+	code, _ = put(`{"level":"loud"}`)
+	assert.Equal(s.T(), http.StatusBadRequest, code)
+	code, _ = put(`{"packages":{"jobs":"warn"}}`)
+	assert.Equal(s.T(), http.StatusBadRequest, code)
+	base, _ = levels.Get()
+	assert.Equal(s.T(), slog.LevelDebug, base, "unchanged by invalid requests")
+
+	code, _ = put(`{"level":"info"}`)
+	assert.Equal(s.T(), http.StatusOK, code)
+	base, packages = levels.Get()
+	assert.Equal(s.T(), slog.LevelInfo, base)
+	assert.Empty(s.T(), packages, "packages not given go back to the overall level")
+}
+
+func (s *controllerTestSuite) Test_adminMiddleware() {
+	serve := func(admins []string, token any) int {
+		e := echo.New()
+		con := &Controller{e: e, cfg: platform.Config{AdminEmails: admins}}
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/v1/admin/db/stats", nil), httptest.NewRecorder())
+		if token != nil {
+			c.Set(authContextKey, token) // fake authentication
+		}
+		assert.NoError(s.T(), con.adminMiddleware(func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		})(c))
+		return c.Response().Status
+	}
+
+	assert.Equal(s.T(), http.StatusOK, serve([]string{"other@example.com", "Logged-In@example.com"}, s.Token))
+	assert.Equal(s.T(), http.StatusForbidden, serve([]string{"other@example.com"}, s.Token))
+	assert.Equal(s.T(), http.StatusForbidden, serve(nil, s.Token), "no admins configured locks everyone out")
+	assert.Equal(s.T(), http.StatusUnauthorized, serve([]string{"logged-in@example.com"}, nil))
+}
@@ -0,0 +1,198 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/apperr"
+	"github.com/drmaples/starter-app/app/dto"
+	"github.com/drmaples/starter-app/app/logging"
+	"github.com/drmaples/starter-app/app/metrics"
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+const (
+	auditRecordedKey    = "audit_recorded"
+	defaultAuditLimit   = 50
+	auditResourcePrefix = "/v1/"
+)
+
+// auditedMethods maps every method that writes to its default audit action
+var auditedMethods = map[string]string{
+	http.MethodPost:   repo.AuditActionCreate,
+	http.MethodPut:    repo.AuditActionUpdate,
+	http.MethodPatch:  repo.AuditActionUpdate,
+	http.MethodDelete: repo.AuditActionDelete,
+}
+
+// auditDetail is what a handler knows about its write that cannot be worked out from the request. zero fields fall
+// back to defaults from the request
+type auditDetail struct {
+	Action     string // defaults from the request method
+	Resource   string // defaults to the first path segment after /v1/
+	ResourceID any    // defaults to the id path param
+	Before     any    // the resource before the change, as returned by the api. nil for creates
+	After      any    // the resource after the change, as returned by the api. nil for deletes
+}
+
+// auditTx writes the audit entry for a handler's write in the write's own transaction, so the two commit or roll
+// back together. status is what the handler responds with once the transaction commits
+func (con *Controller) auditTx(c echo.Context, tx repo.Querier, status int, d auditDetail) error {
+	e := con.auditEntry(c, status, d)
+	if _, err := con.auditRepo.CreateAuditEntry(c.Request().Context(), tx, con.schema(c), e); err != nil {
+		return err
+	}
+	c.Set(auditRecordedKey, true)
+	return nil
+}
+
+// auditMiddleware records every write in the audit log that its handler did not record with auditTx, e.g. failed
+// writes, once the handler is done. it must run after jwt auth and tenant resolution
+func (con *Controller) auditMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if _, ok := auditedMethods[c.Request().Method]; !ok {
+			return next(c)
+		}
+		err := next(c)
+		// a handler can fail after its transaction committed the entry, e.g. sending an invite, record that too
+		recorded, _ := c.Get(auditRecordedKey).(bool)
+		if status := apperr.ResponseStatus(c, err); !recorded || status >= http.StatusBadRequest {
+			con.recordAudit(c, status)
+		}
+		return err
+	}
+}
+
+// recordAudit writes the audit entry for a request the handler did not record itself, on its own connection.
+// failing to audit does not fail the request, so failures are counted for alerting as well as logged
+func (con *Controller) recordAudit(c echo.Context, status int) {
+	// record even when the client has gone away
+	ctx := context.WithoutCancel(c.Request().Context())
+	e := con.auditEntry(c, status, auditDetail{})
+	if _, err := con.auditRepo.CreateAuditEntry(ctx, con.db, con.schema(c), e); err != nil {
+		metrics.ObserveAuditWriteFailure()
+		slog.ErrorContext(ctx, "problem recording audit entry",
+			slog.String("actor", e.Actor),
+			slog.String("action", e.Action),
+			slog.String("route", e.Route),
+			slog.Any("error", err),
+		)
+	}
+}
+
+// auditEntry builds the audit entry for a request, filling in what d leaves zero from the request
+func (con *Controller) auditEntry(c echo.Context, status int, d auditDetail) repo.AuditEntry {
+	ctx := c.Request().Context()
+	req := c.Request()
+
+	actor, err := con.extractUser(c)
+	if err != nil {
+		slog.WarnContext(ctx, "problem finding actor for audit entry", slog.Any("error", err))
+	}
+	e := repo.AuditEntry{
+		Actor:    actor,
+		Action:   auditedMethods[req.Method],
+		Method:   req.Method,
+		Route:    c.Path(),
+		Resource: routeResource(c.Path()),
+		Status:   status,
+	}
+	if d.Action != "" {
+		e.Action = d.Action
+	}
+	if d.Resource != "" {
+		e.Resource = d.Resource
+	}
+	if d.ResourceID != nil {
+		e.ResourceID = optionalString(fmt.Sprint(d.ResourceID))
+	} else {
+		e.ResourceID = optionalString(c.Param("id"))
+	}
+	if e.Before, err = auditJSON(d.Before); err != nil {
+		slog.ErrorContext(ctx, "problem encoding audit before", slog.Any("error", err))
+	}
+	if e.After, err = auditJSON(d.After); err != nil {
+		slog.ErrorContext(ctx, "problem encoding audit after", slog.Any("error", err))
+	}
+	e.IP = optionalString(c.RealIP())
+	e.RequestID = optionalString(logging.RequestID(ctx))
+	return e
+}
+
+// routeResource is "org" for route "/v1/org/:id/members"
+func routeResource(route string) string {
+	resource, _, _ := strings.Cut(strings.TrimPrefix(route, auditResourcePrefix), "/")
+	return resource
+}
+
+func auditJSON(v any) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem encoding audit value")
+	}
+	return b, nil
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// @Summary		audit log
+// @Description	mutating api calls in the caller's tenant, newest first, admins only. pass next_before from a page as the before param to get the next one
+// @Tags		audit
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		actor query string false "only calls made by this user email"
+// @Param 		action query string false "only this action, e.g. create, update, delete"
+// @Param 		resource query string false "only this resource type, e.g. user, organization, webhook"
+// @Param 		resource_id query string false "only this resource id, use with resource"
+// @Param 		since query string false "only calls at or after this RFC3339 time"
+// @Param 		until query string false "only calls before this RFC3339 time"
+// @Param 		before query int false "only entries older than this id"
+// @Param 		limit query int false "max entries returned, default 50, max 500"
+// @Success		200	{object}	dto.AuditLog
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/audit [get]
+func (con *Controller) handleListAudit(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var q dto.ListAuditEntries
+	if err := c.Bind(&q); err != nil {
+		return con.sendError(c, err)
+	}
+	if err := c.Validate(q); err != nil {
+		return con.sendError(c, apperr.Validation(err))
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultAuditLimit
+	}
+
+	entries, err := con.auditRepo.ListAuditEntries(ctx, con.readDB(ctx), con.schema(c), q.Filter())
+	if err != nil {
+		return con.sendError(c, err)
+	}
+
+	var e dto.AuditEntry
+	res := dto.AuditLog{Entries: e.FromModels(entries)}
+	if len(entries) == q.Limit {
+		res.NextBefore = &entries[len(entries)-1].ID
+	}
+	return c.JSON(http.StatusOK, res)
+}
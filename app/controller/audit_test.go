@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drmaples/starter-app/app/dto"
+	"github.com/drmaples/starter-app/app/logging"
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+type fakeAuditRepo struct {
+	entries []repo.AuditEntry
+}
+
+func (r *fakeAuditRepo) CreateAuditEntry(_ context.Context, _ repo.Querier, _ string, e repo.AuditEntry) (*repo.AuditEntry, error) {
+	e.ID = int64(len(r.entries) + 1)
+	r.entries = append(r.entries, e)
+	return &e, nil
+}
+
+func (r *fakeAuditRepo) ListAuditEntries(_ context.Context, _ repo.Querier, _ string, f repo.AuditFilter) ([]repo.AuditEntry, error) {
+	var res []repo.AuditEntry
+	for i := len(r.entries) - 1; i >= 0 && len(res) < f.Limit; i-- {
+		if f.BeforeID == 0 || r.entries[i].ID < f.BeforeID {
+			res = append(res, r.entries[i])
+		}
+	}
+	return res, nil
+}
+
+func (s *controllerTestSuite) Test_auditMiddleware() {
+	e := echo.New()
+	newCtx := func(method string, path string, id string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(method, "/", nil)
+		req = req.WithContext(logging.WithRequestID(req.Context(), "req-1")) // as set by requestIDMiddleware
+		req.Header.Set(echo.HeaderXRealIP, "10.0.0.1")
+		recorder := httptest.NewRecorder()
+		c := e.NewContext(req, recorder)
+		c.Set(authContextKey, s.Token) // fake authentication
+		c.SetPath(path)
+		if id != "" {
+			c.SetParamNames("id")
+			c.SetParamValues(id)
+		}
+		return c, recorder
+	}
+
+	s.Run("handler_detail", func() {
+		audits := &fakeAuditRepo{}
+		con := &Controller{auditRepo: audits}
+		c, _ := newCtx(http.MethodPut, "/v1/user/:id", "5")
+		h := con.auditMiddleware(func(c echo.Context) error {
+			d := auditDetail{Resource: "user", Before: dto.User{ID: 5, FirstName: "a"}, After: dto.User{ID: 5, FirstName: "b"}}
+			if err := con.auditTx(c, nil, http.StatusOK, d); err != nil {
+				return err
+			}
+			return c.NoContent(http.StatusOK)
+		})
+		assert.NoError(s.T(), h(c))
+
+		assert.Len(s.T(), audits.entries, 1)
+		a := audits.entries[0]
+		assert.Equal(s.T(), "logged-in@example.com", a.Actor)
+		assert.Equal(s.T(), repo.AuditActionUpdate, a.Action)
+		assert.Equal(s.T(), http.MethodPut, a.Method)
+		assert.Equal(s.T(), "/v1/user/:id", a.Route)
+		assert.Equal(s.T(), "user", a.Resource)
+		assert.Equal(s.T(), "5", *a.ResourceID)
+		assert.Equal(s.T(), http.StatusOK, a.Status)
+		assert.Equal(s.T(), "10.0.0.1", *a.IP)
+		assert.Equal(s.T(), "req-1", *a.RequestID)
+		assert.JSONEq(s.T(), `{"id":5,"email":"","first_name":"a","last_name":""}`, string(a.Before))
+		assert.JSONEq(s.T(), `{"id":5,"email":"","first_name":"b","last_name":""}`, string(a.After))
+	})
+
+	s.Run("defaults_and_failed_write", func() {
+		audits := &fakeAuditRepo{}
+		con := &Controller{auditRepo: audits}
+		c, _ := newCtx(http.MethodDelete, "/v1/webhooks/:id", "9")
+		h := con.auditMiddleware(func(_ echo.Context) error {
+			return echo.NewHTTPError(http.StatusForbidden)
+		})
+		assert.Error(s.T(), h(c))
+
+		assert.Len(s.T(), audits.entries, 1)
+		a := audits.entries[0]
+		assert.Equal(s.T(), repo.AuditActionDelete, a.Action)
+		assert.Equal(s.T(), "webhooks", a.Resource)
+		assert.Equal(s.T(), "9", *a.ResourceID)
+		assert.Equal(s.T(), http.StatusForbidden, a.Status)
+		assert.Nil(s.T(), a.Before)
+		assert.Nil(s.T(), a.After)
+	})
+
+	s.Run("failed_after_commit", func() {
+		audits := &fakeAuditRepo{}
+		con := &Controller{auditRepo: audits}
+		c, _ := newCtx(http.MethodPost, "/v1/org/:id/invites", "3")
+		h := con.auditMiddleware(func(c echo.Context) error {
+			if err := con.auditTx(c, nil, http.StatusOK, auditDetail{Resource: "invitation", ResourceID: 7}); err != nil {
+				return err
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		})
+		assert.Error(s.T(), h(c))
+
+		// the committed write and the request's failure are both kept
+		assert.Len(s.T(), audits.entries, 2)
+		assert.Equal(s.T(), http.StatusOK, audits.entries[0].Status)
+		assert.Equal(s.T(), "7", *audits.entries[0].ResourceID)
+		assert.Equal(s.T(), http.StatusInternalServerError, audits.entries[1].Status)
+		assert.Equal(s.T(), "3", *audits.entries[1].ResourceID)
+	})
+
+	s.Run("reads_not_audited", func() {
+		audits := &fakeAuditRepo{}
+		con := &Controller{auditRepo: audits}
+		c, _ := newCtx(http.MethodGet, "/v1/user/:id", "5")
+		h := con.auditMiddleware(func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+		assert.NoError(s.T(), h(c))
+		assert.Empty(s.T(), audits.entries)
+	})
+}
+
+func (s *controllerTestSuite) Test_handleListAudit() {
+	e := echo.New()
+	e.Validator = newValidator() // must register validator
+	audits := &fakeAuditRepo{}
+	for range 3 {
+		_, err := audits.CreateAuditEntry(context.Background(), nil, repo.DefaultSchema, repo.AuditEntry{
+			Action: repo.AuditActionUpdate,
+			Before: json.RawMessage(`{"id":1,"name":"old","url":"x"}`),
+			After:  json.RawMessage(`{"id":1,"name":"new","active":true}`),
+		})
+		assert.NoError(s.T(), err)
+	}
+	con := &Controller{e: e, auditRepo: audits}
+
+	list := func(query string) (int, dto.AuditLog) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/audit?"+query, nil)
+		recorder := httptest.NewRecorder()
+		c := e.NewContext(req, recorder)
+		c.Set(authContextKey, s.Token) // fake authentication
+		assert.NoError(s.T(), con.handleListAudit(c))
+
+		var res dto.AuditLog
+		if recorder.Code == http.StatusOK {
+			assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &res))
+		}
+		return recorder.Code, res
+	}
+
+	code, page := list("limit=2")
+	assert.Equal(s.T(), http.StatusOK, code)
+	assert.Equal(s.T(), []int64{3, 2}, []int64{page.Entries[0].ID, page.Entries[1].ID})
+	assert.Equal(s.T(), int64(2), *page.NextBefore)
+	assert.Equal(s.T(), map[string]dto.AuditChange{
+		"name":   {From: json.RawMessage(`"old"`), To: json.RawMessage(`"new"`)},
+		"url":    {From: json.RawMessage(`"x"`)},
+		"active": {To: json.RawMessage(`true`)},
+	}, page.Entries[0].Changes)
+
+	code, page = list("limit=2&before=2")
+	assert.Equal(s.T(), http.StatusOK, code)
+	assert.Len(s.T(), page.Entries, 1)
+	assert.Nil(s.T(), page.NextBefore)
+
+	code, _ = list("limit=1000")
+	assert.Equal(s.T(), http.StatusBadRequest, code)
+	code, _ = list("since=yesterday")
+	assert.Equal(s.T(), http.StatusBadRequest, code)
+}
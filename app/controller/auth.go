@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -13,7 +14,10 @@ import (
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 
-	"github.com/drmaples/starter-app/app/dto"
+	"github.com/drmaples/starter-app/app/apperr"
+	"github.com/drmaples/starter-app/app/metrics"
+	"github.com/drmaples/starter-app/app/repo"
+	"github.com/drmaples/starter-app/app/tracing"
 )
 
 const (
@@ -42,29 +46,59 @@ func (con *Controller) getOauthConfig() *oauth2.Config {
 	}
 }
 
+// exchangeOauthCode trades the callback's code for google's token. traced since it is the slow part of logging in
+func (con *Controller) exchangeOauthCode(ctx context.Context, code string) (*oauth2.Token, error) {
+	ctx, span := tracing.Start(ctx, "oauth.Exchange")
+	defer span.End()
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: tracing.Transport(http.DefaultTransport)})
+	token, err := con.getOauthConfig().Exchange(ctx, code)
+	if err != nil {
+		tracing.Fail(span, err)
+		return nil, errors.Wrap(err, "problem exchanging oauth code for token")
+	}
+	return token, nil
+}
+
 type jwtCustomClaims struct {
 	Name   string `json:"name"`
 	Domain string `json:"domain"`
 	jwt.RegisteredClaims
 }
 
-func (con *Controller) extractUser(c echo.Context) (string, error) {
+func (con *Controller) extractClaims(c echo.Context) (*jwtCustomClaims, error) {
 	rawToken := c.Get(authContextKey)
 	if rawToken == nil {
-		return "", errors.New("jwt missing")
+		return nil, errors.New("jwt missing")
 	}
 	token, ok := rawToken.(*jwt.Token)
 	if !ok {
-		return "", errors.New("jwt is incorrect type")
+		return nil, errors.New("jwt is incorrect type")
 	}
 	claims, ok := token.Claims.(*jwtCustomClaims)
 	if !ok {
-		return "", errors.New("jwt claims are incorrect type")
+		return nil, errors.New("jwt claims are incorrect type")
+	}
+	return claims, nil
+}
+
+func (con *Controller) extractUser(c echo.Context) (string, error) {
+	claims, err := con.extractClaims(c)
+	if err != nil {
+		return "", err
 	}
 	return claims.GetSubject()
 }
 
+// unauthenticated is the error for a request whose jwt claims cannot be read. the reason is kept as the cause, it
+// describes claim parsing rather than anything the caller can act on
+func unauthenticated(err error) *apperr.Error {
+	return &apperr.Error{Code: apperr.CodeUnauthorized, Message: "invalid or expired jwt", Err: err}
+}
+
 func (con *Controller) handleLogin(c echo.Context) error {
+	rememberInvite(c)
+
 	// https://developers.google.com/identity/openid-connect/openid-connect#access-type-param
 	redirectURL := con.getOauthConfig().AuthCodeURL(
 		stateToken,
@@ -76,21 +110,22 @@ func (con *Controller) handleLogin(c echo.Context) error {
 func (con *Controller) handleOauthCallback(c echo.Context) error {
 	ctx := c.Request().Context()
 	code := c.QueryParam("code")
+	defer func() { metrics.ObserveLogin(c.Response().Status == http.StatusOK) }()
+
 	if c.QueryParam("state") != stateToken { // FIXME: validate this with a nonce
-		return c.JSON(http.StatusUnauthorized, dto.NewErrorResp("state token does not match"))
+		return con.sendError(c, apperr.Unauthorized("state token does not match"))
 	}
 
-	googleToken, err := con.getOauthConfig().Exchange(ctx, code)
+	googleToken, err := con.exchangeOauthCode(ctx, code)
 	if err != nil {
-		err := errors.Wrap(err, "problem exchanging oauth code for token")
-		return c.JSON(http.StatusInternalServerError, dto.NewErrorResp(err.Error()))
+		return con.sendError(c, err)
 	}
 
 	rawToken := googleToken.Extra("id_token").(string)
 	googleClaims := jwt.MapClaims{}
 	// FIXME: should verify this against google JWK
 	if _, _, err := jwt.NewParser().ParseUnverified(rawToken, googleClaims); err != nil {
-		return c.JSON(http.StatusInternalServerError, dto.NewErrorResp(err.Error()))
+		return con.sendError(c, err)
 	}
 
 	email := googleClaims["email"].(string)
@@ -102,7 +137,34 @@ func (con *Controller) handleOauthCallback(c echo.Context) error {
 		15*time.Minute,
 	)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, dto.NewErrorResp(err.Error()))
+		return con.sendError(c, err)
+	}
+
+	if token := takeInvite(c); token != "" {
+		schema, err := con.hostSchema(c)
+		if err != nil {
+			if errors.Is(err, repo.ErrUnknownTenant) {
+				return con.sendError(c, apperr.NotFound("unknown tenant"))
+			}
+			return con.sendError(c, apperr.BadRequest(err.Error()))
+		}
+		givenName, _ := googleClaims["given_name"].(string)
+		familyName, _ := googleClaims["family_name"].(string)
+
+		inv, err := con.acceptInvite(ctx, schema, token, repo.User{
+			Email:     email,
+			FirstName: givenName,
+			LastName:  familyName,
+		})
+		if err != nil {
+			return con.sendError(c, err) // errInviteInvalid and errInviteEmailMismatch carry their own status
+		}
+		slog.InfoContext(ctx, "accepted invitation",
+			slog.Group("invitation",
+				slog.Int("id", inv.ID),
+				slog.Int("organization_id", inv.OrganizationID),
+			),
+		)
 	}
 
 	slog.InfoContext(ctx, "successful login", slog.String("email", email))
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/drmaples/starter-app/app/dto"
+	"github.com/drmaples/starter-app/app/health"
+)
+
+const healthStatusShuttingDown = "shutting down"
+
+// @Summary		liveness
+// @Description	whether the server is alive, failing gets it restarted. only runs checks a restart would fix, authenticated callers also get each check's result
+// @Tags		health
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Success		200	{object}	dto.Health
+// @Failure		503	{object}	dto.Health
+// @Router		/healthz [get]
+func (con *Controller) handleLive(c echo.Context) error {
+	return con.healthResponse(c, con.health.Live(c.Request().Context()))
+}
+
+// @Summary		readiness
+// @Description	whether the server should get traffic: its dependencies are healthy and it is not shutting down. authenticated callers also get each check's result
+// @Tags		health
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Success		200	{object}	dto.Health
+// @Failure		503	{object}	dto.Health
+// @Router		/readyz [get]
+func (con *Controller) handleReady(c echo.Context) error {
+	if !con.ready.Load() {
+		return c.JSON(http.StatusServiceUnavailable, dto.Health{Status: healthStatusShuttingDown})
+	}
+	return con.healthResponse(c, con.health.Ready(c.Request().Context()))
+}
+
+// healthResponse only breaks down the checks for authenticated callers
+func (con *Controller) healthResponse(c echo.Context, r health.Report) error {
+	_, err := con.extractUser(c)
+	status := http.StatusOK
+	if !r.OK() {
+		status = http.StatusServiceUnavailable
+	}
+	var h dto.Health
+	return c.JSON(status, h.FromReport(r, err == nil))
+}
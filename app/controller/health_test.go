@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drmaples/starter-app/app/dto"
+	"github.com/drmaples/starter-app/app/health"
+)
+
+func (s *controllerTestSuite) Test_handleReady() {
+	e := echo.New()
+	checks := health.NewRegistry(health.Options{})
+	checks.Register(health.Check{Name: "db", Run: func(context.Context) error { return nil }})
+	con := &Controller{e: e, health: checks}
+
+	probe := func(authenticated bool) (int, dto.Health) {
+		recorder := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/readyz", nil), recorder)
+		if authenticated {
+			c.Set(authContextKey, s.Token) // fake authentication
+		}
+		assert.NoError(s.T(), con.handleReady(c))
+		var actual dto.Health
+		assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &actual))
+		return recorder.Code, actual
+	}
+
+	code, _ := probe(false)
+	assert.Equal(s.T(), http.StatusServiceUnavailable, code, "not ready before the server is listening")
+
+	con.ready.Store(true)
+	code, actual := probe(false)
+	assert.Equal(s.T(), http.StatusOK, code)
+	assert.Equal(s.T(), dto.Health{Status: health.StatusOK}, actual, "no breakdown for anonymous callers")
+
+	code, actual = probe(true)
+	assert.Equal(s.T(), http.StatusOK, code)
+	assert.Len(s.T(), actual.Checks, 1)
+	assert.Equal(s.T(), "db", actual.Checks[0].Name)
+	assert.Equal(s.T(), health.StatusOK, actual.Checks[0].Status)
+
+	assert.NoError(s.T(), con.Shutdown(context.Background()))
+	code, actual = probe(true)
+	assert.Equal(s.T(), http.StatusServiceUnavailable, code, "not ready once draining")
+	assert.Equal(s.T(), healthStatusShuttingDown, actual.Status)
+
+	// a failing dependency fails readiness, new registry so the passing result is not cached
+	con.ready.Store(true)
+	con.health = health.NewRegistry(health.Options{})
+	con.health.Register(health.Check{Name: "db", Run: func(context.Context) error { return errors.New("connection refused") }})
+	code, actual = probe(true)
+	assert.Equal(s.T(), http.StatusServiceUnavailable, code)
+	assert.Equal(s.T(), health.StatusFail, actual.Status)
+	assert.Equal(s.T(), "connection refused", actual.Checks[0].Error)
+}
+
+func (s *controllerTestSuite) Test_handleLive() {
+	e := echo.New()
+	checks := health.NewRegistry(health.Options{})
+	checks.Register(health.Check{Name: "db", Run: func(context.Context) error { return errors.New("connection refused") }})
+	con := &Controller{e: e, health: checks}
+
+	// the db being down is not a reason to restart
+	recorder := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/healthz", nil), recorder)
+	assert.NoError(s.T(), con.handleLive(c))
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+}
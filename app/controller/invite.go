@@ -0,0 +1,327 @@
+package controller
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/apperr"
+	"github.com/drmaples/starter-app/app/dto"
+	"github.com/drmaples/starter-app/app/mail"
+	"github.com/drmaples/starter-app/app/metrics"
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+const (
+	inviteQueryParam = "invite"
+	inviteCookieName = "invite_token"
+	inviteCookieTTL  = 15 * time.Minute // only needs to survive the oauth round trip
+	inviteTokenBytes = 32
+)
+
+var (
+	errInviteInvalid       = apperr.BadRequest("invitation is invalid, expired or already used")
+	errInviteEmailMismatch = apperr.Forbidden("invitation was sent to a different email address")
+)
+
+type inviteRoute struct {
+	ID       int `param:"id"`
+	InviteID int `param:"invite_id"`
+}
+
+// newInviteToken returns a random url safe token. only its hash is stored
+func newInviteToken() (string, error) {
+	b := make([]byte, inviteTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "problem generating invite token")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashInviteToken signs the token with the jwt key so a leaked invitations table cannot be used to forge links
+func (con *Controller) hashInviteToken(token string) string {
+	mac := hmac.New(sha256.New, []byte(con.cfg.JWTSignKey))
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (con *Controller) inviteLink(token string) string {
+	return fmt.Sprintf("%s/login?%s=%s", con.cfg.ServerAddress, inviteQueryParam, url.QueryEscape(token))
+}
+
+// @Summary		invite to organization
+// @Description	email an expiring invitation link to join an organization, requires owner or admin role
+// @Tags		organizations
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		id path int true "organization id"
+// @Param 		data body dto.CreateInvitation true "data"
+// @Success		200	{object}	dto.Invitation
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/org/{id}/invites [post]
+func (con *Controller) handleCreateInvite(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var ir inviteRoute
+	if err := bindPathParams(c, &ir); err != nil {
+		return con.sendError(c, apperr.BadRequest("invalid type for organization id"))
+	}
+	var ci dto.CreateInvitation
+	if err := c.Bind(&ci); err != nil {
+		return con.sendError(c, err)
+	}
+	if err := c.Validate(ci); err != nil {
+		return con.sendError(c, apperr.Validation(err))
+	}
+	token, err := newInviteToken()
+	if err != nil {
+		return con.sendError(c, err)
+	}
+	expiresAt := time.Now().Add(con.cfg.InviteTTL)
+
+	var inv *repo.Invitation
+	var msg mail.Message
+	if err := repo.WithTx(ctx, con.db, nil, func(tx repo.Querier) error {
+		caller, err := con.requireOrgRoleTx(c, tx, ir.ID, orgManagerRoles)
+		if err != nil {
+			return err
+		}
+		if ci.Role == repo.OrgRoleOwner && caller.Role != repo.OrgRoleOwner {
+			return errOwnerOnly
+		}
+
+		org, err := con.orgRepo.GetOrgByID(ctx, tx, con.schema(c), ir.ID)
+		if err != nil {
+			return err
+		}
+		msg, err = mail.Render("invite", []string{ci.Email}, map[string]any{
+			"OrganizationName": org.Name,
+			"Role":             ci.Role,
+			"Link":             con.inviteLink(token),
+			"ExpiresAt":        expiresAt.UTC().Format(time.RFC1123),
+		})
+		if err != nil {
+			return err
+		}
+
+		inv, err = con.inviteRepo.CreateInvite(ctx, tx, con.schema(c), repo.Invitation{
+			OrganizationID: ir.ID,
+			Email:          ci.Email,
+			Role:           ci.Role,
+			TokenHash:      con.hashInviteToken(token),
+			InvitedBy:      &caller.UserID,
+			ExpiresAt:      expiresAt,
+		})
+		if err != nil {
+			return err
+		}
+		var res dto.Invitation
+		return con.auditTx(c, tx, http.StatusOK, auditDetail{Resource: "invitation", ResourceID: inv.ID, After: res.FromModel(*inv)})
+	}); err != nil {
+		return con.sendError(c, err)
+	}
+
+	// sent once the invite is committed, so an invite that was rolled back is never mailed
+	if err := con.mailer.Send(ctx, msg); err != nil {
+		// an invite nobody received is useless, do not leave it pending
+		if rErr := con.inviteRepo.RevokeInvite(ctx, con.db, con.schema(c), ir.ID, inv.ID); rErr != nil {
+			slog.ErrorContext(ctx, "problem revoking unsent invitation", slog.Any("error", rErr))
+		}
+		err := errors.Wrap(err, "problem queueing invitation email")
+		return con.sendError(c, err)
+	}
+
+	slog.InfoContext(ctx, "sent invitation",
+		slog.Group("invitation",
+			slog.Int("id", inv.ID),
+			slog.Int("organization_id", inv.OrganizationID),
+		),
+	)
+
+	var res dto.Invitation
+	return c.JSON(http.StatusOK, res.FromModel(*inv))
+}
+
+// @Summary		list pending invitations
+// @Description	list pending invitations for an organization, requires owner or admin role
+// @Tags		organizations
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		id path int true "organization id"
+// @Success		200	{object}	[]dto.Invitation
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/org/{id}/invites [get]
+func (con *Controller) handleListInvites(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var ir inviteRoute
+	if err := c.Bind(&ir); err != nil {
+		return con.sendError(c, apperr.BadRequest("invalid type for organization id"))
+	}
+	if _, err := con.requireOrgRole(c, ir.ID, orgManagerRoles); err != nil {
+		return con.sendError(c, err)
+	}
+
+	invites, err := con.inviteRepo.ListPendingInvites(ctx, con.readDB(ctx), con.schema(c), ir.ID)
+	if err != nil {
+		return con.sendError(c, err)
+	}
+
+	var res dto.Invitation
+	return c.JSON(http.StatusOK, res.FromModels(invites))
+}
+
+// @Summary		revoke invitation
+// @Description	revoke a pending invitation, requires owner or admin role
+// @Tags		organizations
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		id path int true "organization id"
+// @Param 		invite_id path int true "invitation id"
+// @Success		204
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/org/{id}/invites/{invite_id} [delete]
+func (con *Controller) handleRevokeInvite(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var ir inviteRoute
+	if err := c.Bind(&ir); err != nil {
+		return con.sendError(c, apperr.BadRequest("invalid type for organization or invitation id"))
+	}
+	if err := repo.WithTx(ctx, con.db, nil, func(tx repo.Querier) error {
+		if _, err := con.requireOrgRoleTx(c, tx, ir.ID, orgManagerRoles); err != nil {
+			return err
+		}
+		if err := con.inviteRepo.RevokeInvite(ctx, tx, con.schema(c), ir.ID, ir.InviteID); err != nil {
+			return err
+		}
+		return con.auditTx(c, tx, http.StatusNoContent, auditDetail{Resource: "invitation", ResourceID: ir.InviteID})
+	}); err != nil {
+		if errors.Is(err, repo.ErrNoRowsFound) {
+			return con.sendError(c, apperr.NotFound("no pending invitation for given id"))
+		}
+		return con.sendError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// rememberInvite keeps the invite token from the login link in a short lived cookie so the oauth callback can
+// accept it once the user's email is known
+func rememberInvite(c echo.Context) {
+	token := c.QueryParam(inviteQueryParam)
+	if token == "" {
+		return
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     inviteCookieName,
+		Value:    token,
+		Path:     oauthCallbackURL,
+		MaxAge:   int(inviteCookieTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   c.IsTLS(),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// takeInvite returns the invite token remembered by rememberInvite, clearing the cookie
+func takeInvite(c echo.Context) string {
+	cookie, err := c.Cookie(inviteCookieName)
+	if err != nil || cookie.Value == "" {
+		return ""
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     inviteCookieName,
+		Path:     oauthCallbackURL,
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	return cookie.Value
+}
+
+// acceptInvite links a pending invitation to the users row for email, creating the user if needed, and adds
+// them to the invitation's organization
+func (con *Controller) acceptInvite(ctx context.Context, schema string, token string, newUser repo.User) (*repo.Invitation, error) {
+	var inv *repo.Invitation
+	var created bool
+	err := repo.WithTx(ctx, con.db, nil, func(tx repo.Querier) error {
+		var err error
+		inv, err = con.inviteRepo.GetPendingInviteByTokenHash(ctx, tx, schema, con.hashInviteToken(token))
+		if err != nil {
+			if errors.Is(err, repo.ErrNoRowsFound) {
+				return errInviteInvalid
+			}
+			return err
+		}
+		if !strings.EqualFold(inv.Email, newUser.Email) {
+			return errInviteEmailMismatch
+		}
+
+		u, err := con.userRepo.GetUserByEmail(ctx, tx, schema, newUser.Email)
+		if errors.Is(err, repo.ErrNoRowsFound) {
+			u, err = con.userRepo.CreateUser(ctx, tx, schema, newUser)
+			if err == nil {
+				created = true
+				err = con.recordUserCreated(ctx, tx, schema, *u)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := con.orgRepo.GetMember(ctx, tx, schema, inv.OrganizationID, u.ID); err != nil {
+			if !errors.Is(err, repo.ErrNoRowsFound) {
+				return err
+			}
+			if _, err := con.orgRepo.AddMember(ctx, tx, schema, repo.Membership{
+				OrganizationID: inv.OrganizationID,
+				UserID:         u.ID,
+				Role:           inv.Role,
+			}); err != nil {
+				return err
+			}
+		}
+
+		if err := con.inviteRepo.AcceptInvite(ctx, tx, schema, inv.ID, u.ID); err != nil {
+			if errors.Is(err, repo.ErrNoRowsFound) {
+				return errInviteInvalid // accepted or revoked concurrently
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		metrics.ObserveUserCreated(metrics.UserSourceInvite)
+	}
+	return inv, nil
+}
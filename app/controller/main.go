@@ -2,12 +2,13 @@ package controller
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-playground/validator/v10"
@@ -15,11 +16,23 @@ import (
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/pkg/errors"
 	slogecho "github.com/samber/slog-echo"
 	echoSwagger "github.com/swaggo/echo-swagger"
 
+	"github.com/drmaples/starter-app/app/apperr"
+	"github.com/drmaples/starter-app/app/health"
+	"github.com/drmaples/starter-app/app/logging"
+	"github.com/drmaples/starter-app/app/mail"
+	"github.com/drmaples/starter-app/app/metrics"
 	"github.com/drmaples/starter-app/app/platform"
+	"github.com/drmaples/starter-app/app/ratelimit"
+	"github.com/drmaples/starter-app/app/realtime"
 	"github.com/drmaples/starter-app/app/repo"
+	"github.com/drmaples/starter-app/app/reporting"
+	"github.com/drmaples/starter-app/app/stream"
+	"github.com/drmaples/starter-app/app/tracing"
+	"github.com/drmaples/starter-app/app/webhook"
 	"github.com/drmaples/starter-app/docs" // docs generated by swag cli
 )
 
@@ -36,32 +49,121 @@ import (
 // @in header
 // @name x-jwt
 
+const (
+	headerReadYourWrites = "X-Read-Your-Writes"
+
+	// how long open websockets get to close when the server shuts down
+	realtimeShutdownTimeout = 10 * time.Second
+)
+
 // Controller contains all info about a controller
 type Controller struct {
-	e        *echo.Echo
-	userRepo repo.IUserRepo
-	db       *sql.DB
-	cfg      platform.Config
+	e            *echo.Echo
+	userRepo     repo.IUserRepo
+	orgRepo      repo.IOrgRepo
+	inviteRepo   repo.IInviteRepo
+	scheduleRepo repo.IScheduleRepo
+	outboxRepo   repo.IOutboxRepo
+	webhookRepo  repo.IWebhookRepo
+	auditRepo    repo.IAuditRepo
+	deliverer    *webhook.Deliverer
+	hub          *stream.Hub
+	realtime     *realtime.Hub
+	health       *health.Registry
+	metrics      http.Handler
+	logLevels    *logging.Levels
+	limiter      *ratelimit.Limiter // nil when rate limiting is off
+	reporter     reporting.Reporter
+	mailer       mail.Mailer
+	db           *repo.DB
+	dbRouter     *repo.Router
+	tenants      *repo.TenantProvisioner
+	cfg          platform.Config
+	ready        atomic.Bool // false until the server is listening and again once it starts shutting down
+}
+
+// Deps is what a controller needs from the rest of the app
+type Deps struct {
+	DBRouter     *repo.Router
+	Mailer       mail.Mailer
+	UserRepo     repo.IUserRepo
+	OrgRepo      repo.IOrgRepo
+	InviteRepo   repo.IInviteRepo
+	ScheduleRepo repo.IScheduleRepo
+	OutboxRepo   repo.IOutboxRepo
+	WebhookRepo  repo.IWebhookRepo
+	AuditRepo    repo.IAuditRepo
+	Deliverer    *webhook.Deliverer
+	Hub          *stream.Hub
+	Realtime     *realtime.Hub
+	Health       *health.Registry
+	Metrics      http.Handler
+	LogLevels    *logging.Levels
+	Limiter      *ratelimit.Limiter // nil turns rate limiting off
+	Reporter     reporting.Reporter
 }
 
 // New sets up a new controller
-func New(db *sql.DB, cfg platform.Config, userRepo repo.IUserRepo) *Controller {
+func New(cfg platform.Config, deps Deps) *Controller {
 	e := echo.New()
 	con := &Controller{
-		e:        e,
-		userRepo: userRepo,
-		db:       db,
-		cfg:      cfg,
+		e:            e,
+		userRepo:     deps.UserRepo,
+		orgRepo:      deps.OrgRepo,
+		inviteRepo:   deps.InviteRepo,
+		scheduleRepo: deps.ScheduleRepo,
+		outboxRepo:   deps.OutboxRepo,
+		webhookRepo:  deps.WebhookRepo,
+		auditRepo:    deps.AuditRepo,
+		deliverer:    deps.Deliverer,
+		hub:          deps.Hub,
+		realtime:     deps.Realtime,
+		health:       deps.Health,
+		metrics:      deps.Metrics,
+		logLevels:    deps.LogLevels,
+		limiter:      deps.Limiter,
+		reporter:     deps.Reporter,
+		mailer:       deps.Mailer,
+		db:           deps.DBRouter.Primary(),
+		dbRouter:     deps.DBRouter,
+		tenants:      repo.NewTenantProvisioner(deps.DBRouter.Primary(), cfg.DB, cfg.Tenant.AutoProvision),
+		cfg:          cfg,
 	}
 
 	con.adjustDynamicSwaggerInfo()
 	con.setupRoutes()
 
+	// hijacked websocket connections are not closed by the server, tell clients to go away when it shuts down
+	e.Server.RegisterOnShutdown(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), realtimeShutdownTimeout)
+		defer cancel()
+		if err := deps.Realtime.Shutdown(ctx); err != nil {
+			slog.ErrorContext(ctx, "problem closing websockets", slog.Any("error", err))
+		}
+	})
+	// event streams never go idle, end them so shutdown does not wait out its deadline. clients resume elsewhere
+	// with Last-Event-ID
+	e.Server.RegisterOnShutdown(deps.Hub.Close)
+
 	e.HideBanner = true
 	e.HidePort = true
 	e.Validator = newValidator()
-	e.Use(slogecho.New(slog.Default()))
+	e.HTTPErrorHandler = con.httpErrorHandler
+	e.IPExtractor = ipExtractor(cfg.HTTP)
+	e.Use(requestIDMiddleware)
+	e.Use(tracing.Middleware()) // before the request logger so its lines carry the trace id
+	e.Use(slogecho.NewWithConfig(slog.Default(), slogecho.Config{
+		DefaultLevel:     slog.LevelInfo,
+		ClientErrorLevel: slog.LevelWarn,
+		ServerErrorLevel: slog.LevelError,
+		WithRequestID:    false, // logged as request_id by logging.Handler
+		Filters:          []slogecho.Filter{sampleAccessLog(cfg.Log.AccessSampleRate)},
+	}))
+	e.Use(metrics.HTTPMiddleware())
+	e.Use(con.recoverMiddleware) // inside logging, metrics and tracing so they see the 500
+	e.Use(httpMiddleware(cfg.HTTP)...)
 	e.Use(middleware.TimeoutWithConfig(middleware.TimeoutConfig{
+		Skipper: isStream,
 		Timeout: 30 * time.Second,
 	}))
 
@@ -79,14 +181,36 @@ func New(db *sql.DB, cfg platform.Config, userRepo repo.IUserRepo) *Controller {
 	return con
 }
 
-// Run the web server
-func (con *Controller) Run(ctx context.Context) {
+// Run the web server until it is shut down
+func (con *Controller) Run(ctx context.Context) error {
 	slog.InfoContext(ctx, "starting server",
 		slog.String("env", con.cfg.Environment),
 		slog.String("address", con.cfg.ServerAddress),
 	)
 	bindAddress := fmt.Sprintf(":%d", con.cfg.ServerPort)
-	con.e.Logger.Fatal(con.e.Start(bindAddress))
+	con.ready.Store(true)
+	if err := con.e.Start(bindAddress); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return errors.Wrap(err, "problem running server")
+	}
+	return nil
+}
+
+// Shutdown fails readiness, waits for load balancers to notice, then stops accepting connections and waits for in
+// flight requests to finish until ctx is done
+func (con *Controller) Shutdown(ctx context.Context) error {
+	con.ready.Store(false)
+	slog.InfoContext(ctx, "draining server", slog.Duration("delay", con.cfg.ShutdownDrainDelay))
+	drain := time.NewTimer(con.cfg.ShutdownDrainDelay)
+	defer drain.Stop()
+	select {
+	case <-ctx.Done():
+	case <-drain.C:
+	}
+
+	if err := con.e.Shutdown(ctx); err != nil {
+		return errors.Wrap(err, "problem shutting down server")
+	}
+	return nil
 }
 
 // programmatically set swagger info that changes depending on environment
@@ -102,8 +226,14 @@ func (con *Controller) setupRoutes() {
 			return c.JSON(http.StatusOK, map[string]any{"howdy": "there"})
 		})
 		unrestricted.GET("/favicon.ico", func(_ echo.Context) error { return nil }) // avoids 404 errors in the browser
-		unrestricted.GET("/login", con.handleLogin)
-		unrestricted.GET(oauthCallbackURL, con.handleOauthCallback)
+		unrestricted.GET("/healthz", con.handleLive, con.optionalJWTMiddleware("header:x-jwt"))
+		unrestricted.GET("/readyz", con.handleReady, con.optionalJWTMiddleware("header:x-jwt"))
+		if con.cfg.MetricsPort == 0 {
+			unrestricted.GET("/metrics", echo.WrapHandler(con.metrics))
+		}
+		// probes, metrics and docs are not rate limited
+		unrestricted.GET("/login", con.handleLogin, con.rateLimitMiddleware)
+		unrestricted.GET(oauthCallbackURL, con.handleOauthCallback, con.rateLimitMiddleware)
 
 		unrestricted.GET("/swagger/*", echoSwagger.WrapHandler)
 		unrestricted.GET("/docs", func(c echo.Context) error {
@@ -111,21 +241,111 @@ func (con *Controller) setupRoutes() {
 		})
 	}
 
-	restricted := con.e.Group("/v1")
+	restricted := con.e.Group(apiPrefix)
 	{
 		restricted.Use(
-			echojwt.WithConfig(echojwt.Config{
-				ContextKey: authContextKey,
-				SigningKey: []byte(con.cfg.JWTSignKey),
-				NewClaimsFunc: func(_ echo.Context) jwt.Claims {
-					return new(jwtCustomClaims)
-				},
-				TokenLookup: "header:x-jwt",
-			}),
+			// limited before jwt is required, so floods of bad tokens are limited too. a valid token still limits the
+			// caller by who they are logged in as
+			con.optionalJWTMiddleware("header:x-jwt"),
+			con.rateLimitMiddleware,
+			con.jwtMiddleware("header:x-jwt"),
+			readYourWritesMiddleware,
+			con.tenantMiddleware,
+			con.auditMiddleware,
 		)
 		restricted.GET("/user", con.handleListUsers)
 		restricted.GET("/user/:id", con.handleGetUser)
 		restricted.POST("/user", con.handleCreateUser)
+		restricted.PUT("/user/:id", con.handleUpdateUser)
+		restricted.DELETE("/user/:id", con.handleDeleteUser)
+		restricted.GET("/user/:id/history", con.handleGetUserHistory)
+
+		restricted.GET("/org", con.handleListOrgs)
+		restricted.POST("/org", con.handleCreateOrg)
+		restricted.GET("/org/:id", con.handleGetOrg)
+		restricted.PUT("/org/:id", con.handleUpdateOrg)
+		restricted.DELETE("/org/:id", con.handleDeleteOrg)
+		restricted.GET("/org/:id/members", con.handleListOrgMembers)
+		restricted.POST("/org/:id/members", con.handleAddOrgMember)
+		restricted.PUT("/org/:id/members/:user_id", con.handleUpdateOrgMember)
+		restricted.DELETE("/org/:id/members/:user_id", con.handleRemoveOrgMember)
+		restricted.GET("/org/:id/invites", con.handleListInvites)
+		restricted.POST("/org/:id/invites", con.handleCreateInvite)
+		restricted.DELETE("/org/:id/invites/:invite_id", con.handleRevokeInvite)
+
+		restricted.GET("/webhooks", con.handleListWebhooks)
+		restricted.POST("/webhooks", con.handleCreateWebhook)
+		restricted.GET("/webhooks/:id", con.handleGetWebhook)
+		restricted.PUT("/webhooks/:id", con.handleUpdateWebhook)
+		restricted.DELETE("/webhooks/:id", con.handleDeleteWebhook)
+		restricted.GET("/webhooks/:id/deliveries", con.handleListWebhookDeliveries)
+		restricted.GET("/webhooks/:id/deliveries/:delivery_id", con.handleGetWebhookDelivery)
+		restricted.POST("/webhooks/:id/deliveries/:delivery_id/replay", con.handleReplayWebhookDelivery)
+
+		// events and audit entries hold every user's changes and email, so only admins may read them
+		restricted.GET("/events", con.handleEventStream, con.adminMiddleware)
+		restricted.GET("/audit", con.handleListAudit, con.adminMiddleware)
+
+		admin := restricted.Group("/admin", con.adminMiddleware)
+		admin.GET("/log-level", con.handleGetLogLevel)
+		admin.PUT("/log-level", con.handleSetLogLevel)
+		admin.GET("/db/stats", con.handleDBStats)
+		admin.GET("/schedules/runs", con.handleListScheduleRuns)
+	}
+
+	// browsers cannot set headers when opening a websocket, the jwt may come in the query instead
+	const realtimeTokenLookup = "header:x-jwt,query:token"
+	con.e.GET(realtimePath, con.handleRealtime, con.optionalJWTMiddleware(realtimeTokenLookup), con.rateLimitMiddleware,
+		con.jwtMiddleware(realtimeTokenLookup), con.tenantMiddleware)
+}
+
+// jwtMiddleware authenticates requests with a jwt found by tokenLookup
+func (con *Controller) jwtMiddleware(tokenLookup string) echo.MiddlewareFunc {
+	return echojwt.WithConfig(con.jwtConfig(tokenLookup))
+}
+
+// optionalJWTMiddleware authenticates callers that send a valid jwt and lets everyone else through unauthenticated
+func (con *Controller) optionalJWTMiddleware(tokenLookup string) echo.MiddlewareFunc {
+	cfg := con.jwtConfig(tokenLookup)
+	cfg.ContinueOnIgnoredError = true
+	cfg.ErrorHandler = func(echo.Context, error) error { return nil }
+	return echojwt.WithConfig(cfg)
+}
+
+func (con *Controller) jwtConfig(tokenLookup string) echojwt.Config {
+	return echojwt.Config{
+		ContextKey: authContextKey,
+		SigningKey: []byte(con.cfg.JWTSignKey),
+		NewClaimsFunc: func(_ echo.Context) jwt.Claims {
+			return new(jwtCustomClaims)
+		},
+		TokenLookup: tokenLookup,
+		// log who the request is from along with its id
+		SuccessHandler: func(c echo.Context) {
+			if sub, err := con.extractUser(c); err == nil {
+				req := c.Request()
+				c.SetRequest(req.WithContext(logging.WithSubject(req.Context(), sub)))
+			}
+		},
+	}
+}
+
+// readDB returns where read only queries should go: a healthy replica when configured, else the primary
+func (con *Controller) readDB(ctx context.Context) repo.Querier {
+	if con.dbRouter == nil {
+		return con.db
+	}
+	return con.dbRouter.Reader(ctx)
+}
+
+// readYourWritesMiddleware lets a caller force reads to the primary, e.g. right after a write it needs to see
+func readYourWritesMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if v, _ := strconv.ParseBool(c.Request().Header.Get(headerReadYourWrites)); v {
+			req := c.Request()
+			c.SetRequest(req.WithContext(repo.WithReadYourWrites(req.Context())))
+		}
+		return next(c)
 	}
 }
 
@@ -134,7 +354,9 @@ type customValidator struct {
 }
 
 func newValidator() echo.Validator {
-	return &customValidator{validator: validator.New()}
+	v := validator.New()
+	v.RegisterTagNameFunc(apperr.FieldName) // report fields by the names callers use
+	return &customValidator{validator: v}
 }
 
 func (cv *customValidator) Validate(i interface{}) error {
@@ -0,0 +1,593 @@
+package controller
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+
+	"github.com/drmaples/starter-app/app/apperr"
+	"github.com/drmaples/starter-app/app/dto"
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+var (
+	errLastOwner      = apperr.BadRequest("organization must keep at least one owner")
+	errOwnerOnly      = apperr.Forbidden("only owners can manage owners")
+	errSoleOwner      = apperr.Conflict("user is the only owner of an organization, add another owner first")
+	orgManagerRoles   = []string{repo.OrgRoleOwner, repo.OrgRoleAdmin}
+	orgAnyMemberRoles = []string{repo.OrgRoleOwner, repo.OrgRoleAdmin, repo.OrgRoleMember}
+)
+
+type orgRoute struct {
+	ID int `param:"id"`
+}
+
+type orgMemberRoute struct {
+	ID     int `param:"id"`
+	UserID int `param:"user_id"`
+}
+
+// bindPathParams binds only path params, leaving the request body for a separate c.Bind
+func bindPathParams(c echo.Context, i any) error {
+	return (&echo.DefaultBinder{}).BindPathParams(c, i)
+}
+
+// callerUser looks up the users row of the authenticated caller. writes pass their tx so a user created moments ago
+// is found on the primary
+func (con *Controller) callerUser(c echo.Context, tx repo.Querier) (*repo.User, error) {
+	ctx := c.Request().Context()
+
+	email, err := con.extractUser(c)
+	if err != nil {
+		return nil, unauthenticated(err)
+	}
+	u, err := con.userRepo.GetUserByEmail(ctx, tx, con.schema(c), email)
+	if err != nil {
+		if errors.Is(err, repo.ErrNoRowsFound) {
+			return nil, apperr.Forbidden("caller is not a registered user")
+		}
+		return nil, err
+	}
+	return u, nil
+}
+
+// requireOrgRole returns the caller's membership in an org if it has one of the given roles. non-members get a
+// 404 so org ids cannot be probed. it reads from a replica, writes use requireOrgRoleTx
+func (con *Controller) requireOrgRole(c echo.Context, orgID int, roles []string) (*repo.Membership, error) {
+	ctx := c.Request().Context()
+	return con.checkOrgRole(c, con.readDB(ctx), orgID, roles, false)
+}
+
+// requireOrgRoleTx is requireOrgRole for writes, run in the write's tx. the org and then the caller's membership stay
+// locked until tx ends, so a caller removed or demoted meanwhile cannot still write. the org is locked first, like
+// checkOwnerChange does, so member changes cannot deadlock
+func (con *Controller) requireOrgRoleTx(c echo.Context, tx repo.Querier, orgID int, roles []string) (*repo.Membership, error) {
+	return con.checkOrgRole(c, tx, orgID, roles, true)
+}
+
+func (con *Controller) checkOrgRole(c echo.Context, tx repo.Querier, orgID int, roles []string, lock bool) (*repo.Membership, error) {
+	ctx := c.Request().Context()
+
+	caller, err := con.callerUser(c, tx)
+	if err != nil {
+		return nil, err
+	}
+	var m *repo.Membership
+	if lock {
+		if err = con.orgRepo.LockOrg(ctx, tx, con.schema(c), orgID); err == nil {
+			m, err = con.orgRepo.LockMember(ctx, tx, con.schema(c), orgID, caller.ID)
+		}
+	} else {
+		m, err = con.orgRepo.GetMember(ctx, tx, con.schema(c), orgID, caller.ID)
+	}
+	if err != nil {
+		if errors.Is(err, repo.ErrNoRowsFound) {
+			return nil, apperr.NotFound("no organization for given id")
+		}
+		return nil, err
+	}
+	if !lo.Contains(roles, m.Role) {
+		return nil, apperr.Errorf(apperr.CodeForbidden, "role %q is not allowed to do this", m.Role)
+	}
+	return m, nil
+}
+
+// @Summary		list organizations
+// @Description	list organizations the caller is a member of
+// @Tags		organizations
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Success		200	{object}	[]dto.Organization
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/org [get]
+func (con *Controller) handleListOrgs(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	caller, err := con.callerUser(c, con.readDB(ctx))
+	if err != nil {
+		return con.sendError(c, err)
+	}
+
+	orgs, err := con.orgRepo.ListOrgsForUser(ctx, con.readDB(ctx), con.schema(c), caller.ID)
+	if err != nil {
+		return con.sendError(c, err)
+	}
+
+	var res dto.Organization
+	return c.JSON(http.StatusOK, res.FromModels(orgs))
+}
+
+// @Summary		get organization by id
+// @Description	get organization by id
+// @Tags		organizations
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		id path int true "organization id"
+// @Success		200	{object}	dto.Organization
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/org/{id} [get]
+func (con *Controller) handleGetOrg(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var or orgRoute
+	if err := c.Bind(&or); err != nil {
+		return con.sendError(c, apperr.BadRequest("invalid type for organization id"))
+	}
+	if _, err := con.requireOrgRole(c, or.ID, orgAnyMemberRoles); err != nil {
+		return con.sendError(c, err)
+	}
+
+	o, err := con.orgRepo.GetOrgByID(ctx, con.readDB(ctx), con.schema(c), or.ID)
+	if err != nil {
+		if errors.Is(err, repo.ErrNoRowsFound) {
+			return con.sendError(c, apperr.NotFound("no organization for given id"))
+		}
+		return con.sendError(c, err)
+	}
+
+	var res dto.Organization
+	return c.JSON(http.StatusOK, res.FromModel(*o))
+}
+
+// @Summary		create organization
+// @Description	create organization, the caller becomes its owner
+// @Tags		organizations
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		data body dto.SaveOrganization true "data"
+// @Success		200	{object}	dto.Organization
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/org [post]
+func (con *Controller) handleCreateOrg(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var o dto.SaveOrganization
+	if err := c.Bind(&o); err != nil {
+		return con.sendError(c, err)
+	}
+	if err := c.Validate(o); err != nil {
+		return con.sendError(c, apperr.Validation(err))
+	}
+
+	var newOrg *repo.Organization
+	if err := repo.WithTx(ctx, con.db, nil, func(tx repo.Querier) error {
+		caller, err := con.callerUser(c, tx)
+		if err != nil {
+			return err
+		}
+		newOrg, err = con.orgRepo.CreateOrg(ctx, tx, con.schema(c), o.Model())
+		if err != nil {
+			return err
+		}
+		if _, err := con.orgRepo.AddMember(ctx, tx, con.schema(c), repo.Membership{
+			OrganizationID: newOrg.ID,
+			UserID:         caller.ID,
+			Role:           repo.OrgRoleOwner,
+		}); err != nil {
+			return err
+		}
+		var res dto.Organization
+		return con.auditTx(c, tx, http.StatusOK, auditDetail{Resource: "organization", ResourceID: newOrg.ID, After: res.FromModel(*newOrg)})
+	}); err != nil {
+		return con.sendError(c, err)
+	}
+
+	slog.InfoContext(ctx, "added new organization",
+		slog.Group("organization",
+			slog.Int("id", newOrg.ID),
+		),
+	)
+
+	var res dto.Organization
+	return c.JSON(http.StatusOK, res.FromModel(*newOrg))
+}
+
+// @Summary		update organization
+// @Description	update organization, requires owner or admin role
+// @Tags		organizations
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		id path int true "organization id"
+// @Param 		data body dto.SaveOrganization true "data"
+// @Success		200	{object}	dto.Organization
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/org/{id} [put]
+func (con *Controller) handleUpdateOrg(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var or orgRoute
+	if err := bindPathParams(c, &or); err != nil {
+		return con.sendError(c, apperr.BadRequest("invalid type for organization id"))
+	}
+	var o dto.SaveOrganization
+	if err := c.Bind(&o); err != nil {
+		return con.sendError(c, err)
+	}
+	if err := c.Validate(o); err != nil {
+		return con.sendError(c, apperr.Validation(err))
+	}
+
+	m := o.Model()
+	m.ID = or.ID
+	var before, updated *repo.Organization
+	if err := repo.WithTx(ctx, con.db, nil, func(tx repo.Querier) error {
+		if _, err := con.requireOrgRoleTx(c, tx, or.ID, orgManagerRoles); err != nil {
+			return err
+		}
+		var err error
+		before, err = con.orgRepo.GetOrgByID(ctx, tx, con.schema(c), or.ID)
+		if err != nil {
+			return err
+		}
+		updated, err = con.orgRepo.UpdateOrg(ctx, tx, con.schema(c), m)
+		if err != nil {
+			return err
+		}
+		var res dto.Organization
+		return con.auditTx(c, tx, http.StatusOK, auditDetail{Resource: "organization", Before: res.FromModel(*before), After: res.FromModel(*updated)})
+	}); err != nil {
+		if errors.Is(err, repo.ErrNoRowsFound) {
+			return con.sendError(c, apperr.NotFound("no organization for given id"))
+		}
+		return con.sendError(c, err)
+	}
+
+	var res dto.Organization
+	return c.JSON(http.StatusOK, res.FromModel(*updated))
+}
+
+// @Summary		delete organization
+// @Description	delete organization and all of its memberships, requires owner role
+// @Tags		organizations
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		id path int true "organization id"
+// @Success		204
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/org/{id} [delete]
+func (con *Controller) handleDeleteOrg(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var or orgRoute
+	if err := c.Bind(&or); err != nil {
+		return con.sendError(c, apperr.BadRequest("invalid type for organization id"))
+	}
+
+	var before *repo.Organization
+	if err := repo.WithTx(ctx, con.db, nil, func(tx repo.Querier) error {
+		if _, err := con.requireOrgRoleTx(c, tx, or.ID, []string{repo.OrgRoleOwner}); err != nil {
+			return err
+		}
+		var err error
+		before, err = con.orgRepo.GetOrgByID(ctx, tx, con.schema(c), or.ID)
+		if err != nil {
+			return err
+		}
+		if err := con.orgRepo.DeleteOrg(ctx, tx, con.schema(c), or.ID); err != nil {
+			return err
+		}
+		var res dto.Organization
+		return con.auditTx(c, tx, http.StatusNoContent, auditDetail{Resource: "organization", Before: res.FromModel(*before)})
+	}); err != nil {
+		if errors.Is(err, repo.ErrNoRowsFound) {
+			return con.sendError(c, apperr.NotFound("no organization for given id"))
+		}
+		return con.sendError(c, err)
+	}
+
+	slog.InfoContext(ctx, "deleted organization",
+		slog.Group("organization",
+			slog.Int("id", or.ID),
+		),
+	)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary		list organization members
+// @Description	list organization members
+// @Tags		organizations
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		id path int true "organization id"
+// @Success		200	{object}	[]dto.Member
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/org/{id}/members [get]
+func (con *Controller) handleListOrgMembers(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var or orgRoute
+	if err := c.Bind(&or); err != nil {
+		return con.sendError(c, apperr.BadRequest("invalid type for organization id"))
+	}
+	if _, err := con.requireOrgRole(c, or.ID, orgAnyMemberRoles); err != nil {
+		return con.sendError(c, err)
+	}
+
+	members, err := con.orgRepo.ListMembers(ctx, con.readDB(ctx), con.schema(c), or.ID)
+	if err != nil {
+		return con.sendError(c, err)
+	}
+
+	var res dto.Member
+	return c.JSON(http.StatusOK, res.FromModels(members))
+}
+
+// @Summary		add organization member
+// @Description	add an existing user to an organization, requires owner or admin role
+// @Tags		organizations
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		id path int true "organization id"
+// @Param 		data body dto.AddMember true "data"
+// @Success		200	{object}	dto.Member
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		409	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/org/{id}/members [post]
+func (con *Controller) handleAddOrgMember(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var or orgRoute
+	if err := bindPathParams(c, &or); err != nil {
+		return con.sendError(c, apperr.BadRequest("invalid type for organization id"))
+	}
+	var am dto.AddMember
+	if err := c.Bind(&am); err != nil {
+		return con.sendError(c, err)
+	}
+	if err := c.Validate(am); err != nil {
+		return con.sendError(c, apperr.Validation(err))
+	}
+
+	var m *repo.Membership
+	if err := repo.WithTx(ctx, con.db, nil, func(tx repo.Querier) error {
+		caller, err := con.requireOrgRoleTx(c, tx, or.ID, orgManagerRoles)
+		if err != nil {
+			return err
+		}
+		if am.Role == repo.OrgRoleOwner && caller.Role != repo.OrgRoleOwner {
+			return errOwnerOnly
+		}
+		if _, err := con.userRepo.GetUserByID(ctx, tx, con.schema(c), am.UserID); err != nil {
+			return err
+		}
+		if _, err := con.orgRepo.AddMember(ctx, tx, con.schema(c), repo.Membership{
+			OrganizationID: or.ID,
+			UserID:         am.UserID,
+			Role:           am.Role,
+		}); err != nil {
+			return err
+		}
+		m, err = con.orgRepo.GetMember(ctx, tx, con.schema(c), or.ID, am.UserID)
+		if err != nil {
+			return err
+		}
+		var res dto.Member
+		return con.auditTx(c, tx, http.StatusOK, auditDetail{Resource: "organization_member", ResourceID: memberResourceID(or.ID, am.UserID), After: res.FromModel(*m)})
+	}); err != nil {
+		if errors.Is(err, repo.ErrNoRowsFound) {
+			return con.sendError(c, apperr.NotFound("no user for given id"))
+		}
+		if errors.Is(err, repo.ErrDuplicateMember) {
+			return con.sendError(c, apperr.Conflict("user is already a member"))
+		}
+		return con.sendError(c, err)
+	}
+
+	var res dto.Member
+	return c.JSON(http.StatusOK, res.FromModel(*m))
+}
+
+// @Summary		update organization member
+// @Description	change a member's role, requires owner or admin role
+// @Tags		organizations
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		id path int true "organization id"
+// @Param 		user_id path int true "user id"
+// @Param 		data body dto.UpdateMember true "data"
+// @Success		200	{object}	dto.Member
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/org/{id}/members/{user_id} [put]
+func (con *Controller) handleUpdateOrgMember(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var mr orgMemberRoute
+	if err := bindPathParams(c, &mr); err != nil {
+		return con.sendError(c, apperr.BadRequest("invalid type for organization or user id"))
+	}
+	var um dto.UpdateMember
+	if err := c.Bind(&um); err != nil {
+		return con.sendError(c, err)
+	}
+	if err := c.Validate(um); err != nil {
+		return con.sendError(c, apperr.Validation(err))
+	}
+
+	var before, m *repo.Membership
+	if err := repo.WithTx(ctx, con.db, nil, func(tx repo.Querier) error {
+		caller, err := con.requireOrgRoleTx(c, tx, mr.ID, orgManagerRoles)
+		if err != nil {
+			return err
+		}
+		before, err = con.checkOwnerChange(c, tx, caller, mr, um.Role)
+		if err != nil {
+			return err
+		}
+		m, err = con.orgRepo.UpdateMemberRole(ctx, tx, con.schema(c), mr.ID, mr.UserID, um.Role)
+		if err != nil {
+			return err
+		}
+		var res dto.Member
+		return con.auditTx(c, tx, http.StatusOK, auditDetail{
+			Resource:   "organization_member",
+			ResourceID: memberResourceID(mr.ID, mr.UserID),
+			Before:     res.FromModel(*before),
+			After:      res.FromModel(*m),
+		})
+	}); err != nil {
+		return con.memberChangeError(c, err)
+	}
+
+	var res dto.Member
+	return c.JSON(http.StatusOK, res.FromModel(*m))
+}
+
+// @Summary		remove organization member
+// @Description	remove a user from an organization, requires owner or admin role
+// @Tags		organizations
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		id path int true "organization id"
+// @Param 		user_id path int true "user id"
+// @Success		204
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/org/{id}/members/{user_id} [delete]
+func (con *Controller) handleRemoveOrgMember(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var mr orgMemberRoute
+	if err := c.Bind(&mr); err != nil {
+		return con.sendError(c, apperr.BadRequest("invalid type for organization or user id"))
+	}
+
+	var before *repo.Membership
+	if err := repo.WithTx(ctx, con.db, nil, func(tx repo.Querier) error {
+		caller, err := con.requireOrgRoleTx(c, tx, mr.ID, orgManagerRoles)
+		if err != nil {
+			return err
+		}
+		before, err = con.checkOwnerChange(c, tx, caller, mr, "")
+		if err != nil {
+			return err
+		}
+		if err := con.orgRepo.RemoveMember(ctx, tx, con.schema(c), mr.ID, mr.UserID); err != nil {
+			return err
+		}
+		var res dto.Member
+		return con.auditTx(c, tx, http.StatusNoContent, auditDetail{Resource: "organization_member", ResourceID: memberResourceID(mr.ID, mr.UserID), Before: res.FromModel(*before)})
+	}); err != nil {
+		return con.memberChangeError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// checkOwnerChange enforces that only owners manage owners and that an org never loses its last owner. returns the
+// member being changed. newRole is empty when the member is being removed
+func (con *Controller) checkOwnerChange(c echo.Context, tx repo.Querier, caller *repo.Membership, mr orgMemberRoute, newRole string) (*repo.Membership, error) {
+	ctx := c.Request().Context()
+
+	// members are read under the org's lock, or concurrent changes could each count an owner the other removes.
+	// requireOrgRoleTx took it already, locking it again in the same tx is a no-op
+	if err := con.orgRepo.LockOrg(ctx, tx, con.schema(c), mr.ID); err != nil {
+		return nil, err
+	}
+	target, err := con.orgRepo.GetMember(ctx, tx, con.schema(c), mr.ID, mr.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if target.Role != repo.OrgRoleOwner && newRole != repo.OrgRoleOwner {
+		return target, nil
+	}
+	if caller.Role != repo.OrgRoleOwner {
+		return nil, errOwnerOnly
+	}
+	if target.Role != repo.OrgRoleOwner || newRole == repo.OrgRoleOwner {
+		return target, nil
+	}
+
+	owners, err := con.countOwners(c, tx, mr.ID)
+	if err != nil {
+		return nil, err
+	}
+	if owners <= 1 {
+		return nil, errLastOwner
+	}
+	return target, nil
+}
+
+// countOwners counts an organization's owners. lock the org first when the count decides a change
+func (con *Controller) countOwners(c echo.Context, tx repo.Querier, orgID int) (int, error) {
+	members, err := con.orgRepo.ListMembers(c.Request().Context(), tx, con.schema(c), orgID)
+	if err != nil {
+		return 0, err
+	}
+	return lo.CountBy(members, func(m repo.Membership) bool { return m.Role == repo.OrgRoleOwner }), nil
+}
+
+// memberResourceID identifies a membership in the audit log, e.g. 3/7 for user 7 in org 3
+func memberResourceID(orgID int, userID int) string {
+	return fmt.Sprintf("%d/%d", orgID, userID)
+}
+
+func (con *Controller) memberChangeError(c echo.Context, err error) error {
+	if errors.Is(err, repo.ErrNoRowsFound) {
+		return con.sendError(c, apperr.NotFound("no member for given id"))
+	}
+	return con.sendError(c, err) // errOwnerOnly and errLastOwner carry their own status
+}
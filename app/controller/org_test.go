@@ -0,0 +1,300 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/drmaples/starter-app/app/dto"
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+type mockOrgRepo struct {
+	mock.Mock
+}
+
+func (m *mockOrgRepo) CreateOrg(_ context.Context, _ repo.Querier, _ string, o repo.Organization) (*repo.Organization, error) {
+	args := m.Called(o)
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repo.Organization), args.Error(1)
+}
+
+func (m *mockOrgRepo) GetOrgByID(_ context.Context, _ repo.Querier, _ string, orgID int) (*repo.Organization, error) {
+	args := m.Called(orgID)
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repo.Organization), args.Error(1)
+}
+
+func (m *mockOrgRepo) ListOrgsForUser(_ context.Context, _ repo.Querier, _ string, userID int) ([]repo.Organization, error) {
+	args := m.Called(userID)
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]repo.Organization), args.Error(1)
+}
+
+func (m *mockOrgRepo) UpdateOrg(_ context.Context, _ repo.Querier, _ string, o repo.Organization) (*repo.Organization, error) {
+	args := m.Called(o)
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repo.Organization), args.Error(1)
+}
+
+func (m *mockOrgRepo) DeleteOrg(_ context.Context, _ repo.Querier, _ string, orgID int) error {
+	return m.Called(orgID).Error(0)
+}
+
+func (m *mockOrgRepo) LockOrg(_ context.Context, _ repo.Querier, _ string, orgID int) error {
+	return m.Called(orgID).Error(0)
+}
+
+func (m *mockOrgRepo) LockOwnedOrgs(_ context.Context, _ repo.Querier, _ string, userID int) ([]int, error) {
+	args := m.Called(userID)
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]int), nil
+}
+
+func (m *mockOrgRepo) AddMember(_ context.Context, _ repo.Querier, _ string, mem repo.Membership) (*repo.Membership, error) {
+	args := m.Called(mem)
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repo.Membership), args.Error(1)
+}
+
+func (m *mockOrgRepo) GetMember(_ context.Context, _ repo.Querier, _ string, orgID int, userID int) (*repo.Membership, error) {
+	args := m.Called(orgID, userID)
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repo.Membership), args.Error(1)
+}
+
+func (m *mockOrgRepo) LockMember(_ context.Context, _ repo.Querier, _ string, orgID int, userID int) (*repo.Membership, error) {
+	args := m.Called(orgID, userID)
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repo.Membership), args.Error(1)
+}
+
+func (m *mockOrgRepo) ListMembers(_ context.Context, _ repo.Querier, _ string, orgID int) ([]repo.Membership, error) {
+	args := m.Called(orgID)
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]repo.Membership), args.Error(1)
+}
+
+func (m *mockOrgRepo) UpdateMemberRole(_ context.Context, _ repo.Querier, _ string, orgID int, userID int, role string) (*repo.Membership, error) {
+	args := m.Called(orgID, userID, role)
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repo.Membership), args.Error(1)
+}
+
+func (m *mockOrgRepo) RemoveMember(_ context.Context, _ repo.Querier, _ string, orgID int, userID int) error {
+	return m.Called(orgID, userID).Error(0)
+}
+
+// fakeTxDB is a db that can only begin, commit and roll back, for handlers that run repo mocks inside repo.WithTx
+func fakeTxDB() *repo.DB {
+	return &repo.DB{SQL: sql.OpenDB(fakeTxConnector{})}
+}
+
+type fakeTxConnector struct{}
+
+func (fakeTxConnector) Connect(context.Context) (driver.Conn, error) { return fakeTxConn{}, nil }
+func (fakeTxConnector) Driver() driver.Driver                        { return fakeTxDriver{} }
+
+type fakeTxDriver struct{}
+
+func (fakeTxDriver) Open(string) (driver.Conn, error) { return fakeTxConn{}, nil }
+
+type fakeTxConn struct{}
+
+func (fakeTxConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fake tx db runs no queries")
+}
+func (fakeTxConn) Close() error              { return nil }
+func (fakeTxConn) Begin() (driver.Tx, error) { return fakeTxConn{}, nil }
+func (fakeTxConn) Commit() error             { return nil }
+func (fakeTxConn) Rollback() error           { return nil }
+
+type orgTestSuite struct {
+	suite.Suite
+	Caller  *repo.User
+	FakeOrg *repo.Organization
+	Token   *jwt.Token
+}
+
+func TestOrgSuite(t *testing.T) {
+	suite.Run(t, new(orgTestSuite))
+}
+
+func (s *orgTestSuite) SetupTest() {
+	s.Caller = &repo.User{
+		ID:        222,
+		Email:     "logged-in@example.com",
+		FirstName: "first",
+		LastName:  "last",
+	}
+	s.FakeOrg = &repo.Organization{
+		ID:   333,
+		Name: "acme",
+	}
+	s.Token = newToken(s.Caller.Email, "first last", "example.com", 15*time.Minute)
+}
+
+func (s *orgTestSuite) newContext(method string, body string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	e.Validator = newValidator()
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	recorder := httptest.NewRecorder()
+	c := e.NewContext(req, recorder)
+	c.Set(authContextKey, s.Token) // fake authentication
+	return c, recorder
+}
+
+func (s *orgTestSuite) Test_handleListOrgs_success() {
+	c, recorder := s.newContext(http.MethodGet, "")
+	c.SetPath("/v1/org")
+
+	users := new(mockUserRepo)
+	users.On("GetUserByEmail", mock.Anything, mock.Anything, mock.Anything, s.Caller.Email).Return(s.Caller, nil)
+	orgs := new(mockOrgRepo)
+	orgs.On("ListOrgsForUser", s.Caller.ID).Return([]repo.Organization{*s.FakeOrg}, nil)
+
+	con := Controller{userRepo: users, orgRepo: orgs}
+	assert.NoError(s.T(), con.handleListOrgs(c))
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+
+	var actual []dto.Organization
+	assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &actual))
+	assert.Len(s.T(), actual, 1)
+	assert.Equal(s.T(), s.FakeOrg.ID, actual[0].ID)
+}
+
+func (s *orgTestSuite) Test_handleListOrgs_unregistered_caller() {
+	c, recorder := s.newContext(http.MethodGet, "")
+	c.SetPath("/v1/org")
+
+	users := new(mockUserRepo)
+	users.On("GetUserByEmail", mock.Anything, mock.Anything, mock.Anything, s.Caller.Email).Return(nil, repo.ErrNoRowsFound)
+
+	con := Controller{userRepo: users}
+	assert.NoError(s.T(), con.handleListOrgs(c))
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+}
+
+func (s *orgTestSuite) Test_handleGetOrg_not_member() {
+	c, recorder := s.newContext(http.MethodGet, "")
+	c.SetPath("/v1/org/:id")
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(s.FakeOrg.ID))
+
+	users := new(mockUserRepo)
+	users.On("GetUserByEmail", mock.Anything, mock.Anything, mock.Anything, s.Caller.Email).Return(s.Caller, nil)
+	orgs := new(mockOrgRepo)
+	orgs.On("GetMember", s.FakeOrg.ID, s.Caller.ID).Return(nil, repo.ErrNoRowsFound)
+
+	con := Controller{userRepo: users, orgRepo: orgs}
+	assert.NoError(s.T(), con.handleGetOrg(c))
+	assert.Equal(s.T(), http.StatusNotFound, recorder.Code)
+
+	var actual dto.Problem
+	assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &actual))
+	assert.Equal(s.T(), "no organization for given id", actual.Detail)
+}
+
+func (s *orgTestSuite) Test_handleUpdateOrg_requires_manager() {
+	c, recorder := s.newContext(http.MethodPut, `{"name":"new name"}`)
+	c.SetPath("/v1/org/:id")
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(s.FakeOrg.ID))
+
+	users := new(mockUserRepo)
+	users.On("GetUserByEmail", mock.Anything, mock.Anything, mock.Anything, s.Caller.Email).Return(s.Caller, nil)
+	orgs := new(mockOrgRepo)
+	orgs.On("LockOrg", s.FakeOrg.ID).Return(nil)
+	orgs.On("LockMember", s.FakeOrg.ID, s.Caller.ID).Return(&repo.Membership{
+		OrganizationID: s.FakeOrg.ID,
+		UserID:         s.Caller.ID,
+		Role:           repo.OrgRoleMember,
+	}, nil)
+
+	con := Controller{db: fakeTxDB(), auditRepo: &fakeAuditRepo{}, userRepo: users, orgRepo: orgs}
+	assert.NoError(s.T(), con.handleUpdateOrg(c))
+	assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+	orgs.AssertNotCalled(s.T(), "UpdateOrg", mock.Anything)
+}
+
+func (s *orgTestSuite) Test_handleUpdateOrg_success() {
+	c, recorder := s.newContext(http.MethodPut, `{"name":"new name"}`)
+	c.SetPath("/v1/org/:id")
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(s.FakeOrg.ID))
+
+	users := new(mockUserRepo)
+	users.On("GetUserByEmail", mock.Anything, mock.Anything, mock.Anything, s.Caller.Email).Return(s.Caller, nil)
+	orgs := new(mockOrgRepo)
+	orgs.On("LockOrg", s.FakeOrg.ID).Return(nil)
+	orgs.On("LockMember", s.FakeOrg.ID, s.Caller.ID).Return(&repo.Membership{
+		OrganizationID: s.FakeOrg.ID,
+		UserID:         s.Caller.ID,
+		Role:           repo.OrgRoleAdmin,
+	}, nil)
+	orgs.On("GetOrgByID", s.FakeOrg.ID).Return(s.FakeOrg, nil)
+	orgs.On("UpdateOrg", repo.Organization{ID: s.FakeOrg.ID, Name: "new name"}).Return(&repo.Organization{ID: s.FakeOrg.ID, Name: "new name"}, nil)
+
+	con := Controller{db: fakeTxDB(), auditRepo: &fakeAuditRepo{}, userRepo: users, orgRepo: orgs}
+	assert.NoError(s.T(), con.handleUpdateOrg(c))
+	assert.Equal(s.T(), http.StatusOK, recorder.Code)
+
+	var actual dto.Organization
+	assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &actual))
+	assert.Equal(s.T(), "new name", actual.Name)
+}
+
+func (s *orgTestSuite) Test_handleDeleteOrg_removed_member() {
+	c, recorder := s.newContext(http.MethodDelete, "")
+	c.SetPath("/v1/org/:id")
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(s.FakeOrg.ID))
+
+	// the replica may still list the caller as owner, the locked read on the primary decides
+	users := new(mockUserRepo)
+	users.On("GetUserByEmail", mock.Anything, mock.Anything, mock.Anything, s.Caller.Email).Return(s.Caller, nil)
+	orgs := new(mockOrgRepo)
+	orgs.On("LockOrg", s.FakeOrg.ID).Return(nil)
+	orgs.On("LockMember", s.FakeOrg.ID, s.Caller.ID).Return(nil, repo.ErrNoRowsFound)
+
+	con := Controller{db: fakeTxDB(), auditRepo: &fakeAuditRepo{}, userRepo: users, orgRepo: orgs}
+	assert.NoError(s.T(), con.handleDeleteOrg(c))
+	assert.Equal(s.T(), http.StatusNotFound, recorder.Code)
+	orgs.AssertNotCalled(s.T(), "GetMember", mock.Anything, mock.Anything)
+	orgs.AssertNotCalled(s.T(), "DeleteOrg", mock.Anything)
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/apperr"
+	"github.com/drmaples/starter-app/app/dto"
+	"github.com/drmaples/starter-app/app/logging"
+)
+
+// sendError responds with err as a problem. errors that are not an *apperr.Error, or one of echo's, are internal:
+// they are logged and, outside of dev, the caller only learns something went wrong
+func (con *Controller) sendError(c echo.Context, err error) error {
+	ae := appError(err)
+	ctx := c.Request().Context()
+	// echo's own errors, e.g. from recovering a panic, are logged where they happen
+	var he *echo.HTTPError
+	if ae.Code == apperr.CodeInternal && !errors.As(err, &he) {
+		slog.ErrorContext(ctx, "problem handling request", slog.Any("error", err))
+	}
+
+	var res dto.Problem
+	res = res.FromError(ae, con.cfg.Environment == "dev")
+	res.Instance = c.Request().URL.Path
+	res.RequestID = logging.RequestID(ctx)
+
+	if c.Request().Method == http.MethodHead {
+		return c.NoContent(res.Status)
+	}
+	c.Response().Header().Set(echo.HeaderContentType, dto.MIMEProblemJSON)
+	return c.JSON(res.Status, res)
+}
+
+// httpErrorHandler responds to errors handlers and middleware return rather than respond with, e.g. a missing jwt,
+// with a problem like the ones handlers send
+func (con *Controller) httpErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	if err := con.sendError(c, err); err != nil {
+		slog.ErrorContext(c.Request().Context(), "problem sending error response", slog.Any("error", err))
+	}
+}
+
+// appError converts the errors echo and its middleware return, which carry an http status, into app errors
+func appError(err error) *apperr.Error {
+	var ae *apperr.Error
+	if errors.As(err, &ae) {
+		return ae
+	}
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		code := apperr.CodeForStatus(he.Code)
+		msg := http.StatusText(he.Code)
+		if m, ok := he.Message.(string); ok && code != apperr.CodeInternal {
+			msg = m
+		}
+		return &apperr.Error{Code: code, Message: msg, Err: he.Internal}
+	}
+	return apperr.Internal(err)
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drmaples/starter-app/app/apperr"
+	"github.com/drmaples/starter-app/app/dto"
+	"github.com/drmaples/starter-app/app/platform"
+)
+
+func (s *controllerTestSuite) Test_sendError() {
+	sqlErr := errors.New(`ERROR: relation "users" does not exist (SQLSTATE 42P01)`)
+	serve := func(env string, path string) (*httptest.ResponseRecorder, dto.Problem) {
+		con := &Controller{cfg: platform.Config{Environment: env}}
+		e := echo.New()
+		e.HTTPErrorHandler = con.httpErrorHandler
+		e.GET("/v1/user/:id", func(c echo.Context) error {
+			var ur userRoute
+			if err := c.Bind(&ur); err != nil {
+				return con.sendError(c, err)
+			}
+			return con.sendError(c, sqlErr)
+		})
+
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		var actual dto.Problem
+		assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &actual))
+		return recorder, actual
+	}
+
+	s.Run("internal_hidden", func() {
+		recorder, actual := serve("prod", "/v1/user/1")
+		assert.Equal(s.T(), http.StatusInternalServerError, recorder.Code)
+		assert.Equal(s.T(), dto.MIMEProblemJSON, recorder.Header().Get(echo.HeaderContentType))
+		assert.Equal(s.T(), "internal", actual.Code)
+		assert.Equal(s.T(), "/v1/user/1", actual.Instance)
+		assert.NotContains(s.T(), recorder.Body.String(), "SQLSTATE")
+	})
+
+	s.Run("internal_shown_in_dev", func() {
+		_, actual := serve("dev", "/v1/user/1")
+		assert.Contains(s.T(), actual.Detail, "SQLSTATE")
+	})
+
+	s.Run("bad_path_param", func() {
+		recorder, actual := serve("prod", "/v1/user/abc")
+		assert.Equal(s.T(), http.StatusBadRequest, recorder.Code)
+		assert.Equal(s.T(), "bad_request", actual.Code)
+		assert.Contains(s.T(), actual.Detail, "invalid syntax")
+	})
+
+	s.Run("echo_errors", func() {
+		recorder, actual := serve("prod", "/nowhere")
+		assert.Equal(s.T(), http.StatusNotFound, recorder.Code)
+		assert.Equal(s.T(), dto.MIMEProblemJSON, recorder.Header().Get(echo.HeaderContentType))
+		assert.Equal(s.T(), dto.Problem{
+			Type:     "urn:problem-type:starter-app:not_found",
+			Title:    "Not Found",
+			Status:   http.StatusNotFound,
+			Detail:   "Not Found",
+			Instance: "/nowhere",
+			Code:     "not_found",
+		}, actual)
+	})
+}
+
+func (s *controllerTestSuite) Test_appError() {
+	assert.Equal(s.T(), apperr.CodeRateLimited, appError(echo.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded")).Code)
+	assert.Equal(s.T(), "rate limit exceeded", appError(echo.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded")).Message)
+	assert.Equal(s.T(), "Internal Server Error", appError(echo.NewHTTPError(http.StatusInternalServerError, "dial tcp 10.0.0.1:5432")).Message)
+	assert.Equal(s.T(), apperr.CodeConflict, appError(errors.Wrap(errDeliveryPending, "redelivering")).Code)
+}
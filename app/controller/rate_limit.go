@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/drmaples/starter-app/app/ratelimit"
+)
+
+// rateLimitMiddleware throttles each client to the rate limit policy of the route, see RATE_LIMIT_* config
+func (con *Controller) rateLimitMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return ratelimit.Middleware(con.limiter, con.rateLimitKey)(next)
+}
+
+// rateLimitKey identifies who a request is from: the logged in user when a jwt middleware verified one, else the api
+// key when a trusted proxy passed one on, else the ip. only verified credentials pick the bucket, or a client could
+// get a fresh one by sending anything new, so the api key is only believed from the gateway that checked it
+func (con *Controller) rateLimitKey(c echo.Context) string {
+	if sub, err := con.extractUser(c); err == nil {
+		return "sub:" + sub
+	}
+	if header := con.cfg.RateLimit.APIKeyHeader; header != "" && fromTrustedProxy(c.Request(), con.cfg.HTTP.TrustedProxies) {
+		if key := c.Request().Header.Get(header); key != "" {
+			// keys are credentials, do not keep them in the store
+			sum := sha256.Sum256([]byte(key))
+			return "key:" + hex.EncodeToString(sum[:16])
+		}
+	}
+	return "ip:" + c.RealIP()
+}
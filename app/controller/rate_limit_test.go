@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drmaples/starter-app/app/platform"
+)
+
+func (s *controllerTestSuite) Test_rateLimitKey() {
+	cfg := platform.Config{
+		RateLimit: platform.RateLimitConfig{APIKeyHeader: "X-API-Key"},
+		HTTP:      platform.HTTPConfig{TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}},
+	}
+	e := echo.New()
+	e.IPExtractor = ipExtractor(cfg.HTTP)
+	con := &Controller{e: e, cfg: cfg}
+	newCtx := func(remoteAddr string, apiKey string) echo.Context {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		return e.NewContext(req, httptest.NewRecorder())
+	}
+
+	s.Run("user", func() {
+		c := newCtx("10.1.2.3:4567", "secret")
+		c.Set(authContextKey, s.Token) // fake authentication
+		assert.Equal(s.T(), "sub:logged-in@example.com", con.rateLimitKey(c))
+	})
+
+	s.Run("api_key_from_trusted_proxy", func() {
+		key := con.rateLimitKey(newCtx("10.1.2.3:4567", "secret"))
+		assert.True(s.T(), strings.HasPrefix(key, "key:"))
+		assert.NotContains(s.T(), key, "secret", "keys are hashed")
+		assert.Equal(s.T(), key, con.rateLimitKey(newCtx("10.9.9.9:80", "secret")), "same key, same bucket")
+		assert.NotEqual(s.T(), key, con.rateLimitKey(newCtx("10.1.2.3:4567", "other")))
+	})
+
+	s.Run("api_key_from_client", func() {
+		assert.Equal(s.T(), "ip:203.0.113.9", con.rateLimitKey(newCtx("203.0.113.9:4567", "secret")), "anyone can send the header")
+	})
+
+	s.Run("ip", func() {
+		assert.Equal(s.T(), "ip:203.0.113.9", con.rateLimitKey(newCtx("203.0.113.9:4567", "")))
+	})
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/apperr"
+	"github.com/drmaples/starter-app/app/realtime"
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+const realtimePath = "/v1/ws"
+
+// @Summary		realtime websocket
+// @Description	websocket for presence and live collaboration. browsers cannot set headers on a websocket so the jwt may also be passed as the token query param.
+// @Description	clients send json messages {"type": "subscribe|unsubscribe|publish", "topic": "...", "data": {...}, "ref": "..."}. topics are org/<id>[/...] for members of the org or user/<id>[/...] for that user only.
+// @Description	the server replies with subscribed (including current members), unsubscribed, message, presence (join or leave) and error messages. connections that cannot keep up are closed with 1013, clients should reconnect and resubscribe
+// @Tags		realtime
+// @Security 	ApiKeyAuth
+// @Param 		token query string false "jwt when the x-jwt header cannot be sent"
+// @Success		101
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		503
+// @Router		/v1/ws [get]
+func (con *Controller) handleRealtime(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	caller, err := con.callerUser(c, con.readDB(ctx))
+	if err != nil {
+		return con.sendError(c, err)
+	}
+	if !websocket.IsWebSocketUpgrade(c.Request()) {
+		return con.sendError(c, apperr.BadRequest("expected a websocket upgrade"))
+	}
+
+	schema := con.schema(c)
+	client := realtime.Client{
+		ID:        userSubject(caller.ID),
+		Tenant:    schema,
+		Authorize: con.authorizeTopic(schema, caller),
+	}
+	// blocks until the connection closes, the upgrader has responded on error
+	if err := con.realtime.Serve(c.Response(), c.Request(), client); err != nil {
+		slog.DebugContext(ctx, "websocket connection refused", slog.Any("error", err))
+	}
+	return nil
+}
+
+// authorizeTopic checks the caller may subscribe to a topic. access is checked once on subscribe, a member removed
+// from an org keeps receiving its topics until they unsubscribe or reconnect
+func (con *Controller) authorizeTopic(schema string, caller *repo.User) func(ctx context.Context, topic string) error {
+	return func(ctx context.Context, topic string) error {
+		parts := strings.SplitN(topic, "/", 3)
+		if len(parts) < 2 {
+			return errors.Errorf("topic %q is not scoped to an org or user", topic)
+		}
+		id, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return errors.Errorf("topic %q has an invalid id", topic)
+		}
+
+		switch parts[0] {
+		case "user":
+			if id != caller.ID {
+				return errors.Errorf("topic %q belongs to another user", topic)
+			}
+			return nil
+		case "org":
+			if _, err := con.orgRepo.GetMember(ctx, con.readDB(ctx), schema, id, caller.ID); err != nil {
+				return errors.Wrap(err, "problem checking org membership")
+			}
+			return nil
+		default:
+			return errors.Errorf("topic %q is not scoped to an org or user", topic)
+		}
+	}
+}
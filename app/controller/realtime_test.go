@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+func (s *controllerTestSuite) Test_authorizeTopic() {
+	orgs := new(mockOrgRepo)
+	orgs.On("GetMember", 7, s.FakeUser.ID).Return(&repo.Membership{UserID: s.FakeUser.ID, Role: repo.OrgRoleMember}, nil)
+	orgs.On("GetMember", 8, s.FakeUser.ID).Return(nil, repo.ErrNoRowsFound)
+	authorize := (&Controller{orgRepo: orgs}).authorizeTopic(repo.DefaultSchema, s.FakeUser)
+
+	tests := []struct {
+		topic string
+		ok    bool
+	}{
+		{topic: "org/7", ok: true},
+		{topic: "org/7/doc/3", ok: true},
+		{topic: "org/8/doc/3", ok: false},
+		{topic: fmt.Sprintf("user/%d/drafts", s.FakeUser.ID), ok: true},
+		{topic: fmt.Sprintf("user/%d", s.FakeUser.ID+1), ok: false},
+		{topic: "org/abc", ok: false},
+		{topic: "lobby", ok: false},
+		{topic: "room/1", ok: false},
+	}
+	for _, tc := range tests {
+		err := authorize(context.Background(), tc.topic)
+		assert.Equal(s.T(), tc.ok, err == nil, tc.topic)
+	}
+}
+
+func (s *controllerTestSuite) Test_handleRealtime_requires_upgrade() {
+	m := new(mockUserRepo)
+	m.On("GetUserByEmail", mock.Anything, mock.Anything, mock.Anything, "logged-in@example.com").Return(s.FakeUser, nil)
+	con := &Controller{userRepo: m}
+
+	e := echo.New()
+	recorder := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, realtimePath, nil), recorder)
+	c.Set(authContextKey, s.Token) // fake authentication
+
+	assert.NoError(s.T(), con.handleRealtime(c))
+	assert.Equal(s.T(), http.StatusBadRequest, recorder.Code)
+}
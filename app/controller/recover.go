@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/metrics"
+	"github.com/drmaples/starter-app/app/reporting"
+)
+
+// recoverMiddleware turns a panic serving a request into a 500 problem. the panic is logged with its stack,
+// counted and sent to the error reporter
+func (con *Controller) recoverMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			// the handler's way of aborting a response, net/http handles it
+			if r == http.ErrAbortHandler { //nolint:errorlint // compared as a panic value, not an error chain
+				panic(r)
+			}
+
+			panicErr, ok := r.(error)
+			if !ok {
+				panicErr = errors.New(fmt.Sprint(r))
+			}
+			req := c.Request()
+			ctx := req.Context()
+			// the jwt key is a secret the server always has, as for invite tokens
+			ev := reporting.NewEvent(ctx, panicErr, reporting.PanicStack(), con.cfg.JWTSignKey)
+			ev.Type = fmt.Sprintf("%T", r)
+			ev.Method, ev.Route, ev.Path = req.Method, c.Path(), req.URL.Path
+
+			stack := make([]string, len(ev.Stack))
+			for i, f := range ev.Stack {
+				stack[len(stack)-1-i] = f.String() // innermost first, as go prints stacks
+			}
+			slog.ErrorContext(ctx, "recovered from panic",
+				slog.String("error", panicErr.Error()),
+				slog.String("event_id", ev.ID),
+				slog.Any("stack", stack),
+			)
+			metrics.ObservePanic(c.Path())
+			if con.reporter != nil {
+				if rerr := con.reporter.Report(ctx, ev); rerr != nil {
+					slog.ErrorContext(ctx, "problem reporting panic", slog.String("event_id", ev.ID), slog.Any("error", rerr))
+				}
+			}
+
+			err = echo.NewHTTPError(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)).SetInternal(panicErr)
+		}()
+		return next(c)
+	}
+}
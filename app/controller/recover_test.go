@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drmaples/starter-app/app/dto"
+	"github.com/drmaples/starter-app/app/reporting"
+)
+
+type fakeReporter struct {
+	events []reporting.Event
+}
+
+func (r *fakeReporter) Report(_ context.Context, e reporting.Event) error {
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (s *controllerTestSuite) Test_recoverMiddleware() {
+	reporter := &fakeReporter{}
+	con := &Controller{reporter: reporter}
+	e := echo.New()
+	e.HTTPErrorHandler = con.httpErrorHandler
+	e.Use(requestIDMiddleware, con.recoverMiddleware)
+	e.GET("/v1/user/:id", func(_ echo.Context) error {
+		var u *dto.User
+		return json.NewEncoder(nil).Encode(u.Email) // nil pointer dereference
+	})
+	e.GET("/abort", func(_ echo.Context) error {
+		panic(http.ErrAbortHandler)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/user/1?token=secret", nil)
+	req.Header.Set(echo.HeaderXRequestID, "req-1")
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, req)
+
+	assert.Equal(s.T(), http.StatusInternalServerError, recorder.Code)
+	var actual dto.Problem
+	assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &actual))
+	assert.Equal(s.T(), dto.Problem{
+		Type:      "urn:problem-type:starter-app:internal",
+		Title:     "Internal Server Error",
+		Status:    http.StatusInternalServerError,
+		Detail:    "Internal Server Error",
+		Instance:  "/v1/user/1",
+		Code:      "internal",
+		RequestID: "req-1",
+	}, actual, "no panic details for the caller")
+
+	assert.Len(s.T(), reporter.events, 1)
+	ev := reporter.events[0]
+	assert.Equal(s.T(), "req-1", ev.RequestID)
+	assert.Equal(s.T(), "/v1/user/:id", ev.Route)
+	assert.Equal(s.T(), http.MethodGet, ev.Method)
+	assert.Equal(s.T(), "/v1/user/1", ev.Path, "the query is not reported")
+	assert.Equal(s.T(), "runtime.errorString", ev.Type)
+	assert.Contains(s.T(), ev.Message, "nil pointer dereference")
+	assert.NotEmpty(s.T(), ev.Stack)
+
+	assert.Panics(s.T(), func() {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abort", nil))
+	}, "aborted responses are left to net/http")
+}
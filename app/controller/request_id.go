@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"regexp"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"github.com/drmaples/starter-app/app/logging"
+)
+
+// requestIDRE is what an incoming X-Request-ID must look like to be kept, anything else is replaced so callers
+// cannot put arbitrary text in logs
+var requestIDRE = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestIDMiddleware gives every request an id, the caller's X-Request-ID when it sends one. the id is returned in
+// the X-Request-ID response header and error bodies, and logged with every slog call made with the request's ctx
+func requestIDMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		id := req.Header.Get(echo.HeaderXRequestID)
+		if !requestIDRE.MatchString(id) {
+			id = uuid.NewString()
+		}
+		c.Response().Header().Set(echo.HeaderXRequestID, id)
+		c.SetRequest(req.WithContext(logging.WithRequestID(req.Context(), id)))
+		return next(c)
+	}
+}
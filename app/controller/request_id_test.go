@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drmaples/starter-app/app/apperr"
+	"github.com/drmaples/starter-app/app/dto"
+	"github.com/drmaples/starter-app/app/logging"
+)
+
+func (s *controllerTestSuite) Test_requestIDMiddleware() {
+	con := &Controller{}
+	e := echo.New()
+	e.HTTPErrorHandler = con.httpErrorHandler
+	e.Use(requestIDMiddleware)
+	var seen string
+	e.GET("/ok", func(c echo.Context) error {
+		seen = logging.RequestID(c.Request().Context())
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/bad", func(c echo.Context) error {
+		return con.sendError(c, apperr.BadRequest("bad input"))
+	})
+	e.GET("/denied", func(_ echo.Context) error {
+		return echo.NewHTTPError(http.StatusUnauthorized, "missing or malformed jwt")
+	})
+
+	serve := func(path string, incoming string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if incoming != "" {
+			req.Header.Set(echo.HeaderXRequestID, incoming)
+		}
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	s.Run("honors_incoming", func() {
+		recorder := serve("/ok", "caller-id.1")
+		assert.Equal(s.T(), "caller-id.1", recorder.Header().Get(echo.HeaderXRequestID))
+		assert.Equal(s.T(), "caller-id.1", seen)
+	})
+
+	s.Run("replaces_invalid", func() {
+		recorder := serve("/ok", "has spaces\nand newline")
+		id := recorder.Header().Get(echo.HeaderXRequestID)
+		assert.Regexp(s.T(), requestIDRE, id)
+		assert.NotEqual(s.T(), "has spaces\nand newline", id)
+		assert.Equal(s.T(), id, seen)
+	})
+
+	s.Run("generated_when_missing", func() {
+		first := serve("/ok", "").Header().Get(echo.HeaderXRequestID)
+		second := serve("/ok", "").Header().Get(echo.HeaderXRequestID)
+		assert.NotEmpty(s.T(), first)
+		assert.NotEqual(s.T(), first, second)
+	})
+
+	s.Run("error_bodies", func() {
+		for path, code := range map[string]int{"/bad": http.StatusBadRequest, "/denied": http.StatusUnauthorized} {
+			recorder := serve(path, "req-1")
+			assert.Equal(s.T(), code, recorder.Code, path)
+			var actual dto.Problem
+			assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &actual))
+			assert.Equal(s.T(), "req-1", actual.RequestID, path)
+			assert.NotEmpty(s.T(), actual.Detail, path)
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+
+	"github.com/drmaples/starter-app/app/compress"
+	"github.com/drmaples/starter-app/app/platform"
+	"github.com/drmaples/starter-app/app/ratelimit"
+)
+
+// apiPrefix is where the api routes live, they get their own body limit
+const apiPrefix = "/v1"
+
+// httpMiddleware is cors, security headers, body limits and compression as configured, in the order they run
+func httpMiddleware(cfg platform.HTTPConfig) []echo.MiddlewareFunc {
+	var res []echo.MiddlewareFunc
+	// answers preflight requests ahead of the rest of these and of any route's own middleware, e.g. jwt. the request
+	// id, tracing, logging, metrics and recover middleware registered before it still see them
+	if len(cfg.CORSAllowedOrigins) > 0 {
+		res = append(res, middleware.CORSWithConfig(middleware.CORSConfig{
+			AllowOrigins:     cfg.CORSAllowedOrigins,
+			AllowCredentials: cfg.CORSAllowCredentials,
+			MaxAge:           int(cfg.CORSMaxAge.Seconds()),
+			AllowMethods:     []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete},
+			AllowHeaders: []string{
+				echo.HeaderContentType, echo.HeaderAccept, "x-jwt", echo.HeaderXRequestID, headerReadYourWrites, "Last-Event-ID",
+			},
+			// readable by browser scripts
+			ExposeHeaders: []string{
+				echo.HeaderXRequestID, echo.HeaderRetryAfter,
+				ratelimit.HeaderLimit, ratelimit.HeaderRemaining, ratelimit.HeaderReset, ratelimit.HeaderPolicy,
+			},
+		}))
+	}
+
+	res = append(res,
+		middleware.SecureWithConfig(middleware.SecureConfig{
+			XSSProtection:      "0", // the browser filter it turns on is gone or did more harm than good, csp covers it
+			ContentTypeNosniff: "nosniff",
+			XFrameOptions:      cfg.FrameOptions,
+			HSTSMaxAge:         int(cfg.HSTSMaxAge.Seconds()),
+			ReferrerPolicy:     "no-referrer",
+		}),
+		middleware.SecureWithConfig(middleware.SecureConfig{
+			// swagger ui is built from inline scripts and styles
+			Skipper:               func(c echo.Context) bool { return strings.HasPrefix(c.Path(), "/swagger/") },
+			ContentSecurityPolicy: cfg.ContentSecurityPolicy,
+		}),
+		bodyLimitMiddleware(cfg.BodyLimit, cfg.APIBodyLimit),
+	)
+
+	if cfg.CompressionEnabled {
+		res = append(res, compress.Middleware(compress.Options{
+			MinLength: cfg.CompressionMinLength,
+			Skipper:   isStream,
+		}))
+	}
+	return res
+}
+
+// ipExtractor finds the client's address, which rate limits and the audit log go by. echo's default believes
+// X-Forwarded-For and X-Real-IP from anyone, so a client could send a new address with every request
+func ipExtractor(cfg platform.HTTPConfig) echo.IPExtractor {
+	if len(cfg.TrustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	opts := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, p := range cfg.TrustedProxies {
+		p = p.Masked()
+		opts = append(opts, echo.TrustIPRange(&net.IPNet{
+			IP:   p.Addr().AsSlice(),
+			Mask: net.CIDRMask(p.Bits(), p.Addr().BitLen()),
+		}))
+	}
+	return echo.ExtractIPFromXFFHeader(opts...)
+}
+
+// fromTrustedProxy reports whether req was sent straight from one of the trusted proxies
+func fromTrustedProxy(req *http.Request, proxies []netip.Prefix) bool {
+	ap, err := netip.ParseAddrPort(req.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := ap.Addr().Unmap()
+	for _, p := range proxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyLimitMiddleware rejects request bodies over apiLimit for api routes and over limit for the rest with 413
+func bodyLimitMiddleware(limit string, apiLimit string) echo.MiddlewareFunc {
+	other := middleware.BodyLimit(limit)
+	api := middleware.BodyLimit(apiLimit)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		otherNext, apiNext := other(next), api(next)
+		return func(c echo.Context) error {
+			if strings.HasPrefix(c.Path(), apiPrefix+"/") {
+				return apiNext(c)
+			}
+			return otherNext(c)
+		}
+	}
+}
+
+// isStream is whether a request is for a route that stays open for as long as the client is connected
+func isStream(c echo.Context) bool {
+	return c.Path() == eventStreamPath || c.Path() == realtimePath
+}
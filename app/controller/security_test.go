@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drmaples/starter-app/app/platform"
+)
+
+func (s *controllerTestSuite) Test_httpMiddleware() {
+	e := echo.New()
+	e.Use(httpMiddleware(platform.HTTPConfig{
+		CORSAllowedOrigins:    []string{"https://app.example.com"},
+		CORSMaxAge:            10 * time.Minute,
+		HSTSMaxAge:            time.Hour,
+		ContentSecurityPolicy: "default-src 'self'",
+		FrameOptions:          "DENY",
+		BodyLimit:             "10B",
+		APIBodyLimit:          "1K",
+	})...)
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.POST("/login", ok)
+	e.POST("/v1/user", ok)
+	e.GET("/swagger/*", ok)
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	s.Run("security_headers", func() {
+		req := httptest.NewRequest(http.MethodPost, "/v1/user", nil)
+		req.Header.Set(echo.HeaderXForwardedProto, "https")
+		h := serve(req).Header()
+		assert.Equal(s.T(), "nosniff", h.Get(echo.HeaderXContentTypeOptions))
+		assert.Equal(s.T(), "DENY", h.Get(echo.HeaderXFrameOptions))
+		assert.Equal(s.T(), "max-age=3600; includeSubdomains", h.Get(echo.HeaderStrictTransportSecurity))
+		assert.Equal(s.T(), "default-src 'self'", h.Get(echo.HeaderContentSecurityPolicy))
+
+		h = serve(httptest.NewRequest(http.MethodGet, "/swagger/index.html", nil)).Header()
+		assert.Empty(s.T(), h.Get(echo.HeaderStrictTransportSecurity), "hsts over https only")
+		assert.Empty(s.T(), h.Get(echo.HeaderContentSecurityPolicy), "swagger ui needs inline scripts")
+		assert.Equal(s.T(), "nosniff", h.Get(echo.HeaderXContentTypeOptions))
+	})
+
+	s.Run("cors", func() {
+		req := httptest.NewRequest(http.MethodOptions, "/v1/user", nil)
+		req.Header.Set(echo.HeaderOrigin, "https://app.example.com")
+		req.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodPost)
+		recorder := serve(req)
+		assert.Equal(s.T(), http.StatusNoContent, recorder.Code)
+		assert.Equal(s.T(), "https://app.example.com", recorder.Header().Get(echo.HeaderAccessControlAllowOrigin))
+		assert.Equal(s.T(), "600", recorder.Header().Get(echo.HeaderAccessControlMaxAge))
+		assert.Contains(s.T(), recorder.Header().Get(echo.HeaderAccessControlAllowHeaders), "x-jwt")
+
+		req = httptest.NewRequest(http.MethodPost, "/v1/user", nil)
+		req.Header.Set(echo.HeaderOrigin, "https://evil.example.com")
+		assert.Empty(s.T(), serve(req).Header().Get(echo.HeaderAccessControlAllowOrigin))
+	})
+
+	s.Run("body_limits", func() {
+		body := strings.Repeat("x", 100)
+		assert.Equal(s.T(), http.StatusRequestEntityTooLarge, serve(httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))).Code)
+		assert.Equal(s.T(), http.StatusOK, serve(httptest.NewRequest(http.MethodPost, "/v1/user", strings.NewReader(body))).Code, "api routes have their own limit")
+		body = strings.Repeat("x", 2000)
+		assert.Equal(s.T(), http.StatusRequestEntityTooLarge, serve(httptest.NewRequest(http.MethodPost, "/v1/user", strings.NewReader(body))).Code)
+	})
+}
+
+func (s *controllerTestSuite) Test_ipExtractor() {
+	newReq := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.1.2.3:4567"
+		req.Header.Set(echo.HeaderXForwardedFor, "203.0.113.9")
+		req.Header.Set(echo.HeaderXRealIP, "203.0.113.10")
+		return req
+	}
+
+	s.Run("no_trusted_proxies", func() {
+		assert.Equal(s.T(), "10.1.2.3", ipExtractor(platform.HTTPConfig{})(newReq()), "client headers are ignored")
+	})
+
+	s.Run("trusted_proxy", func() {
+		extract := ipExtractor(platform.HTTPConfig{TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}})
+		assert.Equal(s.T(), "203.0.113.9", extract(newReq()))
+	})
+
+	s.Run("untrusted_proxy", func() {
+		extract := ipExtractor(platform.HTTPConfig{TrustedProxies: []netip.Prefix{netip.MustParsePrefix("192.168.0.0/16")}})
+		assert.Equal(s.T(), "10.1.2.3", extract(newReq()))
+	})
+}
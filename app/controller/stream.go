@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/apperr"
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+const (
+	eventStreamPath     = "/v1/events"
+	headerLastEventID   = "Last-Event-ID"
+	eventReplayPageSize = 500
+)
+
+// @Summary		stream user changes
+// @Description	server-sent events stream of user created, updated and deleted events in the caller's tenant, only for admins. each event's id can be sent back as the Last-Event-ID header to resume after a disconnect, from events kept for EVENT_STREAM_RETENTION
+// @Tags		events
+// @Produce		text/event-stream
+// @Security 	ApiKeyAuth
+// @Param 		Last-Event-ID header int false "resume after this event id"
+// @Success		200
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/events [get]
+func (con *Controller) handleEventStream(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var lastID int64
+	v := c.Request().Header.Get(headerLastEventID)
+	resume := v != ""
+	if resume {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 0 {
+			return con.sendError(c, apperr.BadRequest("invalid Last-Event-ID"))
+		}
+		lastID = id
+	}
+	if _, err := con.callerUser(c, con.readDB(ctx)); err != nil {
+		return con.sendError(c, err)
+	}
+
+	// subscribe before replaying so nothing logged in between is missed, duplicates are skipped by id
+	tenant := con.schema(c)
+	sub := con.hub.Subscribe(tenant)
+	defer sub.Close()
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.Header().Set(echo.HeaderConnection, "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // stop proxies such as nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.WriteString(w, ": connected\n\n"); err != nil {
+		return nil
+	}
+	w.Flush()
+
+	if resume {
+		for {
+			entries, err := con.hub.Replay(ctx, tenant, lastID, eventReplayPageSize)
+			if err != nil {
+				// headers are sent, ending the stream makes the client reconnect and try again
+				slog.ErrorContext(ctx, "problem replaying event stream", slog.Any("error", err))
+				return nil
+			}
+			for _, e := range entries {
+				if err := writeSSE(w, e); err != nil {
+					return nil
+				}
+				lastID = e.ID
+			}
+			w.Flush()
+			if len(entries) < eventReplayPageSize {
+				break
+			}
+		}
+	}
+
+	heartbeat := time.NewTicker(con.cfg.Stream.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-sub.C:
+			if !ok {
+				// dropped as too slow or the server is shutting down, the client resumes from lastID
+				return nil
+			}
+			if e.ID <= lastID {
+				continue
+			}
+			if err := writeSSE(w, e); err != nil {
+				return nil
+			}
+			lastID = e.ID
+			w.Flush()
+		case <-heartbeat.C:
+			// keeps idle connections from being closed by proxies
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return nil
+			}
+			w.Flush()
+		}
+	}
+}
+
+// writeSSE writes one event in the text/event-stream format
+func writeSSE(w io.Writer, e repo.EventLogEntry) error {
+	// data must be a single line
+	var data bytes.Buffer
+	if err := json.Compact(&data, e.Payload); err != nil {
+		return errors.Wrap(err, "problem compacting event payload")
+	}
+	if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.EventType, data.Bytes()); err != nil {
+		return errors.Wrap(err, "problem writing event")
+	}
+	return nil
+}
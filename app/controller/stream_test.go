@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/drmaples/starter-app/app/platform"
+	"github.com/drmaples/starter-app/app/repo"
+	"github.com/drmaples/starter-app/app/stream"
+)
+
+type fakeEventLogRepo struct {
+	repo.IEventLogRepo
+	entries []repo.EventLogEntry
+}
+
+func (r *fakeEventLogRepo) ListEvents(_ context.Context, _ repo.Querier, _ string, tenant string, afterID int64, limit int) ([]repo.EventLogEntry, error) {
+	var res []repo.EventLogEntry
+	for _, e := range r.entries {
+		if e.ID > afterID && e.Tenant == tenant && len(res) < limit {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+func (s *controllerTestSuite) Test_handleEventStream() {
+	e := echo.New()
+	evts := &fakeEventLogRepo{entries: []repo.EventLogEntry{
+		{ID: 1, EventType: "user.created", Tenant: repo.DefaultSchema, Payload: []byte(`{"id": "a"}`)},
+		{ID: 2, EventType: "user.updated", Tenant: "tenant_other", Payload: []byte(`{"id": "b"}`)},
+		{ID: 3, EventType: "user.deleted", Tenant: repo.DefaultSchema, Payload: []byte("{\n\"id\": \"c\"\n}")},
+	}}
+
+	newCon := func() *Controller {
+		m := new(mockUserRepo)
+		m.On("GetUserByEmail", mock.Anything, mock.Anything, mock.Anything, "logged-in@example.com").Return(s.FakeUser, nil)
+		return &Controller{
+			e:        e,
+			userRepo: m,
+			hub:      stream.NewHub(nil, evts, stream.HubOptions{}),
+			cfg:      platform.Config{Stream: platform.StreamConfig{Heartbeat: time.Minute}},
+		}
+	}
+	newCtx := func(lastEventID string) (echo.Context, *httptest.ResponseRecorder, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		req := httptest.NewRequest(http.MethodGet, eventStreamPath, nil).WithContext(ctx)
+		if lastEventID != "" {
+			req.Header.Set(headerLastEventID, lastEventID)
+		}
+		recorder := httptest.NewRecorder()
+		c := e.NewContext(req, recorder)
+		c.Set(authContextKey, s.Token) // fake authentication
+		return c, recorder, cancel
+	}
+
+	s.Run("resume", func() {
+		c, recorder, cancel := newCtx("0")
+		cancel() // the client goes away once the backlog is sent
+		assert.NoError(s.T(), newCon().handleEventStream(c))
+
+		assert.Equal(s.T(), http.StatusOK, recorder.Code)
+		assert.Equal(s.T(), "text/event-stream", recorder.Header().Get(echo.HeaderContentType))
+		assert.Equal(s.T(), ": connected\n\n"+
+			"id: 1\nevent: user.created\ndata: {\"id\":\"a\"}\n\n"+
+			"id: 3\nevent: user.deleted\ndata: {\"id\":\"c\"}\n\n",
+			recorder.Body.String())
+	})
+
+	s.Run("resume_after_last_seen", func() {
+		c, recorder, cancel := newCtx("1")
+		cancel()
+		assert.NoError(s.T(), newCon().handleEventStream(c))
+		assert.NotContains(s.T(), recorder.Body.String(), "id: 1\n")
+		assert.Contains(s.T(), recorder.Body.String(), "id: 3\n")
+	})
+
+	s.Run("no_resume", func() {
+		c, recorder, cancel := newCtx("")
+		cancel()
+		assert.NoError(s.T(), newCon().handleEventStream(c))
+		assert.Equal(s.T(), ": connected\n\n", recorder.Body.String())
+	})
+
+	s.Run("invalid_last_event_id", func() {
+		c, recorder, cancel := newCtx("abc")
+		defer cancel()
+		assert.NoError(s.T(), newCon().handleEventStream(c))
+		assert.Equal(s.T(), http.StatusBadRequest, recorder.Code)
+	})
+}
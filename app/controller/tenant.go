@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"log/slog"
+	"net"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/apperr"
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+const tenantSchemaContextKey = "tenant_schema"
+
+// tenantMiddleware resolves the tenant for the request and stores its postgres schema in the echo context.
+// it must run after jwt auth since the tenant may come from a claim
+func (con *Controller) tenantMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !con.cfg.Tenant.Enabled {
+			return next(c)
+		}
+		ctx := c.Request().Context()
+
+		tenant, err := con.resolveTenant(c)
+		if err != nil {
+			return con.sendError(c, apperr.Forbidden(err.Error()))
+		}
+		schema, err := repo.TenantSchema(tenant)
+		if err != nil {
+			return con.sendError(c, apperr.BadRequest(err.Error()))
+		}
+
+		if con.tenants != nil {
+			if err := con.tenants.Ensure(ctx, schema); err != nil {
+				if errors.Is(err, repo.ErrUnknownTenant) {
+					return con.sendError(c, apperr.NotFound("unknown tenant"))
+				}
+				return con.sendError(c, err)
+			}
+		}
+
+		slog.DebugContext(ctx, "resolved tenant", slog.String("tenant", tenant), slog.String("schema", schema))
+		c.Set(tenantSchemaContextKey, schema)
+		return next(c)
+	}
+}
+
+// resolveTenant uses the jwt domain claim. the request subdomain, when there is one, must agree so a token for one
+// tenant cannot be used against another tenant's host. the host alone never picks the tenant, anyone can send it
+func (con *Controller) resolveTenant(c echo.Context) (string, error) {
+	var claimTenant string
+	if claims, err := con.extractClaims(c); err == nil {
+		claimTenant = strings.ToLower(claims.Domain)
+	}
+	hostTenant := subdomainTenant(c.Request().Host, con.cfg.Tenant.BaseDomain)
+
+	switch {
+	case claimTenant == "":
+		return "", errors.New("token has no tenant")
+	case hostTenant != "" && claimTenant != hostTenant:
+		return "", errors.New("token tenant does not match host")
+	default:
+		return claimTenant, nil
+	}
+}
+
+// subdomainTenant returns "acme" for host "acme.example.com" and base domain "example.com"
+func subdomainTenant(host string, baseDomain string) string {
+	if baseDomain == "" {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	suffix := "." + strings.ToLower(baseDomain)
+	if !strings.HasSuffix(host, suffix) {
+		return ""
+	}
+	return strings.TrimSuffix(host, suffix)
+}
+
+// hostSchema resolves the schema for routes outside the jwt protected group, where only the host can identify
+// the tenant. the host is unauthenticated, so the schema must already exist, it is never provisioned from here
+func (con *Controller) hostSchema(c echo.Context) (string, error) {
+	if !con.cfg.Tenant.Enabled {
+		return repo.DefaultSchema, nil
+	}
+	tenant := subdomainTenant(c.Request().Host, con.cfg.Tenant.BaseDomain)
+	if tenant == "" {
+		return "", errors.New("no tenant for request")
+	}
+	schema, err := repo.TenantSchema(tenant)
+	if err != nil {
+		return "", err
+	}
+	if con.tenants != nil {
+		if err := con.tenants.Check(c.Request().Context(), schema); err != nil {
+			return "", err
+		}
+	}
+	return schema, nil
+}
+
+// schema returns the postgres schema for the request's tenant
+func (con *Controller) schema(c echo.Context) string {
+	if schema, ok := c.Get(tenantSchemaContextKey).(string); ok {
+		return schema
+	}
+	return repo.DefaultSchema
+}
@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drmaples/starter-app/app/platform"
+)
+
+func (s *controllerTestSuite) Test_resolveTenant() {
+	e := echo.New()
+	con := Controller{cfg: platform.Config{Tenant: platform.TenantConfig{Enabled: true, BaseDomain: "example.com"}}}
+	resolve := func(host string, domain string) (string, error) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = host
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.Set(authContextKey, newToken("logged-in@example.com", "first last", domain, time.Minute))
+		return con.resolveTenant(c)
+	}
+
+	tenant, err := resolve("api.local", "acme")
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "acme", tenant)
+
+	tenant, err = resolve("acme.example.com", "ACME")
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "acme", tenant)
+
+	_, err = resolve("other.example.com", "acme")
+	assert.ErrorContains(s.T(), err, "does not match")
+
+	// the host alone is unauthenticated and never picks the tenant
+	_, err = resolve("acme.example.com", "")
+	assert.ErrorContains(s.T(), err, "no tenant")
+}
@@ -1,13 +1,18 @@
 package controller
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
 
+	"github.com/drmaples/starter-app/app/apperr"
 	"github.com/drmaples/starter-app/app/dto"
+	"github.com/drmaples/starter-app/app/events"
+	"github.com/drmaples/starter-app/app/metrics"
 	"github.com/drmaples/starter-app/app/repo"
 )
 
@@ -15,27 +20,27 @@ type userRoute struct {
 	ID int `param:"id"`
 }
 
-// @Summary		list all users
-// @Description	list all users
+// @Summary		list users
+// @Description	list users sharing an organization with the caller
 // @Tags		users
 // @Accept		json
 // @Produce		json
 // @Security 	ApiKeyAuth
 // @Success		200	{object}	[]dto.User
-// @Failure		401	{object}	dto.ErrorResponse
-// @Failure		500	{object}	dto.ErrorResponse
+// @Failure		401	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
 // @Router		/v1/user [get]
 func (con *Controller) handleListUsers(c echo.Context) error {
 	ctx := c.Request().Context()
 
-	_, err := con.extractUser(c)
+	email, err := con.extractUser(c)
 	if err != nil {
-		return c.JSON(http.StatusUnauthorized, dto.NewErrorResp(err.Error()))
+		return con.sendError(c, unauthenticated(err))
 	}
 
-	users, err := con.userRepo.ListUsers(ctx, con.db, repo.DefaultSchema)
+	users, err := con.userRepo.ListUsersByOrgMember(ctx, con.readDB(ctx), con.schema(c), email)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, dto.NewErrorResp(err.Error()))
+		return con.sendError(c, err)
 	}
 
 	var res dto.User
@@ -43,40 +48,38 @@ func (con *Controller) handleListUsers(c echo.Context) error {
 }
 
 // @Summary		get user by id
-// @Description	get user by id
+// @Description	get the caller or a user sharing an organization with them
 // @Tags		users
 // @Accept		json
 // @Produce		json
 // @Security 	ApiKeyAuth
 // @Param 		id path int true "user id"
 // @Success		200	{object}	dto.User
-// @Failure		400	{object}	dto.ErrorResponse
-// @Failure		401	{object}	dto.ErrorResponse
-// @Failure		404	{object}	dto.ErrorResponse
-// @Failure		500	{object}	dto.ErrorResponse
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
 // @Router		/v1/user/{id} [get]
 func (con *Controller) handleGetUser(c echo.Context) error {
 	ctx := c.Request().Context()
 
-	qs := c.QueryParam("xxx")
-
 	var ur userRoute
 	if err := c.Bind(&ur); err != nil {
-		return c.JSON(http.StatusBadRequest, dto.NewErrorResp("invalid type for user id"))
+		return con.sendError(c, apperr.BadRequest("invalid type for user id"))
 	}
 
-	slog.InfoContext(ctx, "calling get user",
-		slog.String("qs", qs),
-		slog.Group("user",
-			slog.Int("id", ur.ID),
-		),
-	)
+	email, err := con.extractUser(c)
+	if err != nil {
+		return con.sendError(c, unauthenticated(err))
+	}
 
-	u, err := con.userRepo.GetUserByID(ctx, con.db, repo.DefaultSchema, ur.ID)
+	// users outside the caller's orgs get the same 404 as ones that do not exist, see handleListUsers
+	u, err := con.userRepo.GetUserByOrgMember(ctx, con.readDB(ctx), con.schema(c), email, ur.ID)
 	if err != nil {
 		if errors.Is(err, repo.ErrNoRowsFound) {
-			return c.JSON(http.StatusNotFound, dto.NewErrorResp("no user for given id"))
+			return con.sendError(c, apperr.NotFound("no user for given id"))
 		}
+		return con.sendError(c, err)
 	}
 
 	var res dto.User
@@ -91,39 +94,38 @@ func (con *Controller) handleGetUser(c echo.Context) error {
 // @Security 	ApiKeyAuth
 // @Param 		data body dto.CreateUser true "data"
 // @Success		200	{object}	dto.User
-// @Failure		400	{object}	dto.ErrorResponse
-// @Failure		401	{object}	dto.ErrorResponse
-// @Failure		404	{object}	dto.ErrorResponse
-// @Failure		500	{object}	dto.ErrorResponse
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
 // @Router		/v1/user [post]
 func (con *Controller) handleCreateUser(c echo.Context) error {
 	ctx := c.Request().Context()
 
 	var u dto.CreateUser
 	if err := c.Bind(&u); err != nil {
-		return c.JSON(http.StatusBadRequest, dto.NewErrorResp(err.Error()))
+		return con.sendError(c, err)
 	}
 	if err := c.Validate(u); err != nil {
-		return c.JSON(http.StatusBadRequest, dto.NewErrorResp(err.Error()))
+		return con.sendError(c, apperr.Validation(err))
 	}
 
-	tx, err := con.db.BeginTx(ctx, nil)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, dto.NewErrorResp(err.Error()))
-	}
-
-	newUser, err := con.userRepo.CreateUser(ctx, tx, repo.DefaultSchema, u.Model())
-	if err != nil {
-		if err := tx.Rollback(); err != nil {
-			err := errors.Wrap(err, "problem rolling back transaction")
-			return c.JSON(http.StatusInternalServerError, dto.NewErrorResp(err.Error()))
+	var newUser *repo.User
+	if err := repo.WithTx(ctx, con.db, nil, func(tx repo.Querier) error {
+		var err error
+		newUser, err = con.userRepo.CreateUser(ctx, tx, con.schema(c), u.Model())
+		if err != nil {
+			return err
 		}
-		return c.JSON(http.StatusInternalServerError, dto.NewErrorResp(err.Error()))
-	}
-	if err := tx.Commit(); err != nil {
-		err := errors.Wrap(err, "problem committing transaction")
-		return c.JSON(http.StatusInternalServerError, dto.NewErrorResp(err.Error()))
+		if err := con.recordUserCreated(ctx, tx, con.schema(c), *newUser); err != nil {
+			return err
+		}
+		var res dto.User
+		return con.auditTx(c, tx, http.StatusOK, auditDetail{Resource: "user", ResourceID: newUser.ID, After: res.FromModel(*newUser)})
+	}); err != nil {
+		return con.sendError(c, err)
 	}
+	metrics.ObserveUserCreated(metrics.UserSourceAPI)
 
 	slog.InfoContext(ctx, "added new user",
 		slog.Group("user",
@@ -134,3 +136,220 @@ func (con *Controller) handleCreateUser(c echo.Context) error {
 	var res dto.User
 	return c.JSON(http.StatusOK, res.FromModel(*newUser))
 }
+
+// @Summary		update user
+// @Description	update the caller's own user
+// @Tags		users
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		id path int true "user id"
+// @Param 		data body dto.UpdateUser true "data"
+// @Success		200	{object}	dto.User
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/user/{id} [put]
+func (con *Controller) handleUpdateUser(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var ur userRoute
+	if err := bindPathParams(c, &ur); err != nil {
+		return con.sendError(c, apperr.BadRequest("invalid type for user id"))
+	}
+	var u dto.UpdateUser
+	if err := c.Bind(&u); err != nil {
+		return con.sendError(c, err)
+	}
+	if err := c.Validate(u); err != nil {
+		return con.sendError(c, apperr.Validation(err))
+	}
+
+	var before, updated *repo.User
+	if err := repo.WithTx(ctx, con.db, nil, func(tx repo.Querier) error {
+		caller, err := con.callerUser(c, tx)
+		if err != nil {
+			return err
+		}
+		if caller.ID != ur.ID {
+			return apperr.Forbidden("can only update your own user")
+		}
+		before, err = con.userRepo.GetUserByID(ctx, tx, con.schema(c), ur.ID)
+		if err != nil {
+			return err
+		}
+		updated, err = con.userRepo.UpdateUser(ctx, tx, con.schema(c), u.Model(ur.ID))
+		if err != nil {
+			return err
+		}
+		if err := events.Record(ctx, tx, con.outboxRepo, events.TypeUserUpdated, con.schema(c), userSubject(ur.ID),
+			events.NewUserUpdated(*before, *updated)); err != nil {
+			return err
+		}
+		var res dto.User
+		return con.auditTx(c, tx, http.StatusOK, auditDetail{Resource: "user", Before: res.FromModel(*before), After: res.FromModel(*updated)})
+	}); err != nil {
+		if errors.Is(err, repo.ErrNoRowsFound) {
+			return con.sendError(c, apperr.NotFound("no user for given id"))
+		}
+		return con.sendError(c, err)
+	}
+
+	slog.InfoContext(ctx, "updated user",
+		slog.Group("user",
+			slog.Int("id", updated.ID),
+		),
+	)
+
+	var res dto.User
+	return c.JSON(http.StatusOK, res.FromModel(*updated))
+}
+
+// @Summary		delete user
+// @Description	delete the caller's own user. refused while they are the only owner of an organization
+// @Tags		users
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		id path int true "user id"
+// @Success		204
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		409	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/user/{id} [delete]
+func (con *Controller) handleDeleteUser(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var ur userRoute
+	if err := c.Bind(&ur); err != nil {
+		return con.sendError(c, apperr.BadRequest("invalid type for user id"))
+	}
+
+	var before *repo.User
+	if err := repo.WithTx(ctx, con.db, nil, func(tx repo.Querier) error {
+		caller, err := con.callerUser(c, tx)
+		if err != nil {
+			return err
+		}
+		if caller.ID != ur.ID {
+			return apperr.Forbidden("can only delete your own user")
+		}
+		before, err = con.userRepo.GetUserByID(ctx, tx, con.schema(c), ur.ID)
+		if err != nil {
+			return err
+		}
+		// memberships go with the user, which must not leave an org without an owner, see checkOwnerChange
+		orgIDs, err := con.orgRepo.LockOwnedOrgs(ctx, tx, con.schema(c), ur.ID)
+		if err != nil {
+			return err
+		}
+		for _, orgID := range orgIDs {
+			owners, err := con.countOwners(c, tx, orgID)
+			if err != nil {
+				return err
+			}
+			if owners <= 1 {
+				return errSoleOwner
+			}
+		}
+		if err := con.userRepo.DeleteUser(ctx, tx, con.schema(c), ur.ID); err != nil {
+			return err
+		}
+		if err := events.Record(ctx, tx, con.outboxRepo, events.TypeUserDeleted, con.schema(c), userSubject(ur.ID),
+			events.UserDeleted{User: events.UserFromModel(*before)}); err != nil {
+			return err
+		}
+		var res dto.User
+		return con.auditTx(c, tx, http.StatusNoContent, auditDetail{Resource: "user", Before: res.FromModel(*before)})
+	}); err != nil {
+		if errors.Is(err, repo.ErrNoRowsFound) {
+			return con.sendError(c, apperr.NotFound("no user for given id"))
+		}
+		return con.sendError(c, err)
+	}
+
+	slog.InfoContext(ctx, "deleted user",
+		slog.Group("user",
+			slog.Int("id", ur.ID),
+		),
+	)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary		user history
+// @Description	every version of a user, oldest first, including the delete of a deleted user. with as_of only the version current at that time is returned. only for the caller, users sharing an organization with them, or admins, who can also read deleted users
+// @Tags		users
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		id path int true "user id"
+// @Param 		as_of query string false "RFC3339 time to read the user as of"
+// @Success		200	{object}	[]dto.UserRevision
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/user/{id}/history [get]
+func (con *Controller) handleGetUserHistory(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var ur userRoute
+	if err := bindPathParams(c, &ur); err != nil {
+		return con.sendError(c, apperr.BadRequest("invalid type for user id"))
+	}
+	var q dto.UserHistory
+	if err := c.Bind(&q); err != nil {
+		return con.sendError(c, err)
+	}
+
+	email, err := con.extractUser(c)
+	if err != nil {
+		return con.sendError(c, unauthenticated(err))
+	}
+	// the same users as handleGetUser, so deleted users, who share no org with anyone, are only for admins
+	if !con.isAdmin(email) {
+		if _, err := con.userRepo.GetUserByOrgMember(ctx, con.readDB(ctx), con.schema(c), email, ur.ID); err != nil {
+			if errors.Is(err, repo.ErrNoRowsFound) {
+				return con.sendError(c, apperr.NotFound("no user for given id"))
+			}
+			return con.sendError(c, err)
+		}
+	}
+
+	var res dto.UserRevision
+	if !q.AsOf.IsZero() {
+		rev, err := con.userRepo.GetUserAsOf(ctx, con.readDB(ctx), con.schema(c), ur.ID, q.AsOf)
+		if err != nil {
+			if errors.Is(err, repo.ErrNoRowsFound) {
+				return con.sendError(c, apperr.NotFound("no user for given id at that time"))
+			}
+			return con.sendError(c, err)
+		}
+		return c.JSON(http.StatusOK, []dto.UserRevision{res.FromModel(*rev)})
+	}
+
+	revs, err := con.userRepo.ListUserRevisions(ctx, con.readDB(ctx), con.schema(c), ur.ID)
+	if err != nil {
+		return con.sendError(c, err)
+	}
+	if len(revs) == 0 {
+		return con.sendError(c, apperr.NotFound("no user for given id"))
+	}
+	return c.JSON(http.StatusOK, res.FromModels(revs))
+}
+
+func userSubject(userID int) string {
+	return fmt.Sprintf("user/%d", userID)
+}
+
+// recordUserCreated adds a user.created event to the outbox as part of tx
+func (con *Controller) recordUserCreated(ctx context.Context, tx repo.Querier, schema string, u repo.User) error {
+	return events.Record(ctx, tx, con.outboxRepo, events.TypeUserCreated, schema, userSubject(u.ID),
+		events.UserCreated{User: events.UserFromModel(u)})
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/stretchr/testify/suite"
 
 	"github.com/drmaples/starter-app/app/dto"
+	"github.com/drmaples/starter-app/app/platform"
 	"github.com/drmaples/starter-app/app/repo"
 )
 
@@ -32,6 +33,30 @@ func (m *mockUserRepo) GetUserByID(_ context.Context, _ repo.Querier, _ string,
 	return args.Get(0).(*repo.User), args.Error(1)
 }
 
+func (m *mockUserRepo) GetUserByEmail(_ context.Context, _ repo.Querier, _ string, email string) (*repo.User, error) {
+	args := m.Called(mock.Anything, mock.Anything, mock.Anything, email)
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repo.User), args.Error(1)
+}
+
+func (m *mockUserRepo) ListUsersByOrgMember(_ context.Context, _ repo.Querier, _ string, memberEmail string) ([]repo.User, error) {
+	args := m.Called(mock.Anything, mock.Anything, mock.Anything, memberEmail)
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]repo.User), args.Error(1)
+}
+
+func (m *mockUserRepo) GetUserByOrgMember(_ context.Context, _ repo.Querier, _ string, memberEmail string, userID int) (*repo.User, error) {
+	args := m.Called(memberEmail, userID)
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repo.User), args.Error(1)
+}
+
 func (m *mockUserRepo) ListUsers(_ context.Context, _ repo.Querier, _ string) ([]repo.User, error) {
 	args := m.Called()
 	if args.Error(1) != nil {
@@ -50,6 +75,34 @@ func (m *mockUserRepo) CreateUser(_ context.Context, _ repo.Querier, _ string, _
 	return &newUser, args.Error(1)
 }
 
+func (m *mockUserRepo) UpdateUser(_ context.Context, _ repo.Querier, _ string, u repo.User) (*repo.User, error) {
+	args := m.Called(mock.Anything, mock.Anything, mock.Anything, u)
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repo.User), args.Error(1)
+}
+
+func (m *mockUserRepo) DeleteUser(_ context.Context, _ repo.Querier, _ string, userID int) error {
+	return m.Called(userID).Error(0)
+}
+
+func (m *mockUserRepo) GetUserAsOf(_ context.Context, _ repo.Querier, _ string, userID int, at time.Time) (*repo.UserRevision, error) {
+	args := m.Called(userID, at)
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repo.UserRevision), args.Error(1)
+}
+
+func (m *mockUserRepo) ListUserRevisions(_ context.Context, _ repo.Querier, _ string, userID int) ([]repo.UserRevision, error) {
+	args := m.Called(userID)
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]repo.UserRevision), args.Error(1)
+}
+
 type controllerTestSuite struct {
 	suite.Suite
 	FakeUser *repo.User
@@ -81,7 +134,7 @@ func (s *controllerTestSuite) Test_handleGetUser_success() {
 	c.SetParamValues(fmt.Sprint(s.FakeUser.ID))
 
 	m := new(mockUserRepo)
-	m.On("GetUserByID", mock.Anything, mock.Anything, mock.Anything, s.FakeUser.ID).Return(s.FakeUser, nil)
+	m.On("GetUserByOrgMember", "logged-in@example.com", s.FakeUser.ID).Return(s.FakeUser, nil)
 
 	con := Controller{e: e, userRepo: m}
 	assert.NoError(s.T(), con.handleGetUser(c))
@@ -105,15 +158,16 @@ func (s *controllerTestSuite) Test_handleGetUser_not_found() {
 	c.SetParamValues(fmt.Sprint(bogusUserID))
 
 	m := new(mockUserRepo)
-	m.On("GetUserByID", mock.Anything, mock.Anything, mock.Anything, bogusUserID).Return(nil, repo.ErrNoRowsFound)
+	m.On("GetUserByOrgMember", "logged-in@example.com", bogusUserID).Return(nil, repo.ErrNoRowsFound)
 
 	con := Controller{e: e, userRepo: m}
 	assert.NoError(s.T(), con.handleGetUser(c))
 	assert.Equal(s.T(), http.StatusNotFound, recorder.Code)
 
-	var actual dto.ErrorResponse
+	var actual dto.Problem
 	assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &actual))
-	assert.Equal(s.T(), actual.Message, "no user for given id")
+	assert.Equal(s.T(), "no user for given id", actual.Detail)
+	assert.Equal(s.T(), "not_found", actual.Code)
 }
 
 func (s *controllerTestSuite) Test_unauthorized() {
@@ -130,9 +184,10 @@ func (s *controllerTestSuite) Test_unauthorized() {
 		assert.NoError(s.T(), con.handleListUsers(c))
 		assert.Equal(s.T(), http.StatusUnauthorized, recorder.Code)
 
-		var actual dto.ErrorResponse
+		var actual dto.Problem
 		assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &actual))
-		assert.Equal(s.T(), "jwt missing", actual.Message)
+		assert.Equal(s.T(), "invalid or expired jwt", actual.Detail, "claim parsing detail is not sent")
+		assert.Equal(s.T(), "unauthorized", actual.Code)
 	})
 
 	s.T().Run("invalid_jwt", func(_ *testing.T) {
@@ -144,9 +199,9 @@ func (s *controllerTestSuite) Test_unauthorized() {
 		assert.NoError(s.T(), con.handleListUsers(c))
 		assert.Equal(s.T(), http.StatusUnauthorized, recorder.Code)
 
-		var actual dto.ErrorResponse
+		var actual dto.Problem
 		assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &actual))
-		assert.Equal(s.T(), "jwt is incorrect type", actual.Message)
+		assert.Equal(s.T(), "invalid or expired jwt", actual.Detail, "claim parsing detail is not sent")
 	})
 }
 
@@ -159,7 +214,7 @@ func (s *controllerTestSuite) Test_handleListUsers_success() {
 	c.SetPath("/v1/user")
 
 	m := new(mockUserRepo)
-	m.On("ListUsers", mock.Anything, mock.Anything, mock.Anything).Return([]repo.User{*s.FakeUser}, nil)
+	m.On("ListUsersByOrgMember", mock.Anything, mock.Anything, mock.Anything, "logged-in@example.com").Return([]repo.User{*s.FakeUser}, nil)
 
 	con := Controller{e: e, userRepo: m}
 	assert.NoError(s.T(), con.handleListUsers(c))
@@ -190,9 +245,10 @@ func (s *controllerTestSuite) Test_handleCreateUser_bad_input() {
 		assert.NoError(s.T(), con.handleCreateUser(c))
 		assert.Equal(s.T(), http.StatusBadRequest, recorder.Code)
 
-		var actual dto.ErrorResponse
+		var actual dto.Problem
 		assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &actual))
-		assert.Contains(s.T(), actual.Message, `'Email' failed on the 'required' tag`)
+		assert.Equal(s.T(), "validation_failed", actual.Code)
+		assert.Equal(s.T(), []dto.ProblemField{{Field: "email", Rule: "required", Message: "is required"}}, actual.Errors)
 	})
 
 	s.T().Run("invalid_json", func(_ *testing.T) {
@@ -206,12 +262,166 @@ func (s *controllerTestSuite) Test_handleCreateUser_bad_input() {
 		assert.NoError(s.T(), con.handleCreateUser(c))
 		assert.Equal(s.T(), http.StatusBadRequest, recorder.Code)
 
-		var actual dto.ErrorResponse
+		var actual dto.Problem
 		assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &actual))
-		assert.Contains(s.T(), actual.Message, `invalid character`)
+		assert.Equal(s.T(), "bad_request", actual.Code)
+		assert.Contains(s.T(), actual.Detail, `invalid character`)
 	})
 }
 
 func (s *controllerTestSuite) Test_handleCreateUser_success() {
 	// assert.Fail(s.T(), "implement me")
 }
+
+func (s *controllerTestSuite) Test_handleUpdateUser() {
+	e := echo.New()
+	e.Validator = newValidator() // must register validator
+
+	newCtx := func(userID string, input string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(input))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		recorder := httptest.NewRecorder()
+		c := e.NewContext(req, recorder)
+		c.Set(authContextKey, s.Token) // fake authentication
+		c.SetPath("/v1/user/:id")
+		c.SetParamNames("id")
+		c.SetParamValues(userID)
+		return c, recorder
+	}
+	valid := `{"first_name":"foo", "last_name":"bar"}`
+
+	s.T().Run("invalid_id", func(_ *testing.T) {
+		c, recorder := newCtx("abc", valid)
+		con := Controller{e: e}
+		assert.NoError(s.T(), con.handleUpdateUser(c))
+		assert.Equal(s.T(), http.StatusBadRequest, recorder.Code)
+	})
+
+	s.T().Run("missing_last_name", func(_ *testing.T) {
+		c, recorder := newCtx("111", `{"email":"new@example.com", "first_name":"foo"}`)
+		con := Controller{e: e}
+		assert.NoError(s.T(), con.handleUpdateUser(c))
+		assert.Equal(s.T(), http.StatusBadRequest, recorder.Code)
+
+		var actual dto.Problem
+		assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &actual))
+		assert.Equal(s.T(), "validation_failed", actual.Code)
+		assert.Equal(s.T(), []dto.ProblemField{{Field: "last_name", Rule: "required", Message: "is required"}}, actual.Errors)
+	})
+
+	s.T().Run("other_user", func(_ *testing.T) {
+		c, recorder := newCtx("222", valid)
+		m := new(mockUserRepo)
+		m.On("GetUserByEmail", mock.Anything, mock.Anything, mock.Anything, "logged-in@example.com").Return(s.FakeUser, nil)
+
+		con := Controller{e: e, db: fakeTxDB(), auditRepo: &fakeAuditRepo{}, userRepo: m}
+		assert.NoError(s.T(), con.handleUpdateUser(c))
+		assert.Equal(s.T(), http.StatusForbidden, recorder.Code)
+		m.AssertNotCalled(s.T(), "UpdateUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func (s *controllerTestSuite) Test_handleGetUserHistory() {
+	e := echo.New()
+	newCtx := func(userID string, query string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		recorder := httptest.NewRecorder()
+		c := e.NewContext(req, recorder)
+		c.Set(authContextKey, s.Token) // fake authentication
+		c.SetPath("/v1/user/:id/history")
+		c.SetParamNames("id")
+		c.SetParamValues(userID)
+		return c, recorder
+	}
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	updated := created.Add(time.Hour)
+	revs := []repo.UserRevision{
+		{User: *s.FakeUser, Revision: 1, Operation: repo.UserHistoryInsert, ValidFrom: created, ValidTo: &updated},
+		{User: *s.FakeUser, Revision: 2, Operation: repo.UserHistoryUpdate, ValidFrom: updated},
+	}
+
+	s.Run("list", func() {
+		c, recorder := newCtx(fmt.Sprint(s.FakeUser.ID), "")
+		m := new(mockUserRepo)
+		m.On("GetUserByOrgMember", "logged-in@example.com", s.FakeUser.ID).Return(s.FakeUser, nil)
+		m.On("ListUserRevisions", s.FakeUser.ID).Return(revs, nil)
+
+		con := Controller{e: e, userRepo: m}
+		assert.NoError(s.T(), con.handleGetUserHistory(c))
+		assert.Equal(s.T(), http.StatusOK, recorder.Code)
+
+		var actual []dto.UserRevision
+		assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &actual))
+		assert.Len(s.T(), actual, 2)
+		assert.Equal(s.T(), s.FakeUser.Email, actual[0].Email)
+		assert.Equal(s.T(), repo.UserHistoryUpdate, actual[1].Operation)
+		assert.Nil(s.T(), actual[1].ValidTo)
+	})
+
+	s.Run("as_of", func() {
+		c, recorder := newCtx(fmt.Sprint(s.FakeUser.ID), "as_of=2024-01-01T00:30:00Z")
+		m := new(mockUserRepo)
+		m.On("GetUserByOrgMember", "logged-in@example.com", s.FakeUser.ID).Return(s.FakeUser, nil)
+		m.On("GetUserAsOf", s.FakeUser.ID, created.Add(30*time.Minute)).Return(&revs[0], nil)
+
+		con := Controller{e: e, userRepo: m}
+		assert.NoError(s.T(), con.handleGetUserHistory(c))
+		assert.Equal(s.T(), http.StatusOK, recorder.Code)
+
+		var actual []dto.UserRevision
+		assert.NoError(s.T(), json.Unmarshal(recorder.Body.Bytes(), &actual))
+		assert.Len(s.T(), actual, 1)
+		assert.Equal(s.T(), 1, actual[0].Revision)
+	})
+
+	s.Run("as_of_before_created", func() {
+		c, recorder := newCtx(fmt.Sprint(s.FakeUser.ID), "as_of=2023-01-01T00:00:00Z")
+		m := new(mockUserRepo)
+		m.On("GetUserByOrgMember", "logged-in@example.com", s.FakeUser.ID).Return(s.FakeUser, nil)
+		m.On("GetUserAsOf", s.FakeUser.ID, mock.Anything).Return(nil, repo.ErrNoRowsFound)
+
+		con := Controller{e: e, userRepo: m}
+		assert.NoError(s.T(), con.handleGetUserHistory(c))
+		assert.Equal(s.T(), http.StatusNotFound, recorder.Code)
+	})
+
+	s.Run("outside_orgs", func() {
+		c, recorder := newCtx(fmt.Sprint(s.FakeUser.ID), "")
+		m := new(mockUserRepo)
+		m.On("GetUserByOrgMember", "logged-in@example.com", s.FakeUser.ID).Return(nil, repo.ErrNoRowsFound)
+
+		con := Controller{e: e, userRepo: m}
+		assert.NoError(s.T(), con.handleGetUserHistory(c))
+		assert.Equal(s.T(), http.StatusNotFound, recorder.Code)
+		m.AssertNotCalled(s.T(), "ListUserRevisions", mock.Anything)
+	})
+
+	s.Run("admin_reads_deleted_user", func() {
+		c, recorder := newCtx(fmt.Sprint(s.FakeUser.ID), "")
+		deleted := []repo.UserRevision{revs[0], revs[1], {User: *s.FakeUser, Revision: 3, Operation: repo.UserHistoryDelete, ValidFrom: updated}}
+		m := new(mockUserRepo)
+		m.On("ListUserRevisions", s.FakeUser.ID).Return(deleted, nil)
+
+		con := Controller{e: e, userRepo: m, cfg: platform.Config{AdminEmails: []string{"Logged-In@example.com"}}}
+		assert.NoError(s.T(), con.handleGetUserHistory(c))
+		assert.Equal(s.T(), http.StatusOK, recorder.Code)
+		m.AssertNotCalled(s.T(), "GetUserByOrgMember", mock.Anything, mock.Anything)
+	})
+
+	s.Run("unknown_user", func() {
+		c, recorder := newCtx("404", "")
+		m := new(mockUserRepo)
+		m.On("ListUserRevisions", 404).Return([]repo.UserRevision{}, nil)
+
+		con := Controller{e: e, userRepo: m, cfg: platform.Config{AdminEmails: []string{"logged-in@example.com"}}}
+		assert.NoError(s.T(), con.handleGetUserHistory(c))
+		assert.Equal(s.T(), http.StatusNotFound, recorder.Code)
+	})
+
+	s.Run("invalid_as_of", func() {
+		c, recorder := newCtx(fmt.Sprint(s.FakeUser.ID), "as_of=yesterday")
+		con := Controller{e: e}
+		assert.NoError(s.T(), con.handleGetUserHistory(c))
+		assert.Equal(s.T(), http.StatusBadRequest, recorder.Code)
+	})
+}
@@ -0,0 +1,469 @@
+package controller
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/apperr"
+	"github.com/drmaples/starter-app/app/dto"
+	"github.com/drmaples/starter-app/app/repo"
+	"github.com/drmaples/starter-app/app/webhook"
+)
+
+const defaultWebhookDeliveriesLimit = 50
+
+var (
+	errWebhookNotFound  = apperr.NotFound("no webhook for given id")
+	errDeliveryNotFound = apperr.NotFound("no webhook delivery for given id")
+	errDeliveryPending  = apperr.Conflict("webhook delivery is still pending")
+	errWebhookURLHost   = apperr.BadRequest("webhook url must resolve to a public address")
+)
+
+type webhookRoute struct {
+	ID         int   `param:"id"`
+	DeliveryID int64 `param:"delivery_id"`
+}
+
+// managedWebhook loads a webhook the caller can manage, i.e. is an owner or admin of its organization
+func (con *Controller) managedWebhook(c echo.Context, webhookID int) (*repo.Webhook, error) {
+	ctx := c.Request().Context()
+	return con.loadManagedWebhook(c, con.readDB(ctx), webhookID, false)
+}
+
+// managedWebhookTx is managedWebhook for writes, see requireOrgRoleTx
+func (con *Controller) managedWebhookTx(c echo.Context, tx repo.Querier, webhookID int) (*repo.Webhook, error) {
+	return con.loadManagedWebhook(c, tx, webhookID, true)
+}
+
+func (con *Controller) loadManagedWebhook(c echo.Context, tx repo.Querier, webhookID int, lock bool) (*repo.Webhook, error) {
+	ctx := c.Request().Context()
+
+	wh, err := con.webhookRepo.GetWebhook(ctx, tx, con.schema(c), webhookID)
+	if err != nil {
+		if errors.Is(err, repo.ErrNoRowsFound) {
+			return nil, errWebhookNotFound
+		}
+		return nil, err
+	}
+	if _, err := con.checkOrgRole(c, tx, wh.OrganizationID, orgManagerRoles, lock); err != nil {
+		if apperr.CodeOf(err) == apperr.CodeNotFound {
+			// do not leak that the webhook exists in another organization
+			return nil, errWebhookNotFound
+		}
+		return nil, err
+	}
+	return wh, nil
+}
+
+// checkWebhookURL refuses urls pointing at loopback, private networks and the like, unless configured to allow them
+func (con *Controller) checkWebhookURL(c echo.Context, rawURL string) error {
+	if con.cfg.Webhook.AllowPrivate {
+		return nil
+	}
+	if err := webhook.CheckURL(c.Request().Context(), rawURL); err != nil {
+		slog.InfoContext(c.Request().Context(), "refused webhook url", slog.Any("error", err))
+		return errWebhookURLHost
+	}
+	return nil
+}
+
+// managedDelivery loads a delivery of a webhook the caller can manage
+func (con *Controller) managedDelivery(c echo.Context, wr webhookRoute) (*repo.WebhookDelivery, error) {
+	ctx := c.Request().Context()
+	return con.loadManagedDelivery(c, con.readDB(ctx), wr, false)
+}
+
+// managedDeliveryTx is managedDelivery for writes, see requireOrgRoleTx
+func (con *Controller) managedDeliveryTx(c echo.Context, tx repo.Querier, wr webhookRoute) (*repo.WebhookDelivery, error) {
+	return con.loadManagedDelivery(c, tx, wr, true)
+}
+
+func (con *Controller) loadManagedDelivery(c echo.Context, tx repo.Querier, wr webhookRoute, lock bool) (*repo.WebhookDelivery, error) {
+	ctx := c.Request().Context()
+
+	if _, err := con.loadManagedWebhook(c, tx, wr.ID, lock); err != nil {
+		return nil, err
+	}
+	del, err := con.webhookRepo.GetDelivery(ctx, tx, con.schema(c), wr.DeliveryID)
+	if err != nil {
+		if errors.Is(err, repo.ErrNoRowsFound) {
+			return nil, errDeliveryNotFound
+		}
+		return nil, err
+	}
+	if del.WebhookID != wr.ID {
+		return nil, errDeliveryNotFound
+	}
+	return del, nil
+}
+
+// @Summary		create webhook
+// @Description	subscribe a url to an organization's events, requires owner or admin role. deliveries are signed with the returned secret, it is not shown again. the url must resolve to a public address
+// @Tags		webhooks
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		data body dto.CreateWebhook true "data"
+// @Success		200	{object}	dto.CreatedWebhook
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/webhooks [post]
+func (con *Controller) handleCreateWebhook(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var cw dto.CreateWebhook
+	if err := c.Bind(&cw); err != nil {
+		return con.sendError(c, err)
+	}
+	if err := c.Validate(cw); err != nil {
+		return con.sendError(c, apperr.Validation(err))
+	}
+	// resolved before the tx, it should not hold locks while waiting on dns
+	if err := con.checkWebhookURL(c, cw.URL); err != nil {
+		return con.sendError(c, err)
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		return con.sendError(c, err)
+	}
+	var wh *repo.Webhook
+	if err := repo.WithTx(ctx, con.db, nil, func(tx repo.Querier) error {
+		caller, err := con.requireOrgRoleTx(c, tx, cw.OrganizationID, orgManagerRoles)
+		if err != nil {
+			return err
+		}
+		wh, err = con.webhookRepo.CreateWebhook(ctx, tx, con.schema(c), cw.Model(caller.UserID, secret))
+		if err != nil {
+			return err
+		}
+		// the secret is only ever shown to the caller, never kept in the audit log
+		var res dto.Webhook
+		return con.auditTx(c, tx, http.StatusOK, auditDetail{Resource: "webhook", ResourceID: wh.ID, After: res.FromModel(*wh)})
+	}); err != nil {
+		return con.sendError(c, err)
+	}
+
+	slog.InfoContext(ctx, "created webhook",
+		slog.Group("webhook",
+			slog.Int("id", wh.ID),
+			slog.Int("organization_id", wh.OrganizationID),
+		),
+	)
+
+	var res dto.Webhook
+	return c.JSON(http.StatusOK, dto.CreatedWebhook{Webhook: res.FromModel(*wh), Secret: wh.Secret})
+}
+
+// @Summary		list webhooks
+// @Description	list an organization's webhooks, requires owner or admin role
+// @Tags		webhooks
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		organization_id query int true "organization id"
+// @Success		200	{object}	[]dto.Webhook
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/webhooks [get]
+func (con *Controller) handleListWebhooks(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var q dto.ListWebhooks
+	if err := c.Bind(&q); err != nil {
+		return con.sendError(c, err)
+	}
+	if err := c.Validate(q); err != nil {
+		return con.sendError(c, apperr.Validation(err))
+	}
+	if _, err := con.requireOrgRole(c, q.OrganizationID, orgManagerRoles); err != nil {
+		return con.sendError(c, err)
+	}
+
+	hooks, err := con.webhookRepo.ListWebhooks(ctx, con.readDB(ctx), con.schema(c), q.OrganizationID)
+	if err != nil {
+		return con.sendError(c, err)
+	}
+
+	var res dto.Webhook
+	return c.JSON(http.StatusOK, res.FromModels(hooks))
+}
+
+// @Summary		get webhook
+// @Description	get a webhook, requires owner or admin role in its organization
+// @Tags		webhooks
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		id path int true "webhook id"
+// @Success		200	{object}	dto.Webhook
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/webhooks/{id} [get]
+func (con *Controller) handleGetWebhook(c echo.Context) error {
+	var wr webhookRoute
+	if err := c.Bind(&wr); err != nil {
+		return con.sendError(c, apperr.BadRequest("invalid type for webhook id"))
+	}
+	wh, err := con.managedWebhook(c, wr.ID)
+	if err != nil {
+		return con.sendError(c, err)
+	}
+
+	var res dto.Webhook
+	return c.JSON(http.StatusOK, res.FromModel(*wh))
+}
+
+// @Summary		update webhook
+// @Description	change a webhook's url, event types or active flag, requires owner or admin role in its organization
+// @Tags		webhooks
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		id path int true "webhook id"
+// @Param 		data body dto.UpdateWebhook true "data"
+// @Success		200	{object}	dto.Webhook
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/webhooks/{id} [put]
+func (con *Controller) handleUpdateWebhook(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var wr webhookRoute
+	if err := bindPathParams(c, &wr); err != nil {
+		return con.sendError(c, apperr.BadRequest("invalid type for webhook id"))
+	}
+	var uw dto.UpdateWebhook
+	if err := c.Bind(&uw); err != nil {
+		return con.sendError(c, err)
+	}
+	if err := c.Validate(uw); err != nil {
+		return con.sendError(c, apperr.Validation(err))
+	}
+	// resolved before the tx, it should not hold locks while waiting on dns
+	if uw.URL != nil {
+		if err := con.checkWebhookURL(c, *uw.URL); err != nil {
+			return con.sendError(c, err)
+		}
+	}
+
+	var wh, updated *repo.Webhook
+	if err := repo.WithTx(ctx, con.db, nil, func(tx repo.Querier) error {
+		var err error
+		wh, err = con.managedWebhookTx(c, tx, wr.ID)
+		if err != nil {
+			return err
+		}
+		updated, err = con.webhookRepo.UpdateWebhook(ctx, tx, con.schema(c), uw.Apply(*wh))
+		if err != nil {
+			return err
+		}
+		var res dto.Webhook
+		return con.auditTx(c, tx, http.StatusOK, auditDetail{Resource: "webhook", Before: res.FromModel(*wh), After: res.FromModel(*updated)})
+	}); err != nil {
+		if errors.Is(err, repo.ErrNoRowsFound) {
+			return con.sendError(c, errWebhookNotFound)
+		}
+		return con.sendError(c, err)
+	}
+
+	var res dto.Webhook
+	return c.JSON(http.StatusOK, res.FromModel(*updated))
+}
+
+// @Summary		delete webhook
+// @Description	delete a webhook and its delivery history, requires owner or admin role in its organization
+// @Tags		webhooks
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		id path int true "webhook id"
+// @Success		204
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/webhooks/{id} [delete]
+func (con *Controller) handleDeleteWebhook(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var wr webhookRoute
+	if err := c.Bind(&wr); err != nil {
+		return con.sendError(c, apperr.BadRequest("invalid type for webhook id"))
+	}
+	var wh *repo.Webhook
+	if err := repo.WithTx(ctx, con.db, nil, func(tx repo.Querier) error {
+		var err error
+		wh, err = con.managedWebhookTx(c, tx, wr.ID)
+		if err != nil {
+			return err
+		}
+		if err := con.webhookRepo.DeleteWebhook(ctx, tx, con.schema(c), wr.ID); err != nil {
+			return err
+		}
+		var res dto.Webhook
+		return con.auditTx(c, tx, http.StatusNoContent, auditDetail{Resource: "webhook", Before: res.FromModel(*wh)})
+	}); err != nil {
+		if errors.Is(err, repo.ErrNoRowsFound) {
+			return con.sendError(c, errWebhookNotFound)
+		}
+		return con.sendError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary		list webhook deliveries
+// @Description	most recent deliveries of a webhook, newest first. requires owner or admin role in its organization
+// @Tags		webhooks
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		id path int true "webhook id"
+// @Param 		limit query int false "max deliveries returned, default 50, max 500"
+// @Success		200	{object}	[]dto.WebhookDelivery
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/webhooks/{id}/deliveries [get]
+func (con *Controller) handleListWebhookDeliveries(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var wr webhookRoute
+	if err := bindPathParams(c, &wr); err != nil {
+		return con.sendError(c, apperr.BadRequest("invalid type for webhook id"))
+	}
+	var q dto.ListWebhookDeliveries
+	if err := c.Bind(&q); err != nil {
+		return con.sendError(c, err)
+	}
+	if err := c.Validate(q); err != nil {
+		return con.sendError(c, apperr.Validation(err))
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultWebhookDeliveriesLimit
+	}
+	if _, err := con.managedWebhook(c, wr.ID); err != nil {
+		return con.sendError(c, err)
+	}
+
+	deliveries, err := con.webhookRepo.ListDeliveries(ctx, con.readDB(ctx), con.schema(c), wr.ID, q.Limit)
+	if err != nil {
+		return con.sendError(c, err)
+	}
+
+	var res dto.WebhookDelivery
+	return c.JSON(http.StatusOK, res.FromModels(deliveries))
+}
+
+// @Summary		get webhook delivery
+// @Description	get a delivery with its payload and every attempt made, requires owner or admin role in the webhook's organization
+// @Tags		webhooks
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		id path int true "webhook id"
+// @Param 		delivery_id path int true "delivery id"
+// @Success		200	{object}	dto.WebhookDelivery
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/webhooks/{id}/deliveries/{delivery_id} [get]
+func (con *Controller) handleGetWebhookDelivery(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var wr webhookRoute
+	if err := c.Bind(&wr); err != nil {
+		return con.sendError(c, apperr.BadRequest("invalid type for webhook or delivery id"))
+	}
+	del, err := con.managedDelivery(c, wr)
+	if err != nil {
+		return con.sendError(c, err)
+	}
+	attempts, err := con.webhookRepo.ListDeliveryAttempts(ctx, con.readDB(ctx), con.schema(c), del.ID)
+	if err != nil {
+		return con.sendError(c, err)
+	}
+
+	var d dto.WebhookDelivery
+	var a dto.WebhookDeliveryAttempt
+	res := d.FromModel(*del)
+	res.Payload = del.Payload
+	res.AttemptLog = a.FromModels(attempts)
+	return c.JSON(http.StatusOK, res)
+}
+
+// @Summary		replay webhook delivery
+// @Description	send a succeeded or failed delivery again with a fresh set of attempts, requires owner or admin role in the webhook's organization
+// @Tags		webhooks
+// @Accept		json
+// @Produce		json
+// @Security 	ApiKeyAuth
+// @Param 		id path int true "webhook id"
+// @Param 		delivery_id path int true "delivery id"
+// @Success		202
+// @Failure		400	{object}	dto.Problem
+// @Failure		401	{object}	dto.Problem
+// @Failure		403	{object}	dto.Problem
+// @Failure		404	{object}	dto.Problem
+// @Failure		409	{object}	dto.Problem
+// @Failure		500	{object}	dto.Problem
+// @Router		/v1/webhooks/{id}/deliveries/{delivery_id}/replay [post]
+func (con *Controller) handleReplayWebhookDelivery(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	var wr webhookRoute
+	if err := c.Bind(&wr); err != nil {
+		return con.sendError(c, apperr.BadRequest("invalid type for webhook or delivery id"))
+	}
+
+	// reset and queue together, a reset delivery that is never queued would stay pending for good
+	var del *repo.WebhookDelivery
+	if err := repo.WithTx(ctx, con.db, nil, func(tx repo.Querier) error {
+		var err error
+		del, err = con.managedDeliveryTx(c, tx, wr)
+		if err != nil {
+			return err
+		}
+		if del.Status == repo.WebhookDeliveryPending {
+			return errDeliveryPending
+		}
+		if err := con.webhookRepo.ResetDelivery(ctx, tx, con.schema(c), del.ID); err != nil {
+			return err
+		}
+		if err := con.deliverer.EnqueueTx(ctx, tx, con.schema(c), del.ID); err != nil {
+			return err
+		}
+		return con.auditTx(c, tx, http.StatusAccepted, auditDetail{Action: "replay", Resource: "webhook_delivery", ResourceID: del.ID})
+	}); err != nil {
+		return con.sendError(c, err)
+	}
+
+	slog.InfoContext(ctx, "replaying webhook delivery",
+		slog.Group("delivery",
+			slog.Int64("id", del.ID),
+			slog.Int("webhook_id", del.WebhookID),
+		),
+	)
+	return c.NoContent(http.StatusAccepted)
+}
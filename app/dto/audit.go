@@ -0,0 +1,133 @@
+package dto
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+// AuditEntry represents one mutating api call
+type AuditEntry struct {
+	ID         int64                  `json:"id"`
+	Actor      string                 `json:"actor"`
+	Action     string                 `json:"action"`
+	Method     string                 `json:"method"`
+	Route      string                 `json:"route"`
+	Resource   string                 `json:"resource"`
+	ResourceID *string                `json:"resource_id,omitempty"`
+	Status     int                    `json:"status"`
+	Before     json.RawMessage        `json:"before,omitempty" swaggertype:"object"`
+	After      json.RawMessage        `json:"after,omitempty" swaggertype:"object"`
+	Changes    map[string]AuditChange `json:"changes,omitempty"`
+	IP         *string                `json:"ip,omitempty"`
+	RequestID  *string                `json:"request_id,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+// AuditChange is a field that differs between before and after. From is missing for fields that were added and To
+// for fields that were removed
+type AuditChange struct {
+	From json.RawMessage `json:"from,omitempty" swaggertype:"object"`
+	To   json.RawMessage `json:"to,omitempty" swaggertype:"object"`
+}
+
+// FromModel converts from model object to DTO
+func (a *AuditEntry) FromModel(m repo.AuditEntry) AuditEntry {
+	return AuditEntry{
+		ID:         m.ID,
+		Actor:      m.Actor,
+		Action:     m.Action,
+		Method:     m.Method,
+		Route:      m.Route,
+		Resource:   m.Resource,
+		ResourceID: m.ResourceID,
+		Status:     m.Status,
+		Before:     m.Before,
+		After:      m.After,
+		Changes:    AuditChanges(m.Before, m.After),
+		IP:         m.IP,
+		RequestID:  m.RequestID,
+		CreatedAt:  m.CreatedAt,
+	}
+}
+
+// FromModels converts list of model object to list of DTOs
+func (a *AuditEntry) FromModels(ms []repo.AuditEntry) []AuditEntry {
+	res := []AuditEntry{}
+	for _, m := range ms {
+		a := AuditEntry{}
+		res = append(res, a.FromModel(m))
+	}
+	return res
+}
+
+// AuditChanges diffs the top level fields of two json objects, either of which may be empty
+func AuditChanges(before json.RawMessage, after json.RawMessage) map[string]AuditChange {
+	var b, a map[string]json.RawMessage
+	if len(before) > 0 && json.Unmarshal(before, &b) != nil {
+		return nil
+	}
+	if len(after) > 0 && json.Unmarshal(after, &a) != nil {
+		return nil
+	}
+
+	res := map[string]AuditChange{}
+	for k, from := range b {
+		to, ok := a[k]
+		if !ok || !jsonEqual(from, to) {
+			res[k] = AuditChange{From: from, To: to}
+		}
+	}
+	for k, to := range a {
+		if _, ok := b[k]; !ok {
+			res[k] = AuditChange{To: to}
+		}
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	return res
+}
+
+func jsonEqual(a json.RawMessage, b json.RawMessage) bool {
+	var ca, cb bytes.Buffer
+	if json.Compact(&ca, a) != nil || json.Compact(&cb, b) != nil {
+		return bytes.Equal(a, b)
+	}
+	return bytes.Equal(ca.Bytes(), cb.Bytes())
+}
+
+// ListAuditEntries is dto for filtering and paging the audit log
+type ListAuditEntries struct {
+	Actor      string    `query:"actor"`
+	Action     string    `query:"action"`
+	Resource   string    `query:"resource"`
+	ResourceID string    `query:"resource_id"`
+	Since      time.Time `query:"since"`
+	Until      time.Time `query:"until"`
+	Before     int64     `query:"before" validate:"omitempty,min=1"`
+	Limit      int       `query:"limit" validate:"omitempty,min=1,max=500"`
+}
+
+// Filter converts the query to a repo filter
+func (l *ListAuditEntries) Filter() repo.AuditFilter {
+	return repo.AuditFilter{
+		Actor:      l.Actor,
+		Action:     l.Action,
+		Resource:   l.Resource,
+		ResourceID: l.ResourceID,
+		Since:      l.Since,
+		Until:      l.Until,
+		BeforeID:   l.Before,
+		Limit:      l.Limit,
+	}
+}
+
+// AuditLog is a page of the audit log, newest first
+type AuditLog struct {
+	Entries []AuditEntry `json:"entries"`
+	// NextBefore is passed as the before query param to get the next page, missing on the last page
+	NextBefore *int64 `json:"next_before,omitempty"`
+}
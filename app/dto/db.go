@@ -0,0 +1,65 @@
+package dto
+
+import (
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+// DBStats represents connection pool stats
+type DBStats struct {
+	Backend string `json:"backend"`
+
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDurationMS     int64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+
+	Pgx *PgxPoolStats `json:"pgx,omitempty"`
+}
+
+// PgxPoolStats represents native pgxpool stats
+type PgxPoolStats struct {
+	AcquireCount         int64 `json:"acquire_count"`
+	AcquireDurationMS    int64 `json:"acquire_duration_ms"`
+	AcquiredConns        int32 `json:"acquired_conns"`
+	CanceledAcquireCount int64 `json:"canceled_acquire_count"`
+	ConstructingConns    int32 `json:"constructing_conns"`
+	EmptyAcquireCount    int64 `json:"empty_acquire_count"`
+	IdleConns            int32 `json:"idle_conns"`
+	MaxConns             int32 `json:"max_conns"`
+	TotalConns           int32 `json:"total_conns"`
+}
+
+// FromModel converts from model object to DTO
+func (s *DBStats) FromModel(m repo.PoolStats) DBStats {
+	res := DBStats{
+		Backend:            m.Backend,
+		MaxOpenConnections: m.SQL.MaxOpenConnections,
+		OpenConnections:    m.SQL.OpenConnections,
+		InUse:              m.SQL.InUse,
+		Idle:               m.SQL.Idle,
+		WaitCount:          m.SQL.WaitCount,
+		WaitDurationMS:     m.SQL.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      m.SQL.MaxIdleClosed,
+		MaxIdleTimeClosed:  m.SQL.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  m.SQL.MaxLifetimeClosed,
+	}
+	if m.Pgx != nil {
+		res.Pgx = &PgxPoolStats{
+			AcquireCount:         m.Pgx.AcquireCount,
+			AcquireDurationMS:    m.Pgx.AcquireDuration.Milliseconds(),
+			AcquiredConns:        m.Pgx.AcquiredConns,
+			CanceledAcquireCount: m.Pgx.CanceledAcquireCount,
+			ConstructingConns:    m.Pgx.ConstructingConns,
+			EmptyAcquireCount:    m.Pgx.EmptyAcquireCount,
+			IdleConns:            m.Pgx.IdleConns,
+			MaxConns:             m.Pgx.MaxConns,
+			TotalConns:           m.Pgx.TotalConns,
+		}
+	}
+	return res
+}
@@ -1,11 +1,52 @@
 package dto
 
-// ErrorResponse is the response for an error
-type ErrorResponse struct {
+import (
+	"net/http"
+
+	"github.com/drmaples/starter-app/app/apperr"
+)
+
+// MIMEProblemJSON is the content type of a Problem
+const MIMEProblemJSON = "application/problem+json"
+
+// problemTypePrefix makes a code into a problem type uri, e.g. urn:problem-type:starter-app:not_found
+const problemTypePrefix = "urn:problem-type:starter-app:"
+
+// Problem is an RFC 7807 problem details error response
+type Problem struct {
+	Type      string         `json:"type"`
+	Title     string         `json:"title"`
+	Status    int            `json:"status"`
+	Detail    string         `json:"detail,omitempty"`
+	Instance  string         `json:"instance,omitempty"` // request path
+	Code      string         `json:"code"`               // stable, see apperr.Code
+	RequestID string         `json:"request_id,omitempty"`
+	Errors    []ProblemField `json:"errors,omitempty"` // validation failures
+}
+
+// ProblemField is why one field of a request failed validation
+type ProblemField struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
 	Message string `json:"message"`
 }
 
-// NewErrorResp returns a new error response
-func NewErrorResp(msg string) ErrorResponse {
-	return ErrorResponse{Message: msg}
+// FromError converts from an app error to DTO. the cause of the error is only included when showInternal is set, see
+// apperr.Error
+func (p *Problem) FromError(e *apperr.Error, showInternal bool) Problem {
+	status := e.Status()
+	res := Problem{
+		Type:   problemTypePrefix + string(e.Code),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: e.Message,
+		Code:   string(e.Code),
+	}
+	if showInternal && e.Err != nil {
+		res.Detail = e.Error()
+	}
+	for _, f := range e.Fields {
+		res.Errors = append(res.Errors, ProblemField{Field: f.Field, Rule: f.Rule, Message: f.Message})
+	}
+	return res
 }
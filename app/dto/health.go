@@ -0,0 +1,42 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/drmaples/starter-app/app/health"
+)
+
+// Health is the outcome of a liveness or readiness probe
+type Health struct {
+	Status string `json:"status"`
+	// Checks is only sent to authenticated callers, check errors can describe internals
+	Checks []HealthCheck `json:"checks,omitempty"`
+}
+
+// HealthCheck is the outcome of one check
+type HealthCheck struct {
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS float64   `json:"duration_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// FromReport converts a health report to DTO, with the checks breakdown only when detailed
+func (h *Health) FromReport(r health.Report, detailed bool) Health {
+	res := Health{Status: r.Status}
+	if !detailed {
+		return res
+	}
+	res.Checks = []HealthCheck{}
+	for _, c := range r.Checks {
+		res.Checks = append(res.Checks, HealthCheck{
+			Name:       c.Name,
+			Status:     c.Status,
+			Error:      c.Error,
+			DurationMS: float64(c.Duration.Microseconds()) / 1000,
+			CheckedAt:  c.CheckedAt,
+		})
+	}
+	return res
+}
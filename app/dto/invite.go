@@ -0,0 +1,45 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+// Invitation represents a pending invitation to join an organization
+type Invitation struct {
+	ID             int       `json:"id"`
+	OrganizationID int       `json:"organization_id"`
+	Email          string    `json:"email"`
+	Role           string    `json:"role"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// FromModel converts from model object to DTO
+func (i *Invitation) FromModel(m repo.Invitation) Invitation {
+	return Invitation{
+		ID:             m.ID,
+		OrganizationID: m.OrganizationID,
+		Email:          m.Email,
+		Role:           m.Role,
+		ExpiresAt:      m.ExpiresAt,
+		CreatedAt:      m.CreatedAt,
+	}
+}
+
+// FromModels converts list of model object to list of DTOs
+func (i *Invitation) FromModels(ms []repo.Invitation) []Invitation {
+	res := []Invitation{}
+	for _, m := range ms {
+		i := Invitation{}
+		res = append(res, i.FromModel(m))
+	}
+	return res
+}
+
+// CreateInvitation is dto for inviting an email address to an organization
+type CreateInvitation struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required,oneof=owner admin member"`
+}
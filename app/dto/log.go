@@ -0,0 +1,23 @@
+package dto
+
+import (
+	"log/slog"
+)
+
+// LogLevels represents the minimum level logged, overall and per package
+type LogLevels struct {
+	Level    string            `json:"level" validate:"required"`
+	Packages map[string]string `json:"packages,omitempty"` // import path or a trailing part of it, e.g. jobs
+}
+
+// FromLevels converts from levels to DTO
+func (l *LogLevels) FromLevels(base slog.Level, packages map[string]slog.Level) LogLevels {
+	res := LogLevels{Level: base.String()}
+	if len(packages) > 0 {
+		res.Packages = make(map[string]string, len(packages))
+		for pkg, lvl := range packages {
+			res.Packages[pkg] = lvl.String()
+		}
+	}
+	return res
+}
@@ -0,0 +1,88 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+// Organization represents an organization in db
+type Organization struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FromModel converts from model object to DTO
+func (o *Organization) FromModel(m repo.Organization) Organization {
+	return Organization{
+		ID:        m.ID,
+		Name:      m.Name,
+		CreatedAt: m.CreatedAt,
+		UpdatedAt: m.UpdatedAt,
+	}
+}
+
+// FromModels converts list of model object to list of DTOs
+func (o *Organization) FromModels(ms []repo.Organization) []Organization {
+	res := []Organization{}
+	for _, m := range ms {
+		o := Organization{}
+		res = append(res, o.FromModel(m))
+	}
+	return res
+}
+
+// SaveOrganization is dto for creating or updating an organization
+type SaveOrganization struct {
+	Name string `json:"name" validate:"required,max=250"`
+}
+
+// Model converts a dto object to model object
+func (o *SaveOrganization) Model() repo.Organization {
+	return repo.Organization{
+		Name: o.Name,
+	}
+}
+
+// Member represents a user's membership in an organization
+type Member struct {
+	OrganizationID int       `json:"organization_id"`
+	UserID         int       `json:"user_id"`
+	Email          string    `json:"email"`
+	Role           string    `json:"role"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// FromModel converts from model object to DTO
+func (mem *Member) FromModel(m repo.Membership) Member {
+	return Member{
+		OrganizationID: m.OrganizationID,
+		UserID:         m.UserID,
+		Email:          m.Email,
+		Role:           m.Role,
+		CreatedAt:      m.CreatedAt,
+	}
+}
+
+// FromModels converts list of model object to list of DTOs
+func (mem *Member) FromModels(ms []repo.Membership) []Member {
+	res := []Member{}
+	for _, m := range ms {
+		mem := Member{}
+		res = append(res, mem.FromModel(m))
+	}
+	return res
+}
+
+// AddMember is dto for adding a user to an organization
+type AddMember struct {
+	UserID int    `json:"user_id" validate:"required"`
+	Role   string `json:"role" validate:"required,oneof=owner admin member"`
+}
+
+// UpdateMember is dto for changing a member's role
+type UpdateMember struct {
+	Role string `json:"role" validate:"required,oneof=owner admin member"`
+}
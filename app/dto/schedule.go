@@ -0,0 +1,49 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+// ScheduleRun represents a single run of a recurring schedule
+type ScheduleRun struct {
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	ScheduledAt time.Time  `json:"scheduled_at"`
+	Status      string     `json:"status"`
+	Error       *string    `json:"error,omitempty"`
+	Instance    string     `json:"instance"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// FromModel converts from model object to DTO
+func (r *ScheduleRun) FromModel(m repo.ScheduleRun) ScheduleRun {
+	return ScheduleRun{
+		ID:          m.ID,
+		Name:        m.Name,
+		ScheduledAt: m.ScheduledAt,
+		Status:      m.Status,
+		Error:       m.Error,
+		Instance:    m.Instance,
+		StartedAt:   m.StartedAt,
+		FinishedAt:  m.FinishedAt,
+	}
+}
+
+// FromModels converts list of model object to list of DTOs
+func (r *ScheduleRun) FromModels(ms []repo.ScheduleRun) []ScheduleRun {
+	res := []ScheduleRun{}
+	for _, m := range ms {
+		r := ScheduleRun{}
+		res = append(res, r.FromModel(m))
+	}
+	return res
+}
+
+// ListScheduleRuns is dto for filtering schedule run history
+type ListScheduleRuns struct {
+	Name  string `query:"name"`
+	Limit int    `query:"limit" validate:"omitempty,min=1,max=500"`
+}
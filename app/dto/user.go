@@ -1,6 +1,8 @@
 package dto
 
 import (
+	"time"
+
 	"github.com/drmaples/starter-app/app/repo"
 )
 
@@ -57,3 +59,55 @@ func (u *CreateUser) Model() repo.User {
 		LastName:  u.LastName,
 	}
 }
+
+// UpdateUser is dto for updating a user
+// email is left out on purpose, it identifies the user to auth and cannot change
+type UpdateUser struct {
+	FirstName string `json:"first_name" validate:"required"`
+	LastName  string `json:"last_name" validate:"required"`
+}
+
+// Model converts a dto object to model object
+func (u *UpdateUser) Model(userID int) repo.User {
+	return repo.User{
+		ID:        userID,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+	}
+}
+
+// UserRevision represents one version of a user
+type UserRevision struct {
+	User
+	Revision  int        `json:"revision"`
+	Operation string     `json:"operation"`
+	ValidFrom time.Time  `json:"valid_from"`
+	ValidTo   *time.Time `json:"valid_to,omitempty"`
+}
+
+// FromModel converts from model object to DTO
+func (r *UserRevision) FromModel(m repo.UserRevision) UserRevision {
+	var u User
+	return UserRevision{
+		User:      u.FromModel(m.User),
+		Revision:  m.Revision,
+		Operation: m.Operation,
+		ValidFrom: m.ValidFrom,
+		ValidTo:   m.ValidTo,
+	}
+}
+
+// FromModels converts list of model object to list of DTOs
+func (r *UserRevision) FromModels(ms []repo.UserRevision) []UserRevision {
+	res := []UserRevision{}
+	for _, m := range ms {
+		r := UserRevision{}
+		res = append(res, r.FromModel(m))
+	}
+	return res
+}
+
+// UserHistory is dto for reading a user's history
+type UserHistory struct {
+	AsOf time.Time `query:"as_of"`
+}
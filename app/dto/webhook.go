@@ -0,0 +1,174 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+// Webhook represents an organization's subscription to events. the secret is only returned on create
+type Webhook struct {
+	ID             int       `json:"id"`
+	OrganizationID int       `json:"organization_id"`
+	URL            string    `json:"url"`
+	EventTypes     []string  `json:"event_types"`
+	Active         bool      `json:"active"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// FromModel converts from model object to DTO
+func (w *Webhook) FromModel(m repo.Webhook) Webhook {
+	eventTypes := []string{}
+	eventTypes = append(eventTypes, m.EventTypes...)
+	return Webhook{
+		ID:             m.ID,
+		OrganizationID: m.OrganizationID,
+		URL:            m.URL,
+		EventTypes:     eventTypes,
+		Active:         m.Active,
+		CreatedAt:      m.CreatedAt,
+		UpdatedAt:      m.UpdatedAt,
+	}
+}
+
+// FromModels converts list of model object to list of DTOs
+func (w *Webhook) FromModels(ms []repo.Webhook) []Webhook {
+	res := []Webhook{}
+	for _, m := range ms {
+		w := Webhook{}
+		res = append(res, w.FromModel(m))
+	}
+	return res
+}
+
+// CreatedWebhook is a newly created webhook along with its signing secret
+type CreatedWebhook struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// CreateWebhook is dto for subscribing an organization to events. no event types means every event type
+type CreateWebhook struct {
+	OrganizationID int      `json:"organization_id" validate:"required"`
+	URL            string   `json:"url" validate:"required,url,startswith=http,max=2048"`
+	EventTypes     []string `json:"event_types" validate:"dive,oneof=user.created user.updated"`
+}
+
+// Model converts dto to model
+func (w CreateWebhook) Model(createdBy int, secret string) repo.Webhook {
+	return repo.Webhook{
+		OrganizationID: w.OrganizationID,
+		URL:            w.URL,
+		Secret:         secret,
+		EventTypes:     w.EventTypes,
+		Active:         true,
+		CreatedBy:      &createdBy,
+	}
+}
+
+// UpdateWebhook is dto for updating a webhook. omitted fields are left unchanged
+type UpdateWebhook struct {
+	URL        *string  `json:"url" validate:"omitempty,url,startswith=http,max=2048"`
+	EventTypes []string `json:"event_types" validate:"omitempty,dive,oneof=user.created user.updated"`
+	Active     *bool    `json:"active"`
+}
+
+// Apply applies the changes to an existing webhook
+func (w UpdateWebhook) Apply(m repo.Webhook) repo.Webhook {
+	if w.URL != nil {
+		m.URL = *w.URL
+	}
+	if w.EventTypes != nil {
+		m.EventTypes = w.EventTypes
+	}
+	if w.Active != nil {
+		m.Active = *w.Active
+	}
+	return m
+}
+
+// ListWebhooks is dto for listing an organization's webhooks
+type ListWebhooks struct {
+	OrganizationID int `query:"organization_id" validate:"required"`
+}
+
+// ListWebhookDeliveries is dto for listing a webhook's deliveries
+type ListWebhookDeliveries struct {
+	Limit int `query:"limit" validate:"omitempty,min=1,max=500"`
+}
+
+// WebhookDelivery represents an event delivered, or being delivered, to a webhook
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int             `json:"webhook_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      *string         `json:"last_error,omitempty"`
+	Payload        json.RawMessage `json:"payload,omitempty" swaggertype:"object"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+
+	AttemptLog []WebhookDeliveryAttempt `json:"attempt_log,omitempty"`
+}
+
+// FromModel converts from model object to DTO
+func (d *WebhookDelivery) FromModel(m repo.WebhookDelivery) WebhookDelivery {
+	return WebhookDelivery{
+		ID:             m.ID,
+		WebhookID:      m.WebhookID,
+		EventID:        m.EventID,
+		EventType:      m.EventType,
+		Status:         m.Status,
+		Attempts:       m.Attempts,
+		LastStatusCode: m.LastStatusCode,
+		LastError:      m.LastError,
+		CreatedAt:      m.CreatedAt,
+		UpdatedAt:      m.UpdatedAt,
+	}
+}
+
+// FromModels converts list of model object to list of DTOs
+func (d *WebhookDelivery) FromModels(ms []repo.WebhookDelivery) []WebhookDelivery {
+	res := []WebhookDelivery{}
+	for _, m := range ms {
+		d := WebhookDelivery{}
+		res = append(res, d.FromModel(m))
+	}
+	return res
+}
+
+// WebhookDeliveryAttempt represents one http request made for a delivery. the receiver's response body is left
+// out, showing it would let callers read whatever a webhook url points at
+type WebhookDeliveryAttempt struct {
+	ID         int64     `json:"id"`
+	StatusCode *int      `json:"status_code,omitempty"`
+	Error      *string   `json:"error,omitempty"`
+	DurationMS int       `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// FromModel converts from model object to DTO
+func (a *WebhookDeliveryAttempt) FromModel(m repo.WebhookDeliveryAttempt) WebhookDeliveryAttempt {
+	return WebhookDeliveryAttempt{
+		ID:         m.ID,
+		StatusCode: m.StatusCode,
+		Error:      m.Error,
+		DurationMS: m.DurationMS,
+		CreatedAt:  m.CreatedAt,
+	}
+}
+
+// FromModels converts list of model object to list of DTOs
+func (a *WebhookDeliveryAttempt) FromModels(ms []repo.WebhookDeliveryAttempt) []WebhookDeliveryAttempt {
+	res := []WebhookDeliveryAttempt{}
+	for _, m := range ms {
+		a := WebhookDeliveryAttempt{}
+		res = append(res, a.FromModel(m))
+	}
+	return res
+}
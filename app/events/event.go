@@ -0,0 +1,126 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+// event types
+const (
+	TypeUserCreated = "user.created"
+	TypeUserUpdated = "user.updated"
+	TypeUserDeleted = "user.deleted"
+)
+
+const (
+	envelopeVersion = 1
+	envelopeSource  = "starter-app"
+)
+
+// Envelope wraps every domain event. consumers get each event at least once and should dedupe on ID
+type Envelope struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Version    int             `json:"version"`
+	Source     string          `json:"source"`
+	Tenant     string          `json:"tenant"`  // schema the change happened in
+	Subject    string          `json:"subject"` // what changed, e.g. user/123
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// User is the user data carried by user events
+type User struct {
+	ID        int    `json:"id"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// UserFromModel converts a user model to event data
+func UserFromModel(m repo.User) User {
+	return User{
+		ID:        m.ID,
+		Email:     m.Email,
+		FirstName: m.FirstName,
+		LastName:  m.LastName,
+	}
+}
+
+// UserCreated is the data of a user.created event
+type UserCreated struct {
+	User User `json:"user"`
+}
+
+// UserDeleted is the data of a user.deleted event, the user as it was before deletion
+type UserDeleted struct {
+	User User `json:"user"`
+}
+
+// UserUpdated is the data of a user.updated event
+type UserUpdated struct {
+	User     User     `json:"user"`
+	Previous User     `json:"previous"`
+	Changed  []string `json:"changed"` // json names of the fields that changed
+}
+
+// NewUserUpdated builds user.updated data, listing the fields that differ between before and after
+func NewUserUpdated(before repo.User, after repo.User) UserUpdated {
+	res := UserUpdated{
+		User:     UserFromModel(after),
+		Previous: UserFromModel(before),
+		Changed:  []string{},
+	}
+	if before.Email != after.Email {
+		res.Changed = append(res.Changed, "email")
+	}
+	if before.FirstName != after.FirstName {
+		res.Changed = append(res.Changed, "first_name")
+	}
+	if before.LastName != after.LastName {
+		res.Changed = append(res.Changed, "last_name")
+	}
+	return res
+}
+
+// New builds an envelope around data
+func New(eventType string, tenant string, subject string, data any) (Envelope, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return Envelope{}, errors.Wrapf(err, "problem marshalling %s event", eventType)
+	}
+	return Envelope{
+		ID:         uuid.New().String(),
+		Type:       eventType,
+		Version:    envelopeVersion,
+		Source:     envelopeSource,
+		Tenant:     tenant,
+		Subject:    subject,
+		OccurredAt: time.Now().UTC(),
+		Data:       b,
+	}, nil
+}
+
+// Record writes an event to the outbox as part of tx, so it is published if and only if tx commits. every tenant
+// shares the outbox in the default schema, Envelope.Tenant says where the change happened
+func Record(ctx context.Context, tx repo.Querier, outboxRepo repo.IOutboxRepo, eventType string, tenant string, subject string, data any) error {
+	env, err := New(eventType, tenant, subject, data)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(env)
+	if err != nil {
+		return errors.Wrapf(err, "problem marshalling %s envelope", eventType)
+	}
+	return outboxRepo.InsertOutboxEvent(ctx, tx, repo.DefaultSchema, repo.OutboxEvent{
+		EventID:   env.ID,
+		EventType: env.Type,
+		Payload:   b,
+	})
+}
@@ -0,0 +1,138 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+type fakeOutboxRepo struct {
+	inserted  []repo.OutboxEvent
+	published []int64
+	failed    map[int64]time.Time
+}
+
+func (r *fakeOutboxRepo) InsertOutboxEvent(_ context.Context, _ repo.Querier, _ string, e repo.OutboxEvent) error {
+	r.inserted = append(r.inserted, e)
+	return nil
+}
+
+func (r *fakeOutboxRepo) ClaimUnpublishedEvents(_ context.Context, _ repo.Querier, _ string, limit int, _ time.Time) ([]repo.OutboxEvent, error) {
+	return r.inserted[:min(limit, len(r.inserted))], nil
+}
+
+func (r *fakeOutboxRepo) MarkEventPublished(_ context.Context, _ repo.Querier, _ string, id int64) error {
+	r.published = append(r.published, id)
+	return nil
+}
+
+func (r *fakeOutboxRepo) MarkEventFailed(_ context.Context, _ repo.Querier, _ string, id int64, _ string, next time.Time) error {
+	if r.failed == nil {
+		r.failed = map[int64]time.Time{}
+	}
+	r.failed[id] = next
+	return nil
+}
+
+func (r *fakeOutboxRepo) DeletePublishedEvents(_ context.Context, _ repo.Querier, _ string, _ time.Time) (int64, error) {
+	return 0, nil
+}
+
+// fakeSink fails events for subjects in failSubjects
+type fakeSink struct {
+	failSubjects map[string]bool
+	received     []Envelope
+}
+
+func (s *fakeSink) Name() string { return "fake" }
+
+func (s *fakeSink) Publish(_ context.Context, env Envelope) error {
+	if s.failSubjects[env.Subject] {
+		return errors.New("boom")
+	}
+	s.received = append(s.received, env)
+	return nil
+}
+
+func TestNewUserUpdated(t *testing.T) {
+	before := repo.User{ID: 1, Email: "a@example.com", FirstName: "foo", LastName: "bar"}
+	after := repo.User{ID: 1, Email: "b@example.com", FirstName: "foo", LastName: "baz"}
+
+	data := NewUserUpdated(before, after)
+	assert.Equal(t, []string{"email", "last_name"}, data.Changed)
+	assert.Equal(t, "a@example.com", data.Previous.Email)
+	assert.Equal(t, "b@example.com", data.User.Email)
+
+	assert.Empty(t, NewUserUpdated(before, before).Changed)
+}
+
+func TestRecord(t *testing.T) {
+	or := &fakeOutboxRepo{}
+	u := repo.User{ID: 7, Email: "a@example.com", FirstName: "foo", LastName: "bar"}
+	err := Record(context.Background(), nil, or, TypeUserCreated, "tenant_acme", "user/7", UserCreated{User: UserFromModel(u)})
+	assert.NoError(t, err)
+	assert.Len(t, or.inserted, 1)
+	assert.Equal(t, TypeUserCreated, or.inserted[0].EventType)
+
+	var env Envelope
+	assert.NoError(t, json.Unmarshal(or.inserted[0].Payload, &env))
+	assert.Equal(t, or.inserted[0].EventID, env.ID)
+	assert.Equal(t, TypeUserCreated, env.Type)
+	assert.Equal(t, envelopeVersion, env.Version)
+	assert.Equal(t, "tenant_acme", env.Tenant)
+	assert.Equal(t, "user/7", env.Subject)
+	assert.JSONEq(t, `{"user":{"id":7,"email":"a@example.com","first_name":"foo","last_name":"bar"}}`, string(env.Data))
+}
+
+func TestRelay_publishAndMarkBatch(t *testing.T) {
+	or := &fakeOutboxRepo{}
+	ctx := context.Background()
+	for _, subject := range []string{"user/1", "user/2"} {
+		assert.NoError(t, Record(ctx, nil, or, TypeUserCreated, repo.DefaultSchema, subject, UserCreated{}))
+	}
+	or.inserted = append(or.inserted, repo.OutboxEvent{EventID: "bad", Payload: []byte("not json")})
+	for i := range or.inserted {
+		or.inserted[i].ID = int64(i + 1)
+	}
+	or.inserted[1].Attempts = 2
+
+	ok := &fakeSink{}
+	flaky := &fakeSink{failSubjects: map[string]bool{"user/2": true}}
+	r := NewRelay(nil, or, []Sink{ok, flaky}, RelayOptions{BaseBackoff: time.Second, MaxBackoff: time.Minute})
+
+	start := time.Now()
+	events, err := or.ClaimUnpublishedEvents(ctx, nil, repo.DefaultSchema, 10, start)
+	assert.NoError(t, err)
+	pubErrs := r.publishBatch(ctx, events)
+	assert.Len(t, pubErrs, 3)
+	assert.NoError(t, r.markBatch(ctx, nil, events, pubErrs))
+
+	assert.Equal(t, []int64{1}, or.published)
+	assert.Len(t, or.failed, 2)
+	// third attempt backs off 1s << 2
+	assert.WithinDuration(t, start.Add(4*time.Second), or.failed[2], time.Second)
+
+	// the healthy sink saw user/2 even though it failed overall, it will see it again on retry
+	assert.Len(t, ok.received, 2)
+	assert.Len(t, flaky.received, 1)
+}
+
+func TestNewSinks(t *testing.T) {
+	sinks, err := NewSinks([]string{SinkLog})
+	assert.NoError(t, err)
+	assert.Len(t, sinks, 1)
+
+	_, err = NewSinks([]string{"kafka"})
+	assert.Error(t, err)
+
+	custom := &fakeSink{}
+	sinks, err = NewSinks([]string{"fake", SinkLog}, custom)
+	assert.NoError(t, err)
+	assert.Equal(t, []Sink{custom, NewLogSink()}, sinks)
+}
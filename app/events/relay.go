@@ -0,0 +1,165 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+const (
+	defaultRelayBatchSize    = 100
+	defaultRelayPollInterval = time.Second
+	defaultRelayClaimTimeout = 5 * time.Minute
+	defaultRelayBaseBackoff  = 5 * time.Second
+	defaultRelayMaxBackoff   = 10 * time.Minute
+)
+
+// RelayOptions controls the relay. zero values use the defaults
+type RelayOptions struct {
+	BatchSize    int
+	PollInterval time.Duration // wait between polls when the outbox is empty
+	ClaimTimeout time.Duration // how long a batch has to be published before other relays may retry it
+	BaseBackoff  time.Duration // wait before the first retry of a failed event, doubled on each subsequent retry
+	MaxBackoff   time.Duration
+}
+
+func (o RelayOptions) withDefaults() RelayOptions {
+	if o.BatchSize <= 0 {
+		o.BatchSize = defaultRelayBatchSize
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = defaultRelayPollInterval
+	}
+	if o.ClaimTimeout <= 0 {
+		o.ClaimTimeout = defaultRelayClaimTimeout
+	}
+	if o.BaseBackoff <= 0 {
+		o.BaseBackoff = defaultRelayBaseBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = defaultRelayMaxBackoff
+	}
+	return o
+}
+
+// Relay publishes outbox events to sinks. an event is only marked published once every sink accepted it, so a
+// failure in one sink means the others see it again on retry: delivery is at least once, and failed events can
+// overtake later ones
+type Relay struct {
+	db         *repo.DB
+	outboxRepo repo.IOutboxRepo
+	sinks      []Sink
+	opts       RelayOptions
+}
+
+// NewRelay creates a new relay
+func NewRelay(db *repo.DB, outboxRepo repo.IOutboxRepo, sinks []Sink, opts RelayOptions) *Relay {
+	return &Relay{
+		db:         db,
+		outboxRepo: outboxRepo,
+		sinks:      sinks,
+		opts:       opts.withDefaults(),
+	}
+}
+
+// Run relays events until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	slog.InfoContext(ctx, "starting outbox relay", slog.Int("sinks", len(r.sinks)))
+	for {
+		n, err := r.RelayOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "problem relaying outbox events", slog.Any("error", err))
+		}
+
+		// a full batch likely means more events are waiting, go again straight away
+		wait := r.opts.PollInterval
+		if n == r.opts.BatchSize {
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// RelayOnce publishes one batch of due events, returning how many were attempted. no transaction is open while
+// publishing, sinks may be slow or remote, so the batch is claimed first and its outcome recorded afterwards
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	claimedUntil := time.Now().Add(r.opts.ClaimTimeout)
+	events, err := r.outboxRepo.ClaimUnpublishedEvents(ctx, r.db, repo.DefaultSchema, r.opts.BatchSize, claimedUntil)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	pubErrs := r.publishBatch(ctx, events)
+	err = repo.WithTx(ctx, r.db, nil, func(tx repo.Querier) error {
+		return r.markBatch(ctx, tx, events, pubErrs)
+	})
+	return len(events), err
+}
+
+// publishBatch publishes claimed events, returning the error publishing each
+func (r *Relay) publishBatch(ctx context.Context, events []repo.OutboxEvent) []error {
+	errs := make([]error, len(events))
+	for i, e := range events {
+		errs[i] = r.publish(ctx, e)
+	}
+	return errs
+}
+
+// markBatch records which events were published and schedules a retry of the rest
+func (r *Relay) markBatch(ctx context.Context, tx repo.Querier, events []repo.OutboxEvent, pubErrs []error) error {
+	for i, e := range events {
+		pubErr := pubErrs[i]
+		if pubErr == nil {
+			if err := r.outboxRepo.MarkEventPublished(ctx, tx, repo.DefaultSchema, e.ID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		next := time.Now().Add(r.backoff(e.Attempts))
+		slog.WarnContext(ctx, "problem publishing event, will retry",
+			slog.Group("event",
+				slog.String("id", e.EventID),
+				slog.String("type", e.EventType),
+				slog.Int("attempt", e.Attempts+1),
+			),
+			slog.Time("next_attempt_at", next),
+			slog.Any("error", pubErr),
+		)
+		if err := r.outboxRepo.MarkEventFailed(ctx, tx, repo.DefaultSchema, e.ID, pubErr.Error(), next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Relay) publish(ctx context.Context, e repo.OutboxEvent) error {
+	var env Envelope
+	if err := json.Unmarshal(e.Payload, &env); err != nil {
+		return errors.Wrap(err, "problem unmarshalling event envelope")
+	}
+	for _, s := range r.sinks {
+		if err := s.Publish(ctx, env); err != nil {
+			return errors.Wrapf(err, "sink %s", s.Name())
+		}
+	}
+	return nil
+}
+
+// backoff returns the wait before retrying an event that has failed attempts times
+func (r *Relay) backoff(attempts int) time.Duration {
+	wait := r.opts.BaseBackoff << attempts
+	if wait <= 0 || wait > r.opts.MaxBackoff {
+		wait = r.opts.MaxBackoff
+	}
+	return wait
+}
@@ -0,0 +1,64 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+
+	"github.com/pkg/errors"
+)
+
+// sink names, see platform.OutboxConfig
+const (
+	SinkLog = "log"
+)
+
+// Sink receives published events. Publish may be called more than once for the same event
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, env Envelope) error
+}
+
+// NewSinks creates the named sinks. sinks built outside this package, e.g. webhooks, are passed in as available
+// and selected by their Name
+func NewSinks(names []string, available ...Sink) ([]Sink, error) {
+	var res []Sink
+	for _, name := range names {
+		if name == SinkLog {
+			res = append(res, NewLogSink())
+			continue
+		}
+		i := slices.IndexFunc(available, func(s Sink) bool { return s.Name() == name })
+		if i < 0 {
+			return nil, errors.Errorf("unknown event sink: %q", name)
+		}
+		res = append(res, available[i])
+	}
+	return res, nil
+}
+
+// LogSink is a Sink that only logs events, for local development
+type LogSink struct{}
+
+// NewLogSink creates a new log sink
+func NewLogSink() Sink {
+	return &LogSink{}
+}
+
+// Name of the sink
+func (s *LogSink) Name() string {
+	return SinkLog
+}
+
+// Publish logs the event
+func (s *LogSink) Publish(ctx context.Context, env Envelope) error {
+	slog.InfoContext(ctx, "publishing event",
+		slog.Group("event",
+			slog.String("id", env.ID),
+			slog.String("type", env.Type),
+			slog.String("tenant", env.Tenant),
+			slog.String("subject", env.Subject),
+		),
+	)
+	return nil
+}
@@ -0,0 +1,75 @@
+package health
+
+import (
+	"context"
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/repo"
+	"github.com/drmaples/starter-app/db"
+)
+
+// DBCheck fails when the db cannot be reached
+func DBCheck(conn *repo.DB) Check {
+	return Check{
+		Name: "db",
+		Run: func(ctx context.Context) error {
+			return repo.Ping(ctx, conn)
+		},
+	}
+}
+
+// MigrationCheck fails when a schema is behind the migrations this binary was built with, or its last migration
+// failed part way. a schema ahead of the binary passes, it is what a rolling deploy looks like once the new version
+// has migrated
+func MigrationCheck(conn *repo.DB, schema string) Check {
+	return Check{
+		Name: "migrations",
+		Run: func(ctx context.Context) error {
+			want, err := db.LatestMigrationVersion()
+			if err != nil {
+				return err
+			}
+			return checkMigrationVersion(ctx, conn, schema, want)
+		},
+	}
+}
+
+// TenantMigrationCheck is MigrationCheck for every tenant schema, which the migrate cli walks after the default schema
+func TenantMigrationCheck(conn *repo.DB) Check {
+	return Check{
+		Name: "tenant_migrations",
+		Run: func(ctx context.Context) error {
+			want, err := db.LatestMigrationVersion()
+			if err != nil {
+				return err
+			}
+			schemas, err := repo.ListTenantSchemas(ctx, conn)
+			if err != nil {
+				return err
+			}
+			for _, schema := range schemas {
+				if err := checkMigrationVersion(ctx, conn, schema, want); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func checkMigrationVersion(ctx context.Context, tx repo.Querier, schema string, want int) error {
+	version, dirty, err := repo.GetMigrationVersion(ctx, tx, schema)
+	if errors.Is(err, repo.ErrNoRowsFound) {
+		return errors.Errorf("schema %s has not been migrated, want version %d", schema, want)
+	}
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return errors.Errorf("schema %s migration %d is dirty", schema, version)
+	}
+	if version < want {
+		return errors.Errorf("schema %s is at migration %d, want %d", schema, version, want)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// check statuses
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+const (
+	defaultTimeout  = 2 * time.Second
+	defaultCacheTTL = 5 * time.Second
+)
+
+// Options controls a Registry. zero values use the defaults
+type Options struct {
+	Timeout  time.Duration // per check, unless the check sets its own
+	CacheTTL time.Duration // how long a result is reused, so frequent probes do not hammer dependencies
+}
+
+func (o Options) withDefaults() Options {
+	if o.Timeout <= 0 {
+		o.Timeout = defaultTimeout
+	}
+	if o.CacheTTL <= 0 {
+		o.CacheTTL = defaultCacheTTL
+	}
+	return o
+}
+
+// Check is one thing the server depends on
+type Check struct {
+	Name    string
+	Run     func(ctx context.Context) error // returns why the check failed, must give up once ctx is done
+	Timeout time.Duration                   // defaults to Options.Timeout
+
+	// Liveness also runs the check for liveness, failing it gets the server restarted. keep to checks a restart
+	// would fix, never external dependencies like the db
+	Liveness bool
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Name      string
+	Status    string
+	Error     string
+	Duration  time.Duration
+	CheckedAt time.Time
+}
+
+// Report is the outcome of every check run, StatusOK only when all of them passed
+type Report struct {
+	Status string
+	Checks []Result
+}
+
+// OK reports whether every check passed
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+type entry struct {
+	check Check
+
+	mu     sync.Mutex // one run of a check at a time, concurrent probes share its result
+	result *Result
+}
+
+// Registry runs registered checks for liveness and readiness probes
+type Registry struct {
+	opts Options
+	now  func() time.Time
+
+	mu      sync.RWMutex
+	entries []*entry
+}
+
+// NewRegistry creates a new registry
+func NewRegistry(opts Options) *Registry {
+	return &Registry{
+		opts: opts.withDefaults(),
+		now:  time.Now,
+	}
+}
+
+// Register adds a check. checks are reported in the order they are registered
+func (r *Registry) Register(c Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, &entry{check: c})
+}
+
+// Live runs the liveness checks
+func (r *Registry) Live(ctx context.Context) Report {
+	return r.run(ctx, func(c Check) bool { return c.Liveness })
+}
+
+// Ready runs every check
+func (r *Registry) Ready(ctx context.Context) Report {
+	return r.run(ctx, func(Check) bool { return true })
+}
+
+func (r *Registry) run(ctx context.Context, include func(Check) bool) Report {
+	r.mu.RLock()
+	var entries []*entry
+	for _, e := range r.entries {
+		if include(e.check) {
+			entries = append(entries, e)
+		}
+	}
+	r.mu.RUnlock()
+
+	res := Report{Status: StatusOK, Checks: make([]Result, len(entries))}
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res.Checks[i] = r.result(ctx, e)
+		}()
+	}
+	wg.Wait()
+
+	for _, c := range res.Checks {
+		if c.Status != StatusOK {
+			res.Status = StatusFail
+		}
+	}
+	return res
+}
+
+// result is the cached result of a check, running it again once the cached one is stale
+func (r *Registry) result(ctx context.Context, e *entry) Result {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.result != nil && r.now().Sub(e.result.CheckedAt) < r.opts.CacheTTL {
+		return *e.result
+	}
+
+	timeout := e.check.Timeout
+	if timeout <= 0 {
+		timeout = r.opts.Timeout
+	}
+	// a probe that gives up should not cancel the run other probes are waiting on
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	start := r.now()
+	err := runCheck(ctx, e.check)
+	res := Result{
+		Name:      e.check.Name,
+		Status:    StatusOK,
+		Duration:  r.now().Sub(start),
+		CheckedAt: start,
+	}
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+	e.result = &res
+	return res
+}
+
+// runCheck runs a check, not waiting past ctx for one that ignores it
+func runCheck(ctx context.Context, c Check) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Run(ctx)
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "check timed out")
+	}
+}
@@ -0,0 +1,81 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_Ready(t *testing.T) {
+	r := NewRegistry(Options{})
+	r.Register(Check{Name: "db", Run: func(context.Context) error { return nil }})
+	r.Register(Check{Name: "cache", Run: func(context.Context) error { return errors.New("connection refused") }})
+
+	report := r.Ready(context.Background())
+	assert.False(t, report.OK())
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Len(t, report.Checks, 2)
+	assert.Equal(t, "db", report.Checks[0].Name)
+	assert.Equal(t, StatusOK, report.Checks[0].Status)
+	assert.Equal(t, "cache", report.Checks[1].Name)
+	assert.Equal(t, StatusFail, report.Checks[1].Status)
+	assert.Equal(t, "connection refused", report.Checks[1].Error)
+}
+
+func TestRegistry_Live(t *testing.T) {
+	r := NewRegistry(Options{})
+	r.Register(Check{Name: "db", Run: func(context.Context) error { return errors.New("down") }})
+	r.Register(Check{Name: "deadlock", Liveness: true, Run: func(context.Context) error { return nil }})
+
+	// a db outage must not get the server restarted
+	report := r.Live(context.Background())
+	assert.True(t, report.OK())
+	assert.Len(t, report.Checks, 1)
+	assert.Equal(t, "deadlock", report.Checks[0].Name)
+
+	assert.True(t, NewRegistry(Options{}).Live(context.Background()).OK(), "no checks is ok")
+}
+
+func TestRegistry_timeout(t *testing.T) {
+	r := NewRegistry(Options{Timeout: time.Hour})
+	r.Register(Check{Name: "slow", Timeout: 10 * time.Millisecond, Run: func(context.Context) error {
+		select {} // ignores ctx
+	}})
+
+	report := r.Ready(context.Background())
+	assert.False(t, report.OK())
+	assert.Contains(t, report.Checks[0].Error, "check timed out")
+}
+
+func TestRegistry_cache(t *testing.T) {
+	now := time.Now()
+	r := NewRegistry(Options{CacheTTL: time.Minute})
+	r.now = func() time.Time { return now }
+
+	var runs atomic.Int32
+	r.Register(Check{Name: "db", Run: func(context.Context) error {
+		runs.Add(1)
+		return nil
+	}})
+
+	// concurrent probes share one run
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.True(t, r.Ready(context.Background()).OK())
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), runs.Load())
+
+	now = now.Add(time.Minute)
+	r.Ready(context.Background())
+	assert.Equal(t, int32(2), runs.Load(), "stale results are checked again")
+}
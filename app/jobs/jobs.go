@@ -0,0 +1,80 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+const (
+	// DefaultQueue is used when a job does not name a queue
+	DefaultQueue = "default"
+
+	defaultMaxAttempts = 5
+)
+
+// EnqueueOptions controls how a job is queued. the zero value runs the job now on DefaultQueue
+type EnqueueOptions struct {
+	Queue       string
+	RunAt       time.Time // zero value means now
+	UniqueKey   string    // optional. while a job with this key is pending or running, enqueueing another returns repo.ErrDuplicateJob
+	MaxAttempts int       // zero value means defaultMaxAttempts
+}
+
+// Client enqueues jobs for the worker binary to run
+type Client struct {
+	db      repo.Querier
+	schema  string
+	jobRepo repo.IJobRepo
+}
+
+// NewClient creates a new job client. jobs are enqueued on db unless a transaction is passed to EnqueueTx
+func NewClient(db repo.Querier, schema string, jobRepo repo.IJobRepo) *Client {
+	return &Client{
+		db:      db,
+		schema:  schema,
+		jobRepo: jobRepo,
+	}
+}
+
+// Enqueue queues a job of the given kind. payload is marshalled to json and handed to the kind's handler
+func (c *Client) Enqueue(ctx context.Context, kind string, payload any, opts EnqueueOptions) (*repo.Job, error) {
+	return c.EnqueueTx(ctx, c.db, kind, payload, opts)
+}
+
+// EnqueueTx queues a job as part of tx, so it only runs if tx commits
+func (c *Client) EnqueueTx(ctx context.Context, tx repo.Querier, kind string, payload any, opts EnqueueOptions) (*repo.Job, error) {
+	if kind == "" {
+		return nil, errors.New("job kind is required")
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem marshalling payload for job %s", kind)
+	}
+
+	j := repo.Job{
+		Queue:       opts.Queue,
+		Kind:        kind,
+		Payload:     b,
+		RunAt:       opts.RunAt,
+		MaxAttempts: opts.MaxAttempts,
+	}
+	if j.Queue == "" {
+		j.Queue = DefaultQueue
+	}
+	if j.RunAt.IsZero() {
+		j.RunAt = time.Now()
+	}
+	if j.MaxAttempts <= 0 {
+		j.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.UniqueKey != "" {
+		j.UniqueKey = &opts.UniqueKey
+	}
+
+	return c.jobRepo.EnqueueJob(ctx, tx, c.schema, j)
+}
@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"context"
+
+	"github.com/drmaples/starter-app/app/mail"
+)
+
+// KindSendEmail sends a mail.Message
+const KindSendEmail = "mail.send"
+
+// Mailer is a mail.Mailer that sends through the job queue. unlike mail.QueuedMailer, queued messages survive
+// restarts and are retried with backoff by the worker binary
+type Mailer struct {
+	client *Client
+}
+
+// NewMailer creates a mailer that enqueues KindSendEmail jobs
+func NewMailer(client *Client) mail.Mailer {
+	return &Mailer{client: client}
+}
+
+// Send enqueues the message
+func (m *Mailer) Send(ctx context.Context, msg mail.Message) error {
+	_, err := m.client.Enqueue(ctx, KindSendEmail, msg, EnqueueOptions{})
+	return err
+}
+
+// RegisterMail registers the KindSendEmail handler, sending with mailer
+func RegisterMail(w *Worker, mailer mail.Mailer) {
+	Register(w, KindSendEmail, mailer.Send)
+}
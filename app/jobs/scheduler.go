@@ -0,0 +1,307 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+const (
+	// ScheduleOff disables a schedule when used as its spec in config
+	ScheduleOff = "off"
+
+	schedulerLockName          = "starter-app/scheduler"
+	defaultSchedulerTick       = time.Second
+	defaultLeaderRetryInterval = 10 * time.Second
+	defaultScheduleRunTimeout  = 10 * time.Minute
+)
+
+// Schedule is a task run on a cron spec, e.g. "0 3 * * *" or "@hourly"
+type Schedule struct {
+	Name string
+	Spec string
+	Run  func(ctx context.Context) error
+}
+
+// EnqueueSchedule returns a schedule that enqueues a job of the given kind on each tick. the tick is the unique key
+// so a job is queued at most once per tick
+func EnqueueSchedule(client *Client, name string, spec string, kind string) Schedule {
+	return Schedule{
+		Name: name,
+		Spec: spec,
+		Run: func(ctx context.Context) error {
+			_, err := client.Enqueue(ctx, kind, map[string]string{"schedule": name}, EnqueueOptions{
+				UniqueKey: fmt.Sprintf("schedule:%s", name),
+			})
+			if errors.Is(err, repo.ErrDuplicateJob) {
+				return nil // previous tick's job has not finished yet
+			}
+			return err
+		},
+	}
+}
+
+// SchedulerOptions controls the scheduler. zero values use the defaults
+type SchedulerOptions struct {
+	Instance            string        // identifies this replica in run history, defaults to hostname and pid
+	Tick                time.Duration // how often due schedules are checked
+	LeaderRetryInterval time.Duration // how often a follower tries to become leader
+	RunTimeout          time.Duration // max time a single run may take
+}
+
+func (o SchedulerOptions) withDefaults() SchedulerOptions {
+	if o.Instance == "" {
+		host, _ := os.Hostname()
+		o.Instance = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if o.Tick <= 0 {
+		o.Tick = defaultSchedulerTick
+	}
+	if o.LeaderRetryInterval <= 0 {
+		o.LeaderRetryInterval = defaultLeaderRetryInterval
+	}
+	if o.RunTimeout <= 0 {
+		o.RunTimeout = defaultScheduleRunTimeout
+	}
+	return o
+}
+
+type scheduleEntry struct {
+	Schedule
+	cron    cron.Schedule
+	next    time.Time
+	running atomic.Bool
+}
+
+// Scheduler fires schedules on every replica that runs it, but only the replica holding the scheduler advisory lock,
+// the leader, actually runs them
+type Scheduler struct {
+	db           *repo.DB
+	schema       string
+	scheduleRepo repo.IScheduleRepo
+	opts         SchedulerOptions
+	entries      []*scheduleEntry
+
+	leaderConn *sql.Conn
+	lastTry    time.Time
+	wg         sync.WaitGroup
+}
+
+// NewScheduler creates a new scheduler. add schedules before calling Run
+func NewScheduler(db *repo.DB, schema string, scheduleRepo repo.IScheduleRepo, opts SchedulerOptions) *Scheduler {
+	return &Scheduler{
+		db:           db,
+		schema:       schema,
+		scheduleRepo: scheduleRepo,
+		opts:         opts.withDefaults(),
+	}
+}
+
+// Add adds a schedule. names must be unique
+func (s *Scheduler) Add(sc Schedule) error {
+	if s.entry(sc.Name) != nil {
+		return errors.Errorf("duplicate schedule name: %s", sc.Name)
+	}
+	parsed, err := cron.ParseStandard(sc.Spec)
+	if err != nil {
+		return errors.Wrapf(err, "invalid cron spec for schedule %s", sc.Name)
+	}
+	s.entries = append(s.entries, &scheduleEntry{Schedule: sc, cron: parsed})
+	return nil
+}
+
+// Configure applies schedules from config, name to cron spec. a name already added from code has its spec replaced,
+// or is removed if the spec is ScheduleOff. any other name becomes a schedule enqueueing a job of that kind
+func (s *Scheduler) Configure(specs map[string]string, client *Client) error {
+	for name, spec := range specs {
+		e := s.entry(name)
+		switch {
+		case spec == ScheduleOff:
+			s.remove(name)
+		case e != nil:
+			parsed, err := cron.ParseStandard(spec)
+			if err != nil {
+				return errors.Wrapf(err, "invalid cron spec for schedule %s", name)
+			}
+			e.Spec, e.cron = spec, parsed
+		default:
+			if err := s.Add(EnqueueSchedule(client, name, spec, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) entry(name string) *scheduleEntry {
+	for _, e := range s.entries {
+		if e.Name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) remove(name string) {
+	for i, e := range s.entries {
+		if e.Name == name {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// Run checks for due schedules until ctx is cancelled, then waits for running ones to finish
+func (s *Scheduler) Run(ctx context.Context) {
+	for _, e := range s.entries {
+		slog.InfoContext(ctx, "registered schedule", slog.String("name", e.Name), slog.String("spec", e.Spec))
+	}
+
+	// runs already started should finish and record their result even when shutting down
+	runCtx := context.WithoutCancel(ctx)
+	defer s.wg.Wait()
+	defer s.resign(runCtx)
+
+	ticker := time.NewTicker(s.opts.Tick)
+	defer ticker.Stop()
+	for {
+		if s.lead(ctx) {
+			s.fireDue(runCtx, time.Now())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lead reports whether this replica is the leader, trying to become it if not. leadership is a session advisory
+// lock on a dedicated connection, so it is lost if that connection dies
+func (s *Scheduler) lead(ctx context.Context) bool {
+	if s.leaderConn != nil {
+		if err := s.leaderConn.PingContext(ctx); err == nil {
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		slog.WarnContext(ctx, "lost scheduler leadership, connection is gone", slog.String("instance", s.opts.Instance))
+		_ = s.leaderConn.Close()
+		s.leaderConn = nil
+	}
+
+	if time.Since(s.lastTry) < s.opts.LeaderRetryInterval {
+		return false
+	}
+	s.lastTry = time.Now()
+
+	conn, err := s.db.SQL.Conn(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "problem getting scheduler connection", slog.Any("error", err))
+		return false
+	}
+	locked, err := repo.TryAdvisoryLock(ctx, repo.FromSQL(conn), repo.AdvisoryLockKey(schedulerLockName))
+	if err != nil || !locked {
+		if err != nil {
+			slog.ErrorContext(ctx, "problem electing scheduler leader", slog.Any("error", err))
+		}
+		_ = conn.Close()
+		return false
+	}
+
+	slog.InfoContext(ctx, "became scheduler leader", slog.String("instance", s.opts.Instance))
+	s.leaderConn = conn
+	// only ticks from now on, ticks missed while nobody was leader are not made up
+	now := time.Now()
+	for _, e := range s.entries {
+		e.next = e.cron.Next(now)
+	}
+	return true
+}
+
+func (s *Scheduler) resign(ctx context.Context) {
+	if s.leaderConn == nil {
+		return
+	}
+	if err := repo.AdvisoryUnlock(ctx, repo.FromSQL(s.leaderConn), repo.AdvisoryLockKey(schedulerLockName)); err != nil {
+		slog.ErrorContext(ctx, "problem releasing scheduler leadership", slog.Any("error", err))
+	}
+	_ = s.leaderConn.Close()
+	s.leaderConn = nil
+}
+
+// fireDue starts every schedule whose next tick is at or before now
+func (s *Scheduler) fireDue(ctx context.Context, now time.Time) {
+	for _, e := range s.entries {
+		if e.next.IsZero() {
+			e.next = e.cron.Next(now)
+		}
+		if now.Before(e.next) {
+			continue
+		}
+		scheduledAt := e.next
+		e.next = e.cron.Next(now)
+
+		if !e.running.CompareAndSwap(false, true) {
+			slog.WarnContext(ctx, "skipping schedule tick, previous run still going",
+				slog.String("name", e.Name),
+				slog.Time("scheduled_at", scheduledAt),
+			)
+			continue
+		}
+		s.wg.Add(1)
+		go func(e *scheduleEntry) {
+			defer s.wg.Done()
+			defer e.running.Store(false)
+			s.fire(ctx, e, scheduledAt)
+		}(e)
+	}
+}
+
+func (s *Scheduler) fire(ctx context.Context, e *scheduleEntry, scheduledAt time.Time) {
+	logger := slog.With(slog.String("schedule", e.Name), slog.Time("scheduled_at", scheduledAt))
+
+	run, err := s.scheduleRepo.StartScheduleRun(ctx, s.db, s.schema, e.Name, scheduledAt, s.opts.Instance)
+	if err != nil {
+		if errors.Is(err, repo.ErrDuplicateScheduleRun) {
+			logger.InfoContext(ctx, "schedule tick already run by another instance")
+			return
+		}
+		logger.ErrorContext(ctx, "problem recording schedule run", slog.Any("error", err))
+		return
+	}
+
+	start := time.Now()
+	runErr := s.runSchedule(ctx, e)
+	if err := s.scheduleRepo.FinishScheduleRun(ctx, s.db, s.schema, run.ID, runErr); err != nil {
+		logger.ErrorContext(ctx, "problem recording schedule run result", slog.Any("error", err))
+	}
+	if runErr != nil {
+		logger.ErrorContext(ctx, "schedule run failed", slog.Any("error", runErr))
+		return
+	}
+	logger.InfoContext(ctx, "schedule run succeeded", slog.Duration("duration", time.Since(start)))
+}
+
+// runSchedule runs the schedule, turning panics into errors
+func (s *Scheduler) runSchedule(ctx context.Context, e *scheduleEntry) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, s.opts.RunTimeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("schedule panicked: %v", r)
+		}
+	}()
+	return e.Run(ctx)
+}
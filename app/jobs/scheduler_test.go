@@ -0,0 +1,129 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+// fakeScheduleRepo records runs, rejecting a tick that was already started like the unique index does
+type fakeScheduleRepo struct {
+	mu       sync.Mutex
+	runs     []repo.ScheduleRun
+	finished map[int64]error
+}
+
+func (r *fakeScheduleRepo) StartScheduleRun(_ context.Context, _ repo.Querier, _ string, name string, scheduledAt time.Time, instance string) (*repo.ScheduleRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, run := range r.runs {
+		if run.Name == name && run.ScheduledAt.Equal(scheduledAt) {
+			return nil, repo.ErrDuplicateScheduleRun
+		}
+	}
+	run := repo.ScheduleRun{ID: int64(len(r.runs) + 1), Name: name, ScheduledAt: scheduledAt, Instance: instance}
+	r.runs = append(r.runs, run)
+	return &run, nil
+}
+
+func (r *fakeScheduleRepo) FinishScheduleRun(_ context.Context, _ repo.Querier, _ string, runID int64, runErr error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.finished == nil {
+		r.finished = map[int64]error{}
+	}
+	r.finished[runID] = runErr
+	return nil
+}
+
+func (r *fakeScheduleRepo) ListScheduleRuns(_ context.Context, _ repo.Querier, _ string, _ string, _ int) ([]repo.ScheduleRun, error) {
+	return r.runs, nil
+}
+
+func TestScheduler_Add(t *testing.T) {
+	s := NewScheduler(nil, repo.DefaultSchema, &fakeScheduleRepo{}, SchedulerOptions{})
+	noop := func(context.Context) error { return nil }
+
+	assert.NoError(t, s.Add(Schedule{Name: "a", Spec: "*/5 * * * *", Run: noop}))
+	assert.NoError(t, s.Add(Schedule{Name: "b", Spec: "@daily", Run: noop}))
+	assert.Error(t, s.Add(Schedule{Name: "a", Spec: "@daily", Run: noop}), "duplicate name")
+	assert.Error(t, s.Add(Schedule{Name: "c", Spec: "not a spec", Run: noop}))
+}
+
+func TestScheduler_Configure(t *testing.T) {
+	s := NewScheduler(nil, repo.DefaultSchema, &fakeScheduleRepo{}, SchedulerOptions{})
+	noop := func(context.Context) error { return nil }
+	assert.NoError(t, s.Add(Schedule{Name: "override", Spec: "@daily", Run: noop}))
+	assert.NoError(t, s.Add(Schedule{Name: "disable", Spec: "@daily", Run: noop}))
+
+	jr := &fakeJobRepo{}
+	err := s.Configure(map[string]string{
+		"override":     "@hourly",
+		"disable":      ScheduleOff,
+		"report.daily": "0 2 * * *",
+	}, NewClient(nil, repo.DefaultSchema, jr))
+	assert.NoError(t, err)
+
+	assert.Len(t, s.entries, 2)
+	assert.Equal(t, "@hourly", s.entry("override").Spec)
+	assert.Nil(t, s.entry("disable"))
+
+	// schedules only known to config enqueue a job of the same kind
+	assert.NoError(t, s.entry("report.daily").Run(context.Background()))
+	assert.Len(t, jr.enqueued, 1)
+	assert.Equal(t, "report.daily", jr.enqueued[0].Kind)
+	assert.Equal(t, "schedule:report.daily", *jr.enqueued[0].UniqueKey)
+
+	assert.Error(t, s.Configure(map[string]string{"override": "bogus"}, nil))
+}
+
+func TestScheduler_fireDue(t *testing.T) {
+	sr := &fakeScheduleRepo{}
+	s := NewScheduler(nil, repo.DefaultSchema, sr, SchedulerOptions{Instance: "test"})
+
+	release := make(chan struct{})
+	var calls int
+	var mu sync.Mutex
+	assert.NoError(t, s.Add(Schedule{Name: "minutely", Spec: "* * * * *", Run: func(context.Context) error {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		<-release
+		return errors.New("boom")
+	}}))
+
+	start := time.Date(2024, 1, 1, 0, 0, 30, 0, time.UTC)
+	ctx := context.Background()
+
+	s.fireDue(ctx, start) // sets the first tick, 00:01
+	s.fireDue(ctx, start.Add(time.Minute))
+	s.fireDue(ctx, start.Add(2*time.Minute)) // previous run still going, skipped
+	close(release)
+	s.wg.Wait()
+
+	assert.Equal(t, 1, calls)
+	assert.Len(t, sr.runs, 1)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC), sr.runs[0].ScheduledAt)
+	assert.Equal(t, "test", sr.runs[0].Instance)
+	assert.EqualError(t, sr.finished[1], "boom")
+
+	// a tick another instance already started is not run again
+	s.entry("minutely").next = time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC)
+	s.fireDue(ctx, start.Add(time.Minute))
+	s.wg.Wait()
+	assert.Equal(t, 1, calls)
+}
+
+func TestScheduler_runSchedule_panic(t *testing.T) {
+	s := NewScheduler(nil, repo.DefaultSchema, &fakeScheduleRepo{}, SchedulerOptions{})
+	assert.NoError(t, s.Add(Schedule{Name: "panics", Spec: "@daily", Run: func(context.Context) error {
+		panic("kaboom")
+	}}))
+	assert.ErrorContains(t, s.runSchedule(context.Background(), s.entry("panics")), "kaboom")
+}
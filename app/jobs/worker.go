@@ -0,0 +1,264 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+const (
+	defaultConcurrency  = 4
+	defaultPollInterval = time.Second
+	defaultJobTimeout   = 5 * time.Minute
+	defaultStuckTimeout = 15 * time.Minute
+	defaultBaseBackoff  = 10 * time.Second
+	defaultMaxBackoff   = time.Hour
+)
+
+// Handler runs a single job. returning an error retries the job with backoff until it runs out of attempts,
+// wrap the error with Permanent to dead letter the job straight away
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a job error as not worth retrying
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
+
+// WorkerOptions controls how a Worker polls and retries. zero values use the defaults
+type WorkerOptions struct {
+	Queue        string
+	ID           string        // identifies this worker in locked_by, defaults to hostname and pid
+	Concurrency  int           // max jobs run at once
+	PollInterval time.Duration // wait between polls when the queue is empty
+	JobTimeout   time.Duration // max time a single attempt may run
+	StuckTimeout time.Duration // running jobs locked longer than this are assumed abandoned and rescued
+	BaseBackoff  time.Duration // wait before the first retry, doubled on each subsequent retry
+	MaxBackoff   time.Duration // upper bound for any single retry wait
+}
+
+func (o WorkerOptions) withDefaults() WorkerOptions {
+	if o.Queue == "" {
+		o.Queue = DefaultQueue
+	}
+	if o.ID == "" {
+		host, _ := os.Hostname()
+		o.ID = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = defaultConcurrency
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = defaultPollInterval
+	}
+	if o.JobTimeout <= 0 {
+		o.JobTimeout = defaultJobTimeout
+	}
+	if o.StuckTimeout <= 0 {
+		o.StuckTimeout = defaultStuckTimeout
+	}
+	if o.BaseBackoff <= 0 {
+		o.BaseBackoff = defaultBaseBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = defaultMaxBackoff
+	}
+	return o
+}
+
+// Worker polls a single queue and runs its jobs with the registered handlers
+type Worker struct {
+	db       repo.Querier
+	schema   string
+	jobRepo  repo.IJobRepo
+	opts     WorkerOptions
+	handlers map[string]Handler
+}
+
+// NewWorker creates a new worker. register handlers before calling Run
+func NewWorker(db repo.Querier, schema string, jobRepo repo.IJobRepo, opts WorkerOptions) *Worker {
+	return &Worker{
+		db:       db,
+		schema:   schema,
+		jobRepo:  jobRepo,
+		opts:     opts.withDefaults(),
+		handlers: map[string]Handler{},
+	}
+}
+
+// Handle registers the handler for a job kind, replacing any existing one
+func (w *Worker) Handle(kind string, h Handler) {
+	w.handlers[kind] = h
+}
+
+// Register registers a typed handler for a job kind. payloads that do not unmarshal into T are dead lettered
+func Register[T any](w *Worker, kind string, fn func(ctx context.Context, payload T) error) {
+	w.Handle(kind, func(ctx context.Context, raw json.RawMessage) error {
+		var payload T
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return Permanent(errors.Wrapf(err, "problem unmarshalling payload for job %s", kind))
+		}
+		return fn(ctx, payload)
+	})
+}
+
+// Run polls for jobs until ctx is cancelled, then waits for running jobs to finish
+func (w *Worker) Run(ctx context.Context) {
+	slog.InfoContext(ctx, "starting job worker",
+		slog.String("queue", w.opts.Queue),
+		slog.String("worker_id", w.opts.ID),
+		slog.Int("concurrency", w.opts.Concurrency),
+	)
+
+	// jobs already claimed should finish and record their result even when shutting down
+	jobCtx := context.WithoutCancel(ctx)
+	slots := make(chan struct{}, w.opts.Concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.rescueLoop(ctx)
+	}()
+
+	for {
+		free := cap(slots) - len(slots)
+		fetched := 0
+		if free > 0 {
+			jobs, err := w.jobRepo.FetchJobs(ctx, w.db, w.schema, w.opts.Queue, w.opts.ID, free)
+			if err != nil && ctx.Err() == nil {
+				slog.ErrorContext(ctx, "problem fetching jobs", slog.Any("error", err))
+			}
+			for _, j := range jobs {
+				slots <- struct{}{}
+				wg.Add(1)
+				go func(j repo.Job) {
+					defer wg.Done()
+					defer func() { <-slots }()
+					w.process(jobCtx, j)
+				}(j)
+			}
+			fetched = len(jobs)
+		}
+
+		// a full batch likely means more jobs are due, poll again straight away
+		wait := w.opts.PollInterval
+		if free > 0 && fetched == free {
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			slog.InfoContext(ctx, "stopping job worker, waiting for running jobs", slog.String("queue", w.opts.Queue))
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (w *Worker) rescueLoop(ctx context.Context) {
+	ticker := time.NewTicker(w.opts.StuckTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := w.jobRepo.RescueStuckJobs(ctx, w.db, w.schema, time.Now().Add(-w.opts.StuckTimeout))
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.ErrorContext(ctx, "problem rescuing stuck jobs", slog.Any("error", err))
+			}
+			continue
+		}
+		if n > 0 {
+			slog.WarnContext(ctx, "rescued stuck jobs", slog.Int64("count", n))
+		}
+	}
+}
+
+func (w *Worker) process(ctx context.Context, j repo.Job) {
+	logger := slog.With(slog.Group("job",
+		slog.Int64("id", j.ID),
+		slog.String("kind", j.Kind),
+		slog.Int("attempt", j.Attempts),
+	))
+
+	start := time.Now()
+	err := w.runHandler(ctx, j)
+	if err == nil {
+		if err := w.jobRepo.CompleteJob(ctx, w.db, w.schema, j.ID); err != nil {
+			logger.ErrorContext(ctx, "problem completing job", slog.Any("error", err))
+			return
+		}
+		logger.InfoContext(ctx, "job succeeded", slog.Duration("duration", time.Since(start)))
+		return
+	}
+
+	var retryAt *time.Time
+	if !IsPermanent(err) && j.Attempts < j.MaxAttempts {
+		t := time.Now().Add(w.backoff(j.Attempts))
+		retryAt = &t
+	}
+	if fErr := w.jobRepo.FailJob(ctx, w.db, w.schema, j.ID, err.Error(), retryAt); fErr != nil {
+		logger.ErrorContext(ctx, "problem failing job", slog.Any("error", fErr))
+		return
+	}
+
+	if retryAt == nil {
+		logger.ErrorContext(ctx, "job failed, dead lettered", slog.Any("error", err))
+		return
+	}
+	logger.WarnContext(ctx, "job failed, will retry", slog.Time("retry_at", *retryAt), slog.Any("error", err))
+}
+
+// runHandler runs the job's handler, turning panics into errors so one bad job cannot take the worker down
+func (w *Worker) runHandler(ctx context.Context, j repo.Job) (err error) {
+	h, ok := w.handlers[j.Kind]
+	if !ok {
+		return Permanent(errors.Errorf("no handler registered for job kind %s", j.Kind))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.opts.JobTimeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("job panicked: %v", r)
+		}
+	}()
+	return h(ctx, j.Payload)
+}
+
+// backoff returns the wait before retrying a job that has failed attempts times
+func (w *Worker) backoff(attempts int) time.Duration {
+	wait := w.opts.BaseBackoff << max(attempts-1, 0)
+	if wait <= 0 || wait > w.opts.MaxBackoff {
+		wait = w.opts.MaxBackoff
+	}
+	// jitter within the upper half so retries stay roughly exponential but do not stampede
+	half := int64(wait / 2)
+	return time.Duration(half + rand.Int63n(half+1)) //nolint:gosec // jitter does not need crypto rand
+}
@@ -0,0 +1,170 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+type failure struct {
+	msg     string
+	retryAt *time.Time
+}
+
+// fakeJobRepo hands out queued jobs once and records what the worker did with them
+type fakeJobRepo struct {
+	mu        sync.Mutex
+	queued    []repo.Job
+	enqueued  []repo.Job
+	completed []int64
+	failed    map[int64]failure
+}
+
+func (r *fakeJobRepo) EnqueueJob(_ context.Context, _ repo.Querier, _ string, j repo.Job) (*repo.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enqueued = append(r.enqueued, j)
+	return &j, nil
+}
+
+func (r *fakeJobRepo) FetchJobs(_ context.Context, _ repo.Querier, _ string, _ string, _ string, limit int) ([]repo.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := min(limit, len(r.queued))
+	res := r.queued[:n]
+	r.queued = r.queued[n:]
+	for i := range res {
+		res[i].Attempts++
+	}
+	return res, nil
+}
+
+func (r *fakeJobRepo) CompleteJob(_ context.Context, _ repo.Querier, _ string, jobID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.completed = append(r.completed, jobID)
+	return nil
+}
+
+func (r *fakeJobRepo) FailJob(_ context.Context, _ repo.Querier, _ string, jobID int64, errMsg string, retryAt *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failed == nil {
+		r.failed = map[int64]failure{}
+	}
+	r.failed[jobID] = failure{msg: errMsg, retryAt: retryAt}
+	return nil
+}
+
+func (r *fakeJobRepo) RescueStuckJobs(_ context.Context, _ repo.Querier, _ string, _ time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (r *fakeJobRepo) RetryDeadJob(_ context.Context, _ repo.Querier, _ string, _ int64) error {
+	return nil
+}
+
+func (r *fakeJobRepo) DeleteSucceededJobs(_ context.Context, _ repo.Querier, _ string, _ time.Time) (int64, error) {
+	return 0, nil
+}
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+func newJob(id int64, kind string, payload string, attempts int) repo.Job {
+	return repo.Job{ID: id, Kind: kind, Payload: json.RawMessage(payload), Attempts: attempts, MaxAttempts: 3}
+}
+
+func TestWorker_Run(t *testing.T) {
+	jr := &fakeJobRepo{queued: []repo.Job{
+		newJob(1, "greet", `{"name":"foo"}`, 0),
+		newJob(2, "greet", `{"name":"fail"}`, 0),
+		newJob(3, "greet", `{"name":"fail"}`, 2), // last attempt
+		newJob(4, "greet", `not json`, 0),
+		newJob(5, "unknown", `{}`, 0),
+		newJob(6, "greet", `{"name":"panic"}`, 0),
+		newJob(7, "greet", `{"name":"permanent"}`, 0),
+	}}
+
+	var mu sync.Mutex
+	var greeted []string
+	w := NewWorker(nil, repo.DefaultSchema, jr, WorkerOptions{Concurrency: 2, PollInterval: 10 * time.Millisecond})
+	Register(w, "greet", func(_ context.Context, g greeting) error {
+		switch g.Name {
+		case "fail":
+			return errors.New("boom")
+		case "panic":
+			panic("kaboom")
+		case "permanent":
+			return Permanent(errors.New("never going to work"))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		greeted = append(greeted, g.Name)
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	w.Run(ctx)
+
+	assert.Equal(t, []string{"foo"}, greeted)
+	assert.Equal(t, []int64{1}, jr.completed)
+	assert.Len(t, jr.failed, 6)
+
+	assert.Equal(t, "boom", jr.failed[2].msg)
+	assert.NotNil(t, jr.failed[2].retryAt, "attempts left, should retry")
+	assert.Nil(t, jr.failed[3].retryAt, "out of attempts, should be dead")
+	assert.Nil(t, jr.failed[4].retryAt, "bad payload is permanent")
+	assert.Nil(t, jr.failed[5].retryAt, "no handler is permanent")
+	assert.Contains(t, jr.failed[6].msg, "kaboom")
+	assert.NotNil(t, jr.failed[6].retryAt, "panics are retried")
+	assert.Nil(t, jr.failed[7].retryAt)
+}
+
+func TestWorker_backoff(t *testing.T) {
+	w := NewWorker(nil, repo.DefaultSchema, &fakeJobRepo{}, WorkerOptions{
+		BaseBackoff: time.Second,
+		MaxBackoff:  time.Minute,
+	})
+	for _, tc := range []struct {
+		attempts int
+		max      time.Duration
+	}{
+		{attempts: 1, max: time.Second},
+		{attempts: 2, max: 2 * time.Second},
+		{attempts: 4, max: 8 * time.Second},
+		{attempts: 10, max: time.Minute},
+		{attempts: 100, max: time.Minute}, // overflow clamps to max
+	} {
+		d := w.backoff(tc.attempts)
+		assert.GreaterOrEqual(t, d, tc.max/2, "attempts %d", tc.attempts)
+		assert.LessOrEqual(t, d, tc.max, "attempts %d", tc.attempts)
+	}
+}
+
+func TestClient_Enqueue(t *testing.T) {
+	jr := &fakeJobRepo{}
+	c := NewClient(nil, repo.DefaultSchema, jr)
+
+	_, err := c.Enqueue(context.Background(), "greet", greeting{Name: "foo"}, EnqueueOptions{UniqueKey: "greet:foo"})
+	assert.NoError(t, err)
+	_, err = c.Enqueue(context.Background(), "", nil, EnqueueOptions{})
+	assert.Error(t, err)
+
+	assert.Len(t, jr.enqueued, 1)
+	j := jr.enqueued[0]
+	assert.Equal(t, DefaultQueue, j.Queue)
+	assert.Equal(t, defaultMaxAttempts, j.MaxAttempts)
+	assert.False(t, j.RunAt.IsZero())
+	assert.Equal(t, "greet:foo", *j.UniqueKey)
+	assert.JSONEq(t, `{"name":"foo"}`, string(j.Payload))
+}
@@ -0,0 +1,113 @@
+package lifecycle
+
+import (
+	"context"
+	stderrors "errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// stopGrace is how long a component still gets to stop once the shutdown deadline has passed, enough for quick
+// ones like closing the db after the http server used up the deadline
+const stopGrace = time.Second
+
+// StopFunc stops a component, giving up once ctx is done
+type StopFunc func(ctx context.Context) error
+
+type component struct {
+	name string
+	stop StopFunc
+}
+
+// Manager stops registered components in the reverse of the order they were registered, so a component is stopped
+// before anything it depends on, e.g. the http server before the db pool
+type Manager struct {
+	mu         sync.Mutex
+	components []component
+	stopped    bool
+}
+
+// New creates a new manager
+func New() *Manager {
+	return &Manager{}
+}
+
+// Register adds a component to stop on Shutdown. register a component after the ones it uses
+func (m *Manager) Register(name string, stop StopFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.components = append(m.components, component{name: name, stop: stop})
+}
+
+// Go runs a background component until it is stopped. run must return once its ctx is done, stopping it cancels the
+// ctx and waits for run to return
+func (m *Manager) Go(name string, run func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx)
+	}()
+
+	m.Register(name, func(stopCtx context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-stopCtx.Done():
+			return stopCtx.Err()
+		}
+	})
+}
+
+// Shutdown stops every component in reverse order. a component that fails or runs out of time does not stop the
+// rest from being stopped, e.g. the db is still closed when the http server could not drain in time. only the first
+// call does anything
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	if m.stopped {
+		m.mu.Unlock()
+		return nil
+	}
+	m.stopped = true
+	components := m.components
+	m.mu.Unlock()
+
+	var errs []error
+	for i := len(components) - 1; i >= 0; i-- {
+		c := components[i]
+		start := time.Now()
+		if err := stop(ctx, c); err != nil {
+			slog.ErrorContext(ctx, "problem stopping component", slog.String("component", c.name), slog.Any("error", err))
+			errs = append(errs, errors.Wrapf(err, "problem stopping %s", c.name))
+			continue
+		}
+		slog.InfoContext(ctx, "stopped component", slog.String("component", c.name), slog.Duration("took", time.Since(start)))
+	}
+	return stderrors.Join(errs...)
+}
+
+// stop runs a component's StopFunc, not waiting much past ctx for one that ignores it
+func stop(ctx context.Context, c component) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.stop(ctx)
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	grace := time.NewTimer(stopGrace)
+	defer grace.Stop()
+	select {
+	case err := <-errc:
+		return err
+	case <-grace.C:
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,63 @@
+package lifecycle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager_Shutdown(t *testing.T) {
+	m := New()
+	var stopped []string
+	record := func(name string, err error) StopFunc {
+		return func(context.Context) error {
+			stopped = append(stopped, name)
+			return err
+		}
+	}
+	m.Register("db", record("db", nil))
+	m.Register("mail queue", record("mail queue", errors.New("boom")))
+	m.Register("http server", record("http server", nil))
+
+	err := m.Shutdown(context.Background())
+	assert.ErrorContains(t, err, "problem stopping mail queue: boom")
+	assert.Equal(t, []string{"http server", "mail queue", "db"}, stopped)
+
+	// only the first call stops anything
+	assert.NoError(t, m.Shutdown(context.Background()))
+	assert.Len(t, stopped, 3)
+}
+
+func TestManager_Shutdown_deadline(t *testing.T) {
+	m := New()
+	dbClosed := false
+	m.Register("db", func(context.Context) error {
+		dbClosed = true
+		return nil
+	})
+	m.Register("http server", func(context.Context) error {
+		select {} // never drains
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := m.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "problem stopping http server")
+	assert.True(t, dbClosed, "later components are stopped even after the deadline")
+}
+
+func TestManager_Go(t *testing.T) {
+	m := New()
+	var finished bool
+	m.Go("hub", func(ctx context.Context) {
+		<-ctx.Done()
+		finished = true
+	})
+
+	assert.NoError(t, m.Shutdown(context.Background()))
+	assert.True(t, finished)
+}
@@ -0,0 +1,140 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// Levels is the minimum level logged, overall and per package. it is safe to change while logging
+type Levels struct {
+	mu       sync.RWMutex
+	base     slog.Level
+	packages map[string]slog.Level // keyed by import path or a trailing part of it, e.g. jobs or app/jobs
+
+	min  atomic.Int64 // lowest of base and packages, anything below it is dropped without looking up the caller
+	pkgs sync.Map     // caller pc -> package path
+}
+
+// NewLevels creates levels logging base and above, except in packages given their own level
+func NewLevels(base slog.Level, packages map[string]slog.Level) *Levels {
+	l := &Levels{}
+	l.Set(base, packages)
+	return l
+}
+
+// ParseLevels parses level names, e.g. debug or warn, into levels
+func ParseLevels(base string, packages map[string]string) (*Levels, error) {
+	b, p, err := ParseLevelNames(base, packages)
+	if err != nil {
+		return nil, err
+	}
+	return NewLevels(b, p), nil
+}
+
+// ParseLevelNames parses level names, e.g. debug or warn, for Levels.Set
+func ParseLevelNames(base string, packages map[string]string) (slog.Level, map[string]slog.Level, error) {
+	var b slog.Level
+	if err := b.UnmarshalText([]byte(base)); err != nil {
+		return 0, nil, errors.Wrapf(err, "invalid log level %q", base)
+	}
+	p := make(map[string]slog.Level, len(packages))
+	for pkg, name := range packages {
+		var lvl slog.Level
+		if err := lvl.UnmarshalText([]byte(name)); err != nil {
+			return 0, nil, errors.Wrapf(err, "invalid log level %q for package %s", name, pkg)
+		}
+		p[pkg] = lvl
+	}
+	return b, p, nil
+}
+
+// Set replaces every level
+func (l *Levels) Set(base slog.Level, packages map[string]slog.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.base = base
+	l.packages = maps.Clone(packages)
+	lowest := base
+	for _, lvl := range packages {
+		lowest = min(lowest, lvl)
+	}
+	l.min.Store(int64(lowest))
+}
+
+// Get returns the current levels
+func (l *Levels) Get() (slog.Level, map[string]slog.Level) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.base, maps.Clone(l.packages)
+}
+
+// forPC is the level for the package of the function at pc, the longest matching package wins
+func (l *Levels) forPC(pc uintptr) slog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if pc == 0 || len(l.packages) == 0 {
+		return l.base
+	}
+
+	pkg := l.packageOf(pc)
+	lvl, matched := l.base, ""
+	for p, pl := range l.packages {
+		if (pkg == p || strings.HasSuffix(pkg, "/"+p)) && len(p) > len(matched) {
+			lvl, matched = pl, p
+		}
+	}
+	return lvl
+}
+
+// packageOf is the import path of the package the function at pc is in
+func (l *Levels) packageOf(pc uintptr) string {
+	if pkg, ok := l.pkgs.Load(pc); ok {
+		return pkg.(string)
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	// e.g. github.com/drmaples/starter-app/app/jobs.(*Worker).Run
+	name := frame.Function
+	slash := strings.LastIndex(name, "/")
+	if dot := strings.Index(name[slash+1:], "."); dot >= 0 {
+		name = name[:slash+1+dot]
+	}
+	l.pkgs.Store(pc, name)
+	return name
+}
+
+// levelHandler drops records below the level for the package that logged them
+type levelHandler struct {
+	next   slog.Handler
+	levels *Levels
+}
+
+// Enabled implements slog.Handler
+func (h *levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return int64(level) >= h.levels.min.Load()
+}
+
+// Handle implements slog.Handler
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < h.levels.forPC(r.PC) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{next: h.next.WithAttrs(attrs), levels: h.levels}
+}
+
+// WithGroup implements slog.Handler
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{next: h.next.WithGroup(name), levels: h.levels}
+}
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+	subjectKey
+)
+
+// WithRequestID stores the id of the request being served in ctx
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID is the id of the request being served, empty outside of a request
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithSubject stores who the request is authenticated as in ctx
+func WithSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectKey, subject)
+}
+
+// Subject is who the request is authenticated as, empty when it is not
+func Subject(ctx context.Context) string {
+	sub, _ := ctx.Value(subjectKey).(string)
+	return sub
+}
+
+// CtxAttrs returns attributes describing ctx, e.g. the request or trace it belongs to. nil when there are none
+type CtxAttrs func(ctx context.Context) []slog.Attr
+
+// RequestAttrs is the request id and authenticated subject in ctx, tying every log line to the request that made it
+func RequestAttrs(ctx context.Context) []slog.Attr {
+	var attrs []slog.Attr
+	if id := RequestID(ctx); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if sub := Subject(ctx); sub != "" {
+		attrs = append(attrs, slog.String("subject", sub))
+	}
+	return attrs
+}
+
+// Handler adds the attributes of a record's ctx, RequestAttrs and any passed to NewHandler, e.g. by packages that
+// keep their own state in ctx. only calls made with a ctx, e.g. slog.InfoContext, get them
+type Handler struct {
+	next  slog.Handler
+	attrs []CtxAttrs
+}
+
+// NewHandler wraps next, adding RequestAttrs and attrs to each record
+func NewHandler(next slog.Handler, attrs ...CtxAttrs) *Handler {
+	return &Handler{next: next, attrs: append([]CtxAttrs{RequestAttrs}, attrs...)}
+}
+
+// Enabled implements slog.Handler
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	for _, fn := range h.attrs {
+		r.AddAttrs(fn(ctx)...)
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Handler{next: h.next.WithAttrs(attrs), attrs: h.attrs}
+}
+
+// WithGroup implements slog.Handler
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{next: h.next.WithGroup(name), attrs: h.attrs}
+}
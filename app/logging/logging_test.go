@@ -0,0 +1,47 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	type tenantKey struct{}
+	tenantAttrs := func(ctx context.Context) []slog.Attr {
+		if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+			return []slog.Attr{slog.String("tenant", tenant)}
+		}
+		return nil
+	}
+	logger := slog.New(NewHandler(slog.NewJSONHandler(&buf, nil), tenantAttrs)).With(slog.String("app", "test"))
+
+	ctx := WithSubject(WithRequestID(context.Background(), "req-1"), "foo@example.com")
+	logger.InfoContext(context.WithValue(ctx, tenantKey{}, "acme"), "in request")
+	logger.Info("no ctx")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"request_id":"req-1"`)
+	assert.Contains(t, lines[0], `"subject":"foo@example.com"`)
+	assert.Contains(t, lines[0], `"tenant":"acme"`)
+	assert.Contains(t, lines[0], `"app":"test"`)
+	assert.NotContains(t, lines[1], "request_id")
+	assert.NotContains(t, lines[1], "subject")
+	assert.NotContains(t, lines[1], "tenant")
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Empty(t, RequestID(ctx))
+	assert.Empty(t, Subject(ctx))
+
+	ctx = WithRequestID(ctx, "req-1")
+	assert.Equal(t, "req-1", RequestID(ctx))
+	assert.Empty(t, Subject(ctx))
+}
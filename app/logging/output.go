@@ -0,0 +1,47 @@
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"math"
+
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/platform"
+)
+
+// log formats
+const (
+	FormatJSON   = "json"
+	FormatText   = "text"   // logfmt style key=value
+	FormatPretty = "pretty" // colored, for reading in a terminal
+)
+
+// levelAll lets every record through a handler, levels are filtered by Levels instead
+const levelAll = slog.Level(math.MinInt)
+
+// NewOutput creates the handler log lines are written to w through, in cfg.Format, redacted and filtered by the
+// returned levels, which can be changed while running
+func NewOutput(w io.Writer, cfg platform.LogConfig) (slog.Handler, *Levels, error) {
+	levels, err := ParseLevels(cfg.Level, cfg.Levels)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var h slog.Handler
+	opts := &slog.HandlerOptions{Level: levelAll}
+	switch cfg.Format {
+	case FormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	case FormatText:
+		h = slog.NewTextHandler(w, opts)
+	case FormatPretty:
+		h = newPrettyHandler(w)
+	default:
+		return nil, nil, errors.Errorf("unknown log format: %q", cfg.Format)
+	}
+	if cfg.Redact {
+		h = &redactHandler{next: h}
+	}
+	return &levelHandler{next: h, levels: levels}, levels, nil
+}
@@ -0,0 +1,123 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorDim    = "\033[2m"
+	colorRed    = "\033[31m"
+	colorYellow = "\033[33m"
+	colorBlue   = "\033[34m"
+	colorGray   = "\033[90m"
+)
+
+// prettyHandler writes one colored, human readable line per record for local development, e.g.
+// 15:04:05.000 INF starting server port=8000
+type prettyHandler struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	attrs  string // already formatted, from WithAttrs
+	prefix string // from WithGroup, e.g. "request."
+}
+
+func newPrettyHandler(w io.Writer) *prettyHandler {
+	return &prettyHandler{mu: &sync.Mutex{}, w: w}
+}
+
+// Enabled implements slog.Handler, levels are filtered before records get here
+func (h *prettyHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+// Handle implements slog.Handler
+func (h *prettyHandler) Handle(_ context.Context, r slog.Record) error {
+	var sb strings.Builder
+	sb.WriteString(colorDim + r.Time.Format("15:04:05.000") + colorReset + " ")
+	sb.WriteString(prettyLevel(r.Level) + " ")
+	sb.WriteString(r.Message)
+	sb.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		writePrettyAttr(&sb, h.prefix, a)
+		return true
+	})
+	sb.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, sb.String())
+	return err
+}
+
+// WithAttrs implements slog.Handler
+func (h *prettyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var sb strings.Builder
+	sb.WriteString(h.attrs)
+	for _, a := range attrs {
+		writePrettyAttr(&sb, h.prefix, a)
+	}
+	res := *h
+	res.attrs = sb.String()
+	return &res
+}
+
+// WithGroup implements slog.Handler
+func (h *prettyHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	res := *h
+	res.prefix = h.prefix + name + "."
+	return &res
+}
+
+func prettyLevel(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return colorRed + "ERR" + colorReset
+	case level >= slog.LevelWarn:
+		return colorYellow + "WRN" + colorReset
+	case level >= slog.LevelInfo:
+		return colorBlue + "INF" + colorReset
+	default:
+		return colorGray + "DBG" + colorReset
+	}
+}
+
+func writePrettyAttr(sb *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			writePrettyAttr(sb, prefix, ga)
+		}
+		return
+	}
+
+	var val string
+	switch a.Value.Kind() {
+	case slog.KindTime:
+		val = a.Value.Time().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		val = fmt.Sprintf("%+v", a.Value.Any())
+	default:
+		val = a.Value.String()
+	}
+	if val == "" || strings.ContainsAny(val, " \t\n\"=") {
+		val = strconv.Quote(val)
+	}
+	sb.WriteString(" " + colorDim + prefix + a.Key + "=" + colorReset + val)
+}
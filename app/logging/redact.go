@@ -0,0 +1,123 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	emailRE  = regexp.MustCompile(`([A-Za-z0-9._%+-])[A-Za-z0-9._%+-]*@([A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,})`)
+	jwtRE    = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	bearerRE = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`)
+	queryRE  = regexp.MustCompile(`(?i)\b((?:token|access_token|refresh_token|id_token|code|state|secret|password|invite)=)[^&\s"]+`)
+
+	// attrs with these keys are hidden entirely, compared lowercase
+	sensitiveKeys = []string{"x-jwt", "authorization", "cookie", "set-cookie", "jwt", "api_key", "api-key"}
+	// nor any key containing one of these
+	sensitiveKeyParts = []string{"token", "secret", "password"}
+)
+
+// redactHandler masks emails, tokens and credentials, e.g. the x-jwt header, before they are written
+type redactHandler struct {
+	next slog.Handler
+}
+
+// Enabled implements slog.Handler
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler
+func (h *redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	res := slog.NewRecord(r.Time, r.Level, redactString(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		res.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, res)
+}
+
+// WithAttrs implements slog.Handler
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	res := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		res[i] = redactAttr(a)
+	}
+	return &redactHandler{next: h.next.WithAttrs(res)}
+}
+
+// WithGroup implements slog.Handler
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{next: h.next.WithGroup(name)}
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	if sensitiveKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactString(a.Value.String()))
+	case slog.KindGroup:
+		group := a.Value.Group()
+		res := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			res[i] = redactAttr(ga)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(res...)}
+	case slog.KindAny:
+		// errors, headers and the like can carry anything, they are logged as their redacted text
+		switch v := a.Value.Any().(type) {
+		case error:
+			return slog.String(a.Key, redactString(v.Error()))
+		case []string:
+			res := make([]string, len(v))
+			for i, s := range v {
+				res[i] = redactString(s)
+			}
+			return slog.Any(a.Key, res)
+		case map[string][]string:
+			res := make([]slog.Attr, 0, len(v))
+			for k, vals := range v {
+				res = append(res, redactAttr(slog.String(k, strings.Join(vals, ","))))
+			}
+			return slog.Attr{Key: a.Key, Value: slog.GroupValue(res...)}
+		case map[string]any:
+			res := make([]slog.Attr, 0, len(v))
+			for k, val := range v {
+				res = append(res, redactAttr(slog.Any(k, val)))
+			}
+			return slog.Attr{Key: a.Key, Value: slog.GroupValue(res...)}
+		}
+	}
+	return a
+}
+
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range sensitiveKeys {
+		if key == k {
+			return true
+		}
+	}
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactString keeps the first character and domain of emails, e.g. f***@example.com, and hides tokens entirely
+func redactString(s string) string {
+	s = jwtRE.ReplaceAllString(s, redacted)
+	s = bearerRE.ReplaceAllString(s, "$1 "+redacted)
+	s = queryRE.ReplaceAllString(s, "${1}"+redacted)
+	return emailRE.ReplaceAllString(s, "$1***@$2")
+}
@@ -0,0 +1,48 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// FileMailer writes each message to an .eml file, which most mail clients can open
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer creates a new file mailer writing into dir
+func NewFileMailer(dir string, from string) Mailer {
+	return &FileMailer{dir: dir, from: from}
+}
+
+// Send writes the message to a new file
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	from := msg.From
+	if from == "" {
+		from = m.from
+	}
+	body, err := buildMIME(from, msg)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(m.dir, 0o750); err != nil {
+		return errors.Wrap(err, "problem creating mail directory")
+	}
+	name := fmt.Sprintf("%s_%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.New().String())
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, body, 0o600); err != nil {
+		return errors.Wrap(err, "problem writing email to file")
+	}
+
+	slog.InfoContext(ctx, "wrote email to file", slog.String("path", path), slog.String("subject", msg.Subject))
+	return nil
+}
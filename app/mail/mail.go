@@ -0,0 +1,70 @@
+package mail
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/platform"
+)
+
+// mail drivers, see platform.MailConfig
+const (
+	DriverLog  = "log"
+	DriverFile = "file"
+	DriverSMTP = "smtp"
+)
+
+// mail queues, see platform.MailConfig
+const (
+	QueueMemory = "memory" // QueuedMailer
+	QueueJobs   = "jobs"   // jobs.Mailer, sent by the worker binary
+)
+
+// Message is an outbound email
+type Message struct {
+	From    string // optional, defaults to the configured from address
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer sends email
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New creates the mailer for the configured driver. it sends inline, wrap it with NewQueuedMailer to send in the
+// background
+func New(cfg platform.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case DriverLog:
+		return NewLogMailer(), nil
+	case DriverFile:
+		return NewFileMailer(cfg.FileDir, cfg.From), nil
+	case DriverSMTP:
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.From), nil
+	default:
+		return nil, errors.Errorf("unknown mail driver: %q", cfg.Driver)
+	}
+}
+
+// LogMailer is a Mailer that only logs messages, for local development
+type LogMailer struct{}
+
+// NewLogMailer creates a new log mailer
+func NewLogMailer() Mailer {
+	return &LogMailer{}
+}
+
+// Send logs the recipients and subject instead of sending the message. the body is never logged, it can hold
+// credentials, e.g. an invite link, use the file or smtp driver to read it
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	slog.InfoContext(ctx, "sending email",
+		slog.Any("to", msg.To),
+		slog.String("subject", msg.Subject),
+	)
+	return nil
+}
@@ -0,0 +1,88 @@
+package mail
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeMailer struct {
+	mu       sync.Mutex
+	failures int // number of sends to fail before succeeding
+	sent     []Message
+}
+
+func (m *fakeMailer) Send(_ context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("boom")
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestRender_invite(t *testing.T) {
+	msg, err := Render("invite", []string{"foo@example.com"}, map[string]any{
+		"OrganizationName": "<acme>",
+		"Role":             "admin",
+		"Link":             "http://localhost/login?invite=abc",
+		"ExpiresAt":        "tomorrow",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo@example.com"}, msg.To)
+	assert.Equal(t, "You have been invited to join <acme>", msg.Subject)
+	assert.Contains(t, msg.Text, "http://localhost/login?invite=abc")
+	assert.Contains(t, msg.HTML, "&lt;acme&gt;") // html is escaped, text is not
+}
+
+func TestRender_missing_template(t *testing.T) {
+	_, err := Render("does-not-exist", nil, nil)
+	assert.Error(t, err)
+}
+
+func TestBuildMIME(t *testing.T) {
+	raw, err := buildMIME("app@example.com", Message{
+		To:      []string{"a@example.com", "b@example.com"},
+		Subject: "hello",
+		Text:    "plain body",
+		HTML:    "<p>html body</p>",
+	})
+	assert.NoError(t, err)
+
+	s := string(raw)
+	assert.Contains(t, s, "From: app@example.com\r\n")
+	assert.Contains(t, s, "To: a@example.com, b@example.com\r\n")
+	assert.Contains(t, s, "Content-Type: multipart/alternative; boundary=")
+	assert.Contains(t, s, "plain body")
+	assert.Contains(t, s, "<p>html body</p>")
+	assert.Less(t, strings.Index(s, "plain body"), strings.Index(s, "<p>html body</p>")) // preferred part goes last
+
+	_, err = buildMIME("app@example.com", Message{Subject: "no recipients"})
+	assert.Error(t, err)
+}
+
+func TestQueuedMailer(t *testing.T) {
+	next := &fakeMailer{failures: 1}
+	q := NewQueuedMailer(next, 10, 1)
+	q.Run(context.Background())
+
+	assert.NoError(t, q.Send(context.Background(), Message{Subject: "one"}))
+	assert.NoError(t, q.Send(context.Background(), Message{Subject: "two"}))
+	q.Close() // waits for the queue to drain, including the retried send
+
+	assert.Len(t, next.sent, 2)
+	assert.Error(t, q.Send(context.Background(), Message{Subject: "after close"}))
+}
+
+func TestQueuedMailer_full(t *testing.T) {
+	q := NewQueuedMailer(&fakeMailer{}, 1, 1) // not running, nothing drains the queue
+
+	assert.NoError(t, q.Send(context.Background(), Message{Subject: "one"}))
+	assert.ErrorIs(t, q.Send(context.Background(), Message{Subject: "two"}), ErrQueueFull)
+}
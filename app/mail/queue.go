@@ -0,0 +1,104 @@
+package mail
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	queueSendAttempts = 3
+	queueRetryBackoff = time.Second
+	queueSendTimeout  = 30 * time.Second
+)
+
+// ErrQueueFull is returned when a message cannot be queued because the queue is at capacity
+var ErrQueueFull = errors.New("mail queue is full")
+
+// QueuedMailer is a Mailer that queues messages in memory and sends them in the background so requests do not
+// wait on a mail server. queued messages are lost if the process dies before they are sent
+type QueuedMailer struct {
+	next    Mailer
+	queue   chan Message
+	workers int
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewQueuedMailer wraps next with a queue of the given size, sent by workers goroutines once Run is called
+func NewQueuedMailer(next Mailer, size int, workers int) *QueuedMailer {
+	return &QueuedMailer{
+		next:    next,
+		queue:   make(chan Message, size),
+		workers: max(workers, 1),
+	}
+}
+
+// Send queues the message. it does not wait for the message to be sent
+func (m *QueuedMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return errors.New("mail queue is closed")
+	}
+
+	select {
+	case m.queue <- msg:
+		return nil
+	default:
+		slog.ErrorContext(ctx, "dropping email, queue is full", slog.String("subject", msg.Subject))
+		return ErrQueueFull
+	}
+}
+
+// Run starts the workers sending queued messages. it returns immediately, use Close to stop
+func (m *QueuedMailer) Run(ctx context.Context) {
+	// sends should finish even when ctx is cancelled during shutdown, Close is what stops the workers
+	ctx = context.WithoutCancel(ctx)
+	for i := 0; i < m.workers; i++ {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			for msg := range m.queue {
+				m.send(ctx, msg)
+			}
+		}()
+	}
+}
+
+// Close stops accepting messages and waits for queued ones to be sent
+func (m *QueuedMailer) Close() {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.queue)
+	}
+	m.mu.Unlock()
+	m.wg.Wait()
+}
+
+func (m *QueuedMailer) send(ctx context.Context, msg Message) {
+	var err error
+	for attempt := 1; attempt <= queueSendAttempts; attempt++ {
+		sendCtx, cancel := context.WithTimeout(ctx, queueSendTimeout)
+		err = m.next.Send(sendCtx, msg)
+		cancel()
+		if err == nil {
+			return
+		}
+		slog.WarnContext(ctx, "problem sending email",
+			slog.Int("attempt", attempt),
+			slog.String("subject", msg.Subject),
+			slog.Any("error", err),
+		)
+		if attempt < queueSendAttempts {
+			time.Sleep(queueRetryBackoff * time.Duration(attempt))
+		}
+	}
+	slog.ErrorContext(ctx, "giving up sending email", slog.String("subject", msg.Subject), slog.Any("error", err))
+}
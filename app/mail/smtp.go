@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+
+	"github.com/pkg/errors"
+)
+
+// SMTPMailer sends email through an SMTP server. STARTTLS is used when the server supports it
+type SMTPMailer struct {
+	addr string
+	host string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer creates a new smtp mailer. auth is skipped when username is empty, e.g. for a local capture server
+func NewSMTPMailer(host string, port int, username string, password string, from string) Mailer {
+	m := &SMTPMailer{
+		addr: fmt.Sprintf("%s:%d", host, port),
+		host: host,
+		from: from,
+	}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+// Send sends the message. smtp.SendMail does not take a context, so ctx is only checked before sending
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	from := msg.From
+	if from == "" {
+		from = m.from
+	}
+	body, err := buildMIME(from, msg)
+	if err != nil {
+		return err
+	}
+
+	if err := smtp.SendMail(m.addr, m.auth, from, msg.To, body); err != nil {
+		return errors.Wrap(err, "problem sending email via smtp")
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"io/fs"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/pkg/errors"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// Render builds a message from the named template. templates/<name>.txt.tmpl must define a "subject" and a
+// "body" template. templates/<name>.html.tmpl is optional and rendered with html escaping
+func Render(name string, to []string, data any) (Message, error) {
+	msg := Message{To: to}
+
+	textTmpl, err := texttemplate.ParseFS(templateFS, "templates/"+name+".txt.tmpl")
+	if err != nil {
+		return Message{}, errors.Wrapf(err, "problem parsing text template %q", name)
+	}
+	subject, err := executeText(textTmpl, "subject", data)
+	if err != nil {
+		return Message{}, err
+	}
+	msg.Subject = strings.TrimSpace(subject)
+	if msg.Text, err = executeText(textTmpl, "body", data); err != nil {
+		return Message{}, err
+	}
+
+	htmlPath := "templates/" + name + ".html.tmpl"
+	if _, err := fs.Stat(templateFS, htmlPath); err != nil {
+		return msg, nil
+	}
+	htmlTmpl, err := htmltemplate.ParseFS(templateFS, htmlPath)
+	if err != nil {
+		return Message{}, errors.Wrapf(err, "problem parsing html template %q", name)
+	}
+	var buf bytes.Buffer
+	if err := htmlTmpl.Execute(&buf, data); err != nil {
+		return Message{}, errors.Wrapf(err, "problem rendering html template %q", name)
+	}
+	msg.HTML = buf.String()
+
+	return msg, nil
+}
+
+func executeText(t *texttemplate.Template, name string, data any) (string, error) {
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", errors.Wrapf(err, "problem rendering %q template", name)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/drmaples/starter-app/app/apperr"
+)
+
+// routeUnmatched labels requests that matched no route, so scans of random paths do not each get their own series
+const routeUnmatched = "unmatched"
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "http requests by route template and status",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "http request durations by route template",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	httpInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "http requests being served, including open event streams and websockets",
+	})
+)
+
+// HTTPMiddleware records rate, errors and duration of requests per echo route template, e.g. /v1/user/:id rather
+// than every user's url
+func HTTPMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			httpInFlight.Inc()
+			defer httpInFlight.Dec()
+
+			start := time.Now()
+			err := next(c)
+
+			route := routeLabel(c.Path())
+			method := c.Request().Method
+			httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+			httpRequests.WithLabelValues(method, route, strconv.Itoa(apperr.ResponseStatus(c, err))).Inc()
+			return err
+		}
+	}
+}
+
+// routeLabel keeps requests that matched no route under one label
+func routeLabel(route string) string {
+	if route == "" {
+		return routeUnmatched
+	}
+	return route
+}
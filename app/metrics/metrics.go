@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes every metric the app defines
+const Namespace = "app"
+
+// login results
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+)
+
+// sources of new users
+const (
+	UserSourceAPI    = "api"
+	UserSourceInvite = "invite"
+)
+
+var (
+	logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "logins_total",
+		Help:      "oauth logins by result",
+	}, []string{"result"})
+
+	usersCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "users_created_total",
+		Help:      "users created, by how they were created",
+	}, []string{"source"})
+
+	rateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "requests rejected for exceeding a rate limit, by policy",
+	}, []string{"policy"})
+
+	panics = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "http_panics_total",
+		Help:      "panics recovered from while serving requests, by route",
+	}, []string{"route"})
+
+	auditWriteFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "audit_write_failures_total",
+		Help:      "audit entries lost because they could not be written",
+	})
+)
+
+// ObserveLogin counts an oauth login
+func ObserveLogin(ok bool) {
+	result := LoginSuccess
+	if !ok {
+		result = LoginFailure
+	}
+	logins.WithLabelValues(result).Inc()
+}
+
+// ObserveUserCreated counts a new user, call once the transaction creating it has committed
+func ObserveUserCreated(source string) {
+	usersCreated.WithLabelValues(source).Inc()
+}
+
+// ObserveRateLimited counts a request rejected by a rate limit policy
+func ObserveRateLimited(policy string) {
+	rateLimited.WithLabelValues(policy).Inc()
+}
+
+// ObservePanic counts a panic recovered from while serving a request to route, as registered, e.g. /v1/user/:id
+func ObservePanic(route string) {
+	panics.WithLabelValues(routeLabel(route)).Inc()
+}
+
+// ObserveAuditWriteFailure counts an audit entry that could not be written. the request it describes was not
+// failed for it, so any increase means the audit log is missing entries and should be alerted on
+func ObserveAuditWriteFailure() {
+	auditWriteFailures.Inc()
+}
+
+// NewRegistry creates a registry with the go runtime, process, db pool, http and business metrics plus any extra
+// collectors, e.g. repo query durations. a registry of our own keeps out whatever dependencies register globally
+func NewRegistry(db *sql.DB, extra ...prometheus.Collector) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, "primary"),
+		httpRequests,
+		httpDuration,
+		httpInFlight,
+		logins,
+		usersCreated,
+		rateLimited,
+		panics,
+		auditWriteFailures,
+	)
+	reg.MustRegister(extra...)
+	return reg
+}
+
+// Handler serves a registry's metrics for scraping
+func Handler(reg *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg})
+}
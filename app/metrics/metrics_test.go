@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // load pgx driver
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(HTTPMiddleware())
+	e.GET("/v1/user/:id", func(c echo.Context) error {
+		if c.Param("id") == "0" {
+			return echo.NewHTTPError(http.StatusNotFound, "no user")
+		}
+		return c.NoContent(http.StatusOK)
+	})
+
+	before := testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/v1/user/:id", "200"))
+	for _, path := range []string{"/v1/user/1", "/v1/user/2", "/v1/user/0", "/wp-login.php"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// labelled by route template, not url
+	assert.Equal(t, before+2, testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/v1/user/:id", "200")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/v1/user/:id", "404")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, routeUnmatched, "404")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(httpInFlight))
+}
+
+func TestObserve(t *testing.T) {
+	ObserveLogin(true)
+	ObserveLogin(false)
+	ObserveLogin(true)
+	assert.Equal(t, float64(2), testutil.ToFloat64(logins.WithLabelValues(LoginSuccess)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(logins.WithLabelValues(LoginFailure)))
+
+	ObserveUserCreated(UserSourceInvite)
+	assert.Equal(t, float64(1), testutil.ToFloat64(usersCreated.WithLabelValues(UserSourceInvite)))
+}
+
+func TestHandler(t *testing.T) {
+	db, err := sql.Open("pgx", "postgres://localhost/none") // never connects, stats only
+	assert.NoError(t, err)
+	extra := prometheus.NewCounter(prometheus.CounterOpts{Name: "extra_total"})
+	extra.Inc()
+
+	recorder := httptest.NewRecorder()
+	Handler(NewRegistry(db, extra)).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	body := recorder.Body.String()
+	for _, name := range []string{"go_goroutines", "go_sql_open_connections", "extra_total"} {
+		assert.True(t, strings.Contains(body, name), name)
+	}
+}
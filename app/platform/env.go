@@ -3,6 +3,7 @@ package platform
 import (
 	"context"
 	"log/slog"
+	"net/netip"
 	"os"
 	"time"
 
@@ -22,16 +23,182 @@ type DBConfig struct {
 	Name     string `env:"PGDATABASE,required"`
 	SSLMode  string `env:"PGSSLMODE" envDefault:"disable"`
 	Schema   string `env:"PGSCHEMA" envDefault:"public"`
+	Backend  string `env:"DB_BACKEND" envDefault:"stdlib"` // stdlib or pgxpool
 
 	ConnMaxIdleTime time.Duration `env:"DB_CONN_MAX_IDLE_TIME" envDefault:"1m"`
 	ConnMaxLifeTime time.Duration `env:"DB_CONN_MAX_LIFETIME" envDefault:"5m"`
 	MaxOpenConns    int           `env:"DB_MAX_OPEN_CONNS" envDefault:"-1"`
 	MaxIdleConns    int           `env:"DB_MAX_IDLE_CONNS" envDefault:"-1"`
+
+	ReplicaURIs          []string      `env:"DB_REPLICA_URIS" envSeparator:","` // optional read replica connection URIs
+	ReplicaMaxLag        time.Duration `env:"DB_REPLICA_MAX_LAG" envDefault:"5s"`
+	ReplicaCheckInterval time.Duration `env:"DB_REPLICA_CHECK_INTERVAL" envDefault:"5s"`
+}
+
+// TenantConfig struct for holding multi-tenancy config
+type TenantConfig struct {
+	Enabled       bool   `env:"TENANCY_ENABLED" envDefault:"false"`
+	BaseDomain    string `env:"TENANT_BASE_DOMAIN"` // tenant is the subdomain of this domain, e.g. acme.example.com
+	AutoProvision bool   `env:"TENANT_AUTO_PROVISION" envDefault:"false"`
+}
+
+// MailConfig struct for holding outbound email config
+type MailConfig struct {
+	Driver string `env:"MAIL_DRIVER" envDefault:"log"` // log, file or smtp
+	From   string `env:"MAIL_FROM" envDefault:"no-reply@localhost"`
+
+	SMTPHost     string `env:"SMTP_HOST" envDefault:"localhost"`
+	SMTPPort     int    `env:"SMTP_PORT" envDefault:"1025"`
+	SMTPUsername string `env:"SMTP_USERNAME"`
+	SMTPPassword string `env:"SMTP_PASSWORD"`
+
+	FileDir string `env:"MAIL_FILE_DIR" envDefault:".mail"`
+
+	Queue        string `env:"MAIL_QUEUE" envDefault:"memory"` // memory or jobs, jobs needs the worker binary running
+	QueueSize    int    `env:"MAIL_QUEUE_SIZE" envDefault:"1000"`
+	QueueWorkers int    `env:"MAIL_QUEUE_WORKERS" envDefault:"2"`
+}
+
+// JobsConfig struct for holding background job worker config
+type JobsConfig struct {
+	Queues       []string      `env:"JOB_QUEUES" envSeparator:"," envDefault:"default"`
+	Concurrency  int           `env:"JOB_CONCURRENCY" envDefault:"4"` // per queue
+	PollInterval time.Duration `env:"JOB_POLL_INTERVAL" envDefault:"1s"`
+	JobTimeout   time.Duration `env:"JOB_TIMEOUT" envDefault:"5m"`
+	StuckTimeout time.Duration `env:"JOB_STUCK_TIMEOUT" envDefault:"15m"`
+	Retention    time.Duration `env:"JOB_RETENTION" envDefault:"168h"` // succeeded jobs older than this are purged
+
+	SchedulerEnabled bool              `env:"SCHEDULER_ENABLED" envDefault:"true"`
+	Schedules        map[string]string `env:"SCHEDULES" envSeparator:";" envKeyValSeparator:"="` // name=cron spec, e.g. purge_jobs=0 3 * * *;report=@daily
+}
+
+// OutboxConfig struct for holding domain event relay config
+type OutboxConfig struct {
+	Sinks        []string      `env:"OUTBOX_SINKS" envSeparator:"," envDefault:"log,webhook,stream"`
+	BatchSize    int           `env:"OUTBOX_BATCH_SIZE" envDefault:"100"`
+	PollInterval time.Duration `env:"OUTBOX_POLL_INTERVAL" envDefault:"1s"`
+	ClaimTimeout time.Duration `env:"OUTBOX_CLAIM_TIMEOUT" envDefault:"5m"` // events a relay claimed but did not finish are retried after this
+	Retention    time.Duration `env:"OUTBOX_RETENTION" envDefault:"168h"`   // published events older than this are purged
+}
+
+// WebhookConfig struct for holding outbound webhook delivery config
+type WebhookConfig struct {
+	MaxAttempts int           `env:"WEBHOOK_MAX_ATTEMPTS" envDefault:"8"` // attempts before a delivery is marked failed
+	Timeout     time.Duration `env:"WEBHOOK_TIMEOUT" envDefault:"10s"`
+	// loopback and private network urls are refused unless allowed, they would let callers reach internal services
+	AllowPrivate bool `env:"WEBHOOK_ALLOW_PRIVATE" envDefault:"false"`
+}
+
+// StreamConfig struct for holding server-sent event stream config
+type StreamConfig struct {
+	Heartbeat time.Duration `env:"EVENT_STREAM_HEARTBEAT" envDefault:"15s"`
+	Buffer    int           `env:"EVENT_STREAM_BUFFER" envDefault:"64"`     // events queued per client before it is disconnected as too slow
+	Retention time.Duration `env:"EVENT_STREAM_RETENTION" envDefault:"24h"` // how long events can be resumed from
+}
+
+// RealtimeConfig struct for holding websocket config
+type RealtimeConfig struct {
+	AllowedOrigins []string      `env:"WS_ALLOWED_ORIGINS" envSeparator:","` // browser origins besides the server's own, * allows any
+	SendBuffer     int           `env:"WS_SEND_BUFFER" envDefault:"256"`     // messages queued per connection before it is closed as too slow
+	PingInterval   time.Duration `env:"WS_PING_INTERVAL" envDefault:"30s"`
+	MaxMessageSize int64         `env:"WS_MAX_MESSAGE_SIZE" envDefault:"65536"` // bytes
+	MaxTopics      int           `env:"WS_MAX_TOPICS" envDefault:"100"`         // subscriptions per connection
+}
+
+// HealthConfig struct for holding health check config
+type HealthConfig struct {
+	CheckTimeout time.Duration `env:"HEALTH_CHECK_TIMEOUT" envDefault:"2s"` // per check
+	CacheTTL     time.Duration `env:"HEALTH_CACHE_TTL" envDefault:"5s"`     // results are reused this long between probes
+}
+
+// TracingConfig struct for holding opentelemetry tracing config. the otlp exporter also reads the standard
+// OTEL_EXPORTER_OTLP_* env vars, e.g. OTEL_EXPORTER_OTLP_ENDPOINT
+type TracingConfig struct {
+	Exporter    string  `env:"TRACING_EXPORTER" envDefault:"none"` // none, stdout or otlp
+	ServiceName string  `env:"OTEL_SERVICE_NAME" envDefault:"starter-app"`
+	SampleRatio float64 `env:"TRACING_SAMPLE_RATIO" envDefault:"1"` // of new traces, traces sampled by the caller are always kept
+}
+
+// LogConfig struct for holding log output config
+type LogConfig struct {
+	Level            string            `env:"LOG_LEVEL" envDefault:"info"`                        // debug, info, warn or error
+	Levels           map[string]string `env:"LOG_LEVELS" envSeparator:"," envKeyValSeparator:"="` // per package, e.g. jobs=debug,slog-echo=warn
+	Format           string            `env:"LOG_FORMAT" envDefault:"json"`                       // json, text or pretty
+	Redact           bool              `env:"LOG_REDACT" envDefault:"true"`                       // mask emails, tokens and credentials
+	AccessSampleRate float64           `env:"LOG_ACCESS_SAMPLE_RATE" envDefault:"1"`              // of successful requests logged, failed ones always are
+}
+
+// RateLimitConfig struct for holding api rate limit config
+type RateLimitConfig struct {
+	Enabled      bool              `env:"RATE_LIMIT_ENABLED" envDefault:"true"`
+	Store        string            `env:"RATE_LIMIT_STORE" envDefault:"memory"`                                                // memory or postgres, postgres shares limits across replicas
+	Default      string            `env:"RATE_LIMIT_DEFAULT" envDefault:"300/1m"`                                              // requests per period per client, for routes without their own
+	Routes       map[string]string `env:"RATE_LIMIT_ROUTES" envSeparator:";" envKeyValSeparator:"=" envDefault:"/login=20/1m"` // METHOD /route or /route = limit/period
+	APIKeyHeader string            `env:"RATE_LIMIT_API_KEY_HEADER"`                                                           // identifies anonymous clients, only believed from TRUSTED_PROXIES, which must check the key
+	Retention    time.Duration     `env:"RATE_LIMIT_RETENTION" envDefault:"24h"`                                               // idle postgres buckets are purged after this, keep above the longest period
+}
+
+// HTTPConfig struct for holding cors, security header, body limit and compression config
+type HTTPConfig struct {
+	CORSAllowedOrigins   []string      `env:"CORS_ALLOWED_ORIGINS" envSeparator:","` // browser origins allowed to call the api, none turns cors off, * allows any
+	CORSAllowCredentials bool          `env:"CORS_ALLOW_CREDENTIALS" envDefault:"false"`
+	CORSMaxAge           time.Duration `env:"CORS_MAX_AGE" envDefault:"10m"` // how long browsers cache a preflight response
+
+	HSTSMaxAge            time.Duration `env:"HSTS_MAX_AGE" envDefault:"8760h"` // only sent over https, 0 turns it off
+	ContentSecurityPolicy string        `env:"CONTENT_SECURITY_POLICY" envDefault:"default-src 'self'; frame-ancestors 'none'"`
+	FrameOptions          string        `env:"FRAME_OPTIONS" envDefault:"DENY"`
+
+	// proxies whose X-Forwarded-For is believed, e.g. 10.0.0.0/8. with none, clients are known by the address they
+	// connect from, since any client can send the header
+	TrustedProxies []netip.Prefix `env:"TRUSTED_PROXIES" envSeparator:","`
+
+	BodyLimit    string `env:"BODY_LIMIT" envDefault:"64K"`    // requests outside /v1, e.g. 512K or 2M
+	APIBodyLimit string `env:"API_BODY_LIMIT" envDefault:"1M"` // requests to /v1
+
+	CompressionEnabled   bool `env:"COMPRESSION_ENABLED" envDefault:"true"`
+	CompressionMinLength int  `env:"COMPRESSION_MIN_LENGTH" envDefault:"1024"` // bytes, smaller responses are not compressed
+}
+
+// ReportingConfig struct for holding error reporting config
+type ReportingConfig struct {
+	Reporter  string        `env:"ERROR_REPORTER" envDefault:"none"` // none, file or sentry
+	SentryDSN string        `env:"SENTRY_DSN"`                       // any sentry compatible server works, e.g. a self-hosted glitchtip
+	FileDir   string        `env:"ERROR_REPORT_DIR" envDefault:".errors"`
+	Timeout   time.Duration `env:"ERROR_REPORT_TIMEOUT" envDefault:"5s"`
+	QueueSize int           `env:"ERROR_REPORT_QUEUE_SIZE" envDefault:"100"`
+}
+
+// WorkerConfig struct for holding job worker binary config
+type WorkerConfig struct {
+	DB        DBConfig
+	Mail      MailConfig
+	Jobs      JobsConfig
+	Outbox    OutboxConfig
+	Webhook   WebhookConfig
+	Stream    StreamConfig
+	Tracing   TracingConfig
+	Log       LogConfig
+	RateLimit RateLimitConfig
+
+	Environment string `env:"ENVIRONMENT,required"`
+
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"30s"` // how long shutting down may take in total, including running jobs finishing
 }
 
 // Config struct for holding app config
 type Config struct {
-	DB DBConfig
+	DB        DBConfig
+	Tenant    TenantConfig
+	Mail      MailConfig
+	Webhook   WebhookConfig
+	Stream    StreamConfig
+	Realtime  RealtimeConfig
+	Health    HealthConfig
+	Tracing   TracingConfig
+	Log       LogConfig
+	RateLimit RateLimitConfig
+	HTTP      HTTPConfig
+	Reporting ReportingConfig
 
 	GoogleClientID     string `env:"GOOGLE_CLIENT_ID,required"`
 	GoogleClientSecret string `env:"GOOGLE_CLIENT_SECRET,required"`
@@ -41,7 +208,15 @@ type Config struct {
 	ServerURL     string `env:"SERVER_URL" envDefault:"http://localhost"`
 	ServerPort    int    `env:"SERVER_PORT" envDefault:"8000"`
 	ServerAddress string `env:"SERVER_ADDRESS,expand" envDefault:"${SERVER_URL}:${SERVER_PORT}"`
+	MetricsPort   int    `env:"METRICS_PORT" envDefault:"0"`         // serves /metrics on its own port, 0 serves it on SERVER_PORT
 	JWTSignKey    string `env:"JWT_SIGN_KEY" envDefault:"my-secret"` // FIXME: do not want default, make required
+
+	AdminEmails []string `env:"ADMIN_EMAILS" envSeparator:","` // users allowed to call /v1/admin, by the email they log in with. none locks everyone out
+
+	ShutdownTimeout    time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"30s"`    // how long shutting down may take in total, keep under the pod's termination grace period
+	ShutdownDrainDelay time.Duration `env:"SHUTDOWN_DRAIN_DELAY" envDefault:"5s"` // time between failing readiness and closing the listener, for load balancers to stop routing here
+
+	InviteTTL time.Duration `env:"INVITE_TTL" envDefault:"168h"`
 }
 
 // NewDBConfig creates new db config. used by CMDs that do not need every setting
@@ -56,6 +231,18 @@ func NewDBConfig() (DBConfig, error) {
 	return cfg, nil
 }
 
+// NewWorkerConfig creates new job worker config
+func NewWorkerConfig() (WorkerConfig, error) {
+	if err := loadEnv(context.Background()); err != nil {
+		return WorkerConfig{}, err
+	}
+	var cfg WorkerConfig
+	if err := env.Parse(&cfg); err != nil {
+		return WorkerConfig{}, err
+	}
+	return cfg, nil
+}
+
 // NewConfig creates new app config
 func NewConfig() (Config, error) {
 	if err := loadEnv(context.Background()); err != nil {
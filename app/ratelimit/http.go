@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/drmaples/starter-app/app/metrics"
+)
+
+// response headers, as in the ietf RateLimit header fields draft
+const (
+	HeaderLimit     = "RateLimit-Limit"
+	HeaderRemaining = "RateLimit-Remaining"
+	HeaderReset     = "RateLimit-Reset"
+	HeaderPolicy    = "RateLimit-Policy"
+)
+
+// KeyFunc identifies the client a request is from, e.g. sub:foo@example.com or ip:10.0.0.1
+type KeyFunc func(c echo.Context) string
+
+// Middleware takes a token from the client's bucket for the route's policy, responding 429 Too Many Requests with
+// Retry-After when there is none left. a nil limiter does not limit. requests are let through if the store fails,
+// an outage of the store should not become an outage of the api
+func Middleware(l *Limiter, key KeyFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if l == nil {
+			return next
+		}
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+			p := l.Policy(c.Request().Method, c.Path())
+			res, err := l.Take(ctx, p, key(c))
+			if err != nil {
+				slog.ErrorContext(ctx, "problem checking rate limit, allowing request", slog.Any("error", err))
+				return next(c)
+			}
+
+			h := c.Response().Header()
+			h.Set(HeaderLimit, strconv.Itoa(p.Limit))
+			h.Set(HeaderRemaining, strconv.Itoa(res.Remaining))
+			h.Set(HeaderReset, seconds(res.Reset))
+			h.Set(HeaderPolicy, fmt.Sprintf("%d;w=%s", p.Limit, seconds(p.Period)))
+			if !res.Allowed {
+				metrics.ObserveRateLimited(p.Name)
+				h.Set(echo.HeaderRetryAfter, seconds(res.RetryAfter))
+				return echo.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded")
+			}
+			return next(c)
+		}
+	}
+}
+
+// seconds rounds up to whole seconds, headers do not take fractions
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,27 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+// PostgresStore keeps buckets in postgres, so limits hold across every replica
+type PostgresStore struct {
+	db     *repo.DB
+	schema string
+	repo   repo.IRateLimitRepo
+}
+
+// NewPostgresStore creates a store keeping buckets in schema
+func NewPostgresStore(db *repo.DB, schema string, rateLimitRepo repo.IRateLimitRepo) *PostgresStore {
+	return &PostgresStore{db: db, schema: schema, repo: rateLimitRepo}
+}
+
+// Take implements Store
+func (s *PostgresStore) Take(ctx context.Context, key string, p Policy) (Result, error) {
+	tokens, allowed, err := s.repo.TakeRateLimitToken(ctx, s.db, s.schema, key, float64(p.Limit), p.perSecond())
+	if err != nil {
+		return Result{}, err
+	}
+	return p.result(tokens, allowed), nil
+}
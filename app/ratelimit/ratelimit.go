@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// store kinds
+const (
+	StoreMemory   = "memory"   // per replica, limits multiply with the number of replicas
+	StorePostgres = "postgres" // shared by every replica
+)
+
+// DefaultPolicy is the name of the policy for routes without one of their own
+const DefaultPolicy = "default"
+
+// Policy lets a client make Limit requests per Period, in bursts of up to Limit. it is a token bucket holding Limit
+// tokens that refills at Limit per Period
+type Policy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+}
+
+// ParsePolicy parses a policy like 100/1m
+func ParsePolicy(name string, s string) (Policy, error) {
+	limit, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Policy{}, errors.Errorf("invalid rate limit %q for %s, want limit/period e.g. 100/1m", s, name)
+	}
+	p := Policy{Name: name}
+	var err error
+	if p.Limit, err = strconv.Atoi(limit); err != nil || p.Limit < 1 {
+		return Policy{}, errors.Errorf("invalid rate limit %q for %s, limit must be a positive number", s, name)
+	}
+	if p.Period, err = time.ParseDuration(period); err != nil || p.Period <= 0 {
+		return Policy{}, errors.Errorf("invalid rate limit %q for %s, period must be a positive duration", s, name)
+	}
+	return p, nil
+}
+
+// perSecond is how fast the bucket refills
+func (p Policy) perSecond() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	Allowed    bool
+	Remaining  int           // whole tokens left
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until a token is available, zero when allowed
+}
+
+// result describes a bucket left holding tokens
+func (p Policy) result(tokens float64, allowed bool) Result {
+	res := Result{
+		Allowed:   allowed,
+		Remaining: max(0, int(math.Floor(tokens))),
+		Reset:     p.wait(float64(p.Limit) - tokens),
+	}
+	if !allowed {
+		res.RetryAfter = p.wait(1 - tokens)
+	}
+	return res
+}
+
+// wait is how long refilling tokens takes
+func (p Policy) wait(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / p.perSecond() * float64(time.Second))
+}
+
+// Store keeps token buckets
+type Store interface {
+	// Take takes a token from the bucket for key, refilled as p says, if it has one
+	Take(ctx context.Context, key string, p Policy) (Result, error)
+}
+
+// Limiter picks the policy for a route and takes tokens from a client's bucket for it
+type Limiter struct {
+	store  Store
+	def    Policy
+	routes map[string]Policy
+}
+
+// New creates a limiter. routes are keyed by METHOD /route or /route for every method, with route as registered,
+// e.g. POST /v1/user or /v1/user/:id. each route policy has its own buckets, routes without one share def's
+func New(store Store, def Policy, routes map[string]Policy) *Limiter {
+	return &Limiter{store: store, def: def, routes: routes}
+}
+
+// NewFromConfig creates a limiter from policies like 100/1m, as in config
+func NewFromConfig(store Store, def string, routes map[string]string) (*Limiter, error) {
+	defPolicy, err := ParsePolicy(DefaultPolicy, def)
+	if err != nil {
+		return nil, err
+	}
+	routePolicies := make(map[string]Policy, len(routes))
+	for route, s := range routes {
+		p, err := ParsePolicy(route, s)
+		if err != nil {
+			return nil, err
+		}
+		routePolicies[route] = p
+	}
+	return New(store, defPolicy, routePolicies), nil
+}
+
+// Policy is the policy for a route
+func (l *Limiter) Policy(method string, route string) Policy {
+	if p, ok := l.routes[method+" "+route]; ok {
+		return p
+	}
+	if p, ok := l.routes[route]; ok {
+		return p
+	}
+	return l.def
+}
+
+// Take takes a token from client's bucket for p
+func (l *Limiter) Take(ctx context.Context, p Policy, client string) (Result, error) {
+	return l.store.Take(ctx, p.Name+"|"+client, p)
+}
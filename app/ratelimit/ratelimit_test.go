@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("default", "100/1m")
+	assert.NoError(t, err)
+	assert.Equal(t, Policy{Name: "default", Limit: 100, Period: time.Minute}, p)
+
+	for _, s := range []string{"100", "0/1m", "x/1m", "100/x", "100/-1s"} {
+		_, err := ParsePolicy("default", s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestLimiter_Policy(t *testing.T) {
+	l, err := NewFromConfig(NewMemoryStore(), "100/1m", map[string]string{
+		"/login":        "5/1m",
+		"POST /v1/user": "10/1m",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "/login", l.Policy(http.MethodGet, "/login").Name)
+	assert.Equal(t, "POST /v1/user", l.Policy(http.MethodPost, "/v1/user").Name)
+	assert.Equal(t, DefaultPolicy, l.Policy(http.MethodGet, "/v1/user").Name)
+
+	_, err = NewFromConfig(NewMemoryStore(), "100/1m", map[string]string{"/login": "lots"})
+	assert.ErrorContains(t, err, "/login")
+}
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	p := Policy{Name: "p", Limit: 2, Period: 10 * time.Second}
+
+	res, _ := s.Take(context.Background(), "a", p)
+	assert.Equal(t, Result{Allowed: true, Remaining: 1, Reset: 5 * time.Second}, res)
+	res, _ = s.Take(context.Background(), "a", p)
+	assert.Equal(t, Result{Allowed: true, Remaining: 0, Reset: 10 * time.Second}, res)
+	res, _ = s.Take(context.Background(), "a", p)
+	assert.Equal(t, Result{Allowed: false, Remaining: 0, Reset: 10 * time.Second, RetryAfter: 5 * time.Second}, res)
+
+	res, _ = s.Take(context.Background(), "b", p)
+	assert.True(t, res.Allowed, "buckets are per key")
+
+	now = now.Add(5 * time.Second)
+	res, _ = s.Take(context.Background(), "a", p)
+	assert.True(t, res.Allowed, "refilled a token")
+
+	now = now.Add(time.Minute)
+	s.sweep()
+	assert.Empty(t, s.buckets, "full buckets are dropped")
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, Policy) (Result, error) {
+	return Result{}, errors.New("connection refused")
+}
+
+func TestMiddleware(t *testing.T) {
+	serve := func(l *Limiter, ip string) *httptest.ResponseRecorder {
+		e := echo.New()
+		e.GET("/v1/user", func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		}, Middleware(l, func(c echo.Context) string { return "ip:" + c.RealIP() }))
+		req := httptest.NewRequest(http.MethodGet, "/v1/user", nil)
+		req.Header.Set(echo.HeaderXRealIP, ip)
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	l := New(NewMemoryStore(), Policy{Name: DefaultPolicy, Limit: 1, Period: time.Minute}, nil)
+	recorder := serve(l, "10.0.0.1")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "1", recorder.Header().Get(HeaderLimit))
+	assert.Equal(t, "0", recorder.Header().Get(HeaderRemaining))
+	assert.Equal(t, "60", recorder.Header().Get(HeaderReset))
+	assert.Equal(t, "1;w=60", recorder.Header().Get(HeaderPolicy))
+	assert.Empty(t, recorder.Header().Get(echo.HeaderRetryAfter))
+
+	recorder = serve(l, "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "60", recorder.Header().Get(echo.HeaderRetryAfter))
+
+	assert.Equal(t, http.StatusOK, serve(l, "10.0.0.2").Code, "other clients are not limited")
+	assert.Equal(t, http.StatusOK, serve(nil, "10.0.0.1").Code, "no limiter, no limits")
+
+	recorder = serve(New(failingStore{}, Policy{Name: DefaultPolicy, Limit: 1, Period: time.Minute}, nil), "10.0.0.1")
+	assert.Equal(t, http.StatusOK, recorder.Code, "a failing store lets requests through")
+	assert.Empty(t, recorder.Header().Get(HeaderLimit))
+}
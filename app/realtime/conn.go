@@ -0,0 +1,129 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// conn is one websocket connection. reads happen in readLoop, every write goes through the send queue to writeLoop
+type conn struct {
+	hub    *Hub
+	ws     *websocket.Conn
+	client Client
+	topics map[string]struct{} // guarded by hub.mu
+
+	mu          sync.Mutex
+	send        chan Outbound
+	closed      bool
+	closeCode   int
+	closeReason string
+}
+
+func newConn(h *Hub, ws *websocket.Conn, client Client) *conn {
+	return &conn{
+		hub:    h,
+		ws:     ws,
+		client: client,
+		topics: map[string]struct{}{},
+		send:   make(chan Outbound, h.opts.SendBuffer),
+	}
+}
+
+func (c *conn) key(topic string) topicKey {
+	return topicKey{tenant: c.client.Tenant, topic: topic}
+}
+
+// enqueue queues a message without blocking. a client too slow to keep up with its queue is disconnected rather than
+// slowing down everyone else on its topics, it can reconnect and resubscribe
+func (c *conn) enqueue(msg Outbound) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.send <- msg:
+	default:
+		c.closeLocked(websocket.CloseTryAgainLater, "too slow")
+	}
+}
+
+func (c *conn) replyError(in Inbound, err error) {
+	c.enqueue(Outbound{Type: TypeError, Topic: in.Topic, Error: err.Error(), Ref: in.Ref})
+}
+
+// close stops the send queue, writeLoop then sends a close message with code and reason. only the first call counts
+func (c *conn) close(code int, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeLocked(code, reason)
+}
+
+func (c *conn) closeLocked(code int, reason string) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.closeCode = code
+	c.closeReason = reason
+	close(c.send)
+}
+
+func (c *conn) readLoop(ctx context.Context) {
+	pongWait := 2 * c.hub.opts.PingInterval
+	c.ws.SetReadLimit(c.hub.opts.MaxMessageSize)
+	_ = c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			// closed by the client, by writeLoop or a missed pong
+			return
+		}
+		_ = c.ws.SetReadDeadline(time.Now().Add(pongWait))
+
+		var in Inbound
+		if err := json.Unmarshal(data, &in); err != nil {
+			c.replyError(in, ErrMalformedMessage)
+			continue
+		}
+		c.hub.handle(ctx, c, in)
+	}
+}
+
+func (c *conn) writeLoop() {
+	ping := time.NewTicker(c.hub.opts.PingInterval)
+	defer func() {
+		ping.Stop()
+		_ = c.ws.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			_ = c.ws.SetWriteDeadline(time.Now().Add(c.hub.opts.WriteTimeout))
+			if !ok {
+				c.mu.Lock()
+				closeMsg := websocket.FormatCloseMessage(c.closeCode, c.closeReason)
+				c.mu.Unlock()
+				_ = c.ws.WriteMessage(websocket.CloseMessage, closeMsg)
+				return
+			}
+			if err := c.ws.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ping.C:
+			_ = c.ws.SetWriteDeadline(time.Now().Add(c.hub.opts.WriteTimeout))
+			if err := c.ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultSendBuffer     = 256
+	defaultPingInterval   = 30 * time.Second
+	defaultWriteTimeout   = 10 * time.Second
+	defaultMaxMessageSize = 64 * 1024
+	defaultMaxTopics      = 100
+)
+
+// ErrShuttingDown is returned by Serve once Shutdown has been called
+var ErrShuttingDown = errors.New("realtime hub is shutting down")
+
+// Options controls a Hub. zero values use the defaults
+type Options struct {
+	AllowedOrigins []string      // origins allowed to connect from besides the server's own host, "*" allows any
+	SendBuffer     int           // messages queued per connection before it is closed as too slow
+	PingInterval   time.Duration // a connection not answering pings for twice this long is closed
+	WriteTimeout   time.Duration
+	MaxMessageSize int64 // bytes, larger messages from a client close its connection
+	MaxTopics      int   // subscriptions per connection
+}
+
+func (o Options) withDefaults() Options {
+	if o.SendBuffer <= 0 {
+		o.SendBuffer = defaultSendBuffer
+	}
+	if o.PingInterval <= 0 {
+		o.PingInterval = defaultPingInterval
+	}
+	if o.WriteTimeout <= 0 {
+		o.WriteTimeout = defaultWriteTimeout
+	}
+	if o.MaxMessageSize <= 0 {
+		o.MaxMessageSize = defaultMaxMessageSize
+	}
+	if o.MaxTopics <= 0 {
+		o.MaxTopics = defaultMaxTopics
+	}
+	return o
+}
+
+// Client is who a connection belongs to
+type Client struct {
+	ID     string // identifies the client to others in presence and published messages, e.g. user/123
+	Tenant string // topics are scoped to a tenant, clients of different tenants never see each other
+
+	// Authorize is checked on subscribe, nil allows every topic
+	Authorize func(ctx context.Context, topic string) error
+}
+
+type topicKey struct {
+	tenant string
+	topic  string
+}
+
+// Hub accepts websocket connections and routes messages between subscribers of a topic. topics live in memory on
+// one server, clients collaborating on a topic must be connected to the same instance
+type Hub struct {
+	opts     Options
+	upgrader websocket.Upgrader
+
+	mu       sync.Mutex
+	conns    map[*conn]struct{}
+	topics   map[topicKey]map[*conn]struct{}
+	shutdown bool
+	wg       sync.WaitGroup
+}
+
+// NewHub creates a new hub
+func NewHub(opts Options) *Hub {
+	opts = opts.withDefaults()
+	h := &Hub{
+		opts:   opts,
+		conns:  map[*conn]struct{}{},
+		topics: map[topicKey]map[*conn]struct{}{},
+	}
+	h.upgrader = websocket.Upgrader{CheckOrigin: h.checkOrigin}
+	return h
+}
+
+// checkOrigin allows same host requests, non browser clients that send no origin and the configured origins
+func (h *Hub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return slices.ContainsFunc(h.opts.AllowedOrigins, func(allowed string) bool {
+		return allowed == "*" || strings.EqualFold(allowed, origin)
+	})
+}
+
+// Serve upgrades the request to a websocket and handles the connection until it closes. the upgrader has already
+// responded to the request when an error is returned
+func (h *Hub) Serve(w http.ResponseWriter, r *http.Request, client Client) error {
+	h.mu.Lock()
+	if h.shutdown {
+		h.mu.Unlock()
+		http.Error(w, ErrShuttingDown.Error(), http.StatusServiceUnavailable)
+		return ErrShuttingDown
+	}
+	h.wg.Add(1)
+	h.mu.Unlock()
+	defer h.wg.Done()
+
+	ws, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return errors.Wrap(err, "problem upgrading to websocket")
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	c := newConn(h, ws, client)
+	h.mu.Lock()
+	if h.shutdown {
+		c.close(websocket.CloseGoingAway, "server shutting down")
+	}
+	h.conns[c] = struct{}{}
+	h.mu.Unlock()
+
+	writeDone := make(chan struct{})
+	go func() {
+		defer close(writeDone)
+		c.writeLoop()
+	}()
+	c.readLoop(ctx)
+
+	h.remove(c)
+	c.close(websocket.CloseNormalClosure, "")
+	<-writeDone
+	return nil
+}
+
+// Publish sends data to every subscriber of a tenant's topic, e.g. a server side change others should see
+func (h *Hub) Publish(tenant string, topic string, data json.RawMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.broadcast(topicKey{tenant: tenant, topic: topic}, nil, Outbound{Type: TypeMessage, Topic: topic, Data: data})
+}
+
+// Shutdown closes every connection with a going away status and waits for them to finish, or ctx to be done. new
+// connections are refused from the moment it is called
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.shutdown = true
+	for c := range h.conns {
+		c.close(websocket.CloseGoingAway, "server shutting down")
+	}
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "problem waiting for websocket connections to close")
+	}
+}
+
+func (h *Hub) handle(ctx context.Context, c *conn, in Inbound) {
+	switch in.Type {
+	case TypeSubscribe:
+		h.subscribe(ctx, c, in)
+	case TypeUnsubscribe:
+		h.unsubscribe(c, in)
+	case TypePublish:
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := c.topics[in.Topic]; !ok {
+			c.replyError(in, ErrNotSubscribed)
+			return
+		}
+		h.broadcast(c.key(in.Topic), c, Outbound{Type: TypeMessage, Topic: in.Topic, Data: in.Data, From: c.client.ID})
+	default:
+		c.replyError(in, ErrUnknownType)
+	}
+}
+
+func (h *Hub) subscribe(ctx context.Context, c *conn, in Inbound) {
+	if !validTopic(in.Topic) {
+		c.replyError(in, ErrInvalidTopic)
+		return
+	}
+	if c.client.Authorize != nil {
+		if err := c.client.Authorize(ctx, in.Topic); err != nil {
+			slog.DebugContext(ctx, "websocket subscription denied", slog.String("topic", in.Topic), slog.Any("error", err))
+			c.replyError(in, ErrTopicUnauthorized)
+			return
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := c.key(in.Topic)
+	if _, ok := c.topics[in.Topic]; !ok {
+		if len(c.topics) >= h.opts.MaxTopics {
+			c.replyError(in, ErrTooManyTopics)
+			return
+		}
+		if !h.present(key, c.client.ID) {
+			h.broadcast(key, c, Outbound{Type: TypePresence, Topic: in.Topic, Action: PresenceJoin, From: c.client.ID})
+		}
+		if h.topics[key] == nil {
+			h.topics[key] = map[*conn]struct{}{}
+		}
+		h.topics[key][c] = struct{}{}
+		c.topics[in.Topic] = struct{}{}
+	}
+	c.enqueue(Outbound{Type: TypeSubscribed, Topic: in.Topic, Members: h.members(key), Ref: in.Ref})
+}
+
+func (h *Hub) unsubscribe(c *conn, in Inbound) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := c.topics[in.Topic]; !ok {
+		c.replyError(in, ErrNotSubscribed)
+		return
+	}
+	h.leave(c, in.Topic)
+	c.enqueue(Outbound{Type: TypeUnsubscribed, Topic: in.Topic, Ref: in.Ref})
+}
+
+// remove drops a closed connection from every topic
+func (h *Hub) remove(c *conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for topic := range c.topics {
+		h.leave(c, topic)
+	}
+	delete(h.conns, c)
+}
+
+// leave must be called with mu held
+func (h *Hub) leave(c *conn, topic string) {
+	key := c.key(topic)
+	delete(h.topics[key], c)
+	delete(c.topics, topic)
+	if len(h.topics[key]) == 0 {
+		delete(h.topics, key)
+	}
+	if !h.present(key, c.client.ID) {
+		h.broadcast(key, c, Outbound{Type: TypePresence, Topic: topic, Action: PresenceLeave, From: c.client.ID})
+	}
+}
+
+// present reports whether a client has any connection subscribed to a topic, e.g. another browser tab. must be
+// called with mu held
+func (h *Hub) present(key topicKey, clientID string) bool {
+	for c := range h.topics[key] {
+		if c.client.ID == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// members must be called with mu held
+func (h *Hub) members(key topicKey) []string {
+	var res []string
+	for c := range h.topics[key] {
+		if !slices.Contains(res, c.client.ID) {
+			res = append(res, c.client.ID)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// broadcast sends to every subscriber of a topic except skip. must be called with mu held
+func (h *Hub) broadcast(key topicKey, skip *conn, msg Outbound) {
+	for c := range h.topics[key] {
+		if c != skip {
+			c.enqueue(msg)
+		}
+	}
+}
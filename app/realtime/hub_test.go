@@ -0,0 +1,184 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// newServer serves the hub, the client id and tenant come from the query string
+func newServer(t *testing.T, hub *Hub) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		_ = hub.Serve(w, r, Client{
+			ID:     q.Get("id"),
+			Tenant: q.Get("tenant"),
+			Authorize: func(_ context.Context, topic string) error {
+				if strings.HasPrefix(topic, "private") {
+					return errors.New("denied")
+				}
+				return nil
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func dial(t *testing.T, srv *httptest.Server, id string, tenant string) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "?id=" + id + "&tenant=" + tenant
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = ws.Close() })
+	return ws
+}
+
+func send(t *testing.T, ws *websocket.Conn, in Inbound) {
+	assert.NoError(t, ws.WriteJSON(in))
+}
+
+func read(t *testing.T, ws *websocket.Conn) Outbound {
+	_ = ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var out Outbound
+	assert.NoError(t, ws.ReadJSON(&out))
+	return out
+}
+
+func TestHub_subscribe_publish_presence(t *testing.T) {
+	srv := newServer(t, NewHub(Options{}))
+
+	alice := dial(t, srv, "user/1", "tenant_a")
+	send(t, alice, Inbound{Type: TypeSubscribe, Topic: "doc/1", Ref: "1"})
+	assert.Equal(t, Outbound{Type: TypeSubscribed, Topic: "doc/1", Members: []string{"user/1"}, Ref: "1"}, read(t, alice))
+
+	bob := dial(t, srv, "user/2", "tenant_a")
+	send(t, bob, Inbound{Type: TypeSubscribe, Topic: "doc/1"})
+	assert.Equal(t, Outbound{Type: TypeSubscribed, Topic: "doc/1", Members: []string{"user/1", "user/2"}}, read(t, bob))
+	assert.Equal(t, Outbound{Type: TypePresence, Topic: "doc/1", Action: PresenceJoin, From: "user/2"}, read(t, alice))
+
+	// same topic name in another tenant is a different topic
+	eve := dial(t, srv, "user/3", "tenant_b")
+	send(t, eve, Inbound{Type: TypeSubscribe, Topic: "doc/1"})
+	assert.Equal(t, []string{"user/3"}, read(t, eve).Members)
+
+	send(t, bob, Inbound{Type: TypePublish, Topic: "doc/1", Data: json.RawMessage(`{"cursor":4}`)})
+	assert.Equal(t, Outbound{Type: TypeMessage, Topic: "doc/1", Data: json.RawMessage(`{"cursor":4}`), From: "user/2"}, read(t, alice))
+
+	send(t, bob, Inbound{Type: TypeUnsubscribe, Topic: "doc/1", Ref: "2"})
+	assert.Equal(t, Outbound{Type: TypeUnsubscribed, Topic: "doc/1", Ref: "2"}, read(t, bob))
+	assert.Equal(t, Outbound{Type: TypePresence, Topic: "doc/1", Action: PresenceLeave, From: "user/2"}, read(t, alice))
+
+	// nothing from the other tenant or bob's own publish reached alice
+	send(t, alice, Inbound{Type: TypeSubscribe, Topic: "doc/1", Ref: "3"})
+	assert.Equal(t, "3", read(t, alice).Ref)
+}
+
+func TestHub_errors(t *testing.T) {
+	srv := newServer(t, NewHub(Options{MaxTopics: 1}))
+	ws := dial(t, srv, "user/1", "tenant_a")
+
+	tests := []struct {
+		name string
+		in   Inbound
+		err  error
+	}{
+		{name: "invalid_topic", in: Inbound{Type: TypeSubscribe, Topic: "bad topic"}, err: ErrInvalidTopic},
+		{name: "unauthorized", in: Inbound{Type: TypeSubscribe, Topic: "private/1"}, err: ErrTopicUnauthorized},
+		{name: "publish_not_subscribed", in: Inbound{Type: TypePublish, Topic: "doc/1"}, err: ErrNotSubscribed},
+		{name: "unsubscribe_not_subscribed", in: Inbound{Type: TypeUnsubscribe, Topic: "doc/1"}, err: ErrNotSubscribed},
+		{name: "unknown_type", in: Inbound{Type: "shout", Topic: "doc/1"}, err: ErrUnknownType},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			send(t, ws, tc.in)
+			out := read(t, ws)
+			assert.Equal(t, TypeError, out.Type)
+			assert.Equal(t, tc.err.Error(), out.Error)
+		})
+	}
+
+	t.Run("too_many_topics", func(t *testing.T) {
+		send(t, ws, Inbound{Type: TypeSubscribe, Topic: "doc/1"})
+		assert.Equal(t, TypeSubscribed, read(t, ws).Type)
+		send(t, ws, Inbound{Type: TypeSubscribe, Topic: "doc/2"})
+		assert.Equal(t, ErrTooManyTopics.Error(), read(t, ws).Error)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		assert.NoError(t, ws.WriteMessage(websocket.TextMessage, []byte("{")))
+		assert.Equal(t, ErrMalformedMessage.Error(), read(t, ws).Error)
+	})
+}
+
+func TestHub_slow_client_is_dropped(t *testing.T) {
+	hub := NewHub(Options{SendBuffer: 1})
+	srv := newServer(t, hub)
+	ws := dial(t, srv, "user/1", "tenant_a")
+	send(t, ws, Inbound{Type: TypeSubscribe, Topic: "doc/1"})
+	read(t, ws)
+
+	// the client does not read while more piles up than socket buffers can hold
+	data := json.RawMessage(`"` + strings.Repeat("x", 10*1024) + `"`)
+	for range 1000 {
+		hub.Publish("tenant_a", "doc/1", data)
+	}
+
+	_ = ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var err error
+	for err == nil {
+		_, _, err = ws.ReadMessage()
+	}
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseTryAgainLater), err)
+}
+
+func TestHub_Shutdown(t *testing.T) {
+	hub := NewHub(Options{})
+	srv := newServer(t, hub)
+	ws := dial(t, srv, "user/1", "tenant_a")
+	send(t, ws, Inbound{Type: TypeSubscribe, Topic: "doc/1"})
+	read(t, ws)
+
+	done := make(chan error)
+	go func() {
+		done <- hub.Shutdown(context.Background())
+	}()
+
+	_ = ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := ws.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+	assert.NoError(t, <-done)
+
+	// new connections are refused
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestHub_checkOrigin(t *testing.T) {
+	hub := NewHub(Options{AllowedOrigins: []string{"https://app.example.com"}})
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{origin: "", want: true},
+		{origin: "http://api.example.com", want: true},
+		{origin: "https://app.example.com", want: true},
+		{origin: "https://evil.example.com", want: false},
+	}
+	for _, tc := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://api.example.com/v1/ws", nil)
+		if tc.origin != "" {
+			r.Header.Set("Origin", tc.origin)
+		}
+		assert.Equal(t, tc.want, hub.checkOrigin(r), tc.origin)
+	}
+}
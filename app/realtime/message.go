@@ -0,0 +1,66 @@
+package realtime
+
+import (
+	"encoding/json"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// message types sent by clients
+const (
+	TypeSubscribe   = "subscribe"
+	TypeUnsubscribe = "unsubscribe"
+	TypePublish     = "publish"
+)
+
+// message types sent by the server
+const (
+	TypeSubscribed   = "subscribed"
+	TypeUnsubscribed = "unsubscribed"
+	TypeMessage      = "message"
+	TypePresence     = "presence"
+	TypeError        = "error"
+)
+
+// presence actions
+const (
+	PresenceJoin  = "join"
+	PresenceLeave = "leave"
+)
+
+var topicPattern = regexp.MustCompile(`^[a-zA-Z0-9_.:/-]{1,200}$`)
+
+// errors sent back to clients
+var (
+	ErrInvalidTopic      = errors.New("invalid topic")
+	ErrNotSubscribed     = errors.New("not subscribed to topic")
+	ErrTooManyTopics     = errors.New("too many subscriptions")
+	ErrUnknownType       = errors.New("unknown message type")
+	ErrMalformedMessage  = errors.New("malformed message")
+	ErrTopicUnauthorized = errors.New("not allowed to subscribe to topic")
+)
+
+// Inbound is a message from a client. Ref is echoed back in the reply so clients can match them up
+type Inbound struct {
+	Type  string          `json:"type"`
+	Topic string          `json:"topic"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Ref   string          `json:"ref,omitempty"`
+}
+
+// Outbound is a message to a client
+type Outbound struct {
+	Type    string          `json:"type"`
+	Topic   string          `json:"topic,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	From    string          `json:"from,omitempty"`    // client that published the message or whose presence changed
+	Action  string          `json:"action,omitempty"`  // presence join or leave
+	Members []string        `json:"members,omitempty"` // everyone subscribed, sent on subscribe
+	Error   string          `json:"error,omitempty"`
+	Ref     string          `json:"ref,omitempty"`
+}
+
+func validTopic(topic string) bool {
+	return topicPattern.MatchString(topic)
+}
@@ -0,0 +1,132 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// audit actions. handlers may record other actions, e.g. replay
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+)
+
+// AuditEntry represents one mutating api call
+type AuditEntry struct {
+	ID         int64           `db:"id"`
+	Actor      string          `db:"actor"`
+	Action     string          `db:"action"`
+	Method     string          `db:"method"`
+	Route      string          `db:"route"`
+	Resource   string          `db:"resource"`
+	ResourceID *string         `db:"resource_id"`
+	Status     int             `db:"status"`
+	Before     json.RawMessage `db:"before"`
+	After      json.RawMessage `db:"after"`
+	IP         *string         `db:"ip"`
+	RequestID  *string         `db:"request_id"`
+	CreatedAt  time.Time       `db:"created_at"`
+}
+
+// AuditFilter narrows down audit entries. zero values do not filter
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	Resource   string
+	ResourceID string
+	Since      time.Time
+	Until      time.Time
+	BeforeID   int64 // entries older than this id, for paging
+	Limit      int
+}
+
+// IAuditRepo is repo interface for the audit log
+type IAuditRepo interface {
+	CreateAuditEntry(ctx context.Context, tx Querier, schema string, e AuditEntry) (*AuditEntry, error)
+	ListAuditEntries(ctx context.Context, tx Querier, schema string, f AuditFilter) ([]AuditEntry, error)
+}
+
+// AuditRepo is implementation of IAuditRepo
+type AuditRepo struct{}
+
+// NewAuditRepo creates a new audit repo
+func NewAuditRepo() IAuditRepo {
+	return &AuditRepo{}
+}
+
+const auditColumns = `id, actor, action, method, route, resource, resource_id, status, before, after, ip, request_id, created_at`
+
+// CreateAuditEntry adds an entry to the audit log
+func (r *AuditRepo) CreateAuditEntry(ctx context.Context, tx Querier, schema string, e AuditEntry) (*AuditEntry, error) {
+	defer observe("AuditRepo", "CreateAuditEntry")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`INSERT INTO %[1]s.audit_log
+		(actor, action, method, route, resource, resource_id, status, before, after, ip, request_id)
+		VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING `+auditColumns,
+		schema)
+
+	var res AuditEntry
+	if err := scanOne(ctx, tx, &res, sqlStatement,
+		e.Actor, e.Action, e.Method, e.Route, e.Resource, e.ResourceID, e.Status,
+		nullJSON(e.Before), nullJSON(e.After), e.IP, e.RequestID,
+	); err != nil {
+		return nil, errors.Wrap(err, "problem creating audit entry")
+	}
+	return &res, nil
+}
+
+// ListAuditEntries gets entries matching a filter, newest first
+func (r *AuditRepo) ListAuditEntries(ctx context.Context, tx Querier, schema string, f AuditFilter) ([]AuditEntry, error) {
+	defer observe("AuditRepo", "ListAuditEntries")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT `+auditColumns+`
+		FROM %[1]s.audit_log
+		WHERE ($1 = '' OR actor = $1)
+		AND ($2 = '' OR action = $2)
+		AND ($3 = '' OR resource = $3)
+		AND ($4 = '' OR resource_id = $4)
+		AND ($5::timestamptz IS NULL OR created_at >= $5)
+		AND ($6::timestamptz IS NULL OR created_at < $6)
+		AND ($7 = 0 OR id < $7)
+		ORDER BY id DESC
+		LIMIT $8`,
+		schema)
+
+	var result []AuditEntry
+	if err := scanAll(ctx, tx, &result, sqlStatement,
+		f.Actor, f.Action, f.Resource, f.ResourceID, nullTime(f.Since), nullTime(f.Until), f.BeforeID, f.Limit,
+	); err != nil {
+		return nil, errors.Wrap(err, "problem listing audit entries")
+	}
+	return result, nil
+}
+
+// nullJSON stores empty json as NULL rather than an invalid empty document
+func nullJSON(b json.RawMessage) any {
+	if len(b) == 0 {
+		return nil
+	}
+	return []byte(b)
+}
+
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
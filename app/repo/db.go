@@ -7,7 +7,9 @@ import (
 	"net/url"
 	"sync"
 
-	_ "github.com/jackc/pgx/v5/stdlib" // postgres drivers
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib" // also registers the postgres driver
 	"github.com/pkg/errors"
 
 	"github.com/drmaples/starter-app/app/platform"
@@ -19,41 +21,69 @@ const (
 
 	// Driver is the database driver to use
 	Driver = "pgx"
+
+	// BackendStdlib uses database/sql with its own connection pool on top of the pgx driver
+	BackendStdlib = "stdlib"
+	// BackendPgxPool runs repo queries on a native pgxpool.Pool
+	BackendPgxPool = "pgxpool"
 )
 
 var (
 	dbConnOnce sync.Once
-	dbInst     *sql.DB
-
-	_ Querier = &sql.DB{}   // assert adheres to interface
-	_ Querier = &sql.Conn{} // assert adheres to interface
-	_ Querier = &sql.Tx{}   // assert adheres to interface
+	dbInst     *DB
+	dbConnErr  error
 )
 
-// Querier represents a query-able database/sql object: sql.DB, sql.Conn, sql.Tx
-type Querier interface {
-	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
-	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
-	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
-}
-
 // dbConn is a singleton db connection since sql.Open should be called once
-func dbConn(cfg platform.DBConfig) *sql.DB {
+func dbConn(ctx context.Context, cfg platform.DBConfig) (*DB, error) {
 	dbConnOnce.Do(func() {
-		dsn := GetConnectionURI(cfg)
+		dbInst, dbConnErr = Open(ctx, cfg)
+	})
+	return dbInst, dbConnErr
+}
+
+// Open opens a new connection pool for the configured backend. prefer Initialize, this is for callers that need
+// their own pool, e.g. tests
+func Open(ctx context.Context, cfg platform.DBConfig) (*DB, error) {
+	dsn := GetConnectionURI(cfg)
+
+	switch cfg.Backend {
+	case BackendStdlib, "":
 		db, err := sql.Open(Driver, dsn)
 		if err != nil {
-			panic(err)
+			return nil, errors.Wrap(err, "problem opening db")
 		}
-
 		db.SetMaxOpenConns(cfg.MaxOpenConns)
 		db.SetMaxIdleConns(cfg.MaxIdleConns)
 		db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 		db.SetConnMaxLifetime(cfg.ConnMaxLifeTime)
+		return &DB{SQL: db}, nil
 
-		dbInst = db
-	})
-	return dbInst
+	case BackendPgxPool:
+		poolCfg, err := pgxpool.ParseConfig(dsn)
+		if err != nil {
+			return nil, errors.Wrap(err, "problem parsing pgxpool config")
+		}
+		if cfg.MaxOpenConns > 0 {
+			poolCfg.MaxConns = int32(cfg.MaxOpenConns)
+		}
+		poolCfg.MaxConnIdleTime = cfg.ConnMaxIdleTime
+		poolCfg.MaxConnLifetime = cfg.ConnMaxLifeTime
+
+		pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+		if err != nil {
+			return nil, errors.Wrap(err, "problem creating pgxpool")
+		}
+		// repo queries go straight to the pool, the sql.DB on top of it is for code that needs database/sql. idle
+		// conns are managed by pgxpool, see stdlib.OpenDBFromPool
+		db := stdlib.OpenDBFromPool(pool)
+		db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+		db.SetConnMaxLifetime(cfg.ConnMaxLifeTime)
+		return &DB{SQL: db, Pool: pool}, nil
+
+	default:
+		return nil, errors.Errorf("unknown db backend: %q", cfg.Backend)
+	}
 }
 
 // GetConnectionURI returns the connection URI for a given schema
@@ -74,10 +104,76 @@ func GetConnectionURI(cfg platform.DBConfig) string {
 }
 
 // Initialize sets up the models layer - db connection
-func Initialize(ctx context.Context, cfg platform.DBConfig) (*sql.DB, error) {
-	db := dbConn(cfg)
-	if err := db.PingContext(ctx); err != nil {
-		return nil, errors.Wrap(err, "cannot connect to db")
+func Initialize(ctx context.Context, cfg platform.DBConfig) (*DB, error) {
+	db, err := dbConn(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := Ping(ctx, db); err != nil {
+		return nil, err
 	}
 	return db, nil
 }
+
+// Ping checks the db can be reached
+func Ping(ctx context.Context, db *DB) error {
+	if err := db.PingContext(ctx); err != nil {
+		return errors.Wrap(err, "cannot connect to db")
+	}
+	return nil
+}
+
+// Close closes the connection pool created by Initialize
+func Close() error {
+	if dbInst == nil {
+		return nil
+	}
+	return errors.Wrap(dbInst.Close(), "problem closing db")
+}
+
+// execAffectingOne runs a statement that should touch a single row, returning ErrNoRowsFound if it touched none
+func execAffectingOne(ctx context.Context, tx Querier, errMsg string, sqlStatement string, args ...any) error {
+	res, err := tx.ExecContext(ctx, sqlStatement, args...)
+	if err != nil {
+		return errors.Wrap(err, errMsg)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, errMsg)
+	}
+	if n == 0 {
+		return ErrNoRowsFound
+	}
+	return nil
+}
+
+// TextArray scans a postgres text[] column, which database/sql cannot scan into a plain []string. pass []string,
+// not TextArray, as a query arg
+type TextArray []string
+
+var _ pgtype.ArraySetter = &TextArray{} // assert adheres to interface
+
+// Scan implements sql.Scanner
+func (a *TextArray) Scan(src any) error {
+	var res []string
+	if err := pgtype.NewMap().SQLScanner(&res).Scan(src); err != nil {
+		return errors.Wrap(err, "problem scanning text array")
+	}
+	*a = res
+	return nil
+}
+
+// SetDimensions implements pgtype.ArraySetter, which the pgxpool backend scans arrays with instead of sql.Scanner
+func (a *TextArray) SetDimensions(dimensions []pgtype.ArrayDimension) error {
+	return (*pgtype.FlatArray[string])(a).SetDimensions(dimensions)
+}
+
+// ScanIndex implements pgtype.ArraySetter
+func (a TextArray) ScanIndex(i int) any {
+	return pgtype.FlatArray[string](a).ScanIndex(i)
+}
+
+// ScanIndexType implements pgtype.ArraySetter
+func (a TextArray) ScanIndexType() any {
+	return pgtype.FlatArray[string](a).ScanIndexType()
+}
@@ -0,0 +1,27 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTextArray(t *testing.T) {
+	m := pgtype.NewMap()
+	want := TextArray{"a", "b,c"}
+
+	// database/sql hands over the text format, pgx scans the binary one natively
+	for _, format := range []int16{pgtype.TextFormatCode, pgtype.BinaryFormatCode} {
+		src, err := m.Encode(pgtype.TextArrayOID, format, []string(want), nil)
+		assert.NoError(t, err)
+
+		var actual TextArray
+		assert.NoError(t, m.Scan(pgtype.TextArrayOID, format, src, &actual), format)
+		assert.Equal(t, want, actual, format)
+	}
+
+	var actual TextArray
+	assert.NoError(t, actual.Scan("{a,\"b,c\"}"))
+	assert.Equal(t, want, actual)
+}
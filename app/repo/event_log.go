@@ -0,0 +1,138 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// EventLogChannel is the postgres NOTIFY channel told the id of every event appended to the event log
+const EventLogChannel = "event_log"
+
+// EventLogEntry represents a published domain event kept for streaming to clients
+type EventLogEntry struct {
+	ID        int64           `db:"id"`
+	EventID   string          `db:"event_id"`
+	EventType string          `db:"event_type"`
+	Tenant    string          `db:"tenant"`
+	Subject   string          `db:"subject"`
+	Payload   json.RawMessage `db:"payload"`
+	CreatedAt time.Time       `db:"created_at"`
+}
+
+// IEventLogRepo is repo interface for the bounded log of recently published events
+type IEventLogRepo interface {
+	AppendEvent(ctx context.Context, tx Querier, schema string, e EventLogEntry) error
+	ListEvents(ctx context.Context, tx Querier, schema string, tenant string, afterID int64, limit int) ([]EventLogEntry, error)
+	LatestEventID(ctx context.Context, tx Querier, schema string) (int64, error)
+	DeleteEventsBefore(ctx context.Context, tx Querier, schema string, before time.Time) (int64, error)
+}
+
+// EventLogRepo is implementation of IEventLogRepo
+type EventLogRepo struct{}
+
+// NewEventLogRepo creates a new event log repo
+func NewEventLogRepo() IEventLogRepo {
+	return &EventLogRepo{}
+}
+
+const eventLogColumns = `id, event_id, event_type, tenant, subject, payload, created_at`
+
+// AppendEvent adds an event to the log and notifies EventLogChannel on commit. appending an event already in the log
+// does nothing. tx must be a transaction: appends are serialized until commit so ids become visible in order and a
+// reader following the log by id never skips one
+func (r *EventLogRepo) AppendEvent(ctx context.Context, tx Querier, schema string, e EventLogEntry) error {
+	defer observe("EventLogRepo", "AppendEvent")()
+	if err := ValidateSchema(schema); err != nil {
+		return err
+	}
+
+	lockKey := AdvisoryLockKey(schema + ".event_log")
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, lockKey); err != nil {
+		return errors.Wrap(err, "problem locking event log")
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`WITH ins AS (
+			INSERT INTO %[1]s.event_log
+			(event_id, event_type, tenant, subject, payload)
+			VALUES
+			($1, $2, $3, $4, $5)
+			ON CONFLICT (event_id) DO NOTHING
+			RETURNING id
+		)
+		SELECT pg_notify($6, id::text) FROM ins`,
+		schema)
+
+	if _, err := tx.ExecContext(ctx, sqlStatement, e.EventID, e.EventType, e.Tenant, e.Subject, e.Payload, EventLogChannel); err != nil {
+		return errors.Wrap(err, "problem appending to event log")
+	}
+	return nil
+}
+
+// ListEvents gets events after an id, oldest first. an empty tenant lists every tenant's events
+func (r *EventLogRepo) ListEvents(ctx context.Context, tx Querier, schema string, tenant string, afterID int64, limit int) ([]EventLogEntry, error) {
+	defer observe("EventLogRepo", "ListEvents")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT `+eventLogColumns+`
+		FROM %[1]s.event_log
+		WHERE id > $1 AND ($2 = '' OR tenant = $2)
+		ORDER BY id
+		LIMIT $3`,
+		schema)
+
+	var result []EventLogEntry
+	if err := scanAll(ctx, tx, &result, sqlStatement, afterID, tenant, limit); err != nil {
+		return nil, errors.Wrap(err, "problem listing event log")
+	}
+	return result, nil
+}
+
+// LatestEventID gets the id of the newest event in the log, 0 when it is empty
+func (r *EventLogRepo) LatestEventID(ctx context.Context, tx Querier, schema string) (int64, error) {
+	defer observe("EventLogRepo", "LatestEventID")()
+	if err := ValidateSchema(schema); err != nil {
+		return 0, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT COALESCE(MAX(id), 0)
+		FROM %[1]s.event_log`,
+		schema)
+
+	var id int64
+	if err := tx.QueryRowContext(ctx, sqlStatement).Scan(&id); err != nil {
+		return 0, errors.Wrap(err, "problem getting latest event log id")
+	}
+	return id, nil
+}
+
+// DeleteEventsBefore deletes events logged before a time, keeping the log bounded. returns the number deleted
+func (r *EventLogRepo) DeleteEventsBefore(ctx context.Context, tx Querier, schema string, before time.Time) (int64, error) {
+	defer observe("EventLogRepo", "DeleteEventsBefore")()
+	if err := ValidateSchema(schema); err != nil {
+		return 0, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`DELETE FROM %[1]s.event_log
+		WHERE created_at < $1`,
+		schema)
+
+	res, err := tx.ExecContext(ctx, sqlStatement, before)
+	if err != nil {
+		return 0, errors.Wrap(err, "problem deleting old event log entries")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "problem deleting old event log entries")
+	}
+	return n, nil
+}
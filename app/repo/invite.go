@@ -0,0 +1,145 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Invitation represents an invite for an email address to join an organization
+type Invitation struct {
+	ID             int        `db:"id"`
+	OrganizationID int        `db:"organization_id"`
+	Email          string     `db:"email"`
+	Role           string     `db:"role"`
+	TokenHash      string     `db:"token_hash"`
+	InvitedBy      *int       `db:"invited_by"`
+	ExpiresAt      time.Time  `db:"expires_at"`
+	AcceptedAt     *time.Time `db:"accepted_at"`
+	AcceptedUserID *int       `db:"accepted_user_id"`
+	RevokedAt      *time.Time `db:"revoked_at"`
+	CreatedAt      time.Time  `db:"created_at"`
+}
+
+// IInviteRepo is repo interface for accessing invitations in db
+type IInviteRepo interface {
+	CreateInvite(ctx context.Context, tx Querier, schema string, inv Invitation) (*Invitation, error)
+	GetPendingInviteByTokenHash(ctx context.Context, tx Querier, schema string, tokenHash string) (*Invitation, error)
+	ListPendingInvites(ctx context.Context, tx Querier, schema string, orgID int) ([]Invitation, error)
+	AcceptInvite(ctx context.Context, tx Querier, schema string, inviteID int, userID int) error
+	RevokeInvite(ctx context.Context, tx Querier, schema string, orgID int, inviteID int) error
+}
+
+// InviteRepo is implementation of IInviteRepo
+type InviteRepo struct{}
+
+// NewInviteRepo creates a new invite repo
+func NewInviteRepo() IInviteRepo {
+	return &InviteRepo{}
+}
+
+const (
+	inviteColumns = `id, organization_id, email, role, token_hash, invited_by, expires_at,
+		accepted_at, accepted_user_id, revoked_at, created_at`
+	invitePending = `accepted_at IS NULL AND revoked_at IS NULL AND expires_at > now()`
+)
+
+// CreateInvite creates a new invitation in db
+func (r *InviteRepo) CreateInvite(ctx context.Context, tx Querier, schema string, inv Invitation) (*Invitation, error) {
+	defer observe("InviteRepo", "CreateInvite")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`INSERT INTO %[1]s.invitations
+		(organization_id, email, role, token_hash, invited_by, expires_at)
+		VALUES
+		($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		schema)
+	row := tx.QueryRowContext(ctx, sqlStatement, inv.OrganizationID, inv.Email, inv.Role, inv.TokenHash, inv.InvitedBy, inv.ExpiresAt)
+
+	if err := row.Scan(&inv.ID, &inv.CreatedAt); err != nil {
+		return nil, errors.Wrap(err, "problem inserting invitation")
+	}
+	return &inv, nil
+}
+
+// GetPendingInviteByTokenHash fetches an invitation that is not yet accepted, revoked or expired
+func (r *InviteRepo) GetPendingInviteByTokenHash(ctx context.Context, tx Querier, schema string, tokenHash string) (*Invitation, error) {
+	defer observe("InviteRepo", "GetPendingInviteByTokenHash")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT `+inviteColumns+`
+		FROM %[1]s.invitations
+		WHERE token_hash = $1 AND `+invitePending,
+		schema)
+
+	var inv Invitation
+	if err := scanOne(ctx, tx, &inv, sqlStatement, tokenHash); err != nil {
+		if isNotFound(err) {
+			return nil, ErrNoRowsFound
+		}
+		return nil, errors.Wrap(err, "problem fetching invitation by token")
+	}
+	return &inv, nil
+}
+
+// ListPendingInvites gets all pending invitations for an organization
+func (r *InviteRepo) ListPendingInvites(ctx context.Context, tx Querier, schema string, orgID int) ([]Invitation, error) {
+	defer observe("InviteRepo", "ListPendingInvites")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT `+inviteColumns+`
+		FROM %[1]s.invitations
+		WHERE organization_id = $1 AND `+invitePending+`
+		ORDER BY id`,
+		schema)
+
+	var result []Invitation
+	if err := scanAll(ctx, tx, &result, sqlStatement, orgID); err != nil {
+		return nil, errors.Wrap(err, "problem listing pending invitations")
+	}
+	return result, nil
+}
+
+// AcceptInvite marks a pending invitation as accepted by a user. returns ErrNoRowsFound if it is no longer pending
+func (r *InviteRepo) AcceptInvite(ctx context.Context, tx Querier, schema string, inviteID int, userID int) error {
+	defer observe("InviteRepo", "AcceptInvite")()
+	if err := ValidateSchema(schema); err != nil {
+		return err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`UPDATE %[1]s.invitations
+		SET accepted_at = now(), accepted_user_id = $2, updated_at = now()
+		WHERE id = $1 AND `+invitePending,
+		schema)
+
+	return execAffectingOne(ctx, tx, "problem accepting invitation", sqlStatement, inviteID, userID)
+}
+
+// RevokeInvite revokes a pending invitation. returns ErrNoRowsFound if it is no longer pending
+func (r *InviteRepo) RevokeInvite(ctx context.Context, tx Querier, schema string, orgID int, inviteID int) error {
+	defer observe("InviteRepo", "RevokeInvite")()
+	if err := ValidateSchema(schema); err != nil {
+		return err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`UPDATE %[1]s.invitations
+		SET revoked_at = now(), updated_at = now()
+		WHERE id = $1 AND organization_id = $2 AND `+invitePending,
+		schema)
+
+	return execAffectingOne(ctx, tx, "problem revoking invitation", sqlStatement, inviteID, orgID)
+}
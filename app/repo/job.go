@@ -0,0 +1,218 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// job statuses. dead jobs ran out of attempts and stay in the table, as a dead letter queue, until retried by hand
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusDead      = "dead"
+)
+
+// ErrDuplicateJob is returned when enqueueing a job whose unique key is held by a pending or running job
+var ErrDuplicateJob = errors.New("job with unique key already queued")
+
+// Job represents a background job in db
+type Job struct {
+	ID          int64           `db:"id"`
+	Queue       string          `db:"queue"`
+	Kind        string          `db:"kind"`
+	Payload     json.RawMessage `db:"payload"`
+	Status      string          `db:"status"`
+	Attempts    int             `db:"attempts"`
+	MaxAttempts int             `db:"max_attempts"`
+	RunAt       time.Time       `db:"run_at"`
+	UniqueKey   *string         `db:"unique_key"`
+	LastError   *string         `db:"last_error"`
+	LockedAt    *time.Time      `db:"locked_at"`
+	LockedBy    *string         `db:"locked_by"`
+	FinishedAt  *time.Time      `db:"finished_at"`
+	CreatedAt   time.Time       `db:"created_at"`
+}
+
+// IJobRepo is repo interface for the background job queue
+type IJobRepo interface {
+	EnqueueJob(ctx context.Context, tx Querier, schema string, j Job) (*Job, error)
+	FetchJobs(ctx context.Context, tx Querier, schema string, queue string, workerID string, limit int) ([]Job, error)
+	CompleteJob(ctx context.Context, tx Querier, schema string, jobID int64) error
+	FailJob(ctx context.Context, tx Querier, schema string, jobID int64, errMsg string, retryAt *time.Time) error
+	RescueStuckJobs(ctx context.Context, tx Querier, schema string, lockedBefore time.Time) (int64, error)
+	RetryDeadJob(ctx context.Context, tx Querier, schema string, jobID int64) error
+	DeleteSucceededJobs(ctx context.Context, tx Querier, schema string, finishedBefore time.Time) (int64, error)
+}
+
+// JobRepo is implementation of IJobRepo
+type JobRepo struct{}
+
+// NewJobRepo creates a new job repo
+func NewJobRepo() IJobRepo {
+	return &JobRepo{}
+}
+
+const jobColumns = `id, queue, kind, payload, status, attempts, max_attempts, run_at, unique_key, last_error,
+	locked_at, locked_by, finished_at, created_at`
+
+// EnqueueJob adds a job to the queue. returns ErrDuplicateJob if its unique key is already queued
+func (r *JobRepo) EnqueueJob(ctx context.Context, tx Querier, schema string, j Job) (*Job, error) {
+	defer observe("JobRepo", "EnqueueJob")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`INSERT INTO %[1]s.jobs
+		(queue, kind, payload, max_attempts, run_at, unique_key)
+		VALUES
+		($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (unique_key) WHERE unique_key IS NOT NULL AND status IN ('pending', 'running') DO NOTHING
+		RETURNING `+jobColumns,
+		schema)
+
+	var res Job
+	if err := scanOne(ctx, tx, &res, sqlStatement, j.Queue, j.Kind, j.Payload, j.MaxAttempts, j.RunAt, j.UniqueKey); err != nil {
+		if isNotFound(err) {
+			return nil, ErrDuplicateJob
+		}
+		return nil, errors.Wrap(err, "problem enqueueing job")
+	}
+	return &res, nil
+}
+
+// FetchJobs claims up to limit due jobs from a queue, marking them running. SKIP LOCKED lets many workers poll
+// the same queue without handing out a job twice
+func (r *JobRepo) FetchJobs(ctx context.Context, tx Querier, schema string, queue string, workerID string, limit int) ([]Job, error) {
+	defer observe("JobRepo", "FetchJobs")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`UPDATE %[1]s.jobs
+		SET status = 'running', attempts = attempts + 1, locked_at = now(), locked_by = $2, updated_at = now()
+		WHERE id IN (
+			SELECT id
+			FROM %[1]s.jobs
+			WHERE queue = $1 AND status = 'pending' AND run_at <= now()
+			ORDER BY run_at, id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+jobColumns,
+		schema)
+
+	var result []Job
+	if err := scanAll(ctx, tx, &result, sqlStatement, queue, workerID, limit); err != nil {
+		return nil, errors.Wrap(err, "problem fetching jobs")
+	}
+	return result, nil
+}
+
+// CompleteJob marks a running job as succeeded
+func (r *JobRepo) CompleteJob(ctx context.Context, tx Querier, schema string, jobID int64) error {
+	defer observe("JobRepo", "CompleteJob")()
+	if err := ValidateSchema(schema); err != nil {
+		return err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`UPDATE %[1]s.jobs
+		SET status = 'succeeded', finished_at = now(), locked_at = NULL, locked_by = NULL, updated_at = now()
+		WHERE id = $1 AND status = 'running'`,
+		schema)
+
+	return execAffectingOne(ctx, tx, "problem completing job", sqlStatement, jobID)
+}
+
+// FailJob records a failed attempt. the job is retried at retryAt, or dead lettered when retryAt is nil
+func (r *JobRepo) FailJob(ctx context.Context, tx Querier, schema string, jobID int64, errMsg string, retryAt *time.Time) error {
+	defer observe("JobRepo", "FailJob")()
+	if err := ValidateSchema(schema); err != nil {
+		return err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`UPDATE %[1]s.jobs
+		SET status = CASE WHEN $3::timestamptz IS NULL THEN 'dead' ELSE 'pending' END,
+			run_at = COALESCE($3::timestamptz, run_at),
+			finished_at = CASE WHEN $3::timestamptz IS NULL THEN now() END,
+			last_error = $2, locked_at = NULL, locked_by = NULL, updated_at = now()
+		WHERE id = $1 AND status = 'running'`,
+		schema)
+
+	return execAffectingOne(ctx, tx, "problem failing job", sqlStatement, jobID, errMsg, retryAt)
+}
+
+// RescueStuckJobs puts jobs that have been running since before lockedBefore back to pending. a worker that dies
+// mid job never finishes it, this is how those jobs get picked up again
+func (r *JobRepo) RescueStuckJobs(ctx context.Context, tx Querier, schema string, lockedBefore time.Time) (int64, error) {
+	defer observe("JobRepo", "RescueStuckJobs")()
+	if err := ValidateSchema(schema); err != nil {
+		return 0, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`UPDATE %[1]s.jobs
+		SET status = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'pending' END,
+			finished_at = CASE WHEN attempts >= max_attempts THEN now() END,
+			last_error = 'job was abandoned by worker ' || COALESCE(locked_by, ''),
+			locked_at = NULL, locked_by = NULL, updated_at = now()
+		WHERE status = 'running' AND locked_at < $1`,
+		schema)
+
+	res, err := tx.ExecContext(ctx, sqlStatement, lockedBefore)
+	if err != nil {
+		return 0, errors.Wrap(err, "problem rescuing stuck jobs")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "problem rescuing stuck jobs")
+	}
+	return n, nil
+}
+
+// RetryDeadJob moves a dead job back to pending with a fresh set of attempts
+func (r *JobRepo) RetryDeadJob(ctx context.Context, tx Querier, schema string, jobID int64) error {
+	defer observe("JobRepo", "RetryDeadJob")()
+	if err := ValidateSchema(schema); err != nil {
+		return err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`UPDATE %[1]s.jobs
+		SET status = 'pending', attempts = 0, run_at = now(), finished_at = NULL, updated_at = now()
+		WHERE id = $1 AND status = 'dead'`,
+		schema)
+
+	return execAffectingOne(ctx, tx, "problem retrying dead job", sqlStatement, jobID)
+}
+
+// DeleteSucceededJobs purges succeeded jobs that finished before finishedBefore. dead jobs are kept for inspection
+func (r *JobRepo) DeleteSucceededJobs(ctx context.Context, tx Querier, schema string, finishedBefore time.Time) (int64, error) {
+	defer observe("JobRepo", "DeleteSucceededJobs")()
+	if err := ValidateSchema(schema); err != nil {
+		return 0, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`DELETE FROM %[1]s.jobs
+		WHERE status = 'succeeded' AND finished_at < $1`,
+		schema)
+
+	res, err := tx.ExecContext(ctx, sqlStatement, finishedBefore)
+	if err != nil {
+		return 0, errors.Wrap(err, "problem deleting succeeded jobs")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "problem deleting succeeded jobs")
+	}
+	return n, nil
+}
@@ -0,0 +1,45 @@
+package repo
+
+import (
+	"context"
+	"hash/fnv"
+
+	"github.com/pkg/errors"
+)
+
+// AdvisoryLockKey maps a lock name to a postgres advisory lock key
+func AdvisoryLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// TryAdvisoryLock takes a session level advisory lock without waiting. the lock belongs to the connection, so conn
+// must be a dedicated sql.Conn that is held for as long as the lock is, it is released if the connection dies
+func TryAdvisoryLock(ctx context.Context, conn Querier, key int64) (bool, error) {
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&locked); err != nil {
+		return false, errors.Wrap(err, "problem taking advisory lock")
+	}
+	return locked, nil
+}
+
+// AdvisoryLock takes a session level advisory lock, waiting for it if another session holds it. see TryAdvisoryLock
+func AdvisoryLock(ctx context.Context, conn Querier, key int64) error {
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, key); err != nil {
+		return errors.Wrap(err, "problem taking advisory lock")
+	}
+	return nil
+}
+
+// AdvisoryUnlock releases a session level advisory lock taken by TryAdvisoryLock on the same conn
+func AdvisoryUnlock(ctx context.Context, conn Querier, key int64) error {
+	var unlocked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_advisory_unlock($1)`, key).Scan(&unlocked); err != nil {
+		return errors.Wrap(err, "problem releasing advisory lock")
+	}
+	if !unlocked {
+		return errors.New("advisory lock was not held")
+	}
+	return nil
+}
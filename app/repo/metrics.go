@@ -0,0 +1,28 @@
+package repo
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "app",
+	Subsystem: "db",
+	Name:      "query_duration_seconds",
+	Help:      "repo method durations, including scanning results",
+	Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+}, []string{"repo", "method"})
+
+// Collectors are the repo metrics to register for scraping
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{queryDuration}
+}
+
+// observe times a repo method, use as the first line of the method: defer observe("UserRepo", "GetUserByID")()
+func observe(repo string, method string) func() {
+	start := time.Now()
+	return func() {
+		queryDuration.WithLabelValues(repo, method).Observe(time.Since(start).Seconds())
+	}
+}
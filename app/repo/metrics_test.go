@@ -0,0 +1,20 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserve(t *testing.T) {
+	func() {
+		defer observe("UserRepo", "GetUserByID")()
+	}()
+	func() {
+		defer observe("UserRepo", "GetUserByID")()
+	}()
+
+	// one series per repo method
+	assert.Equal(t, 1, testutil.CollectAndCount(queryDuration))
+}
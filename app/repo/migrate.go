@@ -1,6 +1,10 @@
 package repo
 
 import (
+	"context"
+	"fmt"
+	"io/fs"
+
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres" // load postgres drivers
 	"github.com/golang-migrate/migrate/v4/source/iofs"
@@ -9,16 +13,50 @@ import (
 	"github.com/drmaples/starter-app/db"
 )
 
-// NewMigrator returns a new db migrator
+// NewMigrator returns a new db migrator for the default schema
 func NewMigrator(dsn string) (*migrate.Migrate, error) {
-	fs, err := iofs.New(db.MigrationFS, db.FileLocation)
+	return newMigrator(db.MigrationFS, dsn)
+}
+
+// NewTenantMigrator returns a new db migrator for a tenant schema, which skips the global migrations
+func NewTenantMigrator(dsn string) (*migrate.Migrate, error) {
+	fsys, err := db.TenantMigrationFS()
+	if err != nil {
+		return nil, err
+	}
+	return newMigrator(fsys, dsn)
+}
+
+func newMigrator(fsys fs.FS, dsn string) (*migrate.Migrate, error) {
+	src, err := iofs.New(fsys, db.FileLocation)
 	if err != nil {
 		return nil, errors.Wrap(err, "problem setting up migration file system")
 	}
 
-	m, err := migrate.NewWithSourceInstance("iofs", fs, dsn)
+	m, err := migrate.NewWithSourceInstance("iofs", src, dsn)
 	if err != nil {
 		return nil, errors.Wrap(err, "problem creating migrate object")
 	}
 	return m, nil
 }
+
+// GetMigrationVersion gets the version a schema was migrated to, and whether that migration failed part way
+func GetMigrationVersion(ctx context.Context, tx Querier, schema string) (int, bool, error) {
+	if err := ValidateSchema(schema); err != nil {
+		return 0, false, err
+	}
+
+	sqlStatement := fmt.Sprintf(`SELECT version, dirty FROM %[1]s.schema_migrations LIMIT 1`, schema)
+
+	var res struct {
+		Version int  `db:"version"`
+		Dirty   bool `db:"dirty"`
+	}
+	if err := scanOne(ctx, tx, &res, sqlStatement); err != nil {
+		if isNotFound(err) {
+			return 0, false, ErrNoRowsFound
+		}
+		return 0, false, errors.Wrap(err, "problem getting migration version")
+	}
+	return res.Version, res.Dirty, nil
+}
@@ -0,0 +1,349 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// organization member roles, ordered from most to least privileged
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// ErrDuplicateMember is returned when adding a user to an organization they are already a member of
+var ErrDuplicateMember = errors.New("user is already a member of organization")
+
+// Organization represents an organization in db
+type Organization struct {
+	ID        int       `db:"id"`
+	Name      string    `db:"name"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// Membership represents a user's membership in an organization
+type Membership struct {
+	OrganizationID int       `db:"organization_id"`
+	UserID         int       `db:"user_id"`
+	Role           string    `db:"role"`
+	Email          string    `db:"email"` // from users, read only
+	CreatedAt      time.Time `db:"created_at"`
+}
+
+// IOrgRepo is repo interface for accessing organizations and their members in db
+type IOrgRepo interface {
+	CreateOrg(ctx context.Context, tx Querier, schema string, o Organization) (*Organization, error)
+	GetOrgByID(ctx context.Context, tx Querier, schema string, orgID int) (*Organization, error)
+	ListOrgsForUser(ctx context.Context, tx Querier, schema string, userID int) ([]Organization, error)
+	UpdateOrg(ctx context.Context, tx Querier, schema string, o Organization) (*Organization, error)
+	DeleteOrg(ctx context.Context, tx Querier, schema string, orgID int) error
+	LockOrg(ctx context.Context, tx Querier, schema string, orgID int) error
+	LockOwnedOrgs(ctx context.Context, tx Querier, schema string, userID int) ([]int, error)
+
+	AddMember(ctx context.Context, tx Querier, schema string, m Membership) (*Membership, error)
+	GetMember(ctx context.Context, tx Querier, schema string, orgID int, userID int) (*Membership, error)
+	LockMember(ctx context.Context, tx Querier, schema string, orgID int, userID int) (*Membership, error)
+	ListMembers(ctx context.Context, tx Querier, schema string, orgID int) ([]Membership, error)
+	UpdateMemberRole(ctx context.Context, tx Querier, schema string, orgID int, userID int, role string) (*Membership, error)
+	RemoveMember(ctx context.Context, tx Querier, schema string, orgID int, userID int) error
+}
+
+// OrgRepo is implementation of IOrgRepo
+type OrgRepo struct{}
+
+// NewOrgRepo creates a new org repo
+func NewOrgRepo() IOrgRepo {
+	return &OrgRepo{}
+}
+
+// CreateOrg creates a new organization in db
+func (r *OrgRepo) CreateOrg(ctx context.Context, tx Querier, schema string, o Organization) (*Organization, error) {
+	defer observe("OrgRepo", "CreateOrg")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`INSERT INTO %[1]s.organizations
+		(name)
+		VALUES
+		($1)
+		RETURNING id, created_at, updated_at`,
+		schema)
+	row := tx.QueryRowContext(ctx, sqlStatement, o.Name)
+
+	if err := row.Scan(&o.ID, &o.CreatedAt, &o.UpdatedAt); err != nil {
+		return nil, errors.Wrap(err, "problem inserting organization")
+	}
+	return &o, nil
+}
+
+// GetOrgByID fetches an organization from the db by ID
+func (r *OrgRepo) GetOrgByID(ctx context.Context, tx Querier, schema string, orgID int) (*Organization, error) {
+	defer observe("OrgRepo", "GetOrgByID")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT id, name, created_at, updated_at
+		FROM %[1]s.organizations
+		WHERE id = $1`,
+		schema)
+
+	var o Organization
+	if err := scanOne(ctx, tx, &o, sqlStatement, orgID); err != nil {
+		if isNotFound(err) {
+			return nil, ErrNoRowsFound
+		}
+		return nil, errors.Wrap(err, "problem fetching organization by id")
+	}
+	return &o, nil
+}
+
+// ListOrgsForUser gets all organizations a user is a member of
+func (r *OrgRepo) ListOrgsForUser(ctx context.Context, tx Querier, schema string, userID int) ([]Organization, error) {
+	defer observe("OrgRepo", "ListOrgsForUser")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT o.id, o.name, o.created_at, o.updated_at
+		FROM %[1]s.organizations o
+		JOIN %[1]s.organization_members om ON om.organization_id = o.id
+		WHERE om.user_id = $1
+		ORDER BY o.id`,
+		schema)
+
+	var result []Organization
+	if err := scanAll(ctx, tx, &result, sqlStatement, userID); err != nil {
+		return nil, errors.Wrap(err, "problem listing organizations for user")
+	}
+	return result, nil
+}
+
+// UpdateOrg updates an organization's name
+func (r *OrgRepo) UpdateOrg(ctx context.Context, tx Querier, schema string, o Organization) (*Organization, error) {
+	defer observe("OrgRepo", "UpdateOrg")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`UPDATE %[1]s.organizations
+		SET name = $2, updated_at = now()
+		WHERE id = $1
+		RETURNING id, name, created_at, updated_at`,
+		schema)
+
+	var res Organization
+	if err := scanOne(ctx, tx, &res, sqlStatement, o.ID, o.Name); err != nil {
+		if isNotFound(err) {
+			return nil, ErrNoRowsFound
+		}
+		return nil, errors.Wrap(err, "problem updating organization")
+	}
+	return &res, nil
+}
+
+// DeleteOrg deletes an organization and, by cascade, its memberships
+func (r *OrgRepo) DeleteOrg(ctx context.Context, tx Querier, schema string, orgID int) error {
+	defer observe("OrgRepo", "DeleteOrg")()
+	if err := ValidateSchema(schema); err != nil {
+		return err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`DELETE FROM %[1]s.organizations
+		WHERE id = $1`,
+		schema)
+
+	return execAffectingOne(ctx, tx, "problem deleting organization", sqlStatement, orgID)
+}
+
+// LockOrg locks an organization until tx ends, so changes to its members are made one at a time. e.g. two owners
+// demoting each other at once cannot both count the other as the remaining owner
+func (r *OrgRepo) LockOrg(ctx context.Context, tx Querier, schema string, orgID int) error {
+	defer observe("OrgRepo", "LockOrg")()
+	if err := ValidateSchema(schema); err != nil {
+		return err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT id FROM %[1]s.organizations
+		WHERE id = $1
+		FOR UPDATE`,
+		schema)
+
+	var id int
+	if err := tx.QueryRowContext(ctx, sqlStatement, orgID).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRowsFound
+		}
+		return errors.Wrap(err, "problem locking organization")
+	}
+	return nil
+}
+
+// LockOwnedOrgs locks the organizations a user is an owner of until tx ends, see LockOrg. returns their ids
+func (r *OrgRepo) LockOwnedOrgs(ctx context.Context, tx Querier, schema string, userID int) ([]int, error) {
+	defer observe("OrgRepo", "LockOwnedOrgs")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	// locked in id order, like any two deletes would, so they cannot deadlock
+	sqlStatement := fmt.Sprintf(
+		`SELECT o.id
+		FROM %[1]s.organizations o
+		JOIN %[1]s.organization_members om ON om.organization_id = o.id
+		WHERE om.user_id = $1 AND om.role = $2
+		ORDER BY o.id
+		FOR UPDATE OF o`,
+		schema)
+
+	var result []int
+	if err := scanAll(ctx, tx, &result, sqlStatement, userID, OrgRoleOwner); err != nil {
+		return nil, errors.Wrap(err, "problem locking owned organizations")
+	}
+	return result, nil
+}
+
+// AddMember adds a user to an organization with a role. returns ErrDuplicateMember if they are already a member
+func (r *OrgRepo) AddMember(ctx context.Context, tx Querier, schema string, m Membership) (*Membership, error) {
+	defer observe("OrgRepo", "AddMember")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`INSERT INTO %[1]s.organization_members
+		(organization_id, user_id, role)
+		VALUES
+		($1, $2, $3)
+		ON CONFLICT (organization_id, user_id) DO NOTHING
+		RETURNING created_at`,
+		schema)
+	row := tx.QueryRowContext(ctx, sqlStatement, m.OrganizationID, m.UserID, m.Role)
+
+	if err := row.Scan(&m.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrDuplicateMember
+		}
+		return nil, errors.Wrap(err, "problem inserting organization member")
+	}
+	return &m, nil
+}
+
+// GetMember fetches a single membership
+func (r *OrgRepo) GetMember(ctx context.Context, tx Querier, schema string, orgID int, userID int) (*Membership, error) {
+	defer observe("OrgRepo", "GetMember")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT om.organization_id, om.user_id, om.role, u.email, om.created_at
+		FROM %[1]s.organization_members om
+		JOIN %[1]s.users u ON u.id = om.user_id
+		WHERE om.organization_id = $1 AND om.user_id = $2`,
+		schema)
+
+	var m Membership
+	if err := scanOne(ctx, tx, &m, sqlStatement, orgID, userID); err != nil {
+		if isNotFound(err) {
+			return nil, ErrNoRowsFound
+		}
+		return nil, errors.Wrap(err, "problem fetching organization member")
+	}
+	return &m, nil
+}
+
+// LockMember is GetMember with the membership row locked against changes until tx ends, so a role checked
+// before a write still holds when the write commits
+func (r *OrgRepo) LockMember(ctx context.Context, tx Querier, schema string, orgID int, userID int) (*Membership, error) {
+	defer observe("OrgRepo", "LockMember")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT om.organization_id, om.user_id, om.role, u.email, om.created_at
+		FROM %[1]s.organization_members om
+		JOIN %[1]s.users u ON u.id = om.user_id
+		WHERE om.organization_id = $1 AND om.user_id = $2
+		FOR SHARE OF om`,
+		schema)
+
+	var m Membership
+	if err := scanOne(ctx, tx, &m, sqlStatement, orgID, userID); err != nil {
+		if isNotFound(err) {
+			return nil, ErrNoRowsFound
+		}
+		return nil, errors.Wrap(err, "problem locking organization member")
+	}
+	return &m, nil
+}
+
+// ListMembers gets all members of an organization
+func (r *OrgRepo) ListMembers(ctx context.Context, tx Querier, schema string, orgID int) ([]Membership, error) {
+	defer observe("OrgRepo", "ListMembers")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT om.organization_id, om.user_id, om.role, u.email, om.created_at
+		FROM %[1]s.organization_members om
+		JOIN %[1]s.users u ON u.id = om.user_id
+		WHERE om.organization_id = $1
+		ORDER BY om.user_id`,
+		schema)
+
+	var result []Membership
+	if err := scanAll(ctx, tx, &result, sqlStatement, orgID); err != nil {
+		return nil, errors.Wrap(err, "problem listing organization members")
+	}
+	return result, nil
+}
+
+// UpdateMemberRole changes a member's role
+func (r *OrgRepo) UpdateMemberRole(ctx context.Context, tx Querier, schema string, orgID int, userID int, role string) (*Membership, error) {
+	defer observe("OrgRepo", "UpdateMemberRole")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`UPDATE %[1]s.organization_members
+		SET role = $3, updated_at = now()
+		WHERE organization_id = $1 AND user_id = $2`,
+		schema)
+
+	if err := execAffectingOne(ctx, tx, "problem updating organization member", sqlStatement, orgID, userID, role); err != nil {
+		return nil, err
+	}
+	return r.GetMember(ctx, tx, schema, orgID, userID)
+}
+
+// RemoveMember removes a user from an organization
+func (r *OrgRepo) RemoveMember(ctx context.Context, tx Querier, schema string, orgID int, userID int) error {
+	defer observe("OrgRepo", "RemoveMember")()
+	if err := ValidateSchema(schema); err != nil {
+		return err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`DELETE FROM %[1]s.organization_members
+		WHERE organization_id = $1 AND user_id = $2`,
+		schema)
+
+	return execAffectingOne(ctx, tx, "problem removing organization member", sqlStatement, orgID, userID)
+}
@@ -0,0 +1,150 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// OutboxEvent represents a domain event waiting to be published
+type OutboxEvent struct {
+	ID            int64           `db:"id"`
+	EventID       string          `db:"event_id"`
+	EventType     string          `db:"event_type"`
+	Payload       json.RawMessage `db:"payload"`
+	Attempts      int             `db:"attempts"`
+	LastError     *string         `db:"last_error"`
+	NextAttemptAt time.Time       `db:"next_attempt_at"`
+	PublishedAt   *time.Time      `db:"published_at"`
+	CreatedAt     time.Time       `db:"created_at"`
+}
+
+// IOutboxRepo is repo interface for the transactional outbox
+type IOutboxRepo interface {
+	InsertOutboxEvent(ctx context.Context, tx Querier, schema string, e OutboxEvent) error
+	ClaimUnpublishedEvents(ctx context.Context, tx Querier, schema string, limit int, claimedUntil time.Time) ([]OutboxEvent, error)
+	MarkEventPublished(ctx context.Context, tx Querier, schema string, id int64) error
+	MarkEventFailed(ctx context.Context, tx Querier, schema string, id int64, errMsg string, nextAttemptAt time.Time) error
+	DeletePublishedEvents(ctx context.Context, tx Querier, schema string, publishedBefore time.Time) (int64, error)
+}
+
+// OutboxRepo is implementation of IOutboxRepo
+type OutboxRepo struct{}
+
+// NewOutboxRepo creates a new outbox repo
+func NewOutboxRepo() IOutboxRepo {
+	return &OutboxRepo{}
+}
+
+const outboxColumns = `id, event_id, event_type, payload, attempts, last_error, next_attempt_at, published_at, created_at`
+
+// InsertOutboxEvent adds an event to the outbox. call it with the same tx as the change the event describes
+func (r *OutboxRepo) InsertOutboxEvent(ctx context.Context, tx Querier, schema string, e OutboxEvent) error {
+	defer observe("OutboxRepo", "InsertOutboxEvent")()
+	if err := ValidateSchema(schema); err != nil {
+		return err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`INSERT INTO %[1]s.outbox
+		(event_id, event_type, payload)
+		VALUES
+		($1, $2, $3)`,
+		schema)
+
+	if _, err := tx.ExecContext(ctx, sqlStatement, e.EventID, e.EventType, e.Payload); err != nil {
+		return errors.Wrap(err, "problem inserting outbox event")
+	}
+	return nil
+}
+
+// ClaimUnpublishedEvents fetches due unpublished events in insert order and makes them not due until claimedUntil, so
+// other relays skip them while they are published without a transaction held open. should the relay die first, they
+// are due again once the claim runs out
+func (r *OutboxRepo) ClaimUnpublishedEvents(ctx context.Context, tx Querier, schema string, limit int, claimedUntil time.Time) ([]OutboxEvent, error) {
+	defer observe("OutboxRepo", "ClaimUnpublishedEvents")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`WITH claimed AS (
+			UPDATE %[1]s.outbox
+			SET next_attempt_at = $2
+			WHERE id IN (
+				SELECT id
+				FROM %[1]s.outbox
+				WHERE published_at IS NULL AND next_attempt_at <= now()
+				ORDER BY id
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING `+outboxColumns+`
+		)
+		SELECT `+outboxColumns+` FROM claimed ORDER BY id`,
+		schema)
+
+	var result []OutboxEvent
+	if err := scanAll(ctx, tx, &result, sqlStatement, limit, claimedUntil); err != nil {
+		return nil, errors.Wrap(err, "problem fetching unpublished outbox events")
+	}
+	return result, nil
+}
+
+// MarkEventPublished marks an outbox event as published
+func (r *OutboxRepo) MarkEventPublished(ctx context.Context, tx Querier, schema string, id int64) error {
+	defer observe("OutboxRepo", "MarkEventPublished")()
+	if err := ValidateSchema(schema); err != nil {
+		return err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`UPDATE %[1]s.outbox
+		SET published_at = now(), attempts = attempts + 1, last_error = NULL
+		WHERE id = $1 AND published_at IS NULL`,
+		schema)
+
+	return execAffectingOne(ctx, tx, "problem marking outbox event published", sqlStatement, id)
+}
+
+// MarkEventFailed records a failed publish, the event is retried at nextAttemptAt
+func (r *OutboxRepo) MarkEventFailed(ctx context.Context, tx Querier, schema string, id int64, errMsg string, nextAttemptAt time.Time) error {
+	defer observe("OutboxRepo", "MarkEventFailed")()
+	if err := ValidateSchema(schema); err != nil {
+		return err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`UPDATE %[1]s.outbox
+		SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3
+		WHERE id = $1 AND published_at IS NULL`,
+		schema)
+
+	return execAffectingOne(ctx, tx, "problem marking outbox event failed", sqlStatement, id, errMsg, nextAttemptAt)
+}
+
+// DeletePublishedEvents purges events published before publishedBefore
+func (r *OutboxRepo) DeletePublishedEvents(ctx context.Context, tx Querier, schema string, publishedBefore time.Time) (int64, error) {
+	defer observe("OutboxRepo", "DeletePublishedEvents")()
+	if err := ValidateSchema(schema); err != nil {
+		return 0, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`DELETE FROM %[1]s.outbox
+		WHERE published_at < $1`,
+		schema)
+
+	res, err := tx.ExecContext(ctx, sqlStatement, publishedBefore)
+	if err != nil {
+		return 0, errors.Wrap(err, "problem deleting published outbox events")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "problem deleting published outbox events")
+	}
+	return n, nil
+}
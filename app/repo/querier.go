@@ -0,0 +1,273 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/georgysavva/scany/v2/dbscan"
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+)
+
+var (
+	_ Querier = &DB{}                  // assert adheres to interface
+	_ Querier = sqlQuerier{}           // assert adheres to interface
+	_ Querier = pgxQuerier{}           // assert adheres to interface
+	_ Rows    = &sql.Rows{}            // assert adheres to interface
+	_ Rows    = &pgxscan.RowsAdapter{} // assert adheres to interface
+	_ Row     = &sql.Row{}             // assert adheres to interface
+
+	// scanAPI scans rows from either backend into structs, the same way sqlscan and pgxscan do by default
+	scanAPI = mustScanAPI()
+)
+
+// Querier represents something queries run on, with either backend: a DB, or a transaction or connection of one
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) Row
+}
+
+// Rows is the result of a query, sql.Rows or the pgx equivalent
+type Rows interface {
+	dbscan.Rows
+}
+
+// Row is the result of a query for a single row. Scan returns sql.ErrNoRows when there is none, whatever the backend
+type Row interface {
+	Scan(dest ...any) error
+}
+
+// Tx is a transaction started by a TxBeginner
+type Tx interface {
+	Querier
+	Commit() error
+	Rollback() error
+}
+
+// sqlDriverQuerier is what sql.DB, sql.Conn and sql.Tx have in common
+type sqlDriverQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// FromSQL makes a Querier of a database/sql object, e.g. a dedicated sql.Conn
+func FromSQL(q sqlDriverQuerier) Querier {
+	return sqlQuerier{q: q}
+}
+
+type sqlQuerier struct {
+	q sqlDriverQuerier
+}
+
+func (s sqlQuerier) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return s.q.ExecContext(ctx, query, args...)
+}
+
+func (s sqlQuerier) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	rows, err := s.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err // not rows, a nil *sql.Rows would be a non nil Rows
+	}
+	return rows, nil
+}
+
+func (s sqlQuerier) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	return s.q.QueryRowContext(ctx, query, args...)
+}
+
+type sqlTx struct {
+	sqlQuerier
+	tx *sql.Tx
+}
+
+func (t sqlTx) Commit() error   { return t.tx.Commit() }
+func (t sqlTx) Rollback() error { return t.tx.Rollback() }
+
+// pgxDriverQuerier is what pgxpool.Pool, pgxpool.Conn and pgx.Tx have in common
+type pgxDriverQuerier interface {
+	Exec(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, query string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, query string, args ...any) pgx.Row
+}
+
+// FromPgx makes a Querier of a native pgx object, e.g. a pgxpool.Pool
+func FromPgx(q pgxDriverQuerier) Querier {
+	return pgxQuerier{q: q}
+}
+
+type pgxQuerier struct {
+	q pgxDriverQuerier
+}
+
+func (p pgxQuerier) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	tag, err := p.q.Exec(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgxResult(tag), nil
+}
+
+func (p pgxQuerier) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	rows, err := p.q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgxscan.NewRowsAdapter(rows), nil
+}
+
+func (p pgxQuerier) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	return pgxRow{row: p.q.QueryRow(ctx, query, args...)}
+}
+
+type pgxRow struct {
+	row pgx.Row
+}
+
+// Scan maps pgx.ErrNoRows to sql.ErrNoRows so callers can check for one error whatever the backend
+func (r pgxRow) Scan(dest ...any) error {
+	err := r.row.Scan(dest...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+type pgxResult pgconn.CommandTag
+
+func (r pgxResult) LastInsertId() (int64, error) {
+	return 0, errors.New("LastInsertId is not supported by postgres, use RETURNING")
+}
+
+func (r pgxResult) RowsAffected() (int64, error) {
+	return pgconn.CommandTag(r).RowsAffected(), nil
+}
+
+// pgxTx keeps the ctx the transaction began with, like sql.Tx, since pgx wants one to commit or roll back
+type pgxTx struct {
+	pgxQuerier
+	ctx context.Context
+	tx  pgx.Tx
+}
+
+func (t pgxTx) Commit() error   { return t.tx.Commit(t.ctx) }
+func (t pgxTx) Rollback() error { return t.tx.Rollback(t.ctx) }
+
+// DB is a connection pool of the configured backend. queries run on Pool when the pgxpool backend is used and on
+// SQL otherwise. SQL is always set, for code that needs database/sql itself, e.g. a dedicated sql.Conn
+type DB struct {
+	SQL  *sql.DB
+	Pool *pgxpool.Pool
+}
+
+func (db *DB) querier() Querier {
+	if db.Pool != nil {
+		return FromPgx(db.Pool)
+	}
+	return FromSQL(db.SQL)
+}
+
+// ExecContext implements Querier
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return db.querier().ExecContext(ctx, query, args...)
+}
+
+// QueryContext implements Querier
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (Rows, error) {
+	return db.querier().QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext implements Querier
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) Row {
+	return db.querier().QueryRowContext(ctx, query, args...)
+}
+
+// BeginTx implements TxBeginner
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	if db.Pool == nil {
+		tx, err := db.SQL.BeginTx(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		return sqlTx{sqlQuerier: sqlQuerier{q: tx}, tx: tx}, nil
+	}
+
+	tx, err := db.Pool.BeginTx(ctx, pgxTxOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	return pgxTx{pgxQuerier: pgxQuerier{q: tx}, ctx: ctx, tx: tx}, nil
+}
+
+// PingContext checks the db can be reached
+func (db *DB) PingContext(ctx context.Context) error {
+	if db.Pool != nil {
+		return db.Pool.Ping(ctx)
+	}
+	return db.SQL.PingContext(ctx)
+}
+
+// Close closes SQL and Pool, which closing SQL does not do when it was opened from the pool
+func (db *DB) Close() error {
+	err := db.SQL.Close()
+	if db.Pool != nil {
+		db.Pool.Close()
+	}
+	return err
+}
+
+func pgxTxOptions(opts *sql.TxOptions) pgx.TxOptions {
+	var res pgx.TxOptions
+	if opts == nil {
+		return res
+	}
+	switch opts.Isolation {
+	case sql.LevelReadUncommitted:
+		res.IsoLevel = pgx.ReadUncommitted
+	case sql.LevelReadCommitted:
+		res.IsoLevel = pgx.ReadCommitted
+	case sql.LevelRepeatableRead, sql.LevelSnapshot:
+		res.IsoLevel = pgx.RepeatableRead
+	case sql.LevelSerializable, sql.LevelLinearizable:
+		res.IsoLevel = pgx.Serializable
+	}
+	if opts.ReadOnly {
+		res.AccessMode = pgx.ReadOnly
+	}
+	return res
+}
+
+func mustScanAPI() *dbscan.API {
+	api, err := pgxscan.NewDBScanAPI()
+	if err != nil {
+		panic(errors.Wrap(err, "problem creating scan api"))
+	}
+	return api
+}
+
+// scanOne runs a query and scans its single row into dst. the error matches isNotFound when there is no row
+func scanOne(ctx context.Context, tx Querier, dst any, query string, args ...any) error {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "problem querying one row")
+	}
+	return scanAPI.ScanOne(dst, rows)
+}
+
+// scanAll runs a query and scans all of its rows into dst, a pointer to a slice
+func scanAll(ctx context.Context, tx Querier, dst any, query string, args ...any) error {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "problem querying rows")
+	}
+	return scanAPI.ScanAll(dst, rows)
+}
+
+// isNotFound reports whether err is from scanOne finding no row
+func isNotFound(err error) bool {
+	return dbscan.NotFound(err)
+}
@@ -0,0 +1,78 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// IRateLimitRepo is repo interface for rate limit token buckets
+type IRateLimitRepo interface {
+	TakeRateLimitToken(ctx context.Context, tx Querier, schema string, key string, capacity float64, perSecond float64) (float64, bool, error)
+	DeleteIdleRateLimitBuckets(ctx context.Context, tx Querier, schema string, idleSince time.Time) (int64, error)
+}
+
+// RateLimitRepo is implementation of IRateLimitRepo
+type RateLimitRepo struct{}
+
+// NewRateLimitRepo creates a new rate limit repo
+func NewRateLimitRepo() IRateLimitRepo {
+	return &RateLimitRepo{}
+}
+
+// TakeRateLimitToken refills the bucket for key at perSecond up to capacity, then takes a token from it if one is
+// left. returns the tokens left and whether one was taken. a single statement, so concurrent callers on any replica
+// queue on the row instead of racing
+func (r *RateLimitRepo) TakeRateLimitToken(ctx context.Context, tx Querier, schema string, key string, capacity float64, perSecond float64) (float64, bool, error) {
+	defer observe("RateLimitRepo", "TakeRateLimitToken")()
+	if err := ValidateSchema(schema); err != nil {
+		return 0, false, err
+	}
+
+	// tokens the bucket has before taking one, now() is the db's clock so replicas with skewed clocks agree
+	const refilled = `LEAST($2::float8, b.tokens + GREATEST(0, EXTRACT(EPOCH FROM now() - b.updated_at)) * $3::float8)`
+	sqlStatement := fmt.Sprintf(
+		`INSERT INTO %[1]s.rate_limit_buckets AS b
+		(key, tokens, allowed, updated_at)
+		VALUES
+		($1, $2::float8 - 1, true, now())
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = CASE WHEN %[2]s >= 1 THEN %[2]s - 1 ELSE %[2]s END,
+			allowed = %[2]s >= 1,
+			updated_at = GREATEST(b.updated_at, now())
+		RETURNING tokens, allowed`,
+		schema, refilled)
+
+	var tokens float64
+	var allowed bool
+	if err := tx.QueryRowContext(ctx, sqlStatement, key, capacity, perSecond).Scan(&tokens, &allowed); err != nil {
+		return 0, false, errors.Wrap(err, "problem taking rate limit token")
+	}
+	return tokens, allowed, nil
+}
+
+// DeleteIdleRateLimitBuckets purges buckets not used since idleSince. a purged bucket starts again full, so idleSince
+// should be further back than the longest rate limit period
+func (r *RateLimitRepo) DeleteIdleRateLimitBuckets(ctx context.Context, tx Querier, schema string, idleSince time.Time) (int64, error) {
+	defer observe("RateLimitRepo", "DeleteIdleRateLimitBuckets")()
+	if err := ValidateSchema(schema); err != nil {
+		return 0, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`DELETE FROM %[1]s.rate_limit_buckets
+		WHERE updated_at < $1`,
+		schema)
+
+	res, err := tx.ExecContext(ctx, sqlStatement, idleSince)
+	if err != nil {
+		return 0, errors.Wrap(err, "problem deleting idle rate limit buckets")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "problem deleting idle rate limit buckets")
+	}
+	return n, nil
+}
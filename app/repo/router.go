@@ -0,0 +1,169 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/platform"
+)
+
+type readYourWritesKey struct{}
+
+// WithReadYourWrites marks ctx so that reads made through a Router go to the primary. use it when a request must
+// see its own writes, which a lagging replica may not have yet
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey{}, true)
+}
+
+func isReadYourWrites(ctx context.Context) bool {
+	v, _ := ctx.Value(readYourWritesKey{}).(bool)
+	return v
+}
+
+type replica struct {
+	db      *sql.DB
+	q       Querier
+	name    string
+	healthy atomic.Bool
+}
+
+// Router sends read only queries to healthy replicas and everything else, including transactions, to the primary
+type Router struct {
+	primary  *DB
+	replicas []*replica
+	maxLag   time.Duration
+	interval time.Duration
+	next     atomic.Uint64
+}
+
+// NewRouter creates a router over the primary and zero or more replicas. replicas start out unhealthy and are
+// only used once Run has checked them
+func NewRouter(primary *DB, replicas []*sql.DB, maxLag time.Duration, checkInterval time.Duration) *Router {
+	r := &Router{
+		primary:  primary,
+		maxLag:   maxLag,
+		interval: checkInterval,
+	}
+	for i, db := range replicas {
+		r.replicas = append(r.replicas, &replica{db: db, q: FromSQL(db), name: fmt.Sprintf("replica-%d", i)})
+	}
+	return r
+}
+
+// InitializeRouter opens connections to the replicas in cfg and returns a router using primary for writes
+func InitializeRouter(cfg platform.DBConfig, primary *DB) (*Router, error) {
+	var replicas []*sql.DB
+	for _, uri := range cfg.ReplicaURIs {
+		db, err := sql.Open(Driver, uri)
+		if err != nil {
+			return nil, errors.Wrap(err, "problem opening replica db")
+		}
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+		db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+		db.SetConnMaxLifetime(cfg.ConnMaxLifeTime)
+		replicas = append(replicas, db)
+	}
+	return NewRouter(primary, replicas, cfg.ReplicaMaxLag, cfg.ReplicaCheckInterval), nil
+}
+
+// Primary returns the primary db. use it for writes and transactions
+func (r *Router) Primary() *DB {
+	return r.primary
+}
+
+// Reader returns a healthy replica, round robin, for read only queries. falls back to the primary when no replica
+// is healthy or ctx was marked with WithReadYourWrites
+func (r *Router) Reader(ctx context.Context) Querier {
+	if len(r.replicas) == 0 || isReadYourWrites(ctx) {
+		return r.primary
+	}
+
+	start := r.next.Add(1)
+	for i := range r.replicas {
+		rep := r.replicas[(int(start)+i)%len(r.replicas)]
+		if rep.healthy.Load() {
+			return rep.q
+		}
+	}
+	return r.primary
+}
+
+// Run checks replica health and lag until ctx is done
+func (r *Router) Run(ctx context.Context) {
+	if len(r.replicas) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		r.checkReplicas(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes all replica connections. the primary is owned by the caller
+func (r *Router) Close() error {
+	var res error
+	for _, rep := range r.replicas {
+		if err := rep.db.Close(); err != nil {
+			res = errors.Wrapf(err, "problem closing %s", rep.name)
+		}
+	}
+	return res
+}
+
+func (r *Router) checkReplicas(ctx context.Context) {
+	for _, rep := range r.replicas {
+		healthy := true
+		lag, err := replicaLag(ctx, rep.q, r.interval)
+		if err != nil {
+			healthy = false
+			slog.WarnContext(ctx, "replica health check failed", slog.String("replica", rep.name), slog.Any("error", err))
+		} else if lag > r.maxLag {
+			healthy = false
+			slog.WarnContext(ctx, "replica lag too high",
+				slog.String("replica", rep.name),
+				slog.Duration("lag", lag),
+				slog.Duration("max_lag", r.maxLag),
+			)
+		}
+
+		if was := rep.healthy.Swap(healthy); was != healthy {
+			slog.InfoContext(ctx, "replica health changed", slog.String("replica", rep.name), slog.Bool("healthy", healthy))
+		}
+	}
+}
+
+// replicaLag returns how far behind the primary a replica is. a replica that has replayed all the wal it received
+// is caught up, however long ago its last replayed transaction was, as that only means the primary is idle
+func replicaLag(ctx context.Context, db Querier, timeout time.Duration) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var inRecovery bool
+	var lagSecs float64
+	row := db.QueryRowContext(ctx,
+		`SELECT pg_is_in_recovery(),
+		CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+		END::float8`)
+	if err := row.Scan(&inRecovery, &lagSecs); err != nil {
+		return 0, errors.Wrap(err, "problem checking replica lag")
+	}
+	if !inRecovery {
+		return 0, errors.New("replica is not in recovery, it may have been promoted")
+	}
+	return time.Duration(lagSecs * float64(time.Second)), nil
+}
@@ -0,0 +1,121 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// schedule run statuses
+const (
+	ScheduleRunRunning   = "running"
+	ScheduleRunSucceeded = "succeeded"
+	ScheduleRunFailed    = "failed"
+)
+
+// ErrDuplicateScheduleRun is returned when a schedule tick has already been started
+var ErrDuplicateScheduleRun = errors.New("schedule run already started")
+
+// ScheduleRun represents a single firing of a recurring schedule
+type ScheduleRun struct {
+	ID          int64      `db:"id"`
+	Name        string     `db:"name"`
+	ScheduledAt time.Time  `db:"scheduled_at"`
+	Status      string     `db:"status"`
+	Error       *string    `db:"error"`
+	Instance    string     `db:"instance"`
+	StartedAt   time.Time  `db:"started_at"`
+	FinishedAt  *time.Time `db:"finished_at"`
+}
+
+// IScheduleRepo is repo interface for recurring schedule run history
+type IScheduleRepo interface {
+	StartScheduleRun(ctx context.Context, tx Querier, schema string, name string, scheduledAt time.Time, instance string) (*ScheduleRun, error)
+	FinishScheduleRun(ctx context.Context, tx Querier, schema string, runID int64, runErr error) error
+	ListScheduleRuns(ctx context.Context, tx Querier, schema string, name string, limit int) ([]ScheduleRun, error)
+}
+
+// ScheduleRepo is implementation of IScheduleRepo
+type ScheduleRepo struct{}
+
+// NewScheduleRepo creates a new schedule repo
+func NewScheduleRepo() IScheduleRepo {
+	return &ScheduleRepo{}
+}
+
+const scheduleRunColumns = `id, name, scheduled_at, status, error, instance, started_at, finished_at`
+
+// StartScheduleRun records that a schedule tick is starting. returns ErrDuplicateScheduleRun if the tick was
+// already started, by this or another instance
+func (r *ScheduleRepo) StartScheduleRun(ctx context.Context, tx Querier, schema string, name string, scheduledAt time.Time, instance string) (*ScheduleRun, error) {
+	defer observe("ScheduleRepo", "StartScheduleRun")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`INSERT INTO %[1]s.schedule_runs
+		(name, scheduled_at, instance)
+		VALUES
+		($1, $2, $3)
+		ON CONFLICT (name, scheduled_at) DO NOTHING
+		RETURNING `+scheduleRunColumns,
+		schema)
+
+	var res ScheduleRun
+	if err := scanOne(ctx, tx, &res, sqlStatement, name, scheduledAt, instance); err != nil {
+		if isNotFound(err) {
+			return nil, ErrDuplicateScheduleRun
+		}
+		return nil, errors.Wrap(err, "problem starting schedule run")
+	}
+	return &res, nil
+}
+
+// FinishScheduleRun records the outcome of a schedule run, failed if runErr is not nil
+func (r *ScheduleRepo) FinishScheduleRun(ctx context.Context, tx Querier, schema string, runID int64, runErr error) error {
+	defer observe("ScheduleRepo", "FinishScheduleRun")()
+	if err := ValidateSchema(schema); err != nil {
+		return err
+	}
+
+	status := ScheduleRunSucceeded
+	var errMsg *string
+	if runErr != nil {
+		status = ScheduleRunFailed
+		msg := runErr.Error()
+		errMsg = &msg
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`UPDATE %[1]s.schedule_runs
+		SET status = $2, error = $3, finished_at = now()
+		WHERE id = $1 AND status = 'running'`,
+		schema)
+
+	return execAffectingOne(ctx, tx, "problem finishing schedule run", sqlStatement, runID, status, errMsg)
+}
+
+// ListScheduleRuns gets the most recent runs, newest first. an empty name lists runs of every schedule
+func (r *ScheduleRepo) ListScheduleRuns(ctx context.Context, tx Querier, schema string, name string, limit int) ([]ScheduleRun, error) {
+	defer observe("ScheduleRepo", "ListScheduleRuns")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT `+scheduleRunColumns+`
+		FROM %[1]s.schedule_runs
+		WHERE $1 = '' OR name = $1
+		ORDER BY scheduled_at DESC, id DESC
+		LIMIT $2`,
+		schema)
+
+	var result []ScheduleRun
+	if err := scanAll(ctx, tx, &result, sqlStatement, name, limit); err != nil {
+		return nil, errors.Wrap(err, "problem listing schedule runs")
+	}
+	return result, nil
+}
@@ -0,0 +1,52 @@
+package repo
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PoolStats is a point in time snapshot of connection pool stats, for monitoring
+type PoolStats struct {
+	Backend string
+	SQL     sql.DBStats
+	Pgx     *PgxPoolStats // only set for the pgxpool backend
+}
+
+// PgxPoolStats are the stats reported by a native pgxpool.Pool
+type PgxPoolStats struct {
+	AcquireCount         int64
+	AcquireDuration      time.Duration
+	AcquiredConns        int32
+	CanceledAcquireCount int64
+	ConstructingConns    int32
+	EmptyAcquireCount    int64
+	IdleConns            int32
+	MaxConns             int32
+	TotalConns           int32
+}
+
+// GetPoolStats returns stats for the given db and, if the db is backed by one, its native pgxpool
+func GetPoolStats(db *DB) PoolStats {
+	res := PoolStats{
+		Backend: BackendStdlib,
+		SQL:     db.SQL.Stats(),
+	}
+	if db.Pool == nil {
+		return res
+	}
+
+	s := db.Pool.Stat()
+	res.Backend = BackendPgxPool
+	res.Pgx = &PgxPoolStats{
+		AcquireCount:         s.AcquireCount(),
+		AcquireDuration:      s.AcquireDuration(),
+		AcquiredConns:        s.AcquiredConns(),
+		CanceledAcquireCount: s.CanceledAcquireCount(),
+		ConstructingConns:    s.ConstructingConns(),
+		EmptyAcquireCount:    s.EmptyAcquireCount(),
+		IdleConns:            s.IdleConns(),
+		MaxConns:             s.MaxConns(),
+		TotalConns:           s.TotalConns(),
+	}
+	return res
+}
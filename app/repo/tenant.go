@@ -0,0 +1,182 @@
+package repo
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/platform"
+)
+
+const tenantSchemaPrefix = "tenant_"
+
+var (
+	// ErrInvalidSchema is returned when a schema name is not a safe postgres identifier
+	ErrInvalidSchema = errors.New("invalid schema name")
+	// ErrUnknownTenant is returned when a tenant schema does not exist and will not be created
+	ErrUnknownTenant = errors.New("unknown tenant")
+
+	// schemas are interpolated into sql with fmt.Sprintf so only allow plain lowercase identifiers.
+	// 63 bytes is the postgres identifier limit
+	schemaRE = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+	// tenants come from subdomains and jwt claims, e.g. "acme", "acme-corp", "acme.com", so they must be dns names:
+	// dot separated labels that do not start or end with a hyphen
+	tenantRE = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+	// a dot is never next to a hyphen or another dot in a dns name, so a single underscore can only be a dot and
+	// distinct tenants always get distinct schemas
+	tenantSchemaReplacer = strings.NewReplacer(".", "_", "-", "__")
+)
+
+// ValidateSchema returns ErrInvalidSchema unless schema is safe to interpolate into a sql statement
+func ValidateSchema(schema string) error {
+	if !schemaRE.MatchString(schema) || strings.HasPrefix(schema, "pg_") || schema == "information_schema" {
+		return errors.Wrapf(ErrInvalidSchema, "%q", schema)
+	}
+	return nil
+}
+
+// TenantSchema maps a tenant identifier to the postgres schema holding its data, e.g. "acme.com" -> "tenant_acme_com"
+// and "acme-corp" -> "tenant_acme__corp"
+func TenantSchema(tenant string) (string, error) {
+	tenant = strings.ToLower(tenant)
+	if !tenantRE.MatchString(tenant) {
+		return "", errors.Wrapf(ErrInvalidSchema, "invalid tenant %q", tenant)
+	}
+
+	schema := tenantSchemaPrefix + tenantSchemaReplacer.Replace(tenant)
+	if err := ValidateSchema(schema); err != nil {
+		return "", err
+	}
+	return schema, nil
+}
+
+// ListTenantSchemas returns the name of every tenant schema
+func ListTenantSchemas(ctx context.Context, tx Querier) ([]string, error) {
+	sqlStatement := `
+		SELECT schema_name
+		FROM information_schema.schemata
+		WHERE starts_with(schema_name, $1)
+		ORDER BY schema_name
+	`
+
+	var schemas []string
+	if err := scanAll(ctx, tx, &schemas, sqlStatement, tenantSchemaPrefix); err != nil {
+		return nil, errors.Wrap(err, "problem listing tenant schemas")
+	}
+	return schemas, nil
+}
+
+// TenantProvisioner makes sure tenant schemas exist and are migrated before they are used
+type TenantProvisioner struct {
+	db         *DB
+	cfg        platform.DBConfig
+	autoCreate bool
+
+	mu    sync.Mutex
+	ready map[string]bool // schemas known to be usable, so each is only checked once per process
+}
+
+// NewTenantProvisioner creates a tenant provisioner. when autoCreate is false unknown tenants are rejected
+func NewTenantProvisioner(db *DB, cfg platform.DBConfig, autoCreate bool) *TenantProvisioner {
+	return &TenantProvisioner{
+		db:         db,
+		cfg:        cfg,
+		autoCreate: autoCreate,
+		ready:      map[string]bool{},
+	}
+}
+
+// Ensure makes sure schema exists. if auto create is enabled, the schema is created if need be and all migrations
+// are applied to it. only call it for a tenant the caller is authenticated for, see Check
+func (p *TenantProvisioner) Ensure(ctx context.Context, schema string) error {
+	return p.ensure(ctx, schema, p.autoCreate)
+}
+
+// Check makes sure schema exists without ever creating it, for tenants that come from something unauthenticated,
+// e.g. the Host header
+func (p *TenantProvisioner) Check(ctx context.Context, schema string) error {
+	return p.ensure(ctx, schema, false)
+}
+
+func (p *TenantProvisioner) ensure(ctx context.Context, schema string, create bool) error {
+	if err := ValidateSchema(schema); err != nil {
+		return err
+	}
+	if p.isReady(schema) {
+		return nil
+	}
+
+	if create {
+		if err := p.create(ctx, schema); err != nil {
+			return err
+		}
+	} else {
+		var exists bool
+		row := p.db.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM information_schema.schemata WHERE schema_name = $1)`, schema)
+		if err := row.Scan(&exists); err != nil {
+			return errors.Wrap(err, "problem checking tenant schema")
+		}
+		if !exists {
+			return errors.Wrapf(ErrUnknownTenant, "schema %q does not exist", schema)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ready[schema] = true
+	return nil
+}
+
+func (p *TenantProvisioner) isReady(schema string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ready[schema]
+}
+
+// create creates and migrates schema while holding an advisory lock for it, so that concurrent first requests, in
+// this process or another, wait for it to be ready rather than race to create it or use it half migrated
+func (p *TenantProvisioner) create(ctx context.Context, schema string) error {
+	conn, err := p.db.SQL.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "problem getting connection to create tenant schema")
+	}
+	defer conn.Close()
+
+	q := FromSQL(conn)
+	key := AdvisoryLockKey("tenant:" + schema)
+	if err := AdvisoryLock(ctx, q, key); err != nil {
+		return err
+	}
+	defer func() {
+		// ctx may be done, the lock must still be released before the connection goes back to the pool
+		if err := AdvisoryUnlock(context.WithoutCancel(ctx), q, key); err != nil {
+			slog.ErrorContext(ctx, "problem releasing tenant schema lock", slog.String("schema", schema), slog.Any("error", err))
+		}
+	}()
+
+	sqlStatement := `CREATE SCHEMA IF NOT EXISTS ` + pgx.Identifier{schema}.Sanitize()
+	if _, err := q.ExecContext(ctx, sqlStatement); err != nil {
+		return errors.Wrap(err, "problem creating tenant schema")
+	}
+
+	// migrations use unqualified table names, pointing search_path at the tenant creates them there
+	cfg := p.cfg
+	cfg.Schema = schema
+	m, err := NewTenantMigrator(GetConnectionURI(cfg))
+	if err != nil {
+		return err
+	}
+	defer func() { _, _ = m.Close() }()
+
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return errors.Wrapf(err, "problem migrating tenant schema %q", schema)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSchema(t *testing.T) {
+	for _, schema := range []string{"public", "tenant_acme", "_x", "a1"} {
+		assert.NoError(t, ValidateSchema(schema), schema)
+	}
+
+	for _, schema := range []string{
+		"",
+		"Public",
+		"1abc",
+		"users; DROP TABLE users; --",
+		"public.users",
+		`"quoted"`,
+		"pg_catalog",
+		"information_schema",
+		"a234567890123456789012345678901234567890123456789012345678901234", // 64 chars
+	} {
+		assert.ErrorIs(t, ValidateSchema(schema), ErrInvalidSchema, schema)
+	}
+}
+
+func TestTenantSchema(t *testing.T) {
+	for tenant, expected := range map[string]string{
+		"acme":               "tenant_acme",
+		"Acme-Corp":          "tenant_acme__corp",
+		"acme.com":           "tenant_acme_com",
+		"xn--80ak6aa92e.com": "tenant_xn____80ak6aa92e_com",
+	} {
+		actual, err := TenantSchema(tenant)
+		assert.NoError(t, err, tenant)
+		assert.Equal(t, expected, actual)
+	}
+
+	for _, tenant := range []string{"", "-acme", "acme-", "acme;drop", "acme corp", "acme_corp", "acme..com", "acme.-corp", ".acme"} {
+		_, err := TenantSchema(tenant)
+		assert.ErrorIs(t, err, ErrInvalidSchema, tenant)
+	}
+}
+
+func TestTenantSchema_distinct(t *testing.T) {
+	tenants := []string{"acme-corp", "acme.corp", "acme--corp", "acme.c.orp", "acme-c.orp", "acme.c-orp", "acmecorp"}
+	seen := map[string]string{}
+	for _, tenant := range tenants {
+		schema, err := TenantSchema(tenant)
+		assert.NoError(t, err, tenant)
+		if other, ok := seen[schema]; ok {
+			t.Errorf("%q and %q share schema %q", tenant, other, schema)
+		}
+		seen[schema] = tenant
+	}
+}
@@ -0,0 +1,18 @@
+package repo
+
+import (
+	"context"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/drmaples/starter-app/app/tracing"
+)
+
+// startSpan starts a span around a repo method, a child of the request's span. use right after observe:
+//
+//	ctx, span := startSpan(ctx, "UserRepo", "GetUserByID")
+//	defer span.End()
+func startSpan(ctx context.Context, repo string, method string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, repo+"."+method, semconv.DBSystemPostgreSQL, semconv.DBOperationName(method))
+}
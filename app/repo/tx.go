@@ -0,0 +1,140 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+)
+
+const (
+	// https://www.postgresql.org/docs/current/errcodes-appendix.html
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+
+	defaultTxMaxRetries  = 3
+	defaultTxBaseBackoff = 50 * time.Millisecond
+	defaultTxMaxBackoff  = 2 * time.Second
+)
+
+var _ TxBeginner = &DB{} // assert adheres to interface
+
+// TxBeginner represents anything that can start a transaction, e.g. a DB
+type TxBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (Tx, error)
+}
+
+// TxOptions controls how WithTx runs a transaction. the zero value uses the db default isolation level
+// and retries serialization failures and deadlocks up to defaultTxMaxRetries times
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+
+	MaxRetries  int           // number of retries after the first attempt. negative disables retries
+	BaseBackoff time.Duration // backoff before the first retry, doubled on each subsequent retry
+	MaxBackoff  time.Duration // upper bound for any single backoff
+}
+
+func (o *TxOptions) withDefaults() TxOptions {
+	var res TxOptions
+	if o != nil {
+		res = *o
+	}
+	if res.MaxRetries == 0 {
+		res.MaxRetries = defaultTxMaxRetries
+	}
+	if res.MaxRetries < 0 {
+		res.MaxRetries = 0
+	}
+	if res.BaseBackoff <= 0 {
+		res.BaseBackoff = defaultTxBaseBackoff
+	}
+	if res.MaxBackoff <= 0 {
+		res.MaxBackoff = defaultTxMaxBackoff
+	}
+	return res
+}
+
+// WithTx runs fn inside a transaction. the transaction is committed if fn returns nil and rolled back if fn returns
+// an error or panics. serialization failures and deadlocks (SQLSTATE 40001, 40P01) cause the whole transaction,
+// including fn, to be retried with exponential backoff so fn must be safe to run more than once
+func WithTx(ctx context.Context, db TxBeginner, opts *TxOptions, fn func(tx Querier) error) error {
+	o := opts.withDefaults()
+	txOpts := &sql.TxOptions{Isolation: o.Isolation, ReadOnly: o.ReadOnly}
+
+	for attempt := 0; ; attempt++ {
+		err := runTx(ctx, db, txOpts, fn)
+		if err == nil {
+			return nil
+		}
+		if !IsRetryableTxErr(err) || attempt >= o.MaxRetries {
+			return err
+		}
+
+		wait := txBackoff(o, attempt)
+		slog.WarnContext(ctx, "retrying transaction",
+			slog.Int("attempt", attempt+1),
+			slog.Duration("backoff", wait),
+			slog.Any("error", err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(err, "context done before transaction could be retried")
+		case <-time.After(wait):
+		}
+	}
+}
+
+func runTx(ctx context.Context, db TxBeginner, txOpts *sql.TxOptions, fn func(tx Querier) error) error {
+	tx, err := db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return errors.Wrap(err, "problem starting transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				slog.ErrorContext(ctx, "problem rolling back transaction after panic", slog.Any("error", rbErr))
+			}
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			// keep the original error as the cause so callers can still inspect it
+			return errors.Wrap(err, fmt.Sprintf("problem rolling back transaction: %v", rbErr))
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "problem committing transaction")
+	}
+	return nil
+}
+
+// IsRetryableTxErr reports whether err is a serialization failure or deadlock that is safe to retry
+func IsRetryableTxErr(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == sqlStateSerializationFailure || pgErr.Code == sqlStateDeadlockDetected
+}
+
+// txBackoff is exponential backoff with full jitter
+// https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+func txBackoff(o TxOptions, attempt int) time.Duration {
+	wait := o.BaseBackoff << attempt
+	if wait <= 0 || wait > o.MaxBackoff {
+		wait = o.MaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(wait)) + 1) //nolint:gosec // jitter does not need crypto rand
+}
@@ -3,8 +3,8 @@ package repo
 import (
 	"context"
 	"fmt"
+	"time"
 
-	"github.com/georgysavva/scany/v2/sqlscan"
 	"github.com/pkg/errors"
 )
 
@@ -22,8 +22,15 @@ type User struct {
 // IUserRepo is repo interface for accessing users in db
 type IUserRepo interface {
 	GetUserByID(ctx context.Context, tx Querier, schema string, userID int) (*User, error)
+	GetUserByEmail(ctx context.Context, tx Querier, schema string, email string) (*User, error)
 	ListUsers(ctx context.Context, tx Querier, schema string) ([]User, error)
+	ListUsersByOrgMember(ctx context.Context, tx Querier, schema string, memberEmail string) ([]User, error)
+	GetUserByOrgMember(ctx context.Context, tx Querier, schema string, memberEmail string, userID int) (*User, error)
 	CreateUser(ctx context.Context, tx Querier, schema string, u User) (*User, error)
+	UpdateUser(ctx context.Context, tx Querier, schema string, u User) (*User, error)
+	DeleteUser(ctx context.Context, tx Querier, schema string, userID int) error
+	GetUserAsOf(ctx context.Context, tx Querier, schema string, userID int, at time.Time) (*UserRevision, error)
+	ListUserRevisions(ctx context.Context, tx Querier, schema string, userID int) ([]UserRevision, error)
 }
 
 // UserRepo is implementation of IUserRepo
@@ -36,6 +43,13 @@ func NewUserRepo() IUserRepo {
 
 // GetUserByID fetches a user from the db by ID
 func (r *UserRepo) GetUserByID(ctx context.Context, tx Querier, schema string, userID int) (*User, error) {
+	defer observe("UserRepo", "GetUserByID")()
+	ctx, span := startSpan(ctx, "UserRepo", "GetUserByID")
+	defer span.End()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
 	sqlStatement := fmt.Sprintf(
 		`SELECT id, email, first_name, last_name
 		FROM %[1]s.users
@@ -43,8 +57,8 @@ func (r *UserRepo) GetUserByID(ctx context.Context, tx Querier, schema string, u
 		schema)
 
 	var u User
-	if err := sqlscan.Get(ctx, tx, &u, sqlStatement, userID); err != nil {
-		if sqlscan.NotFound(err) {
+	if err := scanOne(ctx, tx, &u, sqlStatement, userID); err != nil {
+		if isNotFound(err) {
 			return nil, ErrNoRowsFound
 		}
 		return nil, errors.Wrap(err, "problem fetching user by id")
@@ -52,22 +66,128 @@ func (r *UserRepo) GetUserByID(ctx context.Context, tx Querier, schema string, u
 	return &u, nil
 }
 
+// GetUserByEmail fetches a user from the db by email. emails are not unique, the lowest id wins
+func (r *UserRepo) GetUserByEmail(ctx context.Context, tx Querier, schema string, email string) (*User, error) {
+	defer observe("UserRepo", "GetUserByEmail")()
+	ctx, span := startSpan(ctx, "UserRepo", "GetUserByEmail")
+	defer span.End()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT id, email, first_name, last_name
+		FROM %[1]s.users
+		WHERE email = $1
+		ORDER BY id
+		LIMIT 1`,
+		schema)
+
+	var u User
+	if err := scanOne(ctx, tx, &u, sqlStatement, email); err != nil {
+		if isNotFound(err) {
+			return nil, ErrNoRowsFound
+		}
+		return nil, errors.Wrap(err, "problem fetching user by email")
+	}
+	return &u, nil
+}
+
 // ListUsers gets all users from db
 func (r *UserRepo) ListUsers(ctx context.Context, tx Querier, schema string) ([]User, error) {
+	defer observe("UserRepo", "ListUsers")()
+	ctx, span := startSpan(ctx, "UserRepo", "ListUsers")
+	defer span.End()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
 	sqlStatement := fmt.Sprintf(
 		`SELECT id, email, first_name, last_name
 		FROM %[1]s.users`,
 		schema)
 
 	var result []User
-	if err := sqlscan.Select(ctx, tx, &result, sqlStatement); err != nil {
+	if err := scanAll(ctx, tx, &result, sqlStatement); err != nil {
 		return nil, errors.Wrap(err, "problem getting all users")
 	}
 	return result, nil
 }
 
+// ListUsersByOrgMember gets all users sharing at least one organization with the member with the given email
+func (r *UserRepo) ListUsersByOrgMember(ctx context.Context, tx Querier, schema string, memberEmail string) ([]User, error) {
+	defer observe("UserRepo", "ListUsersByOrgMember")()
+	ctx, span := startSpan(ctx, "UserRepo", "ListUsersByOrgMember")
+	defer span.End()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT DISTINCT u.id, u.email, u.first_name, u.last_name
+		FROM %[1]s.users u
+		JOIN %[1]s.organization_members om ON om.user_id = u.id
+		WHERE om.organization_id IN (
+			SELECT m.organization_id
+			FROM %[1]s.organization_members m
+			JOIN %[1]s.users me ON me.id = m.user_id
+			WHERE me.email = $1
+		)
+		ORDER BY u.id`,
+		schema)
+
+	var result []User
+	if err := scanAll(ctx, tx, &result, sqlStatement, memberEmail); err != nil {
+		return nil, errors.Wrap(err, "problem getting users by org member")
+	}
+	return result, nil
+}
+
+// GetUserByOrgMember fetches a user by ID if it is the member with the given email or shares at least one
+// organization with them, see ListUsersByOrgMember
+func (r *UserRepo) GetUserByOrgMember(ctx context.Context, tx Querier, schema string, memberEmail string, userID int) (*User, error) {
+	defer observe("UserRepo", "GetUserByOrgMember")()
+	ctx, span := startSpan(ctx, "UserRepo", "GetUserByOrgMember")
+	defer span.End()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT u.id, u.email, u.first_name, u.last_name
+		FROM %[1]s.users u
+		WHERE u.id = $2
+		AND (
+			u.email = $1
+			OR EXISTS (
+				SELECT 1
+				FROM %[1]s.organization_members om
+				JOIN %[1]s.organization_members m ON m.organization_id = om.organization_id
+				JOIN %[1]s.users me ON me.id = m.user_id
+				WHERE om.user_id = u.id AND me.email = $1
+			)
+		)`,
+		schema)
+
+	var u User
+	if err := scanOne(ctx, tx, &u, sqlStatement, memberEmail, userID); err != nil {
+		if isNotFound(err) {
+			return nil, ErrNoRowsFound
+		}
+		return nil, errors.Wrap(err, "problem fetching user by org member")
+	}
+	return &u, nil
+}
+
 // CreateUser creates a new user in db
 func (r *UserRepo) CreateUser(ctx context.Context, tx Querier, schema string, u User) (*User, error) {
+	defer observe("UserRepo", "CreateUser")()
+	ctx, span := startSpan(ctx, "UserRepo", "CreateUser")
+	defer span.End()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
 	sqlStatement := fmt.Sprintf(
 		`INSERT INTO %[1]s.users
 		(email, first_name, last_name)
@@ -84,3 +204,46 @@ func (r *UserRepo) CreateUser(ctx context.Context, tx Querier, schema string, u
 
 	return &u, nil
 }
+
+// UpdateUser updates a user's name
+func (r *UserRepo) UpdateUser(ctx context.Context, tx Querier, schema string, u User) (*User, error) {
+	defer observe("UserRepo", "UpdateUser")()
+	ctx, span := startSpan(ctx, "UserRepo", "UpdateUser")
+	defer span.End()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`UPDATE %[1]s.users
+		SET first_name = $2, last_name = $3, updated_at = now()
+		WHERE id = $1
+		RETURNING id, email, first_name, last_name`,
+		schema)
+
+	var res User
+	if err := scanOne(ctx, tx, &res, sqlStatement, u.ID, u.FirstName, u.LastName); err != nil {
+		if isNotFound(err) {
+			return nil, ErrNoRowsFound
+		}
+		return nil, errors.Wrap(err, "problem updating user")
+	}
+	return &res, nil
+}
+
+// DeleteUser deletes a user. their organization memberships go with them
+func (r *UserRepo) DeleteUser(ctx context.Context, tx Querier, schema string, userID int) error {
+	defer observe("UserRepo", "DeleteUser")()
+	ctx, span := startSpan(ctx, "UserRepo", "DeleteUser")
+	defer span.End()
+	if err := ValidateSchema(schema); err != nil {
+		return err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`DELETE FROM %[1]s.users
+		WHERE id = $1`,
+		schema)
+
+	return execAffectingOne(ctx, tx, "problem deleting user", sqlStatement, userID)
+}
@@ -0,0 +1,81 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// user history operations, the statement that created a revision
+const (
+	UserHistoryInsert = "INSERT"
+	UserHistoryUpdate = "UPDATE"
+	UserHistoryDelete = "DELETE"
+)
+
+// UserRevision represents one version of a users row, kept by a trigger on every write
+type UserRevision struct {
+	User
+	Revision  int        `db:"revision"`
+	Operation string     `db:"operation"`
+	ValidFrom time.Time  `db:"valid_from"`
+	ValidTo   *time.Time `db:"valid_to"` // nil while this is the current version
+}
+
+const userRevisionColumns = `id, email, first_name, last_name, revision, operation, valid_from, valid_to`
+
+// GetUserAsOf fetches the version of a user that was current at a point in time. returns ErrNoRowsFound if the
+// user did not exist then, including after it was deleted
+func (r *UserRepo) GetUserAsOf(ctx context.Context, tx Querier, schema string, userID int, at time.Time) (*UserRevision, error) {
+	defer observe("UserRepo", "GetUserAsOf")()
+	ctx, span := startSpan(ctx, "UserRepo", "GetUserAsOf")
+	defer span.End()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT `+userRevisionColumns+`
+		FROM %[1]s.users_history
+		WHERE id = $1 AND valid_from <= $2 AND (valid_to IS NULL OR valid_to > $2)
+		ORDER BY revision DESC
+		LIMIT 1`,
+		schema)
+
+	var res UserRevision
+	if err := scanOne(ctx, tx, &res, sqlStatement, userID, at); err != nil {
+		if isNotFound(err) {
+			return nil, ErrNoRowsFound
+		}
+		return nil, errors.Wrap(err, "problem fetching user as of time")
+	}
+	if res.Operation == UserHistoryDelete {
+		return nil, ErrNoRowsFound
+	}
+	return &res, nil
+}
+
+// ListUserRevisions gets every version of a user, oldest first. a deleted user's last revision is its delete
+func (r *UserRepo) ListUserRevisions(ctx context.Context, tx Querier, schema string, userID int) ([]UserRevision, error) {
+	defer observe("UserRepo", "ListUserRevisions")()
+	ctx, span := startSpan(ctx, "UserRepo", "ListUserRevisions")
+	defer span.End()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT `+userRevisionColumns+`
+		FROM %[1]s.users_history
+		WHERE id = $1
+		ORDER BY revision`,
+		schema)
+
+	var result []UserRevision
+	if err := scanAll(ctx, tx, &result, sqlStatement, userID); err != nil {
+		return nil, errors.Wrap(err, "problem listing user revisions")
+	}
+	return result, nil
+}
@@ -0,0 +1,352 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Webhook represents an organization's subscription to events at a url
+type Webhook struct {
+	ID             int       `db:"id"`
+	OrganizationID int       `db:"organization_id"`
+	URL            string    `db:"url"`
+	Secret         string    `db:"secret"`
+	EventTypes     TextArray `db:"event_types"` // empty means every event type
+	Active         bool      `db:"active"`
+	CreatedBy      *int      `db:"created_by"`
+	CreatedAt      time.Time `db:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at"`
+}
+
+// WebhookDelivery represents a single event to be delivered to a webhook, across all attempts
+type WebhookDelivery struct {
+	ID             int64           `db:"id"`
+	WebhookID      int             `db:"webhook_id"`
+	EventID        string          `db:"event_id"`
+	EventType      string          `db:"event_type"`
+	Payload        json.RawMessage `db:"payload"`
+	Status         string          `db:"status"`
+	Attempts       int             `db:"attempts"`
+	LastStatusCode *int            `db:"last_status_code"`
+	LastError      *string         `db:"last_error"`
+	CreatedAt      time.Time       `db:"created_at"`
+	UpdatedAt      time.Time       `db:"updated_at"`
+}
+
+// WebhookDeliveryAttempt represents one http request made for a delivery
+type WebhookDeliveryAttempt struct {
+	ID           int64     `db:"id"`
+	DeliveryID   int64     `db:"delivery_id"`
+	StatusCode   *int      `db:"status_code"`
+	Error        *string   `db:"error"`
+	ResponseBody *string   `db:"response_body"`
+	DurationMS   int       `db:"duration_ms"`
+	CreatedAt    time.Time `db:"created_at"`
+}
+
+// IWebhookRepo is repo interface for webhooks and their deliveries
+type IWebhookRepo interface {
+	CreateWebhook(ctx context.Context, tx Querier, schema string, w Webhook) (*Webhook, error)
+	GetWebhook(ctx context.Context, tx Querier, schema string, webhookID int) (*Webhook, error)
+	ListWebhooks(ctx context.Context, tx Querier, schema string, orgID int) ([]Webhook, error)
+	ListWebhooksForUserEvent(ctx context.Context, tx Querier, schema string, userID int, eventType string) ([]Webhook, error)
+	UpdateWebhook(ctx context.Context, tx Querier, schema string, w Webhook) (*Webhook, error)
+	DeleteWebhook(ctx context.Context, tx Querier, schema string, webhookID int) error
+
+	CreateDelivery(ctx context.Context, tx Querier, schema string, d WebhookDelivery) (*WebhookDelivery, error)
+	GetDelivery(ctx context.Context, tx Querier, schema string, deliveryID int64) (*WebhookDelivery, error)
+	ListDeliveries(ctx context.Context, tx Querier, schema string, webhookID int, limit int) ([]WebhookDelivery, error)
+	RecordDeliveryAttempt(ctx context.Context, tx Querier, schema string, a WebhookDeliveryAttempt, status string) error
+	ListDeliveryAttempts(ctx context.Context, tx Querier, schema string, deliveryID int64) ([]WebhookDeliveryAttempt, error)
+	ResetDelivery(ctx context.Context, tx Querier, schema string, deliveryID int64) error
+}
+
+// WebhookRepo is implementation of IWebhookRepo
+type WebhookRepo struct{}
+
+// NewWebhookRepo creates a new webhook repo
+func NewWebhookRepo() IWebhookRepo {
+	return &WebhookRepo{}
+}
+
+const (
+	webhookColumns  = `id, organization_id, url, secret, event_types, active, created_by, created_at, updated_at`
+	deliveryColumns = `id, webhook_id, event_id, event_type, payload, status, attempts, last_status_code, last_error,
+		created_at, updated_at`
+)
+
+// CreateWebhook creates a new webhook in db
+func (r *WebhookRepo) CreateWebhook(ctx context.Context, tx Querier, schema string, w Webhook) (*Webhook, error) {
+	defer observe("WebhookRepo", "CreateWebhook")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`INSERT INTO %[1]s.webhooks
+		(organization_id, url, secret, event_types, active, created_by)
+		VALUES
+		($1, $2, $3, $4, $5, $6)
+		RETURNING `+webhookColumns,
+		schema)
+
+	var res Webhook
+	if err := scanOne(ctx, tx, &res, sqlStatement,
+		w.OrganizationID, w.URL, w.Secret, []string(w.EventTypes), w.Active, w.CreatedBy); err != nil {
+		return nil, errors.Wrap(err, "problem inserting webhook")
+	}
+	return &res, nil
+}
+
+// GetWebhook fetches a webhook from the db by ID
+func (r *WebhookRepo) GetWebhook(ctx context.Context, tx Querier, schema string, webhookID int) (*Webhook, error) {
+	defer observe("WebhookRepo", "GetWebhook")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT `+webhookColumns+`
+		FROM %[1]s.webhooks
+		WHERE id = $1`,
+		schema)
+
+	var w Webhook
+	if err := scanOne(ctx, tx, &w, sqlStatement, webhookID); err != nil {
+		if isNotFound(err) {
+			return nil, ErrNoRowsFound
+		}
+		return nil, errors.Wrap(err, "problem fetching webhook by id")
+	}
+	return &w, nil
+}
+
+// ListWebhooks gets all webhooks of an organization
+func (r *WebhookRepo) ListWebhooks(ctx context.Context, tx Querier, schema string, orgID int) ([]Webhook, error) {
+	defer observe("WebhookRepo", "ListWebhooks")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT `+webhookColumns+`
+		FROM %[1]s.webhooks
+		WHERE organization_id = $1
+		ORDER BY id`,
+		schema)
+
+	var result []Webhook
+	if err := scanAll(ctx, tx, &result, sqlStatement, orgID); err != nil {
+		return nil, errors.Wrap(err, "problem listing webhooks")
+	}
+	return result, nil
+}
+
+// ListWebhooksForUserEvent gets the active webhooks subscribed to an event about a user, i.e. those of every
+// organization the user is a member of
+func (r *WebhookRepo) ListWebhooksForUserEvent(ctx context.Context, tx Querier, schema string, userID int, eventType string) ([]Webhook, error) {
+	defer observe("WebhookRepo", "ListWebhooksForUserEvent")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT `+webhookColumns+`
+		FROM %[1]s.webhooks
+		WHERE active
+			AND (cardinality(event_types) = 0 OR $2 = ANY(event_types))
+			AND organization_id IN (
+				SELECT organization_id
+				FROM %[1]s.organization_members
+				WHERE user_id = $1
+			)
+		ORDER BY id`,
+		schema)
+
+	var result []Webhook
+	if err := scanAll(ctx, tx, &result, sqlStatement, userID, eventType); err != nil {
+		return nil, errors.Wrap(err, "problem listing webhooks for user event")
+	}
+	return result, nil
+}
+
+// UpdateWebhook updates a webhook's url, event types and active flag. the secret never changes
+func (r *WebhookRepo) UpdateWebhook(ctx context.Context, tx Querier, schema string, w Webhook) (*Webhook, error) {
+	defer observe("WebhookRepo", "UpdateWebhook")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`UPDATE %[1]s.webhooks
+		SET url = $2, event_types = $3, active = $4, updated_at = now()
+		WHERE id = $1
+		RETURNING `+webhookColumns,
+		schema)
+
+	var res Webhook
+	if err := scanOne(ctx, tx, &res, sqlStatement, w.ID, w.URL, []string(w.EventTypes), w.Active); err != nil {
+		if isNotFound(err) {
+			return nil, ErrNoRowsFound
+		}
+		return nil, errors.Wrap(err, "problem updating webhook")
+	}
+	return &res, nil
+}
+
+// DeleteWebhook deletes a webhook and, by cascade, its deliveries
+func (r *WebhookRepo) DeleteWebhook(ctx context.Context, tx Querier, schema string, webhookID int) error {
+	defer observe("WebhookRepo", "DeleteWebhook")()
+	if err := ValidateSchema(schema); err != nil {
+		return err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`DELETE FROM %[1]s.webhooks
+		WHERE id = $1`,
+		schema)
+
+	return execAffectingOne(ctx, tx, "problem deleting webhook", sqlStatement, webhookID)
+}
+
+// CreateDelivery creates a pending delivery. an event already delivered to the webhook returns the existing
+// delivery, so relaying an event twice is harmless
+func (r *WebhookRepo) CreateDelivery(ctx context.Context, tx Querier, schema string, d WebhookDelivery) (*WebhookDelivery, error) {
+	defer observe("WebhookRepo", "CreateDelivery")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	// the no-op update makes RETURNING produce the existing row on conflict
+	sqlStatement := fmt.Sprintf(
+		`INSERT INTO %[1]s.webhook_deliveries
+		(webhook_id, event_id, event_type, payload)
+		VALUES
+		($1, $2, $3, $4)
+		ON CONFLICT (webhook_id, event_id) DO UPDATE SET webhook_id = EXCLUDED.webhook_id
+		RETURNING `+deliveryColumns,
+		schema)
+
+	var res WebhookDelivery
+	if err := scanOne(ctx, tx, &res, sqlStatement, d.WebhookID, d.EventID, d.EventType, d.Payload); err != nil {
+		return nil, errors.Wrap(err, "problem inserting webhook delivery")
+	}
+	return &res, nil
+}
+
+// GetDelivery fetches a delivery from the db by ID
+func (r *WebhookRepo) GetDelivery(ctx context.Context, tx Querier, schema string, deliveryID int64) (*WebhookDelivery, error) {
+	defer observe("WebhookRepo", "GetDelivery")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT `+deliveryColumns+`
+		FROM %[1]s.webhook_deliveries
+		WHERE id = $1`,
+		schema)
+
+	var d WebhookDelivery
+	if err := scanOne(ctx, tx, &d, sqlStatement, deliveryID); err != nil {
+		if isNotFound(err) {
+			return nil, ErrNoRowsFound
+		}
+		return nil, errors.Wrap(err, "problem fetching webhook delivery by id")
+	}
+	return &d, nil
+}
+
+// ListDeliveries gets a webhook's most recent deliveries, newest first
+func (r *WebhookRepo) ListDeliveries(ctx context.Context, tx Querier, schema string, webhookID int, limit int) ([]WebhookDelivery, error) {
+	defer observe("WebhookRepo", "ListDeliveries")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT `+deliveryColumns+`
+		FROM %[1]s.webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY id DESC
+		LIMIT $2`,
+		schema)
+
+	var result []WebhookDelivery
+	if err := scanAll(ctx, tx, &result, sqlStatement, webhookID, limit); err != nil {
+		return nil, errors.Wrap(err, "problem listing webhook deliveries")
+	}
+	return result, nil
+}
+
+// RecordDeliveryAttempt logs an attempt and moves its delivery to status
+func (r *WebhookRepo) RecordDeliveryAttempt(ctx context.Context, tx Querier, schema string, a WebhookDeliveryAttempt, status string) error {
+	defer observe("WebhookRepo", "RecordDeliveryAttempt")()
+	if err := ValidateSchema(schema); err != nil {
+		return err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`WITH attempt AS (
+			INSERT INTO %[1]s.webhook_delivery_attempts
+			(delivery_id, status_code, error, response_body, duration_ms)
+			VALUES
+			($1, $2, $3, $4, $5)
+		)
+		UPDATE %[1]s.webhook_deliveries
+		SET status = $6, attempts = attempts + 1, last_status_code = $2, last_error = $3, updated_at = now()
+		WHERE id = $1`,
+		schema)
+
+	return execAffectingOne(ctx, tx, "problem recording webhook delivery attempt", sqlStatement,
+		a.DeliveryID, a.StatusCode, a.Error, a.ResponseBody, a.DurationMS, status)
+}
+
+// ListDeliveryAttempts gets every attempt of a delivery, oldest first
+func (r *WebhookRepo) ListDeliveryAttempts(ctx context.Context, tx Querier, schema string, deliveryID int64) ([]WebhookDeliveryAttempt, error) {
+	defer observe("WebhookRepo", "ListDeliveryAttempts")()
+	if err := ValidateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`SELECT id, delivery_id, status_code, error, response_body, duration_ms, created_at
+		FROM %[1]s.webhook_delivery_attempts
+		WHERE delivery_id = $1
+		ORDER BY id`,
+		schema)
+
+	var result []WebhookDeliveryAttempt
+	if err := scanAll(ctx, tx, &result, sqlStatement, deliveryID); err != nil {
+		return nil, errors.Wrap(err, "problem listing webhook delivery attempts")
+	}
+	return result, nil
+}
+
+// ResetDelivery puts a delivery back to pending with a fresh set of attempts, for replaying it. attempts already
+// made stay logged
+func (r *WebhookRepo) ResetDelivery(ctx context.Context, tx Querier, schema string, deliveryID int64) error {
+	defer observe("WebhookRepo", "ResetDelivery")()
+	if err := ValidateSchema(schema); err != nil {
+		return err
+	}
+
+	sqlStatement := fmt.Sprintf(
+		`UPDATE %[1]s.webhook_deliveries
+		SET status = 'pending', attempts = 0, updated_at = now()
+		WHERE id = $1`,
+		schema)
+
+	return execAffectingOne(ctx, tx, "problem resetting webhook delivery", sqlStatement, deliveryID)
+}
@@ -0,0 +1,42 @@
+package reporting
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// FileReporter writes each event to a json file, in the payload sentry would get. for trying out reporting locally
+type FileReporter struct {
+	dir         string
+	environment string
+}
+
+// NewFileReporter creates a new file reporter writing into dir
+func NewFileReporter(dir string, environment string) Reporter {
+	return &FileReporter{dir: dir, environment: environment}
+}
+
+// Report writes the event to a new file
+func (r *FileReporter) Report(ctx context.Context, e Event) error {
+	body, err := json.MarshalIndent(sentryEvent(e, r.environment, ""), "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "problem encoding event")
+	}
+
+	if err := os.MkdirAll(r.dir, 0o750); err != nil {
+		return errors.Wrap(err, "problem creating error report directory")
+	}
+	path := filepath.Join(r.dir, fmt.Sprintf("%s_%s.json", e.Time.Format("20060102T150405"), e.ID))
+	if err := os.WriteFile(path, body, 0o600); err != nil {
+		return errors.Wrap(err, "problem writing error report to file")
+	}
+
+	slog.InfoContext(ctx, "wrote error report to file", slog.String("path", path))
+	return nil
+}
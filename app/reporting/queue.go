@@ -0,0 +1,74 @@
+package reporting
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrQueueFull is returned when an event cannot be queued because the queue is at capacity
+var ErrQueueFull = errors.New("error report queue is full")
+
+// QueuedReporter is a Reporter that queues events in memory and reports them in the background, so a request that
+// panicked does not also wait on the reporting server. events still queued when the process dies are lost
+type QueuedReporter struct {
+	next  Reporter
+	queue chan queuedEvent
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// queuedEvent keeps the values of the ctx it was reported with, but not its cancellation
+type queuedEvent struct {
+	ctx   context.Context
+	event Event
+}
+
+// NewQueuedReporter wraps next with a queue of the given size, reported once Run is called
+func NewQueuedReporter(next Reporter, size int) *QueuedReporter {
+	return &QueuedReporter{next: next, queue: make(chan queuedEvent, size)}
+}
+
+// Report queues the event. it does not wait for the event to be reported
+func (r *QueuedReporter) Report(ctx context.Context, e Event) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return errors.New("error report queue is closed")
+	}
+
+	select {
+	case r.queue <- queuedEvent{ctx: context.WithoutCancel(ctx), event: e}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Run starts reporting queued events. it returns immediately, use Close to stop
+func (r *QueuedReporter) Run() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for q := range r.queue {
+			if err := r.next.Report(q.ctx, q.event); err != nil {
+				slog.ErrorContext(q.ctx, "problem reporting error", slog.String("event_id", q.event.ID), slog.Any("error", err))
+			}
+		}
+	}()
+}
+
+// Close stops accepting events and waits for queued ones to be reported
+func (r *QueuedReporter) Close() {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+}
@@ -0,0 +1,146 @@
+package reporting
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/logging"
+	"github.com/drmaples/starter-app/app/platform"
+)
+
+// reporters, see platform.ReportingConfig
+const (
+	ReporterNone   = "none"
+	ReporterFile   = "file"
+	ReporterSentry = "sentry"
+)
+
+// maxFrames caps how much of a stack is kept
+const maxFrames = 64
+
+// modulePath is this app's module, frames in it are ours rather than a dependency's
+var modulePath = strings.TrimSuffix(reflect.TypeOf(Event{}).PkgPath(), "/app/reporting")
+
+// Frame is one call in a stack trace
+type Frame struct {
+	Function string // e.g. github.com/drmaples/starter-app/app/controller.(*Controller).handleGetUser
+	File     string
+	Line     int
+}
+
+// InApp is whether the frame is this app's code
+func (f Frame) InApp() bool {
+	return strings.HasPrefix(f.Function, modulePath+"/")
+}
+
+// String formats the frame like a go stack trace line
+func (f Frame) String() string {
+	return fmt.Sprintf("%s %s:%d", f.Function, f.File, f.Line)
+}
+
+// Event is an error that needs someone to look at it, e.g. a recovered panic
+type Event struct {
+	ID        string // 32 hex characters, as sentry wants
+	Time      time.Time
+	Type      string // go type of the error or panic value, e.g. runtime.boundsError
+	Message   string
+	Stack     []Frame // outermost call first
+	RequestID string
+	Subject   string // hash of who the request was authenticated as, see SubjectHash
+	Method    string
+	Route     string
+	Path      string // no query, it can hold tokens, e.g. the realtime jwt or an oauth code
+}
+
+// NewEvent creates an event for err, with the request id and the subject in ctx hashed with subjectKey
+func NewEvent(ctx context.Context, err error, stack []Frame, subjectKey string) Event {
+	return Event{
+		ID:        strings.ReplaceAll(uuid.NewString(), "-", ""),
+		Time:      time.Now().UTC(),
+		Type:      fmt.Sprintf("%T", errors.Cause(err)),
+		Message:   err.Error(),
+		Stack:     stack,
+		RequestID: logging.RequestID(ctx),
+		Subject:   SubjectHash(subjectKey, logging.Subject(ctx)),
+	}
+}
+
+// SubjectHash identifies a subject without naming them, subjects are emails and events go to a third party. events
+// of the same user still share a hash. it is keyed with a server secret, a plain hash of an email could be matched
+// against hashes of known emails
+func SubjectHash(key string, subject string) string {
+	if subject == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(subject))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// PanicStack is the stack of the panic being recovered from, starting at the function that panicked. call it from
+// the deferred function that recovers
+func PanicStack() []Frame {
+	pcs := make([]uintptr, maxFrames)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var res []Frame
+	panicking := false
+	for {
+		frame, more := frames.Next()
+		if panicking {
+			res = append(res, Frame{Function: frame.Function, File: frame.File, Line: frame.Line})
+		}
+		// everything up to here is the recovering defer and the runtime's panic handling
+		if frame.Function == "runtime.gopanic" {
+			panicking = true
+		}
+		if !more {
+			break
+		}
+	}
+
+	// innermost first from the runtime
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res
+}
+
+// Reporter sends events where people will see them
+type Reporter interface {
+	Report(ctx context.Context, e Event) error
+}
+
+// New creates the reporter for the configured kind. it reports inline, wrap it with NewQueuedReporter to report in
+// the background
+func New(cfg platform.ReportingConfig, environment string) (Reporter, error) {
+	switch cfg.Reporter {
+	case ReporterNone:
+		return NopReporter{}, nil
+	case ReporterFile:
+		return NewFileReporter(cfg.FileDir, environment), nil
+	case ReporterSentry:
+		return NewSentryReporter(cfg.SentryDSN, environment, cfg.Timeout)
+	default:
+		return nil, errors.Errorf("unknown error reporter: %q", cfg.Reporter)
+	}
+}
+
+// NopReporter drops events, they are still logged where they happen
+type NopReporter struct{}
+
+// Report implements Reporter
+func (NopReporter) Report(context.Context, Event) error {
+	return nil
+}
@@ -0,0 +1,160 @@
+package reporting
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drmaples/starter-app/app/logging"
+)
+
+func panicky() {
+	var m map[string]int
+	m["boom"]++ // panics, assignment to nil map
+}
+
+func recoverStack() (stack []Frame) {
+	defer func() {
+		_ = recover()
+		stack = PanicStack()
+	}()
+	panicky()
+	return nil
+}
+
+func TestPanicStack(t *testing.T) {
+	stack := recoverStack()
+	assert.NotEmpty(t, stack)
+	// the runtime's map code is where it panicked, called from panicky
+	var innermost Frame
+	for _, f := range stack {
+		if f.InApp() {
+			innermost = f
+		}
+	}
+	assert.Equal(t, modulePath+"/app/reporting.panicky", innermost.Function, "starts where the panic happened")
+	assert.Equal(t, "reporting_test.go", filepath.Base(innermost.File))
+	for _, f := range stack {
+		assert.NotContains(t, f.Function, "runtime.gopanic")
+	}
+}
+
+const testSubjectKey = "subject-key"
+
+func testEvent() Event {
+	ctx := logging.WithSubject(logging.WithRequestID(context.Background(), "req-1"), "foo@example.com")
+	e := NewEvent(ctx, errors.New("boom"), []Frame{{Function: modulePath + "/app/controller.handle", File: "/src/handle.go", Line: 7}}, testSubjectKey)
+	e.Method, e.Route, e.Path = http.MethodGet, "/v1/user/:id", "/v1/user/1"
+	return e
+}
+
+func TestSubjectHash(t *testing.T) {
+	h := SubjectHash(testSubjectKey, "foo@example.com")
+	assert.Len(t, h, 32)
+	assert.Equal(t, h, SubjectHash(testSubjectKey, "foo@example.com"), "same user, same hash")
+	assert.NotEqual(t, h, SubjectHash("other-key", "foo@example.com"), "cannot be matched without the key")
+	assert.NotEqual(t, h, SubjectHash(testSubjectKey, "bar@example.com"))
+	assert.Empty(t, SubjectHash(testSubjectKey, ""))
+}
+
+func TestSentryReporter(t *testing.T) {
+	var path, auth string
+	var lines []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth = r.URL.Path, r.Header.Get("X-Sentry-Auth")
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		if strings.Contains(lines[len(lines)-1], "reject me") {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	dsn := strings.Replace(srv.URL, "://", "://pubkey@", 1) + "/sentry/42"
+	r, err := NewSentryReporter(dsn, "test", time.Second)
+	assert.NoError(t, err)
+
+	e := testEvent()
+	assert.NoError(t, r.Report(context.Background(), e))
+	assert.Equal(t, "/sentry/api/42/envelope/", path)
+	assert.Contains(t, auth, "sentry_key=pubkey")
+	assert.Len(t, lines, 3, "envelope header, item header, event")
+	assert.Contains(t, lines[0], `"event_id":"`+e.ID+`"`)
+	assert.Contains(t, lines[1], `"type":"event"`)
+
+	var event sentryPayload
+	assert.NoError(t, json.Unmarshal([]byte(lines[2]), &event))
+	assert.Equal(t, e.ID, event.EventID)
+	assert.Equal(t, "test", event.Environment)
+	assert.Equal(t, "boom", event.Exception.Values[0].Value)
+	assert.Equal(t, []sentryFrame{{
+		Function: modulePath + "/app/controller.handle",
+		Module:   modulePath + "/app/controller",
+		AbsPath:  "/src/handle.go",
+		Lineno:   7,
+		InApp:    true,
+	}}, event.Exception.Values[0].Stacktrace.Frames)
+	assert.Equal(t, &sentryRequest{URL: "/v1/user/1", Method: http.MethodGet}, event.Request)
+	assert.Equal(t, &sentryUser{ID: SubjectHash(testSubjectKey, "foo@example.com")}, event.User)
+	assert.NotContains(t, lines[2], "foo@example.com")
+	assert.Equal(t, map[string]string{"request_id": "req-1", "route": "/v1/user/:id"}, event.Tags)
+
+	e.Message = "reject me"
+	assert.ErrorContains(t, r.Report(context.Background(), e), "429")
+
+	for _, bad := range []string{"", "https://sentry.io/42", "https://key@sentry.io/", "://"} {
+		_, err := NewSentryReporter(bad, "test", time.Second)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestFileReporter(t *testing.T) {
+	dir := t.TempDir()
+	e := testEvent()
+	assert.NoError(t, NewFileReporter(dir, "dev").Report(context.Background(), e))
+
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	body, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), e.ID)
+	assert.Contains(t, string(body), `"environment": "dev"`)
+}
+
+type recordingReporter struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recordingReporter) Report(_ context.Context, e Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+	return nil
+}
+
+func TestQueuedReporter(t *testing.T) {
+	next := &recordingReporter{}
+	q := NewQueuedReporter(next, 1)
+	assert.NoError(t, q.Report(context.Background(), Event{ID: "1"}))
+	assert.ErrorIs(t, q.Report(context.Background(), Event{ID: "2"}), ErrQueueFull, "not running yet")
+
+	q.Run()
+	q.Close()
+	assert.Equal(t, []Event{{ID: "1"}}, next.events, "queued events are reported before Close returns")
+	assert.Error(t, q.Report(context.Background(), Event{ID: "3"}))
+}
@@ -0,0 +1,195 @@
+package reporting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const sentryClient = "starter-app/1.0"
+
+// SentryReporter sends events to a sentry compatible server, e.g. sentry.io or a self-hosted glitchtip, through its
+// envelope endpoint
+type SentryReporter struct {
+	dsn         string
+	endpoint    string
+	auth        string
+	environment string
+	serverName  string
+	client      *http.Client
+}
+
+// NewSentryReporter creates a reporter for a project's dsn, e.g. https://key@o0.ingest.sentry.io/42
+func NewSentryReporter(dsn string, environment string, timeout time.Duration) (*SentryReporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.User.Username() == "" || u.Host == "" {
+		return nil, errors.New("invalid sentry dsn, want scheme://key@host/project")
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	project := path[slash+1:]
+	if project == "" {
+		return nil, errors.New("invalid sentry dsn, project id missing")
+	}
+
+	auth := fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s, sentry_key=%s", sentryClient, u.User.Username())
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+	serverName, _ := os.Hostname()
+	return &SentryReporter{
+		dsn:         dsn,
+		endpoint:    fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, path[:slash], project),
+		auth:        auth,
+		environment: environment,
+		serverName:  serverName,
+		client:      &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Report implements Reporter
+func (r *SentryReporter) Report(ctx context.Context, e Event) error {
+	event, err := json.Marshal(sentryEvent(e, r.environment, r.serverName))
+	if err != nil {
+		return errors.Wrap(err, "problem encoding sentry event")
+	}
+	header, err := json.Marshal(map[string]string{
+		"event_id": e.ID,
+		"sent_at":  time.Now().UTC().Format(time.RFC3339),
+		"dsn":      r.dsn,
+	})
+	if err != nil {
+		return errors.Wrap(err, "problem encoding sentry envelope")
+	}
+
+	// an envelope is newline separated json: its header, then each item's header and payload
+	var body bytes.Buffer
+	body.Write(header)
+	fmt.Fprintf(&body, "\n{\"type\":\"event\",\"length\":%d}\n", len(event))
+	body.Write(event)
+	body.WriteString("\n")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, &body)
+	if err != nil {
+		return errors.Wrap(err, "problem creating sentry request")
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", r.auth)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "problem sending event to sentry")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return errors.Errorf("sentry rejected event: %d %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// sentry's event payload, https://develop.sentry.dev/sdk/data-model/event-payloads/
+type sentryPayload struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Level       string            `json:"level"`
+	Environment string            `json:"environment,omitempty"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Exception   sentryExceptions  `json:"exception"`
+	Request     *sentryRequest    `json:"request,omitempty"`
+	User        *sentryUser       `json:"user,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryException struct {
+	Type       string            `json:"type"`
+	Value      string            `json:"value"`
+	Mechanism  sentryMechanism   `json:"mechanism"`
+	Stacktrace *sentryStacktrace `json:"stacktrace,omitempty"`
+}
+
+type sentryMechanism struct {
+	Type    string `json:"type"`
+	Handled bool   `json:"handled"`
+}
+
+type sentryStacktrace struct {
+	Frames []sentryFrame `json:"frames"`
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+type sentryRequest struct {
+	URL    string `json:"url,omitempty"`
+	Method string `json:"method,omitempty"`
+}
+
+type sentryUser struct {
+	ID string `json:"id"`
+}
+
+func sentryEvent(e Event, environment string, serverName string) sentryPayload {
+	res := sentryPayload{
+		EventID:     e.ID,
+		Timestamp:   e.Time.Format(time.RFC3339Nano),
+		Platform:    "go",
+		Level:       "error",
+		Environment: environment,
+		ServerName:  serverName,
+		Exception: sentryExceptions{Values: []sentryException{{
+			Type:      e.Type,
+			Value:     e.Message,
+			Mechanism: sentryMechanism{Type: "panic", Handled: false},
+		}}},
+		Tags: map[string]string{},
+	}
+	if len(e.Stack) > 0 {
+		frames := make([]sentryFrame, len(e.Stack))
+		for i, f := range e.Stack {
+			frames[i] = sentryFrame{Function: f.Function, Module: module(f.Function), AbsPath: f.File, Lineno: f.Line, InApp: f.InApp()}
+		}
+		res.Exception.Values[0].Stacktrace = &sentryStacktrace{Frames: frames}
+	}
+	if e.Path != "" || e.Method != "" {
+		res.Request = &sentryRequest{URL: e.Path, Method: e.Method}
+	}
+	if e.Subject != "" {
+		res.User = &sentryUser{ID: e.Subject}
+	}
+	if e.RequestID != "" {
+		res.Tags["request_id"] = e.RequestID
+	}
+	if e.Route != "" {
+		res.Tags["route"] = e.Route
+	}
+	return res
+}
+
+// module is the package a function is in, e.g. github.com/drmaples/starter-app/app/controller
+func module(function string) string {
+	slash := strings.LastIndex(function, "/")
+	if dot := strings.Index(function[slash+1:], "."); dot >= 0 {
+		return function[:slash+1+dot]
+	}
+	return ""
+}
@@ -0,0 +1,233 @@
+package stream
+
+import (
+	"context"
+	"database/sql/driver"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+const (
+	defaultPollInterval  = 5 * time.Second
+	defaultRetryInterval = 5 * time.Second
+	defaultBatchSize     = 500
+	defaultBuffer        = 64
+)
+
+// HubOptions controls a Hub. zero values use the defaults
+type HubOptions struct {
+	PollInterval  time.Duration // reads the log even without a notification, in case one was missed
+	RetryInterval time.Duration // wait before listening again after the connection fails
+	BatchSize     int           // events read from the log at a time
+	Buffer        int           // events buffered per subscription before it is dropped as too slow
+}
+
+func (o HubOptions) withDefaults() HubOptions {
+	if o.PollInterval <= 0 {
+		o.PollInterval = defaultPollInterval
+	}
+	if o.RetryInterval <= 0 {
+		o.RetryInterval = defaultRetryInterval
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = defaultBatchSize
+	}
+	if o.Buffer <= 0 {
+		o.Buffer = defaultBuffer
+	}
+	return o
+}
+
+// Hub follows the event log and fans new events out to subscribers. every server replica runs its own hub, postgres
+// LISTEN/NOTIFY tells each of them when events are appended
+type Hub struct {
+	db           *repo.DB
+	eventLogRepo repo.IEventLogRepo
+	opts         HubOptions
+
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	lastID int64
+	closed bool
+}
+
+// NewHub creates a new hub
+func NewHub(db *repo.DB, eventLogRepo repo.IEventLogRepo, opts HubOptions) *Hub {
+	return &Hub{
+		db:           db,
+		eventLogRepo: eventLogRepo,
+		opts:         opts.withDefaults(),
+		subs:         map[*Subscription]struct{}{},
+		lastID:       -1,
+	}
+}
+
+// Subscription receives a tenant's events as they are logged. C is closed when the subscription is closed, or
+// dropped because the subscriber fell too far behind. a dropped subscriber can resume from the log with Replay
+type Subscription struct {
+	C <-chan repo.EventLogEntry
+
+	ch     chan repo.EventLogEntry
+	tenant string
+	hub    *Hub
+}
+
+// Subscribe starts receiving a tenant's events. the subscription is already closed once the hub is closed
+func (h *Hub) Subscribe(tenant string) *Subscription {
+	ch := make(chan repo.EventLogEntry, h.opts.Buffer)
+	sub := &Subscription{C: ch, ch: ch, tenant: tenant, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(ch)
+		return sub
+	}
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+// Close ends every subscription and refuses new ones, so open streams finish when the server shuts down. Run keeps
+// following the log until its ctx is done
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subs {
+		h.remove(sub)
+	}
+}
+
+// Close stops the subscription. safe to call more than once
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// remove must be called with mu held
+func (h *Hub) remove(sub *Subscription) {
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// Replay gets up to limit of a tenant's logged events after an id, for resuming a stream
+func (h *Hub) Replay(ctx context.Context, tenant string, afterID int64, limit int) ([]repo.EventLogEntry, error) {
+	return h.eventLogRepo.ListEvents(ctx, h.db, repo.DefaultSchema, tenant, afterID, limit)
+}
+
+// Run listens for appended events until ctx is done, reconnecting when the connection fails
+func (h *Hub) Run(ctx context.Context) {
+	slog.InfoContext(ctx, "starting event stream hub")
+	for ctx.Err() == nil {
+		if err := h.listen(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "problem listening for events", slog.Any("error", err))
+			select {
+			case <-ctx.Done():
+			case <-time.After(h.opts.RetryInterval):
+			}
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		h.remove(sub)
+	}
+	slog.InfoContext(ctx, "stopped event stream hub")
+}
+
+// listen holds a dedicated connection LISTENing on repo.EventLogChannel, reading the log on every notification
+func (h *Hub) listen(ctx context.Context) error {
+	conn, err := h.db.SQL.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "problem getting connection to listen on")
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) (err error) {
+		pgConn := driverConn.(*stdlib.Conn).Conn()
+		if _, err := pgConn.Exec(ctx, "LISTEN "+repo.EventLogChannel); err != nil {
+			return errors.Wrap(err, "problem listening for events")
+		}
+		defer func() {
+			// the connection goes back to the pool, it must not keep receiving notifications
+			unlistenCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if _, uErr := pgConn.Exec(unlistenCtx, "UNLISTEN *"); uErr != nil && err == nil {
+				slog.WarnContext(ctx, "problem unlistening, discarding connection", slog.Any("error", uErr))
+				err = driver.ErrBadConn
+			}
+		}()
+
+		// catch up on anything appended while not listening
+		if err := h.poll(ctx); err != nil {
+			return err
+		}
+		for {
+			waitCtx, cancel := context.WithTimeout(ctx, h.opts.PollInterval)
+			_, err := pgConn.WaitForNotification(waitCtx)
+			cancel()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+				return errors.Wrap(err, "problem waiting for event notification")
+			}
+			// notifications only say something was appended, the log is the source of truth
+			if err := h.poll(ctx); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// poll reads events appended since the last poll and broadcasts them. the first poll only finds where the log ends,
+// subscribers wanting history use Replay
+func (h *Hub) poll(ctx context.Context) error {
+	if h.lastID < 0 {
+		id, err := h.eventLogRepo.LatestEventID(ctx, h.db, repo.DefaultSchema)
+		if err != nil {
+			return err
+		}
+		h.lastID = id
+	}
+	for {
+		entries, err := h.eventLogRepo.ListEvents(ctx, h.db, repo.DefaultSchema, "", h.lastID, h.opts.BatchSize)
+		if err != nil {
+			return err
+		}
+		h.broadcast(entries)
+		if len(entries) < h.opts.BatchSize {
+			return nil
+		}
+	}
+}
+
+func (h *Hub) broadcast(entries []repo.EventLogEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range entries {
+		for sub := range h.subs {
+			if sub.tenant != e.Tenant {
+				continue
+			}
+			select {
+			case sub.ch <- e:
+			default:
+				// never block the hub on one slow subscriber
+				slog.Warn("dropping slow event stream subscriber", slog.String("tenant", sub.tenant))
+				h.remove(sub)
+			}
+		}
+		h.lastID = e.ID
+	}
+}
@@ -0,0 +1,156 @@
+package stream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drmaples/starter-app/app/events"
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+type fakeEventLogRepo struct {
+	entries []repo.EventLogEntry
+}
+
+func (r *fakeEventLogRepo) AppendEvent(_ context.Context, _ repo.Querier, _ string, e repo.EventLogEntry) error {
+	for _, existing := range r.entries {
+		if existing.EventID == e.EventID {
+			return nil
+		}
+	}
+	e.ID = int64(len(r.entries) + 1)
+	r.entries = append(r.entries, e)
+	return nil
+}
+
+func (r *fakeEventLogRepo) ListEvents(_ context.Context, _ repo.Querier, _ string, tenant string, afterID int64, limit int) ([]repo.EventLogEntry, error) {
+	var res []repo.EventLogEntry
+	for _, e := range r.entries {
+		if e.ID > afterID && (tenant == "" || e.Tenant == tenant) && len(res) < limit {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+func (r *fakeEventLogRepo) LatestEventID(_ context.Context, _ repo.Querier, _ string) (int64, error) {
+	return int64(len(r.entries)), nil
+}
+
+func (r *fakeEventLogRepo) DeleteEventsBefore(_ context.Context, _ repo.Querier, _ string, _ time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (r *fakeEventLogRepo) append(t *testing.T, tenant string) {
+	env, err := events.New(events.TypeUserCreated, tenant, "user/1", events.UserCreated{})
+	assert.NoError(t, err)
+	entry, err := entryFromEnvelope(env)
+	assert.NoError(t, err)
+	assert.NoError(t, r.AppendEvent(context.Background(), nil, repo.DefaultSchema, entry))
+}
+
+func receive(sub *Subscription) []int64 {
+	var ids []int64
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return ids
+			}
+			ids = append(ids, e.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func TestHub_poll(t *testing.T) {
+	ctx := context.Background()
+	r := &fakeEventLogRepo{}
+	r.append(t, "tenant_a")
+
+	h := NewHub(nil, r, HubOptions{BatchSize: 2})
+	a := h.Subscribe("tenant_a")
+	b := h.Subscribe("tenant_b")
+
+	// history is only for Replay
+	assert.NoError(t, h.poll(ctx))
+	assert.Empty(t, receive(a))
+
+	for _, tenant := range []string{"tenant_a", "tenant_b", "tenant_a", "tenant_a"} {
+		r.append(t, tenant)
+	}
+	assert.NoError(t, h.poll(ctx))
+	assert.Equal(t, []int64{2, 4, 5}, receive(a), "paged through every batch")
+	assert.Equal(t, []int64{3}, receive(b))
+
+	assert.NoError(t, h.poll(ctx))
+	assert.Empty(t, receive(a))
+
+	replayed, err := h.Replay(ctx, "tenant_a", 2, 10)
+	assert.NoError(t, err)
+	assert.Len(t, replayed, 2)
+
+	b.Close()
+	b.Close()
+	_, ok := <-b.C
+	assert.False(t, ok)
+}
+
+func TestHub_drops_slow_subscriber(t *testing.T) {
+	ctx := context.Background()
+	r := &fakeEventLogRepo{}
+	h := NewHub(nil, r, HubOptions{Buffer: 2})
+	assert.NoError(t, h.poll(ctx))
+
+	slow := h.Subscribe("tenant_a")
+	fast := h.Subscribe("tenant_a")
+	for range 3 {
+		r.append(t, "tenant_a")
+		assert.NoError(t, h.poll(ctx))
+		receive(fast)
+	}
+
+	// the buffered events are still readable, then the channel is closed
+	assert.Equal(t, []int64{1, 2}, receive(slow))
+	_, ok := <-slow.C
+	assert.False(t, ok)
+
+	r.append(t, "tenant_a")
+	assert.NoError(t, h.poll(ctx))
+	assert.Equal(t, []int64{4}, receive(fast))
+	slow.Close() // closing a dropped subscription is fine
+}
+
+func TestHub_Close(t *testing.T) {
+	h := NewHub(nil, &fakeEventLogRepo{}, HubOptions{})
+	a := h.Subscribe("tenant_a")
+
+	h.Close()
+	_, ok := <-a.C
+	assert.False(t, ok)
+
+	// subscribing after close gets a closed subscription so a stream handler returns straight away
+	b := h.Subscribe("tenant_a")
+	_, ok = <-b.C
+	assert.False(t, ok)
+	b.Close()
+}
+
+func TestEntryFromEnvelope(t *testing.T) {
+	r := &fakeEventLogRepo{}
+	env, err := events.New(events.TypeUserDeleted, "tenant_a", "user/7", events.UserDeleted{User: events.User{ID: 7}})
+	assert.NoError(t, err)
+
+	entry, err := entryFromEnvelope(env)
+	assert.NoError(t, err)
+	assert.Equal(t, env.ID, entry.EventID)
+	assert.Equal(t, events.TypeUserDeleted, entry.EventType)
+	assert.Equal(t, "tenant_a", entry.Tenant)
+	assert.Equal(t, "user/7", entry.Subject)
+	assert.Contains(t, string(entry.Payload), `"data":{"user":{"id":7`)
+	assert.Equal(t, SinkName, NewSink(nil, r).Name())
+}
@@ -0,0 +1,58 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/events"
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+// SinkName is the name of the stream sink, see platform.OutboxConfig
+const SinkName = "stream"
+
+// Sink is an events.Sink that appends events to the event log, notifying every Hub listening
+type Sink struct {
+	db           repo.TxBeginner
+	eventLogRepo repo.IEventLogRepo
+}
+
+// NewSink creates a new stream sink
+func NewSink(db repo.TxBeginner, eventLogRepo repo.IEventLogRepo) events.Sink {
+	return &Sink{
+		db:           db,
+		eventLogRepo: eventLogRepo,
+	}
+}
+
+// Name of the sink
+func (s *Sink) Name() string {
+	return SinkName
+}
+
+// Publish appends the event to the event log. publishing the same event again does nothing
+func (s *Sink) Publish(ctx context.Context, env events.Envelope) error {
+	entry, err := entryFromEnvelope(env)
+	if err != nil {
+		return err
+	}
+	return repo.WithTx(ctx, s.db, nil, func(tx repo.Querier) error {
+		return s.eventLogRepo.AppendEvent(ctx, tx, repo.DefaultSchema, entry)
+	})
+}
+
+func entryFromEnvelope(env events.Envelope) (repo.EventLogEntry, error) {
+	b, err := json.Marshal(env)
+	if err != nil {
+		return repo.EventLogEntry{}, errors.Wrap(err, "problem marshalling event for event log")
+	}
+	return repo.EventLogEntry{
+		EventID:   env.ID,
+		EventType: env.Type,
+		Tenant:    env.Tenant,
+		Subject:   env.Subject,
+		Payload:   b,
+	}, nil
+}
@@ -0,0 +1,105 @@
+package tracing
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/drmaples/starter-app/app/platform"
+)
+
+const callerTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// record installs a tracer provider that keeps ended spans in memory
+func record(t *testing.T) *tracetest.SpanRecorder {
+	_, err := Setup(context.Background(), platform.TracingConfig{Exporter: ExporterNone})
+	assert.NoError(t, err)
+
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	return sr
+}
+
+func TestSetup(t *testing.T) {
+	_, err := Setup(context.Background(), platform.TracingConfig{Exporter: "zipkin"})
+	assert.ErrorContains(t, err, "unknown tracing exporter")
+}
+
+func TestMiddleware(t *testing.T) {
+	sr := record(t)
+
+	e := echo.New()
+	e.Use(Middleware())
+	var handlerSpan trace.SpanContext
+	e.GET("/v1/user/:id", func(c echo.Context) error {
+		handlerSpan = trace.SpanContextFromContext(c.Request().Context())
+		return echo.NewHTTPError(http.StatusInternalServerError, "boom")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/user/7", nil)
+	req.Header.Set("traceparent", callerTraceparent)
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := sr.Ended()
+	assert.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "GET /v1/user/:id", span.Name())
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String(), "continues the caller's trace")
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	assert.Equal(t, span.SpanContext().SpanID(), handlerSpan.SpanID(), "handlers get the span in their ctx")
+	assert.Contains(t, span.Attributes(), semconv.HTTPRoute("/v1/user/:id"))
+	assert.Contains(t, span.Attributes(), semconv.HTTPResponseStatusCode(http.StatusInternalServerError))
+	assert.Equal(t, codes.Error, span.Status().Code)
+}
+
+func TestTransport(t *testing.T) {
+	sr := record(t)
+
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	ctx, parent := Start(context.Background(), "parent")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/hook", nil)
+	assert.NoError(t, err)
+	resp, err := (&http.Client{Transport: Transport(http.DefaultTransport)}).Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	parent.End()
+
+	spans := sr.Ended()
+	assert.Len(t, spans, 2)
+	client := spans[0]
+	assert.Equal(t, trace.SpanKindClient, client.SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), client.Parent().SpanID())
+	assert.Contains(t, got, client.SpanContext().TraceID().String(), "trace is passed on to the server")
+	assert.Contains(t, got, client.SpanContext().SpanID().String())
+	assert.Contains(t, client.Attributes(), semconv.HTTPResponseStatusCode(http.StatusAccepted))
+}
+
+func TestLogAttrs(t *testing.T) {
+	record(t)
+	ctx, span := Start(context.Background(), "op")
+	defer span.End()
+
+	assert.Equal(t, []slog.Attr{
+		slog.String("trace_id", span.SpanContext().TraceID().String()),
+		slog.String("span_id", span.SpanContext().SpanID().String()),
+	}, LogAttrs(ctx))
+	assert.Empty(t, LogAttrs(context.Background()))
+}
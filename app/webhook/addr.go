@@ -0,0 +1,98 @@
+package webhook
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrPrivateAddress is returned for a webhook url that resolves to, or a delivery that connects to, an address that
+// is not public, e.g. loopback, a private network or cloud metadata
+var ErrPrivateAddress = errors.New("webhook address is not public")
+
+// nonPublicPrefixes are special purpose ranges netip does not have a method for, see RFC 6890
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier grade nat
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // nat64, embeds any ipv4 address
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// isPublic reports whether ip is a unicast address on the public internet
+func isPublic(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, p := range nonPublicPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL refuses a webhook url whose host is, or resolves to, an address that is not public. it only catches
+// mistakes and obvious abuse when the url is saved, DNS can change afterwards, so deliveries check again on connect
+func CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.Wrap(err, "problem parsing webhook url")
+	}
+	host := u.Hostname()
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !isPublic(ip) {
+			return ErrPrivateAddress
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return errors.Wrapf(err, "problem resolving webhook host %s", host)
+	}
+	for _, ip := range addrs {
+		if !isPublic(ip) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// dialControl refuses connections to addresses that are not public. it runs on the address actually dialed, after
+// DNS, so a host that resolved to a public address when saved cannot be rebound to a private one
+func dialControl(_, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return errors.Wrapf(err, "problem parsing dialed address %s", address)
+	}
+	if !isPublic(ap.Addr()) {
+		return errors.Wrapf(ErrPrivateAddress, "refusing to connect to %s", ap.Addr())
+	}
+	return nil
+}
+
+// publicTransport is an http.DefaultTransport that only connects to public addresses. it uses no proxy, as the
+// proxy's address would be the one checked
+func publicTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   dialControl,
+	}).DialContext
+	return t
+}
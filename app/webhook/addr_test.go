@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPublic(t *testing.T) {
+	for addr, expected := range map[string]bool{
+		"93.184.216.34":          true,
+		"2606:2800:220:1::":      true,
+		"127.0.0.1":              false,
+		"10.1.2.3":               false,
+		"172.16.0.1":             false,
+		"192.168.1.1":            false,
+		"169.254.169.254":        false, // cloud metadata
+		"100.64.0.1":             false,
+		"0.0.0.0":                false,
+		"255.255.255.255":        false,
+		"::1":                    false,
+		"fd00::1":                false,
+		"fe80::1":                false,
+		"::ffff:127.0.0.1":       false,
+		"::ffff:169.254.169.254": false,
+		"64:ff9b::a9fe:a9fe":     false,
+	} {
+		assert.Equal(t, expected, isPublic(netip.MustParseAddr(addr)), addr)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, CheckURL(ctx, "https://93.184.216.34/hook"))
+	assert.ErrorIs(t, CheckURL(ctx, "http://169.254.169.254/latest/meta-data"), ErrPrivateAddress)
+	assert.ErrorIs(t, CheckURL(ctx, "http://[::1]:8080/"), ErrPrivateAddress)
+	assert.ErrorIs(t, CheckURL(ctx, "http://localhost:8080/"), ErrPrivateAddress)
+}
+
+func TestPublicTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	// a loopback receiver is refused on connect, whatever the url said when it was saved
+	client := &http.Client{Transport: publicTransport(), Timeout: time.Second}
+	_, err := client.Get(srv.URL)
+	assert.ErrorIs(t, err, ErrPrivateAddress)
+}
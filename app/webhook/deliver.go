@@ -0,0 +1,202 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/jobs"
+	"github.com/drmaples/starter-app/app/repo"
+	"github.com/drmaples/starter-app/app/tracing"
+)
+
+// KindDeliver is the job kind that makes one delivery attempt
+const KindDeliver = "webhook.deliver"
+
+const (
+	defaultMaxAttempts     = 8
+	defaultDeliveryTimeout = 10 * time.Second
+	maxResponseBodyLog     = 1024 // kept for operators, never returned by the api
+	userAgent              = "starter-app-webhooks/1"
+
+	// jobMaxAttempts keeps a delivery's job retrying, the delivery's own attempts decide when to give up. a job
+	// failing before it records an attempt, e.g. on the db, must not use them up, or the delivery would stay pending
+	// for good once its job is dead lettered. retries are spaced out by the job queue's max backoff
+	jobMaxAttempts = math.MaxInt32
+)
+
+// DeliverPayload is the payload of a KindDeliver job
+type DeliverPayload struct {
+	Schema     string `json:"schema"`
+	DeliveryID int64  `json:"delivery_id"`
+}
+
+// Options controls delivery. zero values use the defaults
+type Options struct {
+	MaxAttempts  int           // attempts before a delivery is marked failed
+	Timeout      time.Duration // per request
+	AllowPrivate bool          // deliver to loopback and private addresses, for local development and tests
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = defaultMaxAttempts
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaultDeliveryTimeout
+	}
+	return o
+}
+
+// Deliverer sends deliveries. each attempt is a job so retries get the job queue's backoff
+type Deliverer struct {
+	db          repo.Querier
+	webhookRepo repo.IWebhookRepo
+	jobClient   *jobs.Client
+	client      *http.Client
+	opts        Options
+}
+
+// NewDeliverer creates a new deliverer
+func NewDeliverer(db repo.Querier, webhookRepo repo.IWebhookRepo, jobClient *jobs.Client, opts Options) *Deliverer {
+	opts = opts.withDefaults()
+	var transport http.RoundTripper = publicTransport()
+	if opts.AllowPrivate {
+		transport = http.DefaultTransport
+	}
+	return &Deliverer{
+		db:          db,
+		webhookRepo: webhookRepo,
+		jobClient:   jobClient,
+		client: &http.Client{
+			Timeout:   opts.Timeout,
+			Transport: tracing.Transport(transport),
+			// a redirect could point the signed request anywhere, treat it as a failed attempt instead
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		opts: opts,
+	}
+}
+
+// Register registers the KindDeliver job handler
+func Register(w *jobs.Worker, d *Deliverer) {
+	jobs.Register(w, KindDeliver, d.Deliver)
+}
+
+// Enqueue queues an attempt for a pending delivery. a delivery already queued is not queued again
+func (d *Deliverer) Enqueue(ctx context.Context, schema string, deliveryID int64) error {
+	return d.EnqueueTx(ctx, d.db, schema, deliveryID)
+}
+
+// EnqueueTx queues an attempt for a pending delivery as part of tx, so it is only queued if tx commits
+func (d *Deliverer) EnqueueTx(ctx context.Context, tx repo.Querier, schema string, deliveryID int64) error {
+	_, err := d.jobClient.EnqueueTx(ctx, tx, KindDeliver, DeliverPayload{Schema: schema, DeliveryID: deliveryID}, jobs.EnqueueOptions{
+		UniqueKey:   fmt.Sprintf("%s:%s:%d", KindDeliver, schema, deliveryID),
+		MaxAttempts: jobMaxAttempts,
+	})
+	if errors.Is(err, repo.ErrDuplicateJob) {
+		return nil
+	}
+	return err
+}
+
+// Deliver makes one attempt at a delivery and logs it. a failed attempt returns an error so the job is retried,
+// until the delivery runs out of attempts and is marked failed
+func (d *Deliverer) Deliver(ctx context.Context, p DeliverPayload) error {
+	del, err := d.webhookRepo.GetDelivery(ctx, d.db, p.Schema, p.DeliveryID)
+	if err != nil {
+		if errors.Is(err, repo.ErrNoRowsFound) {
+			return jobs.Permanent(errors.Errorf("webhook delivery %d not found", p.DeliveryID))
+		}
+		return err
+	}
+	if del.Status != repo.WebhookDeliveryPending {
+		return nil // already delivered or given up on, e.g. a duplicate job
+	}
+	wh, err := d.webhookRepo.GetWebhook(ctx, d.db, p.Schema, del.WebhookID)
+	if err != nil {
+		if errors.Is(err, repo.ErrNoRowsFound) {
+			return jobs.Permanent(errors.Errorf("webhook %d not found", del.WebhookID))
+		}
+		return err
+	}
+
+	attempt := d.send(ctx, wh, del)
+	status := repo.WebhookDeliverySucceeded
+	var sendErr error
+	if attempt.Error != nil {
+		sendErr = errors.New(*attempt.Error)
+		status = repo.WebhookDeliveryPending
+		// a disabled webhook is not retried, the delivery can be replayed once it is enabled again
+		if !wh.Active || del.Attempts+1 >= d.opts.MaxAttempts {
+			status = repo.WebhookDeliveryFailed
+		}
+	}
+	if err := d.webhookRepo.RecordDeliveryAttempt(ctx, d.db, p.Schema, attempt, status); err != nil {
+		return err
+	}
+
+	switch status {
+	case repo.WebhookDeliverySucceeded:
+		return nil
+	case repo.WebhookDeliveryFailed:
+		slog.WarnContext(ctx, "giving up on webhook delivery",
+			slog.Int64("delivery_id", del.ID),
+			slog.Int("webhook_id", wh.ID),
+			slog.Any("error", sendErr),
+		)
+		return jobs.Permanent(sendErr)
+	default:
+		return sendErr
+	}
+}
+
+// send makes the http request, describing the outcome as an attempt
+func (d *Deliverer) send(ctx context.Context, wh *repo.Webhook, del *repo.WebhookDelivery) repo.WebhookDeliveryAttempt {
+	attempt := repo.WebhookDeliveryAttempt{DeliveryID: del.ID}
+	fail := func(err error) repo.WebhookDeliveryAttempt {
+		msg := err.Error()
+		attempt.Error = &msg
+		return attempt
+	}
+
+	if !wh.Active {
+		return fail(errors.New("webhook is disabled"))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(del.Payload))
+	if err != nil {
+		return fail(errors.Wrap(err, "problem building request"))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	SetHeaders(req.Header, wh.Secret, del.EventID, time.Now(), del.Payload)
+
+	start := time.Now()
+	resp, err := d.client.Do(req)
+	attempt.DurationMS = int(time.Since(start).Milliseconds())
+	if err != nil {
+		return fail(errors.Wrap(err, "problem sending request"))
+	}
+	defer resp.Body.Close()
+
+	code := resp.StatusCode
+	attempt.StatusCode = &code
+	if b, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBodyLog)); err == nil && len(b) > 0 {
+		// postgres text rejects invalid utf8 and NUL
+		body := strings.ReplaceAll(strings.ToValidUTF8(string(b), "\uFFFD"), "\x00", "")
+		attempt.ResponseBody = &body
+	}
+	if code < 200 || code > 299 {
+		return fail(errors.Errorf("receiver responded with status %d", code))
+	}
+	return attempt
+}
@@ -0,0 +1,270 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drmaples/starter-app/app/events"
+	"github.com/drmaples/starter-app/app/jobs"
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+// fakeWebhookRepo keeps webhooks and deliveries in memory. methods not used by the package panic
+type fakeWebhookRepo struct {
+	repo.IWebhookRepo
+
+	hooks      map[int]repo.Webhook
+	deliveries map[int64]*repo.WebhookDelivery
+	attempts   []repo.WebhookDeliveryAttempt
+}
+
+func newFakeWebhookRepo(hooks ...repo.Webhook) *fakeWebhookRepo {
+	r := &fakeWebhookRepo{hooks: map[int]repo.Webhook{}, deliveries: map[int64]*repo.WebhookDelivery{}}
+	for _, wh := range hooks {
+		r.hooks[wh.ID] = wh
+	}
+	return r
+}
+
+func (r *fakeWebhookRepo) GetWebhook(_ context.Context, _ repo.Querier, _ string, webhookID int) (*repo.Webhook, error) {
+	wh, ok := r.hooks[webhookID]
+	if !ok {
+		return nil, repo.ErrNoRowsFound
+	}
+	return &wh, nil
+}
+
+func (r *fakeWebhookRepo) ListWebhooksForUserEvent(_ context.Context, _ repo.Querier, _ string, _ int, _ string) ([]repo.Webhook, error) {
+	var res []repo.Webhook
+	for _, wh := range r.hooks {
+		res = append(res, wh)
+	}
+	return res, nil
+}
+
+func (r *fakeWebhookRepo) CreateDelivery(_ context.Context, _ repo.Querier, _ string, d repo.WebhookDelivery) (*repo.WebhookDelivery, error) {
+	for _, existing := range r.deliveries {
+		if existing.WebhookID == d.WebhookID && existing.EventID == d.EventID {
+			return existing, nil
+		}
+	}
+	d.ID = int64(len(r.deliveries) + 1)
+	d.Status = repo.WebhookDeliveryPending
+	r.deliveries[d.ID] = &d
+	return &d, nil
+}
+
+func (r *fakeWebhookRepo) GetDelivery(_ context.Context, _ repo.Querier, _ string, deliveryID int64) (*repo.WebhookDelivery, error) {
+	d, ok := r.deliveries[deliveryID]
+	if !ok {
+		return nil, repo.ErrNoRowsFound
+	}
+	res := *d
+	return &res, nil
+}
+
+func (r *fakeWebhookRepo) RecordDeliveryAttempt(_ context.Context, _ repo.Querier, _ string, a repo.WebhookDeliveryAttempt, status string) error {
+	r.attempts = append(r.attempts, a)
+	d := r.deliveries[a.DeliveryID]
+	d.Attempts++
+	d.Status = status
+	d.LastStatusCode = a.StatusCode
+	d.LastError = a.Error
+	return nil
+}
+
+// fakeJobRepo records enqueued jobs, rejecting a second live job with the same unique key
+type fakeJobRepo struct {
+	repo.IJobRepo
+
+	jobs []repo.Job
+}
+
+func (r *fakeJobRepo) EnqueueJob(_ context.Context, _ repo.Querier, _ string, j repo.Job) (*repo.Job, error) {
+	for _, existing := range r.jobs {
+		if j.UniqueKey != nil && existing.UniqueKey != nil && *existing.UniqueKey == *j.UniqueKey {
+			return nil, repo.ErrDuplicateJob
+		}
+	}
+	r.jobs = append(r.jobs, j)
+	return &j, nil
+}
+
+type receiver struct {
+	*httptest.Server
+	statuses []int // status to respond with per request, the last one repeats
+	requests int
+	errs     []error
+}
+
+// newReceiver starts a server that verifies each delivery like a real receiver would
+func newReceiver(t *testing.T, secret string, statuses ...int) *receiver {
+	rcv := &receiver{statuses: statuses}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := Verify(secret, r.Header, body, DefaultTolerance, time.Now()); err != nil {
+			rcv.errs = append(rcv.errs, err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		status := rcv.statuses[min(rcv.requests, len(rcv.statuses)-1)]
+		rcv.requests++
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("ack\x00\xff"))
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func newTestDeliverer(wr repo.IWebhookRepo, jr repo.IJobRepo, maxAttempts int) *Deliverer {
+	return NewDeliverer(nil, wr, jobs.NewClient(nil, repo.DefaultSchema, jr), Options{
+		MaxAttempts:  maxAttempts,
+		Timeout:      time.Second,
+		AllowPrivate: true, // receivers listen on loopback
+	})
+}
+
+func TestDeliver(t *testing.T) {
+	const secret = "whsec_test"
+	ctx := context.Background()
+
+	newDelivery := func(wr *fakeWebhookRepo) DeliverPayload {
+		d, err := wr.CreateDelivery(ctx, nil, repo.DefaultSchema, repo.WebhookDelivery{
+			WebhookID: 1, EventID: "evt_1", EventType: events.TypeUserCreated, Payload: []byte(`{"id":"evt_1"}`),
+		})
+		assert.NoError(t, err)
+		return DeliverPayload{Schema: repo.DefaultSchema, DeliveryID: d.ID}
+	}
+
+	t.Run("success", func(t *testing.T) {
+		rcv := newReceiver(t, secret, http.StatusOK)
+		wr := newFakeWebhookRepo(repo.Webhook{ID: 1, URL: rcv.URL, Secret: secret, Active: true})
+		d := newTestDeliverer(wr, &fakeJobRepo{}, 3)
+		p := newDelivery(wr)
+
+		assert.NoError(t, d.Deliver(ctx, p))
+		assert.Empty(t, rcv.errs)
+		assert.Equal(t, repo.WebhookDeliverySucceeded, wr.deliveries[p.DeliveryID].Status)
+		assert.Equal(t, http.StatusOK, *wr.attempts[0].StatusCode)
+		assert.Equal(t, "ack�", *wr.attempts[0].ResponseBody)
+
+		// a duplicate job for a delivered delivery does nothing
+		assert.NoError(t, d.Deliver(ctx, p))
+		assert.Equal(t, 1, rcv.requests)
+	})
+
+	t.Run("retries then gives up", func(t *testing.T) {
+		rcv := newReceiver(t, secret, http.StatusInternalServerError)
+		wr := newFakeWebhookRepo(repo.Webhook{ID: 1, URL: rcv.URL, Secret: secret, Active: true})
+		d := newTestDeliverer(wr, &fakeJobRepo{}, 2)
+		p := newDelivery(wr)
+
+		err := d.Deliver(ctx, p)
+		assert.Error(t, err)
+		assert.False(t, jobs.IsPermanent(err), "retried by the job queue")
+		assert.Equal(t, repo.WebhookDeliveryPending, wr.deliveries[p.DeliveryID].Status)
+
+		err = d.Deliver(ctx, p)
+		assert.True(t, jobs.IsPermanent(err))
+		assert.Equal(t, repo.WebhookDeliveryFailed, wr.deliveries[p.DeliveryID].Status)
+		assert.Equal(t, 2, wr.deliveries[p.DeliveryID].Attempts)
+		assert.Len(t, wr.attempts, 2)
+		assert.Equal(t, 2, rcv.requests)
+	})
+
+	t.Run("recovers after a failure", func(t *testing.T) {
+		rcv := newReceiver(t, secret, http.StatusServiceUnavailable, http.StatusOK)
+		wr := newFakeWebhookRepo(repo.Webhook{ID: 1, URL: rcv.URL, Secret: secret, Active: true})
+		d := newTestDeliverer(wr, &fakeJobRepo{}, 3)
+		p := newDelivery(wr)
+
+		assert.Error(t, d.Deliver(ctx, p))
+		assert.NoError(t, d.Deliver(ctx, p))
+		assert.Equal(t, repo.WebhookDeliverySucceeded, wr.deliveries[p.DeliveryID].Status)
+		assert.Contains(t, *wr.attempts[0].Error, "503")
+		assert.Nil(t, wr.attempts[1].Error)
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		rcv := newReceiver(t, secret, http.StatusOK)
+		rcv.Close()
+		wr := newFakeWebhookRepo(repo.Webhook{ID: 1, URL: rcv.URL, Secret: secret, Active: true})
+		d := newTestDeliverer(wr, &fakeJobRepo{}, 3)
+		p := newDelivery(wr)
+
+		assert.Error(t, d.Deliver(ctx, p))
+		assert.Nil(t, wr.attempts[0].StatusCode)
+		assert.NotNil(t, wr.attempts[0].Error)
+	})
+
+	t.Run("disabled webhook is not retried", func(t *testing.T) {
+		rcv := newReceiver(t, secret, http.StatusOK)
+		wr := newFakeWebhookRepo(repo.Webhook{ID: 1, URL: rcv.URL, Secret: secret, Active: false})
+		d := newTestDeliverer(wr, &fakeJobRepo{}, 3)
+		p := newDelivery(wr)
+
+		err := d.Deliver(ctx, p)
+		assert.True(t, jobs.IsPermanent(err))
+		assert.Equal(t, repo.WebhookDeliveryFailed, wr.deliveries[p.DeliveryID].Status)
+		assert.Len(t, wr.attempts, 1)
+		assert.Equal(t, 0, rcv.requests)
+	})
+
+	t.Run("job outlives the delivery's attempts", func(t *testing.T) {
+		jr := &fakeJobRepo{}
+		d := newTestDeliverer(newFakeWebhookRepo(), jr, 3)
+		assert.NoError(t, d.EnqueueTx(ctx, nil, repo.DefaultSchema, 1))
+		assert.Greater(t, jr.jobs[0].MaxAttempts, 3)
+	})
+
+	t.Run("missing delivery is permanent", func(t *testing.T) {
+		d := newTestDeliverer(newFakeWebhookRepo(), &fakeJobRepo{}, 3)
+		err := d.Deliver(ctx, DeliverPayload{Schema: repo.DefaultSchema, DeliveryID: 42})
+		assert.True(t, jobs.IsPermanent(err))
+	})
+}
+
+func TestSink_Publish(t *testing.T) {
+	ctx := context.Background()
+	wr := newFakeWebhookRepo(
+		repo.Webhook{ID: 1, URL: "http://a.example.com", Active: true},
+		repo.Webhook{ID: 2, URL: "http://b.example.com", Active: true},
+	)
+	jr := &fakeJobRepo{}
+	s := NewSink(nil, wr, newTestDeliverer(wr, jr, 3))
+
+	env, err := events.New(events.TypeUserCreated, "tenant_acme", "user/7", events.UserCreated{User: events.User{ID: 7}})
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Publish(ctx, env))
+	assert.Len(t, wr.deliveries, 2)
+	assert.Len(t, jr.jobs, 2)
+	for _, d := range wr.deliveries {
+		var got events.Envelope
+		assert.NoError(t, json.Unmarshal(d.Payload, &got))
+		assert.Equal(t, env.ID, got.ID)
+		assert.Equal(t, env.ID, d.EventID)
+	}
+	var p DeliverPayload
+	assert.NoError(t, json.Unmarshal(jr.jobs[0].Payload, &p))
+	assert.Equal(t, "tenant_acme", p.Schema)
+	assert.Equal(t, KindDeliver, jr.jobs[0].Kind)
+
+	// publishing again, e.g. after the relay failed on another sink, creates nothing new
+	assert.NoError(t, s.Publish(ctx, env))
+	assert.Len(t, wr.deliveries, 2)
+	assert.Len(t, jr.jobs, 2)
+
+	// non user events have no subscribers yet
+	other, err := events.New("org.created", "tenant_acme", "org/1", struct{}{})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Publish(ctx, other))
+	assert.Len(t, wr.deliveries, 2)
+}
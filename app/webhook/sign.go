@@ -0,0 +1,89 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// headers sent with every delivery
+const (
+	HeaderID        = "Webhook-Id"
+	HeaderTimestamp = "Webhook-Timestamp"
+	HeaderSignature = "Webhook-Signature"
+
+	signatureVersion = "v1"
+	secretPrefix     = "whsec_"
+	secretBytes      = 32
+
+	// DefaultTolerance is how old a delivery's timestamp may be before Verify rejects it as a replay
+	DefaultTolerance = 5 * time.Minute
+)
+
+// errors returned by Verify
+var (
+	ErrMissingHeaders   = errors.New("missing webhook headers")
+	ErrInvalidTimestamp = errors.New("webhook timestamp is invalid or outside tolerance")
+	ErrInvalidSignature = errors.New("webhook signature does not match")
+)
+
+// NewSecret returns a random signing secret
+func NewSecret() (string, error) {
+	b := make([]byte, secretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "problem generating webhook secret")
+	}
+	return secretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Sign returns the signature header value for a delivery. the timestamp is part of what is signed, so a captured
+// request cannot be replayed later with a fresh timestamp
+func Sign(secret string, id string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s.%d.", id, timestamp.Unix())
+	mac.Write(body)
+	return signatureVersion + "=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SetHeaders signs body and sets the delivery headers on h
+func SetHeaders(h http.Header, secret string, id string, timestamp time.Time, body []byte) {
+	h.Set(HeaderID, id)
+	h.Set(HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+	h.Set(HeaderSignature, Sign(secret, id, timestamp, body))
+}
+
+// Verify checks a received delivery's signature and that its timestamp is within tolerance of now. receivers should
+// also dedupe on the Webhook-Id header, deliveries are at least once
+func Verify(secret string, h http.Header, body []byte, tolerance time.Duration, now time.Time) error {
+	id, ts, sig := h.Get(HeaderID), h.Get(HeaderTimestamp), h.Get(HeaderSignature)
+	if id == "" || ts == "" || sig == "" {
+		return ErrMissingHeaders
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	timestamp := time.Unix(unix, 0)
+	if now.Sub(timestamp).Abs() > tolerance {
+		return ErrInvalidTimestamp
+	}
+
+	expected := Sign(secret, id, timestamp, body)
+	// several signatures may be sent space separated, e.g. while rotating secrets
+	for _, s := range strings.Fields(sig) {
+		if hmac.Equal([]byte(s), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
@@ -0,0 +1,60 @@
+package webhook
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSecret(t *testing.T) {
+	a, err := NewSecret()
+	assert.NoError(t, err)
+	b, err := NewSecret()
+	assert.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(a, secretPrefix))
+	assert.NotEqual(t, a, b)
+}
+
+func TestVerify(t *testing.T) {
+	const secret = "whsec_test"
+	body := []byte(`{"id":"evt_1"}`)
+	now := time.Unix(1700000000, 0)
+
+	signed := func() http.Header {
+		h := http.Header{}
+		SetHeaders(h, secret, "evt_1", now, body)
+		return h
+	}
+
+	assert.NoError(t, Verify(secret, signed(), body, DefaultTolerance, now))
+	assert.NoError(t, Verify(secret, signed(), body, DefaultTolerance, now.Add(DefaultTolerance)))
+
+	assert.ErrorIs(t, Verify("whsec_other", signed(), body, DefaultTolerance, now), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify(secret, signed(), []byte(`{"id":"evt_2"}`), DefaultTolerance, now), ErrInvalidSignature)
+
+	// replayed later, the timestamp is too old
+	assert.ErrorIs(t, Verify(secret, signed(), body, DefaultTolerance, now.Add(DefaultTolerance+time.Second)), ErrInvalidTimestamp)
+
+	// a fresh timestamp does not match the signature
+	h := signed()
+	h.Set(HeaderTimestamp, strconv.FormatInt(now.Add(time.Hour).Unix(), 10))
+	assert.ErrorIs(t, Verify(secret, h, body, DefaultTolerance, now.Add(time.Hour)), ErrInvalidSignature)
+
+	h = signed()
+	h.Set(HeaderTimestamp, "yesterday")
+	assert.ErrorIs(t, Verify(secret, h, body, DefaultTolerance, now), ErrInvalidTimestamp)
+
+	h = signed()
+	h.Del(HeaderSignature)
+	assert.ErrorIs(t, Verify(secret, h, body, DefaultTolerance, now), ErrMissingHeaders)
+
+	// any one of several signatures may match, e.g. while rotating secrets
+	h = signed()
+	h.Set(HeaderSignature, Sign("whsec_old", "evt_1", now, body)+" "+h.Get(HeaderSignature))
+	assert.NoError(t, Verify(secret, h, body, DefaultTolerance, now))
+}
@@ -0,0 +1,86 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/drmaples/starter-app/app/events"
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+// SinkName is the name of the webhook sink, see platform.OutboxConfig
+const SinkName = "webhook"
+
+// Sink is an events.Sink that fans events out to subscribed webhooks as deliveries
+type Sink struct {
+	db          repo.Querier
+	webhookRepo repo.IWebhookRepo
+	deliverer   *Deliverer
+}
+
+// NewSink creates a new webhook sink
+func NewSink(db repo.Querier, webhookRepo repo.IWebhookRepo, deliverer *Deliverer) events.Sink {
+	return &Sink{
+		db:          db,
+		webhookRepo: webhookRepo,
+		deliverer:   deliverer,
+	}
+}
+
+// Name of the sink
+func (s *Sink) Name() string {
+	return SinkName
+}
+
+// Publish creates a delivery for every webhook subscribed to the event and queues it. publishing the same event
+// again reuses the existing deliveries
+func (s *Sink) Publish(ctx context.Context, env events.Envelope) error {
+	hooks, err := s.subscribers(ctx, env)
+	if err != nil {
+		return err
+	}
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(env)
+	if err != nil {
+		return errors.Wrap(err, "problem marshalling event for webhook")
+	}
+	for _, wh := range hooks {
+		del, err := s.webhookRepo.CreateDelivery(ctx, s.db, env.Tenant, repo.WebhookDelivery{
+			WebhookID: wh.ID,
+			EventID:   env.ID,
+			EventType: env.Type,
+			Payload:   body,
+		})
+		if err != nil {
+			return err
+		}
+		if del.Status != repo.WebhookDeliveryPending || del.Attempts > 0 {
+			continue // handed to the job queue by an earlier publish
+		}
+		if err := s.deliverer.Enqueue(ctx, env.Tenant, del.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscribers finds the webhooks an event goes to. user events go to the organizations the user belongs to, so a
+// deleted user, no longer in any organization, has none
+func (s *Sink) subscribers(ctx context.Context, env events.Envelope) ([]repo.Webhook, error) {
+	if !strings.HasPrefix(env.Type, "user.") {
+		return nil, nil
+	}
+	var data struct {
+		User events.User `json:"user"`
+	}
+	if err := json.Unmarshal(env.Data, &data); err != nil {
+		return nil, errors.Wrapf(err, "problem unmarshalling %s event", env.Type)
+	}
+	return s.webhookRepo.ListWebhooksForUserEvent(ctx, s.db, env.Tenant, data.User.ID, env.Type)
+}
@@ -0,0 +1,23 @@
+CREATE TABLE jobs (
+    id BIGSERIAL PRIMARY KEY,
+    queue VARCHAR(100) DEFAULT 'default' NOT NULL,
+    kind VARCHAR(100) NOT NULL,
+    payload JSONB DEFAULT '{}' NOT NULL,
+    status VARCHAR(20) DEFAULT 'pending' NOT NULL CHECK (status IN ('pending', 'running', 'succeeded', 'dead')),
+    attempts INTEGER DEFAULT 0 NOT NULL,
+    max_attempts INTEGER DEFAULT 5 NOT NULL,
+    run_at TIMESTAMPTZ DEFAULT now() NOT NULL,
+    unique_key VARCHAR(250),
+    last_error TEXT,
+    locked_at TIMESTAMPTZ,
+    locked_by VARCHAR(250),
+    finished_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT now() NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT now() NOT NULL
+);
+
+-- workers only ever look for due pending jobs in their queue
+CREATE INDEX jobs_fetch_idx ON jobs (queue, run_at) WHERE status = 'pending';
+
+-- at most one live job per unique key, finished jobs free the key up again
+CREATE UNIQUE INDEX jobs_unique_key_idx ON jobs (unique_key) WHERE unique_key IS NOT NULL AND status IN ('pending', 'running');
@@ -0,0 +1,13 @@
+CREATE TABLE schedule_runs (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    scheduled_at TIMESTAMPTZ NOT NULL,
+    status VARCHAR(20) DEFAULT 'running' NOT NULL CHECK (status IN ('running', 'succeeded', 'failed')),
+    error TEXT,
+    instance VARCHAR(250) NOT NULL,
+    started_at TIMESTAMPTZ DEFAULT now() NOT NULL,
+    finished_at TIMESTAMPTZ
+);
+
+-- a tick fires at most once, even if leadership changes hands mid tick
+CREATE UNIQUE INDEX schedule_runs_name_scheduled_at_idx ON schedule_runs (name, scheduled_at);
@@ -0,0 +1,13 @@
+CREATE TABLE event_log (
+    id BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL UNIQUE,
+    event_type VARCHAR(100) NOT NULL,
+    tenant VARCHAR(100) NOT NULL,
+    subject VARCHAR(250) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now() NOT NULL
+);
+
+-- resuming a stream reads one tenant's events after an id
+CREATE INDEX event_log_tenant_id_idx ON event_log (tenant, id);
+CREATE INDEX event_log_created_at_idx ON event_log (created_at);
@@ -0,0 +1,20 @@
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor VARCHAR(250) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    route VARCHAR(250) NOT NULL,
+    resource VARCHAR(100) NOT NULL,
+    resource_id VARCHAR(100),
+    status INTEGER NOT NULL,
+    before JSONB,
+    after JSONB,
+    ip VARCHAR(64),
+    request_id VARCHAR(100),
+    created_at TIMESTAMPTZ DEFAULT now() NOT NULL
+);
+
+-- the log is paged newest first, optionally filtered to one actor or resource
+CREATE INDEX audit_log_actor_id_idx ON audit_log (actor, id);
+CREATE INDEX audit_log_resource_id_idx ON audit_log (resource, resource_id, id);
+CREATE INDEX audit_log_created_at_idx ON audit_log (created_at);
@@ -0,0 +1,3 @@
+DROP TRIGGER users_history ON users;
+DROP FUNCTION users_history_trigger();
+DROP TABLE users_history;
@@ -0,0 +1,54 @@
+-- every version of every users row. a version is current from valid_from until valid_to, null while it still is.
+-- deletes add a version with operation DELETE so a user can be told apart from one that never existed
+CREATE TABLE users_history (
+    history_id BIGSERIAL PRIMARY KEY,
+    id INTEGER NOT NULL,
+    revision INTEGER NOT NULL,
+    operation VARCHAR(10) NOT NULL CHECK (operation IN ('INSERT', 'UPDATE', 'DELETE')),
+    email VARCHAR(250),
+    first_name VARCHAR(100),
+    last_name VARCHAR(100),
+    valid_from TIMESTAMPTZ NOT NULL,
+    valid_to TIMESTAMPTZ,
+    UNIQUE (id, revision)
+);
+
+CREATE INDEX users_history_id_valid_from_idx ON users_history (id, valid_from);
+
+-- tenant schemas each have their own users table, TG_TABLE_SCHEMA keeps history next to the row that changed
+-- whatever search_path the writer has. writes to a users row are serialized by its row lock so revisions never race
+CREATE FUNCTION users_history_trigger() RETURNS TRIGGER AS $$
+DECLARE
+    rec RECORD;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        rec := OLD;
+    ELSE
+        rec := NEW;
+    END IF;
+
+    IF TG_OP <> 'INSERT' THEN
+        EXECUTE format('UPDATE %I.users_history SET valid_to = now() WHERE id = $1 AND valid_to IS NULL', TG_TABLE_SCHEMA)
+        USING OLD.id;
+    END IF;
+
+    EXECUTE format(
+        'INSERT INTO %1$I.users_history (id, revision, operation, email, first_name, last_name, valid_from)
+        SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3, $4, $5, now()
+        FROM %1$I.users_history
+        WHERE id = $1',
+        TG_TABLE_SCHEMA)
+    USING rec.id, TG_OP, rec.email, rec.first_name, rec.last_name;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_history
+AFTER INSERT OR UPDATE OR DELETE ON users
+FOR EACH ROW EXECUTE FUNCTION users_history_trigger();
+
+-- users that already exist start with their current version
+INSERT INTO users_history (id, revision, operation, email, first_name, last_name, valid_from)
+SELECT id, 1, 'INSERT', email, first_name, last_name, updated_at
+FROM users;
@@ -0,0 +1,11 @@
+-- token buckets shared by every server replica. unlogged, losing them on a crash only means clients start with a full
+-- bucket, and it keeps the write per request out of the WAL
+CREATE UNLOGGED TABLE rate_limit_buckets (
+    key VARCHAR(300) PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    allowed BOOLEAN NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT now() NOT NULL
+);
+
+-- idle buckets are purged
+CREATE INDEX rate_limit_buckets_updated_at_idx ON rate_limit_buckets (updated_at);
@@ -0,0 +1 @@
+-- the dropped copies were never used, the global migrations recreate them should a tenant schema ever need them
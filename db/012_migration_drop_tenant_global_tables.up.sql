@@ -0,0 +1,9 @@
+-- tenant schemas used to get every migration, so they have unused copies of the global tables. global tables only
+-- belong in the default schema, which this leaves alone
+DO $$
+BEGIN
+    IF current_schema() LIKE 'tenant\_%' THEN
+        EXECUTE format('DROP TABLE IF EXISTS %1$I.jobs, %1$I.schedule_runs, %1$I.outbox, %1$I.event_log, %1$I.rate_limit_buckets', current_schema());
+    END IF;
+END
+$$;
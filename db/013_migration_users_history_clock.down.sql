@@ -0,0 +1,26 @@
+CREATE OR REPLACE FUNCTION users_history_trigger() RETURNS TRIGGER AS $$
+DECLARE
+    rec RECORD;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        rec := OLD;
+    ELSE
+        rec := NEW;
+    END IF;
+
+    IF TG_OP <> 'INSERT' THEN
+        EXECUTE format('UPDATE %I.users_history SET valid_to = now() WHERE id = $1 AND valid_to IS NULL', TG_TABLE_SCHEMA)
+        USING OLD.id;
+    END IF;
+
+    EXECUTE format(
+        'INSERT INTO %1$I.users_history (id, revision, operation, email, first_name, last_name, valid_from)
+        SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3, $4, $5, now()
+        FROM %1$I.users_history
+        WHERE id = $1',
+        TG_TABLE_SCHEMA)
+    USING rec.id, TG_OP, rec.email, rec.first_name, rec.last_name;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,30 @@
+-- now() is when the writing transaction started, so a transaction that started first but updated a user last would
+-- end the newer version before it began. clock_timestamp() is when the write happened, and the row lock orders
+-- writes to the same user, so versions never overlap
+CREATE OR REPLACE FUNCTION users_history_trigger() RETURNS TRIGGER AS $$
+DECLARE
+    rec RECORD;
+    changed_at TIMESTAMPTZ := clock_timestamp();
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        rec := OLD;
+    ELSE
+        rec := NEW;
+    END IF;
+
+    IF TG_OP <> 'INSERT' THEN
+        EXECUTE format('UPDATE %I.users_history SET valid_to = $2 WHERE id = $1 AND valid_to IS NULL', TG_TABLE_SCHEMA)
+        USING OLD.id, changed_at;
+    END IF;
+
+    EXECUTE format(
+        'INSERT INTO %1$I.users_history (id, revision, operation, email, first_name, last_name, valid_from)
+        SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3, $4, $5, $6
+        FROM %1$I.users_history
+        WHERE id = $1',
+        TG_TABLE_SCHEMA)
+    USING rec.id, TG_OP, rec.email, rec.first_name, rec.last_name, changed_at;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
@@ -8,6 +8,7 @@ import (
 	"runtime"
 	"sort"
 	"strconv"
+	"testing/fstest"
 
 	"github.com/pkg/errors"
 	"github.com/samber/lo"
@@ -19,9 +20,42 @@ var MigrationFS embed.FS
 // pathRE is regex of a migration file
 var pathRE = regexp.MustCompile(`(\d+)_migration.*`)
 
+// globalRE is regex of a migration for tables shared by every tenant, e.g. jobs and the outbox. they only belong in
+// the default schema
+var globalRE = regexp.MustCompile(`^\d+_migration_global_`)
+
 // FileLocation is location where all migration files live
 const FileLocation = "."
 
+// globalPlaceholder replaces the body of global migrations for tenant schemas
+const globalPlaceholder = "-- global migration, only applied to the default schema\n"
+
+// TenantMigrationFS returns the migrations for tenant schemas. global migrations keep their version with an empty
+// body, so a tenant schema is at the same version as the default schema once migrated
+func TenantMigrationFS() (fs.FS, error) {
+	paths, err := MigrationFS.ReadDir(FileLocation)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem listing paths")
+	}
+
+	tenantFS := fstest.MapFS{}
+	for _, p := range paths {
+		if !pathRE.MatchString(p.Name()) {
+			continue
+		}
+		if globalRE.MatchString(p.Name()) {
+			tenantFS[p.Name()] = &fstest.MapFile{Data: []byte(globalPlaceholder)}
+			continue
+		}
+		body, err := MigrationFS.ReadFile(p.Name())
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem reading %s", p.Name())
+		}
+		tenantFS[p.Name()] = &fstest.MapFile{Data: body}
+	}
+	return tenantFS, nil
+}
+
 // LatestMigrationVersion returns the latest available migration as found on the filesystem
 func LatestMigrationVersion() (int, error) {
 	paths, err := MigrationFS.ReadDir(FileLocation)
@@ -0,0 +1,105 @@
+package test_repo
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+type auditSuite struct {
+	suite.Suite
+
+	backend   string
+	container IPostgresContainer
+	ctx       context.Context
+	db        *repo.DB
+	auditRepo repo.IAuditRepo
+}
+
+func TestAuditSuite(t *testing.T) {
+	suite.Run(t, &auditSuite{backend: repo.BackendStdlib})
+}
+
+func TestAuditSuitePgxPool(t *testing.T) {
+	suite.Run(t, &auditSuite{backend: repo.BackendPgxPool})
+}
+
+func (s *auditSuite) SetupSuite() {
+	s.container = NewPostgresContainerWithBackend(s.backend)
+	assert.NoError(s.T(), s.container.Setup())
+
+	s.db = s.container.GetDB()
+	s.auditRepo = repo.NewAuditRepo()
+}
+
+func (s *auditSuite) TearDownSuite() {
+	assert.NoError(s.T(), s.container.TearDown())
+}
+
+func (s *auditSuite) SetupTest() {
+	s.ctx = context.TODO()
+
+	// every test starts from an empty log
+	_, err := s.db.ExecContext(s.ctx, `DELETE FROM audit_log`)
+	assert.NoError(s.T(), err)
+}
+
+func (s *auditSuite) create(actor string, action string, resource string, resourceID string) *repo.AuditEntry {
+	e, err := s.auditRepo.CreateAuditEntry(s.ctx, s.db, repo.DefaultSchema, repo.AuditEntry{
+		Actor:      actor,
+		Action:     action,
+		Method:     "PUT",
+		Route:      "/v1/" + resource + "/:id",
+		Resource:   resource,
+		ResourceID: &resourceID,
+		Status:     200,
+		After:      json.RawMessage(`{"id": 1}`),
+	})
+	assert.NoError(s.T(), err)
+	return e
+}
+
+func (s *auditSuite) TestCreateAndList() {
+	first := s.create("a@example.com", repo.AuditActionCreate, "user", "1")
+	s.create("b@example.com", repo.AuditActionUpdate, "user", "1")
+	last := s.create("a@example.com", repo.AuditActionUpdate, "webhook", "7")
+
+	assert.Nil(s.T(), first.Before)
+	assert.JSONEq(s.T(), `{"id": 1}`, string(first.After))
+	assert.Nil(s.T(), first.IP)
+
+	all, err := s.auditRepo.ListAuditEntries(s.ctx, s.db, repo.DefaultSchema, repo.AuditFilter{Limit: 10})
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), all, 3)
+	assert.Equal(s.T(), last.ID, all[0].ID)
+
+	tests := []struct {
+		name   string
+		filter repo.AuditFilter
+		want   int
+	}{
+		{name: "actor", filter: repo.AuditFilter{Actor: "a@example.com"}, want: 2},
+		{name: "action", filter: repo.AuditFilter{Action: repo.AuditActionUpdate}, want: 2},
+		{name: "resource", filter: repo.AuditFilter{Resource: "user", ResourceID: "1"}, want: 2},
+		{name: "before_id", filter: repo.AuditFilter{BeforeID: last.ID}, want: 2},
+		{name: "since", filter: repo.AuditFilter{Since: time.Now().Add(time.Hour)}, want: 0},
+		{name: "until", filter: repo.AuditFilter{Until: time.Now().Add(time.Hour)}, want: 3},
+		{name: "limit", filter: repo.AuditFilter{Limit: 1}, want: 1},
+	}
+	for _, tc := range tests {
+		s.Run(tc.name, func() {
+			if tc.filter.Limit == 0 {
+				tc.filter.Limit = 10
+			}
+			res, err := s.auditRepo.ListAuditEntries(s.ctx, s.db, repo.DefaultSchema, tc.filter)
+			assert.NoError(s.T(), err)
+			assert.Len(s.T(), res, tc.want)
+		})
+	}
+}
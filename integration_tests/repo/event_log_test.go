@@ -0,0 +1,118 @@
+package test_repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/drmaples/starter-app/app/events"
+	"github.com/drmaples/starter-app/app/repo"
+	"github.com/drmaples/starter-app/app/stream"
+)
+
+type eventLogSuite struct {
+	suite.Suite
+
+	backend      string
+	container    IPostgresContainer
+	ctx          context.Context
+	db           *repo.DB
+	eventLogRepo repo.IEventLogRepo
+}
+
+func TestEventLogSuite(t *testing.T) {
+	suite.Run(t, &eventLogSuite{backend: repo.BackendStdlib})
+}
+
+func TestEventLogSuitePgxPool(t *testing.T) {
+	suite.Run(t, &eventLogSuite{backend: repo.BackendPgxPool})
+}
+
+func (s *eventLogSuite) SetupSuite() {
+	s.container = NewPostgresContainerWithBackend(s.backend)
+	assert.NoError(s.T(), s.container.Setup())
+
+	s.db = s.container.GetDB()
+	s.eventLogRepo = repo.NewEventLogRepo()
+}
+
+func (s *eventLogSuite) TearDownSuite() {
+	assert.NoError(s.T(), s.container.TearDown())
+}
+
+func (s *eventLogSuite) SetupTest() {
+	s.ctx = context.TODO()
+
+	// every test starts from an empty log
+	_, err := s.db.ExecContext(s.ctx, `DELETE FROM event_log`)
+	assert.NoError(s.T(), err)
+}
+
+func (s *eventLogSuite) publish(tenant string) events.Envelope {
+	env, err := events.New(events.TypeUserCreated, tenant, "user/1", events.UserCreated{})
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), stream.NewSink(s.db, s.eventLogRepo).Publish(s.ctx, env))
+	return env
+}
+
+func (s *eventLogSuite) TestAppendAndList() {
+	a := s.publish("tenant_a")
+	s.publish("tenant_b")
+	s.publish("tenant_a")
+
+	// publishing an event again does not log it twice
+	assert.NoError(s.T(), stream.NewSink(s.db, s.eventLogRepo).Publish(s.ctx, a))
+
+	all, err := s.eventLogRepo.ListEvents(s.ctx, s.db, repo.DefaultSchema, "", 0, 10)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), all, 3)
+	assert.Equal(s.T(), a.ID, all[0].EventID)
+	assert.Contains(s.T(), string(all[0].Payload), a.ID)
+
+	tenantA, err := s.eventLogRepo.ListEvents(s.ctx, s.db, repo.DefaultSchema, "tenant_a", all[0].ID, 10)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), tenantA, 1)
+	assert.Equal(s.T(), all[2].ID, tenantA[0].ID)
+
+	latest, err := s.eventLogRepo.LatestEventID(s.ctx, s.db, repo.DefaultSchema)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), all[2].ID, latest)
+
+	n, err := s.eventLogRepo.DeleteEventsBefore(s.ctx, s.db, repo.DefaultSchema, time.Now().Add(time.Minute))
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), int64(3), n)
+}
+
+func (s *eventLogSuite) TestHub_receives_notifications() {
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+
+	// a long poll interval means only a notification can deliver the event in time
+	hub := stream.NewHub(s.db, s.eventLogRepo, stream.HubOptions{PollInterval: time.Minute})
+	sub := hub.Subscribe("tenant_a")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hub.Run(ctx)
+	}()
+
+	// the hub only streams events logged after it starts listening
+	assert.Eventually(s.T(), func() bool {
+		s.publish("tenant_a")
+		select {
+		case e := <-sub.C:
+			return e.Tenant == "tenant_a"
+		case <-time.After(500 * time.Millisecond):
+			return false
+		}
+	}, 10*time.Second, 100*time.Millisecond)
+
+	cancel()
+	<-done
+	// subscriptions are closed when the hub stops, ranging over one ends once it is drained
+	for range sub.C {
+	}
+}
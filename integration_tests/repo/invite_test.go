@@ -0,0 +1,109 @@
+package test_repo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+type inviteSuite struct {
+	suite.Suite
+
+	backend    string
+	container  IPostgresContainer
+	ctx        context.Context
+	db         *repo.DB
+	userRepo   repo.IUserRepo
+	orgRepo    repo.IOrgRepo
+	inviteRepo repo.IInviteRepo
+}
+
+func TestInviteSuite(t *testing.T) {
+	suite.Run(t, &inviteSuite{backend: repo.BackendStdlib})
+}
+
+func TestInviteSuitePgxPool(t *testing.T) {
+	suite.Run(t, &inviteSuite{backend: repo.BackendPgxPool})
+}
+
+func (s *inviteSuite) SetupSuite() {
+	s.container = NewPostgresContainerWithBackend(s.backend)
+	assert.NoError(s.T(), s.container.Setup())
+
+	s.db = s.container.GetDB()
+	s.userRepo = repo.NewUserRepo()
+	s.orgRepo = repo.NewOrgRepo()
+	s.inviteRepo = repo.NewInviteRepo()
+}
+
+func (s *inviteSuite) TearDownSuite() {
+	assert.NoError(s.T(), s.container.TearDown())
+}
+
+func (s *inviteSuite) SetupTest() {
+	s.ctx = context.TODO()
+}
+
+func (s *inviteSuite) createInvite(expiresAt time.Time) *repo.Invitation {
+	o, err := s.orgRepo.CreateOrg(s.ctx, s.db, repo.DefaultSchema, repo.Organization{Name: uuid.New().String()})
+	assert.NoError(s.T(), err)
+
+	inv, err := s.inviteRepo.CreateInvite(s.ctx, s.db, repo.DefaultSchema, repo.Invitation{
+		OrganizationID: o.ID,
+		Email:          fmt.Sprintf("%s@example.com", uuid.New().String()),
+		Role:           repo.OrgRoleMember,
+		TokenHash:      uuid.New().String(),
+		ExpiresAt:      expiresAt,
+	})
+	assert.NoError(s.T(), err)
+	return inv
+}
+
+func (s *inviteSuite) TestCreateAndAccept() {
+	inv := s.createInvite(time.Now().Add(time.Hour))
+
+	pending, err := s.inviteRepo.ListPendingInvites(s.ctx, s.db, repo.DefaultSchema, inv.OrganizationID)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), pending, 1)
+
+	fetched, err := s.inviteRepo.GetPendingInviteByTokenHash(s.ctx, s.db, repo.DefaultSchema, inv.TokenHash)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), inv.ID, fetched.ID)
+
+	u, err := s.userRepo.CreateUser(s.ctx, s.db, repo.DefaultSchema, repo.User{Email: inv.Email})
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.inviteRepo.AcceptInvite(s.ctx, s.db, repo.DefaultSchema, inv.ID, u.ID))
+
+	// single use
+	assert.ErrorIs(s.T(), s.inviteRepo.AcceptInvite(s.ctx, s.db, repo.DefaultSchema, inv.ID, u.ID), repo.ErrNoRowsFound)
+	_, err = s.inviteRepo.GetPendingInviteByTokenHash(s.ctx, s.db, repo.DefaultSchema, inv.TokenHash)
+	assert.ErrorIs(s.T(), err, repo.ErrNoRowsFound)
+}
+
+func (s *inviteSuite) TestExpired() {
+	inv := s.createInvite(time.Now().Add(-time.Minute))
+
+	_, err := s.inviteRepo.GetPendingInviteByTokenHash(s.ctx, s.db, repo.DefaultSchema, inv.TokenHash)
+	assert.ErrorIs(s.T(), err, repo.ErrNoRowsFound)
+
+	pending, err := s.inviteRepo.ListPendingInvites(s.ctx, s.db, repo.DefaultSchema, inv.OrganizationID)
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), pending)
+}
+
+func (s *inviteSuite) TestRevoke() {
+	inv := s.createInvite(time.Now().Add(time.Hour))
+
+	assert.ErrorIs(s.T(), s.inviteRepo.RevokeInvite(s.ctx, s.db, repo.DefaultSchema, inv.OrganizationID+1, inv.ID), repo.ErrNoRowsFound)
+	assert.NoError(s.T(), s.inviteRepo.RevokeInvite(s.ctx, s.db, repo.DefaultSchema, inv.OrganizationID, inv.ID))
+
+	_, err := s.inviteRepo.GetPendingInviteByTokenHash(s.ctx, s.db, repo.DefaultSchema, inv.TokenHash)
+	assert.ErrorIs(s.T(), err, repo.ErrNoRowsFound)
+}
@@ -0,0 +1,163 @@
+package test_repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+type jobSuite struct {
+	suite.Suite
+
+	backend   string
+	container IPostgresContainer
+	ctx       context.Context
+	db        *repo.DB
+	jobRepo   repo.IJobRepo
+	queue     string
+}
+
+func TestJobSuite(t *testing.T) {
+	suite.Run(t, &jobSuite{backend: repo.BackendStdlib})
+}
+
+func TestJobSuitePgxPool(t *testing.T) {
+	suite.Run(t, &jobSuite{backend: repo.BackendPgxPool})
+}
+
+func (s *jobSuite) SetupSuite() {
+	s.container = NewPostgresContainerWithBackend(s.backend)
+	assert.NoError(s.T(), s.container.Setup())
+
+	s.db = s.container.GetDB()
+	s.jobRepo = repo.NewJobRepo()
+}
+
+func (s *jobSuite) TearDownSuite() {
+	assert.NoError(s.T(), s.container.TearDown())
+}
+
+func (s *jobSuite) SetupTest() {
+	s.ctx = context.TODO()
+	s.queue = uuid.New().String() // each test gets its own queue
+}
+
+func (s *jobSuite) enqueue(runAt time.Time, uniqueKey *string) (*repo.Job, error) {
+	return s.jobRepo.EnqueueJob(s.ctx, s.db, repo.DefaultSchema, repo.Job{
+		Queue:       s.queue,
+		Kind:        "test",
+		Payload:     []byte(`{"foo":"bar"}`),
+		MaxAttempts: 2,
+		RunAt:       runAt,
+		UniqueKey:   uniqueKey,
+	})
+}
+
+func (s *jobSuite) fetch(tx repo.Querier) []repo.Job {
+	jobs, err := s.jobRepo.FetchJobs(s.ctx, tx, repo.DefaultSchema, s.queue, "test-worker", 10)
+	assert.NoError(s.T(), err)
+	return jobs
+}
+
+func (s *jobSuite) TestEnqueueFetchComplete() {
+	j, err := s.enqueue(time.Now(), nil)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), repo.JobStatusPending, j.Status)
+
+	jobs := s.fetch(s.db)
+	assert.Len(s.T(), jobs, 1)
+	assert.Equal(s.T(), j.ID, jobs[0].ID)
+	assert.Equal(s.T(), repo.JobStatusRunning, jobs[0].Status)
+	assert.Equal(s.T(), 1, jobs[0].Attempts)
+	assert.JSONEq(s.T(), `{"foo":"bar"}`, string(jobs[0].Payload))
+
+	assert.Empty(s.T(), s.fetch(s.db), "running job must not be handed out again")
+
+	assert.NoError(s.T(), s.jobRepo.CompleteJob(s.ctx, s.db, repo.DefaultSchema, j.ID))
+	assert.ErrorIs(s.T(), s.jobRepo.CompleteJob(s.ctx, s.db, repo.DefaultSchema, j.ID), repo.ErrNoRowsFound)
+}
+
+func (s *jobSuite) TestFetch_skips_future_jobs() {
+	_, err := s.enqueue(time.Now().Add(time.Hour), nil)
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), s.fetch(s.db))
+}
+
+func (s *jobSuite) TestFetch_skip_locked() {
+	for i := 0; i < 2; i++ {
+		_, err := s.enqueue(time.Now(), nil)
+		assert.NoError(s.T(), err)
+	}
+
+	tx1, err := s.db.BeginTx(s.ctx, nil)
+	assert.NoError(s.T(), err)
+	defer func() { _ = tx1.Rollback() }()
+	jobs1, err := s.jobRepo.FetchJobs(s.ctx, tx1, repo.DefaultSchema, s.queue, "worker-1", 1)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), jobs1, 1)
+
+	// tx1 still holds its row lock, a second worker must get the other job rather than block
+	jobs2 := s.fetch(s.db)
+	assert.Len(s.T(), jobs2, 1)
+	assert.NotEqual(s.T(), jobs1[0].ID, jobs2[0].ID)
+}
+
+func (s *jobSuite) TestEnqueue_unique_key() {
+	key := uuid.New().String()
+	j, err := s.enqueue(time.Now(), &key)
+	assert.NoError(s.T(), err)
+
+	_, err = s.enqueue(time.Now(), &key)
+	assert.ErrorIs(s.T(), err, repo.ErrDuplicateJob)
+
+	// key is free again once the job finishes
+	s.fetch(s.db)
+	assert.NoError(s.T(), s.jobRepo.CompleteJob(s.ctx, s.db, repo.DefaultSchema, j.ID))
+	_, err = s.enqueue(time.Now(), &key)
+	assert.NoError(s.T(), err)
+}
+
+func (s *jobSuite) TestFailJob_retry_then_dead() {
+	j, err := s.enqueue(time.Now(), nil)
+	assert.NoError(s.T(), err)
+
+	s.fetch(s.db)
+	retryAt := time.Now().Add(-time.Second)
+	assert.NoError(s.T(), s.jobRepo.FailJob(s.ctx, s.db, repo.DefaultSchema, j.ID, "boom", &retryAt))
+
+	jobs := s.fetch(s.db)
+	assert.Len(s.T(), jobs, 1)
+	assert.Equal(s.T(), 2, jobs[0].Attempts)
+	assert.Equal(s.T(), "boom", *jobs[0].LastError)
+
+	assert.NoError(s.T(), s.jobRepo.FailJob(s.ctx, s.db, repo.DefaultSchema, j.ID, "boom again", nil))
+	assert.Empty(s.T(), s.fetch(s.db))
+
+	assert.NoError(s.T(), s.jobRepo.RetryDeadJob(s.ctx, s.db, repo.DefaultSchema, j.ID))
+	jobs = s.fetch(s.db)
+	assert.Len(s.T(), jobs, 1)
+	assert.Equal(s.T(), 1, jobs[0].Attempts)
+}
+
+func (s *jobSuite) TestRescueStuckJobs() {
+	j, err := s.enqueue(time.Now(), nil)
+	assert.NoError(s.T(), err)
+	s.fetch(s.db)
+
+	n, err := s.jobRepo.RescueStuckJobs(s.ctx, s.db, repo.DefaultSchema, time.Now().Add(-time.Hour))
+	assert.NoError(s.T(), err)
+	assert.Zero(s.T(), n)
+
+	_, err = s.jobRepo.RescueStuckJobs(s.ctx, s.db, repo.DefaultSchema, time.Now().Add(time.Second))
+	assert.NoError(s.T(), err)
+
+	jobs := s.fetch(s.db)
+	assert.Len(s.T(), jobs, 1)
+	assert.Equal(s.T(), j.ID, jobs[0].ID)
+}
@@ -0,0 +1,78 @@
+package test_repo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/drmaples/starter-app/app/health"
+	"github.com/drmaples/starter-app/app/repo"
+	"github.com/drmaples/starter-app/db"
+)
+
+type migrateSuite struct {
+	suite.Suite
+
+	backend   string
+	container IPostgresContainer
+	ctx       context.Context
+	db        *repo.DB
+}
+
+func TestMigrateSuite(t *testing.T) {
+	suite.Run(t, &migrateSuite{backend: repo.BackendStdlib})
+}
+
+func TestMigrateSuitePgxPool(t *testing.T) {
+	suite.Run(t, &migrateSuite{backend: repo.BackendPgxPool})
+}
+
+func (s *migrateSuite) SetupSuite() {
+	s.container = NewPostgresContainerWithBackend(s.backend)
+	assert.NoError(s.T(), s.container.Setup())
+
+	s.db = s.container.GetDB()
+}
+
+func (s *migrateSuite) TearDownSuite() {
+	assert.NoError(s.T(), s.container.TearDown())
+}
+
+func (s *migrateSuite) SetupTest() {
+	s.ctx = context.TODO()
+}
+
+func (s *migrateSuite) TestGetMigrationVersion() {
+	latest, err := db.LatestMigrationVersion()
+	assert.NoError(s.T(), err)
+
+	version, dirty, err := repo.GetMigrationVersion(s.ctx, s.db, repo.DefaultSchema)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), latest, version)
+	assert.False(s.T(), dirty)
+
+	_, _, err = repo.GetMigrationVersion(s.ctx, s.db, "bad schema")
+	assert.ErrorIs(s.T(), err, repo.ErrInvalidSchema)
+}
+
+func (s *migrateSuite) TestHealthChecks() {
+	assert.NoError(s.T(), health.DBCheck(s.db).Run(s.ctx))
+
+	check := health.MigrationCheck(s.db, repo.DefaultSchema)
+	assert.NoError(s.T(), check.Run(s.ctx))
+
+	// pretend the last migration has not been applied, then that it failed part way
+	_, err := s.db.ExecContext(s.ctx, `UPDATE schema_migrations SET version = version - 1`)
+	assert.NoError(s.T(), err)
+	assert.ErrorContains(s.T(), check.Run(s.ctx), "want")
+
+	_, err = s.db.ExecContext(s.ctx, `UPDATE schema_migrations SET version = version + 1, dirty = true`)
+	assert.NoError(s.T(), err)
+	assert.ErrorContains(s.T(), check.Run(s.ctx), "dirty")
+
+	_, err = s.db.ExecContext(s.ctx, `UPDATE schema_migrations SET dirty = false`)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), check.Run(s.ctx))
+}
@@ -0,0 +1,261 @@
+package test_repo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+type orgSuite struct {
+	suite.Suite
+
+	backend   string
+	container IPostgresContainer
+	ctx       context.Context
+	db        *repo.DB
+	userRepo  repo.IUserRepo
+	orgRepo   repo.IOrgRepo
+}
+
+func TestOrgSuite(t *testing.T) {
+	suite.Run(t, &orgSuite{backend: repo.BackendStdlib})
+}
+
+func TestOrgSuitePgxPool(t *testing.T) {
+	suite.Run(t, &orgSuite{backend: repo.BackendPgxPool})
+}
+
+func (s *orgSuite) SetupSuite() {
+	s.container = NewPostgresContainerWithBackend(s.backend)
+	assert.NoError(s.T(), s.container.Setup())
+
+	s.db = s.container.GetDB()
+	s.userRepo = repo.NewUserRepo()
+	s.orgRepo = repo.NewOrgRepo()
+}
+
+func (s *orgSuite) TearDownSuite() {
+	assert.NoError(s.T(), s.container.TearDown())
+}
+
+func (s *orgSuite) SetupTest() {
+	s.ctx = context.TODO()
+}
+
+func (s *orgSuite) createUser() *repo.User {
+	u, err := s.userRepo.CreateUser(s.ctx, s.db, repo.DefaultSchema, repo.User{
+		Email:     fmt.Sprintf("%s@example.com", uuid.New().String()),
+		FirstName: "foo",
+		LastName:  "bar",
+	})
+	assert.NoError(s.T(), err)
+	return u
+}
+
+func (s *orgSuite) createOrg(owner *repo.User) *repo.Organization {
+	o, err := s.orgRepo.CreateOrg(s.ctx, s.db, repo.DefaultSchema, repo.Organization{Name: uuid.New().String()})
+	assert.NoError(s.T(), err)
+	_, err = s.orgRepo.AddMember(s.ctx, s.db, repo.DefaultSchema, repo.Membership{
+		OrganizationID: o.ID,
+		UserID:         owner.ID,
+		Role:           repo.OrgRoleOwner,
+	})
+	assert.NoError(s.T(), err)
+	return o
+}
+
+func (s *orgSuite) TestCreateAndGetOrg() {
+	owner := s.createUser()
+	o := s.createOrg(owner)
+	assert.GreaterOrEqual(s.T(), o.ID, 1)
+
+	fetched, err := s.orgRepo.GetOrgByID(s.ctx, s.db, repo.DefaultSchema, o.ID)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), o.Name, fetched.Name)
+
+	orgs, err := s.orgRepo.ListOrgsForUser(s.ctx, s.db, repo.DefaultSchema, owner.ID)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), orgs, 1)
+	assert.Equal(s.T(), o.ID, orgs[0].ID)
+}
+
+func (s *orgSuite) TestUpdateAndDeleteOrg() {
+	o := s.createOrg(s.createUser())
+
+	o.Name = "renamed"
+	updated, err := s.orgRepo.UpdateOrg(s.ctx, s.db, repo.DefaultSchema, *o)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "renamed", updated.Name)
+
+	assert.NoError(s.T(), s.orgRepo.DeleteOrg(s.ctx, s.db, repo.DefaultSchema, o.ID))
+	_, err = s.orgRepo.GetOrgByID(s.ctx, s.db, repo.DefaultSchema, o.ID)
+	assert.ErrorIs(s.T(), err, repo.ErrNoRowsFound)
+	assert.ErrorIs(s.T(), s.orgRepo.DeleteOrg(s.ctx, s.db, repo.DefaultSchema, o.ID), repo.ErrNoRowsFound)
+}
+
+func (s *orgSuite) TestMembers() {
+	owner := s.createUser()
+	member := s.createUser()
+	o := s.createOrg(owner)
+
+	_, err := s.orgRepo.AddMember(s.ctx, s.db, repo.DefaultSchema, repo.Membership{
+		OrganizationID: o.ID,
+		UserID:         member.ID,
+		Role:           repo.OrgRoleMember,
+	})
+	assert.NoError(s.T(), err)
+
+	_, err = s.orgRepo.AddMember(s.ctx, s.db, repo.DefaultSchema, repo.Membership{
+		OrganizationID: o.ID,
+		UserID:         member.ID,
+		Role:           repo.OrgRoleAdmin,
+	})
+	assert.ErrorIs(s.T(), err, repo.ErrDuplicateMember)
+
+	members, err := s.orgRepo.ListMembers(s.ctx, s.db, repo.DefaultSchema, o.ID)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), members, 2)
+
+	m, err := s.orgRepo.UpdateMemberRole(s.ctx, s.db, repo.DefaultSchema, o.ID, member.ID, repo.OrgRoleAdmin)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), repo.OrgRoleAdmin, m.Role)
+	assert.Equal(s.T(), member.Email, m.Email)
+
+	assert.NoError(s.T(), s.orgRepo.RemoveMember(s.ctx, s.db, repo.DefaultSchema, o.ID, member.ID))
+	_, err = s.orgRepo.GetMember(s.ctx, s.db, repo.DefaultSchema, o.ID, member.ID)
+	assert.ErrorIs(s.T(), err, repo.ErrNoRowsFound)
+}
+
+func (s *orgSuite) TestLockOrg() {
+	o := s.createOrg(s.createUser())
+
+	tx1, err := s.db.BeginTx(s.ctx, nil)
+	assert.NoError(s.T(), err)
+	defer func() { _ = tx1.Rollback() }()
+	assert.NoError(s.T(), s.orgRepo.LockOrg(s.ctx, tx1, repo.DefaultSchema, o.ID))
+
+	// a second transaction waits for the first to finish
+	locked := make(chan error, 1)
+	go func() {
+		locked <- repo.WithTx(s.ctx, s.db, nil, func(tx repo.Querier) error {
+			return s.orgRepo.LockOrg(s.ctx, tx, repo.DefaultSchema, o.ID)
+		})
+	}()
+	select {
+	case <-locked:
+		s.T().Fatal("lock was taken while another transaction held it")
+	case <-time.After(200 * time.Millisecond):
+	}
+	assert.NoError(s.T(), tx1.Commit())
+	assert.NoError(s.T(), <-locked)
+
+	assert.ErrorIs(s.T(), s.orgRepo.LockOrg(s.ctx, s.db, repo.DefaultSchema, -1), repo.ErrNoRowsFound)
+}
+
+func (s *orgSuite) TestLockOwnedOrgs() {
+	u := s.createUser()
+	owned := s.createOrg(u)
+	other := s.createOrg(s.createUser())
+	_, err := s.orgRepo.AddMember(s.ctx, s.db, repo.DefaultSchema, repo.Membership{
+		OrganizationID: other.ID,
+		UserID:         u.ID,
+		Role:           repo.OrgRoleMember,
+	})
+	assert.NoError(s.T(), err)
+
+	err = repo.WithTx(s.ctx, s.db, nil, func(tx repo.Querier) error {
+		ids, err := s.orgRepo.LockOwnedOrgs(s.ctx, tx, repo.DefaultSchema, u.ID)
+		assert.Equal(s.T(), []int{owned.ID}, ids)
+		return err
+	})
+	assert.NoError(s.T(), err)
+}
+
+func (s *orgSuite) TestListUsersByOrgMember() {
+	caller := s.createUser()
+	colleague := s.createUser()
+	stranger := s.createUser()
+	o := s.createOrg(caller)
+	s.createOrg(stranger)
+
+	_, err := s.orgRepo.AddMember(s.ctx, s.db, repo.DefaultSchema, repo.Membership{
+		OrganizationID: o.ID,
+		UserID:         colleague.ID,
+		Role:           repo.OrgRoleMember,
+	})
+	assert.NoError(s.T(), err)
+
+	users, err := s.userRepo.ListUsersByOrgMember(s.ctx, s.db, repo.DefaultSchema, caller.Email)
+	assert.NoError(s.T(), err)
+
+	var ids []int
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+	assert.ElementsMatch(s.T(), []int{caller.ID, colleague.ID}, ids)
+}
+
+func (s *orgSuite) TestGetUserByOrgMember() {
+	caller := s.createUser()
+	colleague := s.createUser()
+	stranger := s.createUser()
+	o := s.createOrg(caller)
+	s.createOrg(stranger)
+
+	_, err := s.orgRepo.AddMember(s.ctx, s.db, repo.DefaultSchema, repo.Membership{
+		OrganizationID: o.ID,
+		UserID:         colleague.ID,
+		Role:           repo.OrgRoleMember,
+	})
+	assert.NoError(s.T(), err)
+
+	for _, u := range []*repo.User{caller, colleague} {
+		found, err := s.userRepo.GetUserByOrgMember(s.ctx, s.db, repo.DefaultSchema, caller.Email, u.ID)
+		assert.NoError(s.T(), err)
+		assert.Equal(s.T(), u.Email, found.Email)
+	}
+	_, err = s.userRepo.GetUserByOrgMember(s.ctx, s.db, repo.DefaultSchema, caller.Email, stranger.ID)
+	assert.ErrorIs(s.T(), err, repo.ErrNoRowsFound)
+
+	// a user in no org can still read themselves
+	loner := s.createUser()
+	found, err := s.userRepo.GetUserByOrgMember(s.ctx, s.db, repo.DefaultSchema, loner.Email, loner.ID)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), loner.ID, found.ID)
+}
+
+func (s *orgSuite) TestLockMember() {
+	owner := s.createUser()
+	o := s.createOrg(owner)
+
+	tx1, err := s.db.BeginTx(s.ctx, nil)
+	assert.NoError(s.T(), err)
+	defer func() { _ = tx1.Rollback() }()
+	m, err := s.orgRepo.LockMember(s.ctx, tx1, repo.DefaultSchema, o.ID, owner.ID)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), repo.OrgRoleOwner, m.Role)
+
+	// a demotion waits for the transaction that checked the role to finish
+	demoted := make(chan error, 1)
+	go func() {
+		_, err := s.orgRepo.UpdateMemberRole(s.ctx, s.db, repo.DefaultSchema, o.ID, owner.ID, repo.OrgRoleMember)
+		demoted <- err
+	}()
+	select {
+	case <-demoted:
+		s.T().Fatal("member was changed while another transaction held its lock")
+	case <-time.After(200 * time.Millisecond):
+	}
+	assert.NoError(s.T(), tx1.Commit())
+	assert.NoError(s.T(), <-demoted)
+
+	_, err = s.orgRepo.LockMember(s.ctx, s.db, repo.DefaultSchema, o.ID, -1)
+	assert.ErrorIs(s.T(), err, repo.ErrNoRowsFound)
+}
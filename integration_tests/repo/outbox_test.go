@@ -0,0 +1,129 @@
+package test_repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/drmaples/starter-app/app/events"
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+type outboxSuite struct {
+	suite.Suite
+
+	backend    string
+	container  IPostgresContainer
+	ctx        context.Context
+	db         *repo.DB
+	outboxRepo repo.IOutboxRepo
+}
+
+func TestOutboxSuite(t *testing.T) {
+	suite.Run(t, &outboxSuite{backend: repo.BackendStdlib})
+}
+
+func TestOutboxSuitePgxPool(t *testing.T) {
+	suite.Run(t, &outboxSuite{backend: repo.BackendPgxPool})
+}
+
+func (s *outboxSuite) SetupSuite() {
+	s.container = NewPostgresContainerWithBackend(s.backend)
+	assert.NoError(s.T(), s.container.Setup())
+
+	s.db = s.container.GetDB()
+	s.outboxRepo = repo.NewOutboxRepo()
+}
+
+func (s *outboxSuite) TearDownSuite() {
+	assert.NoError(s.T(), s.container.TearDown())
+}
+
+func (s *outboxSuite) SetupTest() {
+	s.ctx = context.TODO()
+
+	// every test starts from an empty outbox
+	_, err := s.db.ExecContext(s.ctx, `DELETE FROM outbox`)
+	assert.NoError(s.T(), err)
+}
+
+func (s *outboxSuite) record(tx repo.Querier, subject string) {
+	assert.NoError(s.T(), events.Record(s.ctx, tx, s.outboxRepo, events.TypeUserCreated, repo.DefaultSchema, subject, events.UserCreated{}))
+}
+
+func (s *outboxSuite) TestRecord_is_transactional() {
+	err := repo.WithTx(s.ctx, s.db, nil, func(tx repo.Querier) error {
+		s.record(tx, "user/rolled-back")
+		return errors.New("rollback")
+	})
+	assert.Error(s.T(), err)
+
+	assert.NoError(s.T(), repo.WithTx(s.ctx, s.db, nil, func(tx repo.Querier) error {
+		s.record(tx, "user/committed")
+		return nil
+	}))
+
+	evts, err := s.outboxRepo.ClaimUnpublishedEvents(s.ctx, s.db, repo.DefaultSchema, 10, time.Now())
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), evts, 1)
+	assert.Contains(s.T(), string(evts[0].Payload), "user/committed")
+}
+
+func (s *outboxSuite) TestPublishAndFail() {
+	s.record(s.db, "user/1")
+	s.record(s.db, "user/2")
+
+	evts, err := s.outboxRepo.ClaimUnpublishedEvents(s.ctx, s.db, repo.DefaultSchema, 10, time.Now())
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), evts, 2)
+	assert.Less(s.T(), evts[0].ID, evts[1].ID, "insert order")
+
+	assert.NoError(s.T(), s.outboxRepo.MarkEventPublished(s.ctx, s.db, repo.DefaultSchema, evts[0].ID))
+	assert.ErrorIs(s.T(), s.outboxRepo.MarkEventPublished(s.ctx, s.db, repo.DefaultSchema, evts[0].ID), repo.ErrNoRowsFound)
+	assert.NoError(s.T(), s.outboxRepo.MarkEventFailed(s.ctx, s.db, repo.DefaultSchema, evts[1].ID, "boom", time.Now().Add(time.Hour)))
+
+	evts, err = s.outboxRepo.ClaimUnpublishedEvents(s.ctx, s.db, repo.DefaultSchema, 10, time.Now())
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), evts, "published and backing off events are not due")
+
+	n, err := s.outboxRepo.DeletePublishedEvents(s.ctx, s.db, repo.DefaultSchema, time.Now().Add(time.Second))
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), int64(1), n)
+}
+
+func (s *outboxSuite) TestClaim() {
+	s.record(s.db, "user/"+uuid.New().String())
+	s.record(s.db, "user/"+uuid.New().String())
+	s.record(s.db, "user/"+uuid.New().String())
+
+	claimed, err := s.outboxRepo.ClaimUnpublishedEvents(s.ctx, s.db, repo.DefaultSchema, 1, time.Now().Add(time.Hour))
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), claimed, 1)
+
+	// a relay mid claim holds its rows locked, a second relay skips them instead of waiting
+	tx, err := s.db.BeginTx(s.ctx, nil)
+	assert.NoError(s.T(), err)
+	defer func() { _ = tx.Rollback() }()
+	locked, err := s.outboxRepo.ClaimUnpublishedEvents(s.ctx, tx, repo.DefaultSchema, 1, time.Now().Add(time.Hour))
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), locked, 1)
+
+	others, err := s.outboxRepo.ClaimUnpublishedEvents(s.ctx, s.db, repo.DefaultSchema, 10, time.Now().Add(time.Hour))
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), others, 1, "claimed and locked events are skipped")
+	assert.NotContains(s.T(), []int64{claimed[0].ID, locked[0].ID}, others[0].ID)
+
+	// the claim is released by publishing the event, or by it running out
+	assert.NoError(s.T(), s.outboxRepo.MarkEventPublished(s.ctx, s.db, repo.DefaultSchema, claimed[0].ID))
+	_, err = s.db.ExecContext(s.ctx, `UPDATE outbox SET next_attempt_at = now() WHERE id = $1`, others[0].ID)
+	assert.NoError(s.T(), err)
+	again, err := s.outboxRepo.ClaimUnpublishedEvents(s.ctx, s.db, repo.DefaultSchema, 10, time.Now().Add(time.Hour))
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), again, 1)
+	assert.Equal(s.T(), others[0].ID, again[0].ID)
+}
@@ -0,0 +1,127 @@
+package test_repo
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+type rateLimitSuite struct {
+	suite.Suite
+
+	backend       string
+	container     IPostgresContainer
+	ctx           context.Context
+	db            *repo.DB
+	rateLimitRepo repo.IRateLimitRepo
+}
+
+func TestRateLimitSuite(t *testing.T) {
+	suite.Run(t, &rateLimitSuite{backend: repo.BackendStdlib})
+}
+
+func TestRateLimitSuitePgxPool(t *testing.T) {
+	suite.Run(t, &rateLimitSuite{backend: repo.BackendPgxPool})
+}
+
+func (s *rateLimitSuite) SetupSuite() {
+	s.container = NewPostgresContainerWithBackend(s.backend)
+	assert.NoError(s.T(), s.container.Setup())
+
+	s.db = s.container.GetDB()
+	s.rateLimitRepo = repo.NewRateLimitRepo()
+}
+
+func (s *rateLimitSuite) TearDownSuite() {
+	assert.NoError(s.T(), s.container.TearDown())
+}
+
+func (s *rateLimitSuite) SetupTest() {
+	s.ctx = context.TODO()
+
+	_, err := s.db.ExecContext(s.ctx, `DELETE FROM rate_limit_buckets`)
+	assert.NoError(s.T(), err)
+}
+
+func (s *rateLimitSuite) TestTakeRateLimitToken() {
+	// refills too slowly to matter during the test
+	take := func(key string) (float64, bool) {
+		tokens, allowed, err := s.rateLimitRepo.TakeRateLimitToken(s.ctx, s.db, repo.DefaultSchema, key, 2, 0.0001)
+		assert.NoError(s.T(), err)
+		return tokens, allowed
+	}
+
+	tokens, allowed := take("a")
+	assert.True(s.T(), allowed)
+	assert.InDelta(s.T(), 1, tokens, 0.01)
+	_, allowed = take("a")
+	assert.True(s.T(), allowed)
+	tokens, allowed = take("a")
+	assert.False(s.T(), allowed)
+	assert.InDelta(s.T(), 0, tokens, 0.01, "a rejected request does not go into debt")
+
+	_, allowed = take("b")
+	assert.True(s.T(), allowed, "buckets are per key")
+
+	// a minute idle refills the bucket
+	_, err := s.db.ExecContext(s.ctx, `UPDATE rate_limit_buckets SET updated_at = updated_at - interval '1 minute' WHERE key = 'a'`)
+	assert.NoError(s.T(), err)
+	tokens, allowed, err = s.rateLimitRepo.TakeRateLimitToken(s.ctx, s.db, repo.DefaultSchema, "a", 2, 1)
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), allowed)
+	assert.InDelta(s.T(), 1, tokens, 0.01, "refilled up to capacity only")
+
+	_, _, err = s.rateLimitRepo.TakeRateLimitToken(s.ctx, s.db, "bad schema", "a", 2, 1)
+	assert.Error(s.T(), err)
+}
+
+func (s *rateLimitSuite) TestTakeRateLimitToken_concurrent() {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	allowedCount := 0
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, allowed, err := s.rateLimitRepo.TakeRateLimitToken(s.ctx, s.db, repo.DefaultSchema, "busy", 5, 0.0001)
+			assert.NoError(s.T(), err)
+			if allowed {
+				mu.Lock()
+				allowedCount++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(s.T(), 5, allowedCount, "no more than capacity across concurrent callers")
+}
+
+func (s *rateLimitSuite) TestDeleteIdleRateLimitBuckets() {
+	for _, key := range []string{"idle", "active"} {
+		_, _, err := s.rateLimitRepo.TakeRateLimitToken(s.ctx, s.db, repo.DefaultSchema, key, 2, 1)
+		assert.NoError(s.T(), err)
+	}
+	_, err := s.db.ExecContext(s.ctx, `UPDATE rate_limit_buckets SET updated_at = now() - interval '2 days' WHERE key = 'idle'`)
+	assert.NoError(s.T(), err)
+
+	n, err := s.rateLimitRepo.DeleteIdleRateLimitBuckets(s.ctx, s.db, repo.DefaultSchema, time.Now().Add(-24*time.Hour))
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), int64(1), n)
+
+	var keys []string
+	rows, err := s.db.QueryContext(s.ctx, `SELECT key FROM rate_limit_buckets`)
+	assert.NoError(s.T(), err)
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		assert.NoError(s.T(), rows.Scan(&key))
+		keys = append(keys, key)
+	}
+	assert.Equal(s.T(), []string{"active"}, keys)
+}
@@ -0,0 +1,108 @@
+package test_repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+type scheduleSuite struct {
+	suite.Suite
+
+	backend      string
+	container    IPostgresContainer
+	ctx          context.Context
+	db           *repo.DB
+	scheduleRepo repo.IScheduleRepo
+}
+
+func TestScheduleSuite(t *testing.T) {
+	suite.Run(t, &scheduleSuite{backend: repo.BackendStdlib})
+}
+
+func TestScheduleSuitePgxPool(t *testing.T) {
+	suite.Run(t, &scheduleSuite{backend: repo.BackendPgxPool})
+}
+
+func (s *scheduleSuite) SetupSuite() {
+	s.container = NewPostgresContainerWithBackend(s.backend)
+	assert.NoError(s.T(), s.container.Setup())
+
+	s.db = s.container.GetDB()
+	s.scheduleRepo = repo.NewScheduleRepo()
+}
+
+func (s *scheduleSuite) TearDownSuite() {
+	assert.NoError(s.T(), s.container.TearDown())
+}
+
+func (s *scheduleSuite) SetupTest() {
+	s.ctx = context.TODO()
+}
+
+func (s *scheduleSuite) TestScheduleRuns() {
+	name := uuid.New().String()
+	tick := time.Now().Truncate(time.Minute)
+
+	run, err := s.scheduleRepo.StartScheduleRun(s.ctx, s.db, repo.DefaultSchema, name, tick, "instance-1")
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), repo.ScheduleRunRunning, run.Status)
+
+	_, err = s.scheduleRepo.StartScheduleRun(s.ctx, s.db, repo.DefaultSchema, name, tick, "instance-2")
+	assert.ErrorIs(s.T(), err, repo.ErrDuplicateScheduleRun)
+
+	assert.NoError(s.T(), s.scheduleRepo.FinishScheduleRun(s.ctx, s.db, repo.DefaultSchema, run.ID, nil))
+	assert.ErrorIs(s.T(), s.scheduleRepo.FinishScheduleRun(s.ctx, s.db, repo.DefaultSchema, run.ID, nil), repo.ErrNoRowsFound)
+
+	next, err := s.scheduleRepo.StartScheduleRun(s.ctx, s.db, repo.DefaultSchema, name, tick.Add(time.Minute), "instance-1")
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.scheduleRepo.FinishScheduleRun(s.ctx, s.db, repo.DefaultSchema, next.ID, errors.New("boom")))
+
+	runs, err := s.scheduleRepo.ListScheduleRuns(s.ctx, s.db, repo.DefaultSchema, name, 10)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), runs, 2)
+	assert.Equal(s.T(), next.ID, runs[0].ID, "newest first")
+	assert.Equal(s.T(), repo.ScheduleRunFailed, runs[0].Status)
+	assert.Equal(s.T(), "boom", *runs[0].Error)
+	assert.Equal(s.T(), repo.ScheduleRunSucceeded, runs[1].Status)
+	assert.NotNil(s.T(), runs[1].FinishedAt)
+
+	all, err := s.scheduleRepo.ListScheduleRuns(s.ctx, s.db, repo.DefaultSchema, "", 1)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), all, 1)
+}
+
+func (s *scheduleSuite) TestAdvisoryLock() {
+	key := repo.AdvisoryLockKey(uuid.New().String())
+
+	sqlConn1, err := s.db.SQL.Conn(s.ctx)
+	assert.NoError(s.T(), err)
+	defer sqlConn1.Close()
+	sqlConn2, err := s.db.SQL.Conn(s.ctx)
+	assert.NoError(s.T(), err)
+	defer sqlConn2.Close()
+	conn1, conn2 := repo.FromSQL(sqlConn1), repo.FromSQL(sqlConn2)
+
+	locked, err := repo.TryAdvisoryLock(s.ctx, conn1, key)
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), locked)
+
+	locked, err = repo.TryAdvisoryLock(s.ctx, conn2, key)
+	assert.NoError(s.T(), err)
+	assert.False(s.T(), locked, "only one session may hold the lock")
+
+	assert.Error(s.T(), repo.AdvisoryUnlock(s.ctx, conn2, key), "cannot release a lock held by another session")
+	assert.NoError(s.T(), repo.AdvisoryUnlock(s.ctx, conn1, key))
+
+	locked, err = repo.TryAdvisoryLock(s.ctx, conn2, key)
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), locked)
+	assert.NoError(s.T(), repo.AdvisoryUnlock(s.ctx, conn2, key))
+}
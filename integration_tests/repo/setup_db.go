@@ -1,7 +1,7 @@
 package test_repo
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
 	"log/slog"
 	"strconv"
@@ -32,7 +32,8 @@ const (
 
 // IPostgresContainer is the interface
 type IPostgresContainer interface {
-	GetDB() *sql.DB
+	GetDB() *repo.DB
+	GetConfig() platform.DBConfig
 	Setup() error
 	TearDown() error
 }
@@ -40,18 +41,30 @@ type IPostgresContainer interface {
 type postgresContainer struct {
 	pool     *dockertest.Pool
 	resource *dockertest.Resource
-	db       *sql.DB
+	backend  string
+	cfg      platform.DBConfig
+	db       *repo.DB
 }
 
 // NewPostgresContainer creates new postgres docker container for use with integration tests
 func NewPostgresContainer() IPostgresContainer {
-	return &postgresContainer{}
+	return NewPostgresContainerWithBackend(repo.BackendStdlib)
 }
 
-func (c *postgresContainer) GetDB() *sql.DB {
+// NewPostgresContainerWithBackend creates new postgres docker container, connecting via the given repo backend.
+// suites run once per backend, both must behave identically
+func NewPostgresContainerWithBackend(backend string) IPostgresContainer {
+	return &postgresContainer{backend: backend}
+}
+
+func (c *postgresContainer) GetDB() *repo.DB {
 	return c.db
 }
 
+func (c *postgresContainer) GetConfig() platform.DBConfig {
+	return c.cfg
+}
+
 func (c *postgresContainer) Setup() error {
 	pool, err := dockertest.NewPool("")
 	if err != nil {
@@ -95,25 +108,28 @@ func (c *postgresContainer) Setup() error {
 	if err != nil {
 		return err
 	}
-	dsn := repo.GetConnectionURI(platform.DBConfig{
+	cfg := platform.DBConfig{
 		Host:     resource.GetBoundIP(dockerPortName),
 		Port:     port,
 		User:     pgUser,
 		Password: pgPass,
 		Name:     pgDB,
 		SSLMode:  pgSSL,
-	})
-	slog.Info("connecting to test database", slog.String("dsn", dsn))
+		Backend:  c.backend,
+	}
+	dsn := repo.GetConnectionURI(cfg)
+	slog.Info("connecting to test database", slog.String("dsn", dsn), slog.String("backend", c.backend))
 
-	var db *sql.DB
+	var db *repo.DB
 	pool.MaxWait = maxRetryWait * time.Second
 	// exponential backoff-retry, because the application in the container might not be ready to accept connections yet
 	if err := pool.Retry(func() error {
-		db, err = sql.Open(repo.Driver, dsn)
+		db, err = repo.Open(context.Background(), cfg)
 		if err != nil {
 			return errors.Wrap(err, "error connecting to database")
 		}
-		if err := db.Ping(); err != nil {
+		if err := repo.Ping(context.Background(), db); err != nil {
+			_ = db.Close()
 			return errors.Wrap(err, "error pinging database")
 		}
 		m, err := repo.NewMigrator(dsn)
@@ -128,12 +144,23 @@ func (c *postgresContainer) Setup() error {
 	}); err != nil {
 		return errors.Wrap(err, "error pinging database")
 	}
+	c.cfg = cfg
 	c.db = db
 
 	return nil
 }
 
+// TearDown cleans up whatever Setup got to, which may not be everything if it failed
 func (c *postgresContainer) TearDown() error {
+	if c.db != nil {
+		if err := c.db.Close(); err != nil {
+			slog.Warn("problem closing test database", slog.Any("error", err))
+		}
+	}
+	if c.pool == nil || c.resource == nil {
+		return nil
+	}
+
 	slog.Info("purging docker container")
 	if err := c.pool.Purge(c.resource); err != nil {
 		return errors.Wrap(err, "could not purge docker container")
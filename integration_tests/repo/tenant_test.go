@@ -0,0 +1,181 @@
+package test_repo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/drmaples/starter-app/app/health"
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+type tenantSuite struct {
+	suite.Suite
+
+	backend   string
+	container IPostgresContainer
+	ctx       context.Context
+	db        *repo.DB
+	userRepo  repo.IUserRepo
+}
+
+func TestTenantSuite(t *testing.T) {
+	suite.Run(t, &tenantSuite{backend: repo.BackendStdlib})
+}
+
+func TestTenantSuitePgxPool(t *testing.T) {
+	suite.Run(t, &tenantSuite{backend: repo.BackendPgxPool})
+}
+
+func (s *tenantSuite) SetupSuite() {
+	s.container = NewPostgresContainerWithBackend(s.backend)
+	assert.NoError(s.T(), s.container.Setup())
+
+	s.db = s.container.GetDB()
+	s.userRepo = repo.NewUserRepo()
+}
+
+func (s *tenantSuite) TearDownSuite() {
+	assert.NoError(s.T(), s.container.TearDown())
+}
+
+func (s *tenantSuite) SetupTest() {
+	s.ctx = context.TODO()
+}
+
+func (s *tenantSuite) TestUnknownTenantRejected() {
+	p := repo.NewTenantProvisioner(s.db, s.container.GetConfig(), false)
+	err := p.Ensure(s.ctx, "tenant_does_not_exist")
+	assert.ErrorIs(s.T(), err, repo.ErrUnknownTenant)
+}
+
+func (s *tenantSuite) TestAutoProvisionIsolatesTenants() {
+	p := repo.NewTenantProvisioner(s.db, s.container.GetConfig(), true)
+
+	schemaA, err := repo.TenantSchema("acme")
+	assert.NoError(s.T(), err)
+	schemaB, err := repo.TenantSchema("globex")
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), p.Ensure(s.ctx, schemaA))
+	assert.NoError(s.T(), p.Ensure(s.ctx, schemaB))
+	assert.NoError(s.T(), p.Ensure(s.ctx, schemaA)) // idempotent
+
+	u, err := s.userRepo.CreateUser(s.ctx, s.db, schemaA, repo.User{
+		Email:     fmt.Sprintf("%s@example.com", schemaA),
+		FirstName: "foo",
+		LastName:  "bar",
+	})
+	assert.NoError(s.T(), err)
+
+	usersA, err := s.userRepo.ListUsers(s.ctx, s.db, schemaA)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), usersA, 1)
+	assert.Equal(s.T(), u.ID, usersA[0].ID)
+
+	usersB, err := s.userRepo.ListUsers(s.ctx, s.db, schemaB)
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), usersB)
+
+	// the history trigger writes next to the tenant's users table, not wherever search_path points
+	revsA, err := s.userRepo.ListUserRevisions(s.ctx, s.db, schemaA, u.ID)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), revsA, 1)
+	revsDefault, err := s.userRepo.ListUserRevisions(s.ctx, s.db, repo.DefaultSchema, u.ID)
+	assert.NoError(s.T(), err)
+	assert.False(s.T(), lo.ContainsBy(revsDefault, func(r repo.UserRevision) bool { return r.Email == u.Email }))
+}
+
+func (s *tenantSuite) TestAutoProvisionConcurrent() {
+	schema, err := repo.TenantSchema("initech-" + uuid.New().String()[:8])
+	assert.NoError(s.T(), err)
+
+	// two provisioners stand in for two processes getting their first request for the tenant at once
+	provisioners := []*repo.TenantProvisioner{
+		repo.NewTenantProvisioner(s.db, s.container.GetConfig(), true),
+		repo.NewTenantProvisioner(s.db, s.container.GetConfig(), true),
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, 6)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = provisioners[i%len(provisioners)].Ensure(s.ctx, schema)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		assert.NoError(s.T(), err)
+	}
+
+	users, err := s.userRepo.ListUsers(s.ctx, s.db, schema)
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), users)
+}
+
+func (s *tenantSuite) tableExists(schema, table string) bool {
+	var exists bool
+	row := s.db.QueryRowContext(s.ctx, `SELECT to_regclass($1) IS NOT NULL`, schema+"."+table)
+	assert.NoError(s.T(), row.Scan(&exists))
+	return exists
+}
+
+func (s *tenantSuite) TestTenantMigrations() {
+	p := repo.NewTenantProvisioner(s.db, s.container.GetConfig(), true)
+	schema, err := repo.TenantSchema("hooli-" + uuid.New().String()[:8])
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), p.Ensure(s.ctx, schema))
+
+	// global tables only live in the default schema
+	assert.True(s.T(), s.tableExists(schema, "users"))
+	assert.False(s.T(), s.tableExists(schema, "jobs"))
+	assert.True(s.T(), s.tableExists(repo.DefaultSchema, "jobs"))
+
+	schemas, err := repo.ListTenantSchemas(s.ctx, s.db)
+	assert.NoError(s.T(), err)
+	assert.Contains(s.T(), schemas, schema)
+	assert.NotContains(s.T(), schemas, repo.DefaultSchema)
+
+	check := health.TenantMigrationCheck(s.db)
+	assert.NoError(s.T(), check.Run(s.ctx))
+	_, err = s.db.ExecContext(s.ctx, fmt.Sprintf(`UPDATE %s.schema_migrations SET version = version - 1`, schema))
+	assert.NoError(s.T(), err)
+	assert.ErrorContains(s.T(), check.Run(s.ctx), schema)
+}
+
+func (s *tenantSuite) TestTenantMigrationsDropGlobalCopies() {
+	schema, err := repo.TenantSchema("umbrella-" + uuid.New().String()[:8])
+	assert.NoError(s.T(), err)
+	_, err = s.db.ExecContext(s.ctx, `CREATE SCHEMA `+schema)
+	assert.NoError(s.T(), err)
+
+	// tenants provisioned before the split got every migration, global ones included
+	cfg := s.container.GetConfig()
+	cfg.Schema = schema
+	m, err := repo.NewMigrator(repo.GetConnectionURI(cfg))
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), m.Migrate(11))
+	_, _ = m.Close()
+	assert.True(s.T(), s.tableExists(schema, "jobs"))
+
+	m, err = repo.NewTenantMigrator(repo.GetConnectionURI(cfg))
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), m.Up())
+	_, _ = m.Close()
+	for _, table := range []string{"jobs", "schedule_runs", "outbox", "event_log", "rate_limit_buckets"} {
+		assert.False(s.T(), s.tableExists(schema, table), table)
+		assert.True(s.T(), s.tableExists(repo.DefaultSchema, table), table)
+	}
+	assert.True(s.T(), s.tableExists(schema, "users_history"))
+}
+
+func (s *tenantSuite) TestInvalidSchemaRejected() {
+	_, err := s.userRepo.ListUsers(s.ctx, s.db, "public.users; DROP TABLE users; --")
+	assert.ErrorIs(s.T(), err, repo.ErrInvalidSchema)
+}
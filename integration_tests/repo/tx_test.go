@@ -0,0 +1,141 @@
+package test_repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+type txSuite struct {
+	suite.Suite
+
+	backend   string
+	container IPostgresContainer
+	ctx       context.Context
+	db        *repo.DB
+	userRepo  repo.IUserRepo
+}
+
+func TestTxSuite(t *testing.T) {
+	suite.Run(t, &txSuite{backend: repo.BackendStdlib})
+}
+
+func TestTxSuitePgxPool(t *testing.T) {
+	suite.Run(t, &txSuite{backend: repo.BackendPgxPool})
+}
+
+func (s *txSuite) SetupSuite() {
+	s.container = NewPostgresContainerWithBackend(s.backend)
+	assert.NoError(s.T(), s.container.Setup())
+
+	s.db = s.container.GetDB()
+	s.userRepo = repo.NewUserRepo()
+}
+
+func (s *txSuite) TearDownSuite() {
+	assert.NoError(s.T(), s.container.TearDown())
+}
+
+func (s *txSuite) SetupTest() {
+	s.ctx = context.TODO()
+}
+
+func (s *txSuite) newUser() repo.User {
+	return repo.User{
+		Email:     fmt.Sprintf("%s@example.com", uuid.New().String()),
+		FirstName: "foo",
+		LastName:  "bar",
+	}
+}
+
+func (s *txSuite) TestCommit() {
+	var newUser *repo.User
+	err := repo.WithTx(s.ctx, s.db, nil, func(tx repo.Querier) error {
+		var err error
+		newUser, err = s.userRepo.CreateUser(s.ctx, tx, repo.DefaultSchema, s.newUser())
+		return err
+	})
+	assert.NoError(s.T(), err)
+
+	fetchedUser, err := s.userRepo.GetUserByID(s.ctx, s.db, repo.DefaultSchema, newUser.ID)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), newUser.Email, fetchedUser.Email)
+}
+
+func (s *txSuite) TestRollbackOnError() {
+	expectedErr := errors.New("boom")
+
+	var newUser *repo.User
+	err := repo.WithTx(s.ctx, s.db, nil, func(tx repo.Querier) error {
+		var err error
+		newUser, err = s.userRepo.CreateUser(s.ctx, tx, repo.DefaultSchema, s.newUser())
+		if err != nil {
+			return err
+		}
+		return expectedErr
+	})
+	assert.ErrorIs(s.T(), err, expectedErr)
+
+	_, err = s.userRepo.GetUserByID(s.ctx, s.db, repo.DefaultSchema, newUser.ID)
+	assert.ErrorIs(s.T(), err, repo.ErrNoRowsFound)
+}
+
+func (s *txSuite) TestRollbackOnPanic() {
+	var newUser *repo.User
+	assert.Panics(s.T(), func() {
+		_ = repo.WithTx(s.ctx, s.db, nil, func(tx repo.Querier) error {
+			var err error
+			newUser, err = s.userRepo.CreateUser(s.ctx, tx, repo.DefaultSchema, s.newUser())
+			if err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	})
+
+	_, err := s.userRepo.GetUserByID(s.ctx, s.db, repo.DefaultSchema, newUser.ID)
+	assert.ErrorIs(s.T(), err, repo.ErrNoRowsFound)
+}
+
+func (s *txSuite) TestRetryOnSerializationFailure() {
+	attempts := 0
+	err := repo.WithTx(s.ctx, s.db, &repo.TxOptions{Isolation: sql.LevelSerializable}, func(tx repo.Querier) error {
+		attempts++
+		if attempts == 1 {
+			return &pgconn.PgError{Code: "40001", Message: "could not serialize access"}
+		}
+		_, err := s.userRepo.CreateUser(s.ctx, tx, repo.DefaultSchema, s.newUser())
+		return err
+	})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), 2, attempts)
+}
+
+func (s *txSuite) TestRetriesExhausted() {
+	attempts := 0
+	err := repo.WithTx(s.ctx, s.db, &repo.TxOptions{MaxRetries: 2}, func(_ repo.Querier) error {
+		attempts++
+		return &pgconn.PgError{Code: "40P01", Message: "deadlock detected"}
+	})
+	assert.True(s.T(), repo.IsRetryableTxErr(err))
+	assert.Equal(s.T(), 3, attempts)
+}
+
+func (s *txSuite) TestNoRetryOnOtherErrors() {
+	attempts := 0
+	err := repo.WithTx(s.ctx, s.db, nil, func(_ repo.Querier) error {
+		attempts++
+		return &pgconn.PgError{Code: "23505", Message: "unique violation"}
+	})
+	assert.Error(s.T(), err)
+	assert.Equal(s.T(), 1, attempts)
+}
@@ -2,9 +2,9 @@ package test_repo
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/samber/lo"
@@ -17,18 +17,23 @@ import (
 type userSuite struct {
 	suite.Suite
 
+	backend   string
 	container IPostgresContainer
 	ctx       context.Context
-	db        *sql.DB
+	db        *repo.DB
 	userRepo  repo.IUserRepo
 }
 
 func TestUserSuite(t *testing.T) {
-	suite.Run(t, new(userSuite))
+	suite.Run(t, &userSuite{backend: repo.BackendStdlib})
+}
+
+func TestUserSuitePgxPool(t *testing.T) {
+	suite.Run(t, &userSuite{backend: repo.BackendPgxPool})
 }
 
 func (s *userSuite) SetupSuite() {
-	s.container = NewPostgresContainer()
+	s.container = NewPostgresContainerWithBackend(s.backend)
 	assert.NoError(s.T(), s.container.Setup())
 
 	s.db = s.container.GetDB()
@@ -88,3 +93,114 @@ func (s *userSuite) TestListUsers() {
 
 	assert.True(s.T(), lo.ContainsBy(users, func(x repo.User) bool { return u.ID == x.ID }))
 }
+
+func (s *userSuite) TestUpdateUser() {
+	u, err := s.userRepo.CreateUser(s.ctx, s.db, repo.DefaultSchema, repo.User{
+		Email:     fmt.Sprintf("%s@example.com", uuid.New().String()),
+		FirstName: "foo",
+		LastName:  "bar",
+	})
+	assert.NoError(s.T(), err)
+
+	u.FirstName = "changed"
+	email := u.Email
+	u.Email = "other@example.com"
+	updated, err := s.userRepo.UpdateUser(s.ctx, s.db, repo.DefaultSchema, *u)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "changed", updated.FirstName)
+	assert.Equal(s.T(), email, updated.Email, "email must not change")
+
+	_, err = s.userRepo.UpdateUser(s.ctx, s.db, repo.DefaultSchema, repo.User{ID: -1, Email: "x@example.com"})
+	assert.ErrorIs(s.T(), err, repo.ErrNoRowsFound)
+}
+
+func (s *userSuite) TestDeleteUser() {
+	u, err := s.userRepo.CreateUser(s.ctx, s.db, repo.DefaultSchema, repo.User{
+		Email: fmt.Sprintf("%s@example.com", uuid.New().String()),
+	})
+	assert.NoError(s.T(), err)
+
+	assert.NoError(s.T(), s.userRepo.DeleteUser(s.ctx, s.db, repo.DefaultSchema, u.ID))
+	_, err = s.userRepo.GetUserByID(s.ctx, s.db, repo.DefaultSchema, u.ID)
+	assert.ErrorIs(s.T(), err, repo.ErrNoRowsFound)
+	assert.ErrorIs(s.T(), s.userRepo.DeleteUser(s.ctx, s.db, repo.DefaultSchema, u.ID), repo.ErrNoRowsFound)
+}
+
+func (s *userSuite) TestUserHistory() {
+	u, err := s.userRepo.CreateUser(s.ctx, s.db, repo.DefaultSchema, repo.User{
+		Email:     fmt.Sprintf("%s@example.com", uuid.New().String()),
+		FirstName: "foo",
+		LastName:  "bar",
+	})
+	assert.NoError(s.T(), err)
+	u.FirstName = "changed"
+	_, err = s.userRepo.UpdateUser(s.ctx, s.db, repo.DefaultSchema, *u)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.userRepo.DeleteUser(s.ctx, s.db, repo.DefaultSchema, u.ID))
+
+	revs, err := s.userRepo.ListUserRevisions(s.ctx, s.db, repo.DefaultSchema, u.ID)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), revs, 3)
+	assert.Equal(s.T(), []string{repo.UserHistoryInsert, repo.UserHistoryUpdate, repo.UserHistoryDelete},
+		lo.Map(revs, func(r repo.UserRevision, _ int) string { return r.Operation }))
+	assert.Equal(s.T(), []int{1, 2, 3}, lo.Map(revs, func(r repo.UserRevision, _ int) int { return r.Revision }))
+	assert.Equal(s.T(), "foo", revs[0].FirstName)
+	assert.Equal(s.T(), "changed", revs[1].FirstName)
+	assert.Equal(s.T(), revs[1].ValidFrom, *revs[0].ValidTo)
+	assert.Nil(s.T(), revs[2].ValidTo)
+
+	asOf, err := s.userRepo.GetUserAsOf(s.ctx, s.db, repo.DefaultSchema, u.ID, revs[0].ValidFrom)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "foo", asOf.FirstName)
+	asOf, err = s.userRepo.GetUserAsOf(s.ctx, s.db, repo.DefaultSchema, u.ID, revs[1].ValidFrom)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "changed", asOf.FirstName)
+
+	// before it was created and after it was deleted
+	_, err = s.userRepo.GetUserAsOf(s.ctx, s.db, repo.DefaultSchema, u.ID, revs[0].ValidFrom.Add(-time.Second))
+	assert.ErrorIs(s.T(), err, repo.ErrNoRowsFound)
+	_, err = s.userRepo.GetUserAsOf(s.ctx, s.db, repo.DefaultSchema, u.ID, revs[2].ValidFrom)
+	assert.ErrorIs(s.T(), err, repo.ErrNoRowsFound)
+}
+
+func (s *userSuite) TestUserHistoryInterleavedWriters() {
+	u, err := s.userRepo.CreateUser(s.ctx, s.db, repo.DefaultSchema, repo.User{
+		Email:     fmt.Sprintf("%s@example.com", uuid.New().String()),
+		FirstName: "foo",
+		LastName:  "bar",
+	})
+	assert.NoError(s.T(), err)
+
+	// a starts first but updates last, after b has committed
+	txA, err := s.db.BeginTx(s.ctx, nil)
+	assert.NoError(s.T(), err)
+	defer func() { _ = txA.Rollback() }()
+	_, err = txA.ExecContext(s.ctx, `SELECT 1`)
+	assert.NoError(s.T(), err)
+	time.Sleep(10 * time.Millisecond)
+
+	b := *u
+	b.FirstName = "b"
+	_, err = s.userRepo.UpdateUser(s.ctx, s.db, repo.DefaultSchema, b)
+	assert.NoError(s.T(), err)
+
+	a := *u
+	a.FirstName = "a"
+	_, err = s.userRepo.UpdateUser(s.ctx, txA, repo.DefaultSchema, a)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), txA.Commit())
+
+	revs, err := s.userRepo.ListUserRevisions(s.ctx, s.db, repo.DefaultSchema, u.ID)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), []string{"foo", "b", "a"}, lo.Map(revs, func(r repo.UserRevision, _ int) string { return r.FirstName }))
+	for _, r := range revs[:2] {
+		assert.False(s.T(), r.ValidTo.Before(r.ValidFrom), "revision %d ends before it starts", r.Revision)
+	}
+
+	asOf, err := s.userRepo.GetUserAsOf(s.ctx, s.db, repo.DefaultSchema, u.ID, revs[1].ValidFrom)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "b", asOf.FirstName)
+	asOf, err = s.userRepo.GetUserAsOf(s.ctx, s.db, repo.DefaultSchema, u.ID, time.Now())
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "a", asOf.FirstName)
+}
@@ -0,0 +1,186 @@
+package test_repo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/drmaples/starter-app/app/events"
+	"github.com/drmaples/starter-app/app/repo"
+)
+
+type webhookSuite struct {
+	suite.Suite
+
+	backend     string
+	container   IPostgresContainer
+	ctx         context.Context
+	db          *repo.DB
+	userRepo    repo.IUserRepo
+	orgRepo     repo.IOrgRepo
+	webhookRepo repo.IWebhookRepo
+}
+
+func TestWebhookSuite(t *testing.T) {
+	suite.Run(t, &webhookSuite{backend: repo.BackendStdlib})
+}
+
+func TestWebhookSuitePgxPool(t *testing.T) {
+	suite.Run(t, &webhookSuite{backend: repo.BackendPgxPool})
+}
+
+func (s *webhookSuite) SetupSuite() {
+	s.container = NewPostgresContainerWithBackend(s.backend)
+	assert.NoError(s.T(), s.container.Setup())
+
+	s.db = s.container.GetDB()
+	s.userRepo = repo.NewUserRepo()
+	s.orgRepo = repo.NewOrgRepo()
+	s.webhookRepo = repo.NewWebhookRepo()
+}
+
+func (s *webhookSuite) TearDownSuite() {
+	assert.NoError(s.T(), s.container.TearDown())
+}
+
+func (s *webhookSuite) SetupTest() {
+	s.ctx = context.TODO()
+}
+
+// createMember creates a user that belongs to a new organization
+func (s *webhookSuite) createMember() (*repo.User, *repo.Organization) {
+	u, err := s.userRepo.CreateUser(s.ctx, s.db, repo.DefaultSchema, repo.User{
+		Email: fmt.Sprintf("%s@example.com", uuid.New().String()),
+	})
+	assert.NoError(s.T(), err)
+	o, err := s.orgRepo.CreateOrg(s.ctx, s.db, repo.DefaultSchema, repo.Organization{Name: uuid.New().String()})
+	assert.NoError(s.T(), err)
+	_, err = s.orgRepo.AddMember(s.ctx, s.db, repo.DefaultSchema, repo.Membership{
+		OrganizationID: o.ID,
+		UserID:         u.ID,
+		Role:           repo.OrgRoleOwner,
+	})
+	assert.NoError(s.T(), err)
+	return u, o
+}
+
+func (s *webhookSuite) createWebhook(orgID int, eventTypes ...string) *repo.Webhook {
+	wh, err := s.webhookRepo.CreateWebhook(s.ctx, s.db, repo.DefaultSchema, repo.Webhook{
+		OrganizationID: orgID,
+		URL:            "http://localhost/hook",
+		Secret:         "whsec_test",
+		EventTypes:     eventTypes,
+		Active:         true,
+	})
+	assert.NoError(s.T(), err)
+	return wh
+}
+
+func (s *webhookSuite) TestWebhookCRUD() {
+	_, o := s.createMember()
+	wh := s.createWebhook(o.ID, events.TypeUserCreated)
+	assert.Equal(s.T(), repo.TextArray{events.TypeUserCreated}, wh.EventTypes)
+
+	fetched, err := s.webhookRepo.GetWebhook(s.ctx, s.db, repo.DefaultSchema, wh.ID)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "whsec_test", fetched.Secret)
+
+	fetched.URL = "http://localhost/other"
+	fetched.EventTypes = nil
+	fetched.Active = false
+	updated, err := s.webhookRepo.UpdateWebhook(s.ctx, s.db, repo.DefaultSchema, *fetched)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "http://localhost/other", updated.URL)
+	assert.Empty(s.T(), updated.EventTypes)
+	assert.False(s.T(), updated.Active)
+
+	hooks, err := s.webhookRepo.ListWebhooks(s.ctx, s.db, repo.DefaultSchema, o.ID)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), hooks, 1)
+
+	assert.NoError(s.T(), s.webhookRepo.DeleteWebhook(s.ctx, s.db, repo.DefaultSchema, wh.ID))
+	_, err = s.webhookRepo.GetWebhook(s.ctx, s.db, repo.DefaultSchema, wh.ID)
+	assert.ErrorIs(s.T(), err, repo.ErrNoRowsFound)
+	assert.ErrorIs(s.T(), s.webhookRepo.DeleteWebhook(s.ctx, s.db, repo.DefaultSchema, wh.ID), repo.ErrNoRowsFound)
+}
+
+func (s *webhookSuite) TestListWebhooksForUserEvent() {
+	u, o := s.createMember()
+	all := s.createWebhook(o.ID)
+	created := s.createWebhook(o.ID, events.TypeUserCreated)
+	s.createWebhook(o.ID, events.TypeUserUpdated)
+	inactive := s.createWebhook(o.ID)
+	inactive.Active = false
+	_, err := s.webhookRepo.UpdateWebhook(s.ctx, s.db, repo.DefaultSchema, *inactive)
+	assert.NoError(s.T(), err)
+
+	// another organization's webhook never sees this user's events
+	_, other := s.createMember()
+	s.createWebhook(other.ID)
+
+	hooks, err := s.webhookRepo.ListWebhooksForUserEvent(s.ctx, s.db, repo.DefaultSchema, u.ID, events.TypeUserCreated)
+	assert.NoError(s.T(), err)
+	var ids []int
+	for _, wh := range hooks {
+		ids = append(ids, wh.ID)
+	}
+	assert.ElementsMatch(s.T(), []int{all.ID, created.ID}, ids)
+}
+
+func (s *webhookSuite) TestDeliveries() {
+	_, o := s.createMember()
+	wh := s.createWebhook(o.ID)
+
+	d := repo.WebhookDelivery{
+		WebhookID: wh.ID,
+		EventID:   uuid.New().String(),
+		EventType: events.TypeUserCreated,
+		Payload:   []byte(`{"id":"evt"}`),
+	}
+	del, err := s.webhookRepo.CreateDelivery(s.ctx, s.db, repo.DefaultSchema, d)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), repo.WebhookDeliveryPending, del.Status)
+
+	// the same event again is the same delivery
+	again, err := s.webhookRepo.CreateDelivery(s.ctx, s.db, repo.DefaultSchema, d)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), del.ID, again.ID)
+
+	code, msg, body := 500, "receiver responded with status 500", "oops"
+	assert.NoError(s.T(), s.webhookRepo.RecordDeliveryAttempt(s.ctx, s.db, repo.DefaultSchema, repo.WebhookDeliveryAttempt{
+		DeliveryID: del.ID, StatusCode: &code, Error: &msg, ResponseBody: &body, DurationMS: 12,
+	}, repo.WebhookDeliveryFailed))
+
+	fetched, err := s.webhookRepo.GetDelivery(s.ctx, s.db, repo.DefaultSchema, del.ID)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), repo.WebhookDeliveryFailed, fetched.Status)
+	assert.Equal(s.T(), 1, fetched.Attempts)
+	assert.Equal(s.T(), code, *fetched.LastStatusCode)
+	assert.Equal(s.T(), msg, *fetched.LastError)
+	assert.JSONEq(s.T(), `{"id":"evt"}`, string(fetched.Payload))
+
+	assert.NoError(s.T(), s.webhookRepo.ResetDelivery(s.ctx, s.db, repo.DefaultSchema, del.ID))
+	fetched, err = s.webhookRepo.GetDelivery(s.ctx, s.db, repo.DefaultSchema, del.ID)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), repo.WebhookDeliveryPending, fetched.Status)
+	assert.Equal(s.T(), 0, fetched.Attempts)
+
+	assert.NoError(s.T(), s.webhookRepo.RecordDeliveryAttempt(s.ctx, s.db, repo.DefaultSchema, repo.WebhookDeliveryAttempt{
+		DeliveryID: del.ID, StatusCode: new(int), DurationMS: 3,
+	}, repo.WebhookDeliverySucceeded))
+
+	// attempts from before the reset stay logged
+	attempts, err := s.webhookRepo.ListDeliveryAttempts(s.ctx, s.db, repo.DefaultSchema, del.ID)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), attempts, 2)
+	assert.Equal(s.T(), "oops", *attempts[0].ResponseBody)
+
+	deliveries, err := s.webhookRepo.ListDeliveries(s.ctx, s.db, repo.DefaultSchema, wh.ID, 10)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), deliveries, 1)
+	assert.Equal(s.T(), repo.WebhookDeliverySucceeded, deliveries[0].Status)
+}
@@ -25,8 +25,18 @@ func (Run) Server() error {
 	return sh.RunV("go", "run", "app/cmd/server/main.go")
 }
 
+// Worker runs the background job worker
+func (Run) Worker() error {
+	return sh.RunV("go", "run", "app/cmd/worker/main.go")
+}
+
 func (Run) Db() error {
-	return sh.RunV("docker-compose", "up", "--force-recreate")
+	return sh.RunV("docker-compose", "up", "--force-recreate", "postgres")
+}
+
+// Mail runs a local smtp server that captures all mail, view it at http://localhost:8025
+func (Run) Mail() error {
+	return sh.RunV("docker-compose", "up", "--force-recreate", "mailpit")
 }
 
 func (Gen) Swagger() error {
@@ -77,6 +87,7 @@ func (Build) Containers() error {
 		// these depend on base. they are run in parallel
 		func() error { return buildImg("server") },
 		func() error { return buildImg("migrate") },
+		func() error { return buildImg("worker") },
 	)
 
 	return nil
@@ -10,16 +10,20 @@ import (
 )
 
 func main() {
-	if len(os.Args) != 2 {
-		panic("missing email address")
+	if len(os.Args) < 2 || len(os.Args) > 3 {
+		panic("usage: get-jwt <email> [tenant]")
 	}
 	email := os.Args[1]
+	var tenant string // required when TENANCY_ENABLED, tokens without one are rejected
+	if len(os.Args) == 3 {
+		tenant = os.Args[2]
+	}
 
 	cfg, err := platform.NewConfig()
 	if err != nil {
 		panic(err)
 	}
-	token, err := controller.NewSignedToken(cfg.JWTSignKey, email, "", "", time.Hour)
+	token, err := controller.NewSignedToken(cfg.JWTSignKey, email, "", tenant, time.Hour)
 	if err != nil {
 		panic(err)
 	}